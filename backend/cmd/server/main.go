@@ -15,7 +15,12 @@ import (
 	"megashop/internal/email"
 	"megashop/internal/handlers"
 	"megashop/internal/middleware"
+	"megashop/internal/payment"
+	"megashop/internal/scheduler"
 	"megashop/internal/search"
+	"megashop/internal/shipping"
+	"megashop/internal/stock"
+	"megashop/internal/tracking"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -51,13 +56,28 @@ func main() {
 	searchEngine := search.NewEngine(db, redisCache)
 
 	// Email Service
-	emailSvc := email.NewService(cfg)
+	emailSvc := email.NewService(cfg, db)
 	if emailSvc.IsConfigured() {
 		log.Println("📧 Email service configured")
 	} else {
 		log.Println("⚠️  Email service NOT configured (set SMTP_HOST, SMTP_USER, SMTP_PASSWORD)")
 	}
 
+	// Background workers, stopped on shutdown
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go email.NewOutboxWorker(db, emailSvc.Sender(), 5*time.Second).Run(workerCtx)
+	if source := shipping.PacketaFeedSource(cfg.PacketaBranchFeed, cfg.PacketaAPIKey); source != "" {
+		go shipping.NewPacketaSyncWorker(db, source, cfg.PacketaSyncInterval).Run(workerCtx)
+	}
+	trackingSyncer := tracking.NewSyncer(db, cfg, emailSvc)
+	if cfg.TrackingSyncInterval > 0 {
+		go tracking.NewWorker(trackingSyncer, cfg.TrackingSyncInterval).Run(workerCtx)
+	}
+	go stock.NewExpiryWorker(db, emailSvc, 5*time.Minute).Run(workerCtx)
+	go payment.NewRefundWorker(db, payment.NewRefunders(cfg), emailSvc, 10*time.Minute).Run(workerCtx)
+	go scheduler.New(db, handlers.SupplierPipeline(db, cfg), time.Minute).Run(workerCtx)
+
 	// Gin router
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -110,18 +130,22 @@ func main() {
 			
 			// Orders
 			public.POST("/orders", handlers.CreateOrder(db, cfg, emailSvc))
-			public.GET("/orders/:id", handlers.GetOrder(db))
+			public.GET("/orders/:id", handlers.GetOrder(db, cfg))
 			public.GET("/orders/track/:number", handlers.TrackOrder(db))
+			public.GET("/orders/:id/invoice.pdf", handlers.DownloadInvoicePDF(db, cfg))
 			
 			// Payments
 			public.POST("/payments/comgate/init", handlers.InitComgatePayment(db, cfg))
-			public.POST("/payments/comgate/callback", handlers.ComgateCallback(db, cfg))
+			public.POST("/payments/comgate/callback", handlers.ComgateCallback(db, cfg, emailSvc))
 			public.POST("/payments/gopay/init", handlers.InitGoPayPayment(db, cfg))
-			public.POST("/payments/gopay/callback", handlers.GoPayCallback(db, cfg))
+			public.Match([]string{"GET", "POST"}, "/payments/gopay/callback", handlers.GoPayCallback(db, cfg, emailSvc))
 			
 			// Shipping
 			public.GET("/shipping/methods", handlers.GetShippingMethods(db))
-			public.POST("/shipping/packeta/points", handlers.GetPacketaPoints(cfg))
+			public.POST("/shipping/rates", handlers.GetShippingRates(db))
+			public.GET("/shipping/packeta/points", handlers.GetPacketaPoints(db))
+			public.POST("/shipping/packeta/points", handlers.GetPacketaPoints(db))
+			public.GET("/shipping/packeta/points/:id", handlers.GetPacketaPoint(db))
 
 			// Export feeds (Heureka XML, etc.)
 			public.GET("/export/heureka.xml", handlers.ExportHeurekaXML(db, cfg, redisCache))
@@ -151,6 +175,20 @@ func main() {
 			admin.DELETE("/products/:id", handlers.DeleteProduct(db, redisCache))
 			admin.POST("/products/bulk", handlers.BulkUpdateProducts(db, redisCache))
 			admin.POST("/products/import", handlers.ImportProducts(db, redisCache))
+			admin.GET("/products/:id/stock-movements", handlers.ListStockMovements(db))
+			admin.POST("/products/:id/stock", handlers.AdjustStock(db, redisCache))
+			admin.GET("/products/:id/price-history", handlers.GetPriceHistory(db))
+			admin.GET("/stock/discrepancies", handlers.ListStockDiscrepancies(db))
+			admin.GET("/products/:id/offers", handlers.ListProductOffers(db))
+			admin.POST("/products/:id/offers/refresh", handlers.RefreshProductOffer(db, redisCache))
+			admin.GET("/offer-rules", handlers.GetOfferRules(db))
+			admin.PUT("/offer-rules", handlers.UpdateOfferRules(db, redisCache))
+			admin.GET("/pricing/rules", handlers.ListPricingRules(db))
+			admin.POST("/pricing/rules", handlers.CreatePricingRule(db))
+			admin.PUT("/pricing/rules/:id", handlers.UpdatePricingRule(db))
+			admin.DELETE("/pricing/rules/:id", handlers.DeletePricingRule(db))
+			admin.POST("/pricing/preview", handlers.PreviewPricing(db))
+			admin.POST("/pricing/apply", handlers.ApplyPricing(db, redisCache))
 			
 			// Categories CRUD (DELETE /all MUST be before /:id to avoid route conflict)
 			admin.DELETE("/categories/all", handlers.DeleteAllCategories(db, redisCache))
@@ -161,9 +199,42 @@ func main() {
 			
 			// Orders management
 			admin.GET("/orders", handlers.ListOrders(db))
-			admin.PUT("/orders/:id/status", handlers.UpdateOrderStatus(db))
-			admin.POST("/orders/:id/invoice", handlers.GenerateInvoice(db))
+			admin.PUT("/orders/:id/status", handlers.UpdateOrderStatus(db, emailSvc))
+			admin.GET("/orders/:id/timeline", handlers.GetOrderTimeline(db))
+			admin.POST("/orders/:id/invoice", handlers.GenerateInvoice(db, cfg))
+			admin.GET("/orders/:id/invoice", handlers.GetOrderInvoice(db))
+			admin.GET("/orders/:id/invoice/pdf", handlers.DownloadInvoicePDF(db, cfg))
+			admin.POST("/orders/:id/credit-notes", handlers.CreateCreditNote(db, cfg))
+			admin.GET("/orders/:id/credit-notes", handlers.ListOrderCreditNotes(db))
+			admin.GET("/credit-notes/:id/pdf", handlers.DownloadCreditNotePDF(db, cfg))
+			admin.GET("/accounting/export", handlers.ExportAccounting(db))
+			admin.GET("/orders/:id/payments", handlers.ListOrderPayments(db))
+			admin.POST("/orders/:id/refund", handlers.RefundOrder(db, cfg, emailSvc))
+			admin.POST("/payments/bank-statement", handlers.ImportBankStatement(db, emailSvc))
 			
+			// Customer email templates
+			admin.GET("/email-templates", handlers.ListEmailTemplates(db))
+			admin.GET("/email-templates/:key", handlers.GetEmailTemplate(db))
+			admin.PUT("/email-templates/:key", handlers.UpdateEmailTemplate(db, cfg))
+			admin.DELETE("/email-templates/:key", handlers.ResetEmailTemplate(db))
+			admin.POST("/email-templates/:key/preview", handlers.PreviewEmailTemplate(db, cfg))
+			admin.GET("/email-outbox", handlers.ListEmailOutbox(db))
+			admin.GET("/email-outbox/:id", handlers.GetEmailOutboxMessage(db))
+			admin.POST("/email-outbox/:id/resend", handlers.ResendEmail(db))
+
+			// Shipping
+			admin.GET("/shipping/rates", handlers.GetShippingRateTables(db))
+			admin.PUT("/shipping/methods/:code/rates", handlers.UpdateShippingRates(db))
+			admin.GET("/shipping/packeta/sync", handlers.GetPacketaSyncStatus(db))
+			admin.POST("/shipping/packeta/sync", handlers.SyncPacketaPoints(db, cfg))
+			admin.GET("/orders/:id/shipments", handlers.ListOrderShipments(db))
+			admin.POST("/orders/:id/shipment", handlers.CreateShipment(db, cfg))
+			admin.DELETE("/orders/:id/shipment", handlers.CancelShipment(db, cfg))
+			admin.GET("/orders/:id/shipment/label", handlers.DownloadShipmentLabel(db, cfg))
+			admin.POST("/orders/:id/tracking/refresh", handlers.RefreshOrderTracking(db, trackingSyncer))
+			admin.POST("/shipments", handlers.BulkCreateShipments(db, cfg))
+			admin.POST("/shipments/labels", handlers.BulkShipmentLabels(db, cfg))
+
 			// Settings
 			admin.GET("/settings", handlers.GetSettings(db))
 			admin.PUT("/settings", handlers.UpdateSettings(db, redisCache))
@@ -192,6 +263,8 @@ func main() {
 			admin.POST("/suppliers/:id/import", handlers.StartImport(db))
 			admin.GET("/suppliers/:id/import/:importId/progress", handlers.GetImportProgress(db))
 			admin.GET("/suppliers/:id/imports", handlers.ListImports(db))
+			admin.POST("/suppliers/:id/pipeline", handlers.RunSupplierPipeline(db, cfg))
+			admin.GET("/suppliers/:id/pipeline-runs", handlers.ListPipelineRuns(db))
 			admin.POST("/suppliers/:id/preview", handlers.PreviewFeed(db))
 			
 			// Supplier products
@@ -259,6 +332,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopWorkers()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -17,12 +19,47 @@ type Config struct {
 	ComgateShopID    string
 	ComgateSecret    string
 	ComgateTestMode  bool
+	ComgateAPIURL    string
 	GoPayClientID    string
 	GoPayClientSecret string
 	GoPayTestMode    bool
+	GoPayGoID        string
+	GoPayAPIURL      string
+
+	// Bank transfer
+	BankIBAN            string
+	BankBIC             string
+	BankBeneficiary     string
+	BankTransferDueDays int
+
+	// Unpaid orders are cancelled and their stock released after these, 0 keeps them
+	OnlinePaymentExpiry   time.Duration // card payments (Comgate, GoPay)
+	TransferPaymentExpiry time.Duration // bank transfers, leave time for the statement import
+
+	// Invoicing - supplier details printed on invoices
+	CompanyName         string
+	CompanyStreet       string
+	CompanyCity         string
+	CompanyPostalCode   string
+	CompanyCountry      string
+	CompanyICO          string
+	CompanyDIC          string
+	CompanyICDPH        string
+	CompanyRegistration string
+	InvoiceDueDays      int
 	
 	// Packeta
 	PacketaAPIKey    string
+	PacketaBranchFeed   string // branch feed URL or local file, default the API export
+	PacketaSyncInterval time.Duration
+	PacketaAPIPassword  string
+	PacketaAPIURL       string
+	PacketaSender       string  // sender label ("eshop") from the Packeta client section
+	PacketaLabelFormat  string
+	PacketaDefaultWeight float64 // kg, when the products have no weight
+
+	// Shipment tracking
+	TrackingSyncInterval time.Duration // 0 disables the tracking sync
 	
 	// SMTP Email
 	SMTPHost     string
@@ -33,6 +70,10 @@ type Config struct {
 	ShopName     string
 	ShopURL      string
 
+	// Email delivery: smtp, dir (write .eml files) or memory (tests)
+	EmailMode      string
+	EmailOutputDir string
+
 	// Storage
 	StoragePath string
 	CDNUrl      string
@@ -44,6 +85,47 @@ func Load() *Config {
 		origins = "http://localhost:3000"
 	}
 
+	goPayTestMode := os.Getenv("GOPAY_TEST_MODE") == "true"
+	goPayAPIURL := "https://gate.gopay.cz/api"
+	if goPayTestMode {
+		goPayAPIURL = "https://gw.sandbox.gopay.com/api"
+	}
+
+	bankTransferDueDays, err := strconv.Atoi(getEnv("BANK_TRANSFER_DUE_DAYS", "7"))
+	if err != nil || bankTransferDueDays < 1 {
+		bankTransferDueDays = 7
+	}
+
+	packetaSyncHours, err := strconv.Atoi(getEnv("PACKETA_SYNC_INTERVAL_HOURS", "24"))
+	if err != nil || packetaSyncHours < 1 {
+		packetaSyncHours = 24
+	}
+
+	packetaDefaultWeight, err := strconv.ParseFloat(getEnv("PACKETA_DEFAULT_WEIGHT", "1"), 64)
+	if err != nil || packetaDefaultWeight <= 0 {
+		packetaDefaultWeight = 1
+	}
+
+	onlinePaymentExpiryMinutes, err := strconv.Atoi(getEnv("ONLINE_PAYMENT_EXPIRY_MINUTES", "60"))
+	if err != nil || onlinePaymentExpiryMinutes < 0 {
+		onlinePaymentExpiryMinutes = 60
+	}
+
+	transferPaymentExpiryDays, err := strconv.Atoi(getEnv("TRANSFER_PAYMENT_EXPIRY_DAYS", strconv.Itoa(bankTransferDueDays+3)))
+	if err != nil || transferPaymentExpiryDays < 0 {
+		transferPaymentExpiryDays = bankTransferDueDays + 3
+	}
+
+	trackingSyncMinutes, err := strconv.Atoi(getEnv("TRACKING_SYNC_INTERVAL_MINUTES", "60"))
+	if err != nil || trackingSyncMinutes < 0 {
+		trackingSyncMinutes = 60
+	}
+
+	invoiceDueDays, err := strconv.Atoi(getEnv("INVOICE_DUE_DAYS", "14"))
+	if err != nil || invoiceDueDays < 0 {
+		invoiceDueDays = 14
+	}
+
 	return &Config{
 		Port:           getEnv("PORT", "8080"),
 		Environment:    getEnv("ENVIRONMENT", "development"),
@@ -55,11 +137,42 @@ func Load() *Config {
 		ComgateShopID:    os.Getenv("COMGATE_SHOP_ID"),
 		ComgateSecret:    os.Getenv("COMGATE_SECRET"),
 		ComgateTestMode:  os.Getenv("COMGATE_TEST_MODE") == "true",
+		ComgateAPIURL:    getEnv("COMGATE_API_URL", "https://payments.comgate.cz/v1.0"),
 		GoPayClientID:    os.Getenv("GOPAY_CLIENT_ID"),
 		GoPayClientSecret: os.Getenv("GOPAY_CLIENT_SECRET"),
-		GoPayTestMode:    os.Getenv("GOPAY_TEST_MODE") == "true",
+		GoPayTestMode:    goPayTestMode,
+		GoPayGoID:        os.Getenv("GOPAY_GOID"),
+		GoPayAPIURL:      getEnv("GOPAY_API_URL", goPayAPIURL),
+
+		BankIBAN:            os.Getenv("BANK_IBAN"),
+		BankBIC:             os.Getenv("BANK_BIC"),
+		BankBeneficiary:     getEnv("BANK_BENEFICIARY", getEnv("SHOP_NAME", "ProfiBuy.net")),
+		BankTransferDueDays: bankTransferDueDays,
+
+		OnlinePaymentExpiry:   time.Duration(onlinePaymentExpiryMinutes) * time.Minute,
+		TransferPaymentExpiry: time.Duration(transferPaymentExpiryDays) * 24 * time.Hour,
+
+		CompanyName:         getEnv("COMPANY_NAME", getEnv("SHOP_NAME", "ProfiBuy.net")),
+		CompanyStreet:       os.Getenv("COMPANY_STREET"),
+		CompanyCity:         os.Getenv("COMPANY_CITY"),
+		CompanyPostalCode:   os.Getenv("COMPANY_POSTAL_CODE"),
+		CompanyCountry:      getEnv("COMPANY_COUNTRY", "Slovensko"),
+		CompanyICO:          os.Getenv("COMPANY_ICO"),
+		CompanyDIC:          os.Getenv("COMPANY_DIC"),
+		CompanyICDPH:        os.Getenv("COMPANY_IC_DPH"),
+		CompanyRegistration: os.Getenv("COMPANY_REGISTRATION"),
+		InvoiceDueDays:      invoiceDueDays,
 		
 		PacketaAPIKey:    os.Getenv("PACKETA_API_KEY"),
+		PacketaBranchFeed:   os.Getenv("PACKETA_BRANCH_FEED"),
+		PacketaSyncInterval: time.Duration(packetaSyncHours) * time.Hour,
+		PacketaAPIPassword:  os.Getenv("PACKETA_API_PASSWORD"),
+		PacketaAPIURL:       getEnv("PACKETA_API_URL", "https://www.zasilkovna.cz/api/rest"),
+		PacketaSender:       os.Getenv("PACKETA_SENDER"),
+		PacketaLabelFormat:  getEnv("PACKETA_LABEL_FORMAT", "A6 on A4"),
+		PacketaDefaultWeight: packetaDefaultWeight,
+
+		TrackingSyncInterval: time.Duration(trackingSyncMinutes) * time.Minute,
 
 		SMTPHost:     getEnv("SMTP_HOST", ""),
 		SMTPPort:     getEnv("SMTP_PORT", "587"),
@@ -69,6 +182,9 @@ func Load() *Config {
 		ShopName:     getEnv("SHOP_NAME", "ProfiBuy.net"),
 		ShopURL:      getEnv("SHOP_URL", "https://profibuy.net"),
 
+		EmailMode:      getEnv("EMAIL_MODE", "smtp"),
+		EmailOutputDir: getEnv("EMAIL_OUTPUT_DIR", "./storage/emails"),
+
 		StoragePath: getEnv("STORAGE_PATH", "./storage"),
 		CDNUrl:           getEnv("CDN_URL", ""),
 	}
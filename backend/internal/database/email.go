@@ -0,0 +1,244 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ==================== EMAIL TEMPLATES ====================
+
+// GetEmailTemplate returns the template customized in admin, or nil
+func (p *Postgres) GetEmailTemplate(ctx context.Context, key string) (*models.EmailTemplate, error) {
+	t := models.EmailTemplate{Key: key, Customized: true}
+	err := p.pool.QueryRow(ctx, `
+		SELECT subject, body_html, updated_by, updated_at FROM email_templates WHERE key = $1
+	`, key).Scan(&t.Subject, &t.BodyHTML, &t.UpdatedBy, &t.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get email template: %w", err)
+	}
+	return &t, nil
+}
+
+// SaveEmailTemplate stores the admin version of a template
+func (p *Postgres) SaveEmailTemplate(ctx context.Context, t *models.EmailTemplate, updatedBy *uuid.UUID) error {
+	err := p.pool.QueryRow(ctx, `
+		INSERT INTO email_templates (key, subject, body_html, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			subject = EXCLUDED.subject, body_html = EXCLUDED.body_html,
+			updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		RETURNING updated_by, updated_at
+	`, t.Key, t.Subject, t.BodyHTML, updatedBy).Scan(&t.UpdatedBy, &t.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("save email template: %w", err)
+	}
+	t.Customized = true
+	return nil
+}
+
+// DeleteEmailTemplate drops the admin version, the default is used again
+func (p *Postgres) DeleteEmailTemplate(ctx context.Context, key string) error {
+	if _, err := p.pool.Exec(ctx, `DELETE FROM email_templates WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("delete email template: %w", err)
+	}
+	return nil
+}
+
+// ==================== EMAIL OUTBOX ====================
+
+// EnqueueEmail adds a rendered email to the outbox, due immediately. The
+// retry limit is the caller's (email.Service sets email.DefaultMaxAttempts).
+func (p *Postgres) EnqueueEmail(ctx context.Context, e *models.OutboxEmail) error {
+	err := p.pool.QueryRow(ctx, `
+		INSERT INTO email_outbox (kind, order_id, to_address, subject, body_html, images, max_attempts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, status, next_attempt_at, created_at, updated_at
+	`, e.Kind, e.OrderID, e.ToAddress, e.Subject, e.BodyHTML, e.Images, e.MaxAttempts,
+	).Scan(&e.ID, &e.Status, &e.NextAttemptAt, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("enqueue email: %w", err)
+	}
+	return nil
+}
+
+// ClaimEmails locks due messages for delivery. SKIP LOCKED lets several
+// workers run side by side; the lease brings back messages of a worker
+// that died while sending.
+func (p *Postgres) ClaimEmails(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	rows, err := p.pool.Query(ctx, `
+		UPDATE email_outbox SET
+			status = 'sending',
+			attempts = attempts + 1,
+			next_attempt_at = NOW() + make_interval(secs => $2),
+			updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status IN ('pending', 'sending') AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+outboxColumns, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim emails: %w", err)
+	}
+	return scanOutboxEmails(rows)
+}
+
+// MarkEmailSent records a successful delivery
+func (p *Postgres) MarkEmailSent(ctx context.Context, id uuid.UUID) error {
+	_, err := p.pool.Exec(ctx, `
+		UPDATE email_outbox SET status = 'sent', sent_at = NOW(), last_error = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return fmt.Errorf("mark email sent: %w", err)
+	}
+	return nil
+}
+
+// MarkEmailFailed schedules a retry at retryAt, or marks the email dead when nil
+func (p *Postgres) MarkEmailFailed(ctx context.Context, id uuid.UUID, lastError string, retryAt *time.Time) error {
+	var err error
+	if retryAt != nil {
+		_, err = p.pool.Exec(ctx, `
+			UPDATE email_outbox SET status = 'pending', next_attempt_at = $2, last_error = $3, updated_at = NOW()
+			WHERE id = $1
+		`, id, *retryAt, lastError)
+	} else {
+		_, err = p.pool.Exec(ctx, `
+			UPDATE email_outbox SET status = 'dead', last_error = $2, updated_at = NOW()
+			WHERE id = $1
+		`, id, lastError)
+	}
+	if err != nil {
+		return fmt.Errorf("mark email failed: %w", err)
+	}
+	return nil
+}
+
+// ListOutboxEmails lists the outbox newest first, without bodies. status
+// "failed" selects dead messages and pending ones that already failed.
+func (p *Postgres) ListOutboxEmails(ctx context.Context, status string, page, limit int) (*models.PaginatedResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	where := "TRUE"
+	var args []any
+	switch status {
+	case "":
+	case "failed":
+		where = "(e.status = 'dead' OR (e.status = 'pending' AND e.attempts > 0))"
+	default:
+		args = append(args, status)
+		where = "e.status = $1"
+	}
+
+	var total int64
+	if err := p.pool.QueryRow(ctx, `SELECT COUNT(*) FROM email_outbox e WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("count emails: %w", err)
+	}
+
+	args = append(args, limit, offset)
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+outboxListColumns+`
+		FROM email_outbox e
+		LEFT JOIN orders o ON o.id = e.order_id
+		WHERE `+where+`
+		ORDER BY e.created_at DESC
+		LIMIT $`+fmt.Sprint(len(args)-1)+` OFFSET $`+fmt.Sprint(len(args))+`
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list emails: %w", err)
+	}
+	defer rows.Close()
+
+	emails := []models.OutboxEmail{}
+	for rows.Next() {
+		var e models.OutboxEmail
+		err := rows.Scan(&e.ID, &e.Kind, &e.OrderID, &e.OrderNumber, &e.ToAddress, &e.Subject,
+			&e.Status, &e.Attempts, &e.MaxAttempts, &e.NextAttemptAt, &e.LastError,
+			&e.CreatedAt, &e.UpdatedAt, &e.SentAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan email: %w", err)
+		}
+		emails = append(emails, e)
+	}
+
+	return &models.PaginatedResponse{
+		Items:      emails,
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: int(math.Ceil(float64(total) / float64(limit))),
+	}, rows.Err()
+}
+
+// GetOutboxEmail returns an outbox message with its body, or nil
+func (p *Postgres) GetOutboxEmail(ctx context.Context, id uuid.UUID) (*models.OutboxEmail, error) {
+	rows, err := p.pool.Query(ctx, `SELECT `+outboxColumns+` FROM email_outbox WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("get email: %w", err)
+	}
+	emails, err := scanOutboxEmails(rows)
+	if err != nil || len(emails) == 0 {
+		return nil, err
+	}
+	return &emails[0], nil
+}
+
+// ResendEmail queues a dead (or already sent) message again with fresh attempts.
+// Returns false if the message does not exist or is still queued.
+func (p *Postgres) ResendEmail(ctx context.Context, id uuid.UUID) (bool, error) {
+	result, err := p.pool.Exec(ctx, `
+		UPDATE email_outbox SET
+			status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = NULL, updated_at = NOW()
+		WHERE id = $1 AND status IN ('dead', 'sent')
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("resend email: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const outboxColumns = `
+	id, kind, order_id, to_address, subject, body_html, images, status, attempts, max_attempts,
+	next_attempt_at, COALESCE(last_error, ''), created_at, updated_at, sent_at
+`
+
+const outboxListColumns = `
+	e.id, e.kind, e.order_id, COALESCE(o.order_number, ''), e.to_address, e.subject,
+	e.status, e.attempts, e.max_attempts, e.next_attempt_at, COALESCE(e.last_error, ''),
+	e.created_at, e.updated_at, e.sent_at
+`
+
+func scanOutboxEmails(rows pgx.Rows) ([]models.OutboxEmail, error) {
+	defer rows.Close()
+	var emails []models.OutboxEmail
+	for rows.Next() {
+		var e models.OutboxEmail
+		err := rows.Scan(&e.ID, &e.Kind, &e.OrderID, &e.ToAddress, &e.Subject, &e.BodyHTML, &e.Images,
+			&e.Status, &e.Attempts, &e.MaxAttempts, &e.NextAttemptAt, &e.LastError,
+			&e.CreatedAt, &e.UpdatedAt, &e.SentAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan email: %w", err)
+		}
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
@@ -0,0 +1,314 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ==================== INVOICES ====================
+
+// Document number series kept in document_sequences
+const (
+	SeriesInvoice    = "invoice"
+	SeriesCreditNote = "credit_note"
+)
+
+// nextDocumentNumber allocates the next number of a per-year series. The row
+// lock is held until the transaction ends, so the series has no gaps.
+func nextDocumentNumber(ctx context.Context, tx pgx.Tx, series string, year int) (int, error) {
+	var seq int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO document_sequences (series, year, last_number) VALUES ($1, $2, 1)
+		ON CONFLICT (series, year) DO UPDATE SET last_number = document_sequences.last_number + 1
+		RETURNING last_number
+	`, series, year).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("next %s number: %w", series, err)
+	}
+	return seq, nil
+}
+
+// CreateInvoice numbers and stores a new invoice for its order. format builds
+// the number from year and sequence, store renders and saves the PDF (setting
+// PDFPath); if it fails nothing is stored and the number is not used up.
+// Returns the existing invoice (and false) if the order was already invoiced.
+func (p *Postgres) CreateInvoice(ctx context.Context, inv *models.Invoice, format func(year, seq int) string, store func(*models.Invoice) error) (*models.Invoice, bool, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize invoicing of the same order
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM orders WHERE id = $1 FOR UPDATE`, inv.OrderID); err != nil {
+		return nil, false, fmt.Errorf("lock order: %w", err)
+	}
+	existing, err := scanInvoice(tx.QueryRow(ctx, `SELECT `+invoiceColumns+` FROM invoices i WHERE i.order_id = $1`, inv.OrderID))
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, false, fmt.Errorf("get invoice: %w", err)
+	}
+	if existing != nil {
+		return existing, false, nil
+	}
+
+	inv.ID = uuid.New()
+	inv.Year = inv.IssueDate.Year()
+	inv.Sequence, err = nextDocumentNumber(ctx, tx, SeriesInvoice, inv.Year)
+	if err != nil {
+		return nil, false, err
+	}
+	inv.Number = format(inv.Year, inv.Sequence)
+
+	if err := store(inv); err != nil {
+		return nil, false, err
+	}
+
+	supplier, _ := json.Marshal(inv.Supplier)
+	customer, _ := json.Marshal(inv.Customer)
+	lines, _ := json.Marshal(inv.Lines)
+	summary, _ := json.Marshal(inv.VATSummary)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO invoices (
+			id, order_id, number, year, sequence, issue_date, supply_date, due_date,
+			supplier, customer, lines, vat_summary, subtotal, vat_total, total, currency,
+			payment_method, variable_symbol, iban, paid, pdf_path
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
+			NULLIF($17, ''), NULLIF($18, ''), NULLIF($19, ''), $20, $21
+		)
+		RETURNING created_at
+	`,
+		inv.ID, inv.OrderID, inv.Number, inv.Year, inv.Sequence, inv.IssueDate, inv.SupplyDate, inv.DueDate,
+		supplier, customer, lines, summary, inv.Subtotal, inv.VATTotal, inv.Total, inv.Currency,
+		inv.PaymentMethod, inv.VariableSymbol, inv.IBAN, inv.Paid, inv.PDFPath,
+	).Scan(&inv.CreatedAt)
+	if err != nil {
+		return nil, false, fmt.Errorf("insert invoice: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE orders SET invoice_number = $2, updated_at = NOW() WHERE id = $1`, inv.OrderID, inv.Number)
+	if err != nil {
+		return nil, false, fmt.Errorf("set invoice number: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, fmt.Errorf("commit invoice: %w", err)
+	}
+	return inv, true, nil
+}
+
+// GetInvoiceByOrder returns the invoice of an order or nil
+func (p *Postgres) GetInvoiceByOrder(ctx context.Context, orderID uuid.UUID) (*models.Invoice, error) {
+	inv, err := scanInvoice(p.pool.QueryRow(ctx, `SELECT `+invoiceColumns+` FROM invoices i WHERE i.order_id = $1`, orderID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get invoice: %w", err)
+	}
+	return inv, nil
+}
+
+// ListInvoices returns invoices issued in the date range (inclusive)
+func (p *Postgres) ListInvoices(ctx context.Context, from, to time.Time) ([]models.Invoice, error) {
+	rows, err := p.pool.Query(ctx, `SELECT `+invoiceColumns+` FROM invoices i
+		WHERE i.issue_date BETWEEN $1 AND $2 ORDER BY i.issue_date, i.number`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("list invoices: %w", err)
+	}
+	defer rows.Close()
+
+	var invoices []models.Invoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan invoice: %w", err)
+		}
+		invoices = append(invoices, *inv)
+	}
+	return invoices, rows.Err()
+}
+
+const invoiceColumns = `
+	i.id, i.order_id, (SELECT order_number FROM orders WHERE id = i.order_id), i.number, i.year, i.sequence,
+	i.issue_date, i.supply_date, i.due_date, i.supplier, i.customer, i.lines, i.vat_summary,
+	i.subtotal, i.vat_total, i.total, COALESCE(i.currency, 'EUR'),
+	COALESCE(i.payment_method, ''), COALESCE(i.variable_symbol, ''), COALESCE(i.iban, ''),
+	COALESCE(i.paid, false), COALESCE(i.pdf_path, ''), i.created_at
+`
+
+func scanInvoice(row pgx.Row) (*models.Invoice, error) {
+	var inv models.Invoice
+	var supplier, customer, lines, summary []byte
+	err := row.Scan(
+		&inv.ID, &inv.OrderID, &inv.OrderNumber, &inv.Number, &inv.Year, &inv.Sequence,
+		&inv.IssueDate, &inv.SupplyDate, &inv.DueDate, &supplier, &customer, &lines, &summary,
+		&inv.Subtotal, &inv.VATTotal, &inv.Total, &inv.Currency,
+		&inv.PaymentMethod, &inv.VariableSymbol, &inv.IBAN,
+		&inv.Paid, &inv.PDFPath, &inv.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal(supplier, &inv.Supplier)
+	json.Unmarshal(customer, &inv.Customer)
+	json.Unmarshal(lines, &inv.Lines)
+	json.Unmarshal(summary, &inv.VATSummary)
+	return &inv, nil
+}
+
+// ==================== CREDIT NOTES ====================
+
+// CreateCreditNote issues a credit note to an invoice. build gets the invoice
+// and its earlier credit notes while the invoice is locked, so concurrent
+// corrections cannot together credit more than was invoiced. format and
+// store work as in CreateInvoice.
+func (p *Postgres) CreateCreditNote(ctx context.Context, invoiceID uuid.UUID, createdBy *uuid.UUID,
+	build func(inv *models.Invoice, previous []models.CreditNote) (*models.CreditNote, error),
+	format func(year, seq int) string, store func(*models.CreditNote) error) (*models.CreditNote, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM invoices WHERE id = $1 FOR UPDATE`, invoiceID); err != nil {
+		return nil, fmt.Errorf("lock invoice: %w", err)
+	}
+	inv, err := scanInvoice(tx.QueryRow(ctx, `SELECT `+invoiceColumns+` FROM invoices i WHERE i.id = $1`, invoiceID))
+	if err != nil {
+		return nil, fmt.Errorf("get invoice: %w", err)
+	}
+	previous, err := queryCreditNotes(ctx, tx, `WHERE cn.invoice_id = $1 ORDER BY cn.created_at`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	cn, err := build(inv, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	cn.ID = uuid.New()
+	cn.Year = cn.IssueDate.Year()
+	cn.Sequence, err = nextDocumentNumber(ctx, tx, SeriesCreditNote, cn.Year)
+	if err != nil {
+		return nil, err
+	}
+	cn.Number = format(cn.Year, cn.Sequence)
+	cn.CreatedBy = createdBy
+	cn.CreatedAt = time.Now()
+
+	if err := store(cn); err != nil {
+		return nil, err
+	}
+
+	supplier, _ := json.Marshal(cn.Supplier)
+	customer, _ := json.Marshal(cn.Customer)
+	lines, _ := json.Marshal(cn.Lines)
+	summary, _ := json.Marshal(cn.VATSummary)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO credit_notes (
+			id, invoice_id, order_id, number, year, sequence, issue_date, supply_date, reason,
+			supplier, customer, lines, vat_summary, subtotal, vat_total, total, currency,
+			payment_method, pdf_path, created_by
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
+			NULLIF($18, ''), $19, $20
+		)
+		RETURNING created_at
+	`,
+		cn.ID, cn.InvoiceID, cn.OrderID, cn.Number, cn.Year, cn.Sequence, cn.IssueDate, cn.SupplyDate, cn.Reason,
+		supplier, customer, lines, summary, cn.Subtotal, cn.VATTotal, cn.Total, cn.Currency,
+		cn.PaymentMethod, cn.PDFPath, cn.CreatedBy,
+	).Scan(&cn.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert credit note: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit credit note: %w", err)
+	}
+	return cn, nil
+}
+
+// GetCreditNote returns a credit note by ID or nil
+func (p *Postgres) GetCreditNote(ctx context.Context, id uuid.UUID) (*models.CreditNote, error) {
+	cn, err := scanCreditNote(p.pool.QueryRow(ctx, `SELECT `+creditNoteColumns+` FROM credit_notes cn WHERE cn.id = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get credit note: %w", err)
+	}
+	return cn, nil
+}
+
+// ListOrderCreditNotes returns the credit notes of an order, oldest first
+func (p *Postgres) ListOrderCreditNotes(ctx context.Context, orderID uuid.UUID) ([]models.CreditNote, error) {
+	return queryCreditNotes(ctx, p.pool, `WHERE cn.order_id = $1 ORDER BY cn.created_at`, orderID)
+}
+
+// ListCreditNotes returns credit notes issued in the date range (inclusive)
+func (p *Postgres) ListCreditNotes(ctx context.Context, from, to time.Time) ([]models.CreditNote, error) {
+	return queryCreditNotes(ctx, p.pool, `WHERE cn.issue_date BETWEEN $1 AND $2 ORDER BY cn.issue_date, cn.number`, from, to)
+}
+
+func queryCreditNotes(ctx context.Context, q interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}, where string, args ...any) ([]models.CreditNote, error) {
+	rows, err := q.Query(ctx, `SELECT `+creditNoteColumns+` FROM credit_notes cn `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list credit notes: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []models.CreditNote
+	for rows.Next() {
+		cn, err := scanCreditNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan credit note: %w", err)
+		}
+		notes = append(notes, *cn)
+	}
+	return notes, rows.Err()
+}
+
+const creditNoteColumns = `
+	cn.id, cn.invoice_id, (SELECT number FROM invoices WHERE id = cn.invoice_id),
+	cn.order_id, (SELECT order_number FROM orders WHERE id = cn.order_id),
+	cn.number, cn.year, cn.sequence, cn.issue_date, cn.supply_date, cn.reason,
+	cn.supplier, cn.customer, cn.lines, cn.vat_summary,
+	cn.subtotal, cn.vat_total, cn.total, COALESCE(cn.currency, 'EUR'),
+	COALESCE(cn.payment_method, ''), COALESCE(cn.pdf_path, ''), cn.created_by, cn.created_at
+`
+
+func scanCreditNote(row pgx.Row) (*models.CreditNote, error) {
+	var cn models.CreditNote
+	var supplier, customer, lines, summary []byte
+	err := row.Scan(
+		&cn.ID, &cn.InvoiceID, &cn.InvoiceNumber,
+		&cn.OrderID, &cn.OrderNumber,
+		&cn.Number, &cn.Year, &cn.Sequence, &cn.IssueDate, &cn.SupplyDate, &cn.Reason,
+		&supplier, &customer, &lines, &summary,
+		&cn.Subtotal, &cn.VATTotal, &cn.Total, &cn.Currency,
+		&cn.PaymentMethod, &cn.PDFPath, &cn.CreatedBy, &cn.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal(supplier, &cn.Supplier)
+	json.Unmarshal(customer, &cn.Customer)
+	json.Unmarshal(lines, &cn.Lines)
+	json.Unmarshal(summary, &cn.VATSummary)
+	return &cn, nil
+}
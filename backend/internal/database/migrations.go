@@ -842,3 +842,594 @@ END $$;
 -- Set default delivery days for remaining products
 UPDATE products SET delivery_days = 3 WHERE delivery_days IS NULL OR delivery_days = 0;
 `
+
+var migration007 = `
+-- Migration 007: Comgate card payments
+-- Stores the gateway transaction ID on the order and allows cancelled payments
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_transaction_id VARCHAR(100);
+CREATE INDEX IF NOT EXISTS idx_orders_payment_transaction ON orders(payment_transaction_id);
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_payment_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_payment_status_check
+    CHECK (payment_status IN ('pending', 'paid', 'failed', 'cancelled', 'refunded'));
+`
+
+var migration008 = `
+-- Migration 008: Payment transactions ledger
+-- Every payment attempt and refund is recorded, orders.payment_status is derived from it
+
+CREATE TABLE IF NOT EXISTS payment_transactions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES payment_transactions(id) ON DELETE SET NULL,  -- refund -> original payment
+
+    gateway VARCHAR(20) NOT NULL,  -- 'comgate', 'gopay', 'transfer', 'cod'
+    type VARCHAR(20) NOT NULL CHECK (type IN ('payment', 'refund')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed', 'cancelled')),
+
+    amount DECIMAL(12, 2) NOT NULL,
+    currency VARCHAR(3) DEFAULT 'EUR',
+    external_id VARCHAR(100),  -- gateway transaction / refund ID
+    note TEXT,
+    error_message TEXT,
+
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_payment_transactions_order ON payment_transactions(order_id);
+CREATE INDEX idx_payment_transactions_parent ON payment_transactions(parent_id);
+CREATE UNIQUE INDEX idx_payment_transactions_external ON payment_transactions(gateway, external_id)
+    WHERE type = 'payment' AND external_id IS NOT NULL;
+
+-- Backfill the ledger from orders paid before it existed
+INSERT INTO payment_transactions (order_id, gateway, type, status, amount, currency, external_id, created_at, updated_at)
+SELECT o.id, COALESCE(NULLIF(o.payment_method, ''), 'unknown'), 'payment', 'succeeded', o.total, o.currency,
+       o.payment_transaction_id, COALESCE(o.paid_at, o.created_at), COALESCE(o.paid_at, o.created_at)
+FROM orders o
+WHERE o.payment_status IN ('paid', 'refunded')
+  AND NOT EXISTS (SELECT 1 FROM payment_transactions pt WHERE pt.order_id = o.id);
+
+INSERT INTO payment_transactions (order_id, parent_id, gateway, type, status, amount, currency, note)
+SELECT pt.order_id, pt.id, pt.gateway, 'refund', 'succeeded', pt.amount, pt.currency, 'Backfilled by migration 008'
+FROM payment_transactions pt
+JOIN orders o ON o.id = pt.order_id
+WHERE o.payment_status = 'refunded' AND pt.type = 'payment';
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_payment_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_payment_status_check
+    CHECK (payment_status IN ('pending', 'paid', 'failed', 'cancelled', 'partially_refunded', 'refunded'));
+`
+
+var migration009 = `
+-- Migration 009: Bank transfer payments
+-- Orders paid by transfer get a numeric variable symbol for matching bank statements
+
+CREATE SEQUENCE IF NOT EXISTS order_variable_symbol_seq START WITH 1000001;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS variable_symbol VARCHAR(10);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_variable_symbol ON orders(variable_symbol) WHERE variable_symbol IS NOT NULL;
+`
+
+var migration010 = `
+-- Migration 010: Bank statement import
+-- Transfers are matched from bank statements, an underpaid order stays partially paid
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_payment_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_payment_status_check
+    CHECK (payment_status IN ('pending', 'partially_paid', 'paid', 'failed', 'cancelled', 'partially_refunded', 'refunded'));
+`
+
+var migration011 = `
+-- Migration 011: Invoices
+-- Issued invoices with a per-year gapless number series and the stored PDF
+
+CREATE TABLE IF NOT EXISTS document_sequences (
+    series VARCHAR(20) NOT NULL,  -- 'invoice', later other document types
+    year INTEGER NOT NULL,
+    last_number INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (series, year)
+);
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL UNIQUE REFERENCES orders(id) ON DELETE RESTRICT,
+    number VARCHAR(50) UNIQUE NOT NULL,
+    year INTEGER NOT NULL,
+    sequence INTEGER NOT NULL,
+
+    issue_date DATE NOT NULL,
+    supply_date DATE NOT NULL,
+    due_date DATE NOT NULL,
+
+    supplier JSONB NOT NULL,
+    customer JSONB NOT NULL,
+    lines JSONB NOT NULL,
+    vat_summary JSONB NOT NULL,
+
+    subtotal DECIMAL(12, 2) NOT NULL,
+    vat_total DECIMAL(12, 2) NOT NULL,
+    total DECIMAL(12, 2) NOT NULL,
+    currency VARCHAR(3) DEFAULT 'EUR',
+
+    payment_method VARCHAR(50),
+    variable_symbol VARCHAR(10),
+    iban VARCHAR(34),
+    paid BOOLEAN DEFAULT false,
+
+    pdf_path TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (year, sequence)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_issue_date ON invoices(issue_date);
+`
+
+var migration012 = `
+-- Migration 012: Credit notes
+-- Corrective documents (dobropis) to issued invoices with their own number series
+
+CREATE TABLE IF NOT EXISTS credit_notes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE RESTRICT,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    number VARCHAR(50) UNIQUE NOT NULL,
+    year INTEGER NOT NULL,
+    sequence INTEGER NOT NULL,
+
+    issue_date DATE NOT NULL,
+    supply_date DATE NOT NULL,
+    reason TEXT NOT NULL,
+
+    supplier JSONB NOT NULL,
+    customer JSONB NOT NULL,
+    lines JSONB NOT NULL,
+    vat_summary JSONB NOT NULL,
+
+    subtotal DECIMAL(12, 2) NOT NULL,  -- negative
+    vat_total DECIMAL(12, 2) NOT NULL,
+    total DECIMAL(12, 2) NOT NULL,
+    currency VARCHAR(3) DEFAULT 'EUR',
+    payment_method VARCHAR(50),
+
+    pdf_path TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (year, sequence)
+);
+
+CREATE INDEX IF NOT EXISTS idx_credit_notes_invoice ON credit_notes(invoice_id);
+CREATE INDEX IF NOT EXISTS idx_credit_notes_issue_date ON credit_notes(issue_date);
+`
+
+var migration013 = `
+-- Migration 013: Order status history
+-- Validated status transitions are recorded with the actor and an optional note
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'paid', 'processing', 'shipped', 'delivered', 'cancelled', 'returned', 'refunded'));
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(30),  -- NULL for the order creation
+    to_status VARCHAR(30) NOT NULL,
+    actor_type VARCHAR(20) NOT NULL CHECK (actor_type IN ('admin', 'customer', 'system')),
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order ON order_status_history(order_id, created_at);
+
+-- Existing orders start their timeline with the current status
+INSERT INTO order_status_history (order_id, from_status, to_status, actor_type, note, created_at)
+SELECT id, NULL, status, 'system', 'Stav pred zavedením histórie', updated_at
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM order_status_history h WHERE h.order_id = o.id);
+`
+
+var migration014 = `
+-- Migration 014: Email templates
+-- Customer emails customized in admin; keys without a row use the built-in default
+
+CREATE TABLE IF NOT EXISTS email_templates (
+    key VARCHAR(50) PRIMARY KEY,
+    subject TEXT NOT NULL,
+    body_html TEXT NOT NULL,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+`
+
+var migration015 = `
+-- Migration 015: Email outbox
+-- Customer emails are queued and delivered by a background worker with retries
+
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    kind VARCHAR(50) NOT NULL,  -- order_confirmation or an email template key
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    to_address VARCHAR(255) NOT NULL,
+    subject TEXT NOT NULL,
+    body_html TEXT NOT NULL,
+    images JSONB,  -- inline images (PAY by square QR code)
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'sent', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 10,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_due ON email_outbox(next_attempt_at) WHERE status IN ('pending', 'sending');
+CREATE INDEX IF NOT EXISTS idx_email_outbox_status ON email_outbox(status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_email_outbox_order ON email_outbox(order_id);
+`
+
+var migration016 = `
+-- Migration 016: Packeta pickup points
+-- Local copy of the Packeta branch feed, refreshed by the branch sync
+
+CREATE TABLE IF NOT EXISTS packeta_points (
+    id VARCHAR(20) PRIMARY KEY,  -- Packeta branch ID
+    name VARCHAR(255) NOT NULL,
+    place VARCHAR(255),
+    street VARCHAR(255),
+    city VARCHAR(100),
+    zip VARCHAR(10),  -- without spaces
+    country VARCHAR(2) NOT NULL,
+    type VARCHAR(20) NOT NULL DEFAULT 'pickup_point',
+    latitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    longitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    directions TEXT,
+    url VARCHAR(500),
+    photo VARCHAR(500),
+    max_weight DECIMAL(8,2) NOT NULL DEFAULT 0,
+    opening_hours JSONB NOT NULL DEFAULT '{}',
+    search_text TEXT NOT NULL DEFAULT '',  -- lowercase, without diacritics
+    is_active BOOLEAN NOT NULL DEFAULT true,  -- false once the point disappears from the feed
+    synced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_packeta_points_zip ON packeta_points(zip) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_packeta_points_country ON packeta_points(country) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_packeta_points_search ON packeta_points USING gin(search_text gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_packeta_points_location ON packeta_points(latitude, longitude) WHERE is_active;
+`
+
+var migration017 = `
+-- Migration 017: Shipments
+-- Parcels registered with carriers, and the pickup point chosen at checkout
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS pickup_point_id VARCHAR(20);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS pickup_point_name VARCHAR(500);  -- snapshot shown to staff and customer
+
+CREATE TABLE IF NOT EXISTS shipments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    carrier VARCHAR(20) NOT NULL,
+    packet_id VARCHAR(50) NOT NULL,
+    tracking_number VARCHAR(100) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'created' CHECK (status IN ('created', 'cancelled')),
+    pickup_point_id VARCHAR(20),
+    value DECIMAL(12,2) NOT NULL DEFAULT 0,
+    cod_amount DECIMAL(12,2) NOT NULL DEFAULT 0,
+    weight DECIMAL(8,3) NOT NULL DEFAULT 0,
+    label_path VARCHAR(500),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    cancelled_at TIMESTAMP WITH TIME ZONE
+);
+
+-- At most one live shipment per order
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shipments_order_active ON shipments(order_id) WHERE status = 'created';
+CREATE INDEX IF NOT EXISTS idx_shipments_order ON shipments(order_id);
+CREATE INDEX IF NOT EXISTS idx_shipments_carrier_packet ON shipments(carrier, packet_id);
+`
+
+var migration018 = `
+-- Migration 018: Shipping rates
+-- Weight tiers and per-country prices of shipping methods, plus surcharge
+-- and exclusion rules. Methods without rates keep their flat price.
+
+CREATE TABLE IF NOT EXISTS shipping_rates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    method_code VARCHAR(50) NOT NULL REFERENCES shipping_methods(code) ON UPDATE CASCADE ON DELETE CASCADE,
+    country VARCHAR(2),  -- destination ISO code, NULL = any country
+    weight_from DECIMAL(8,3) NOT NULL DEFAULT 0,  -- kg, inclusive
+    weight_to DECIMAL(8,3),  -- kg, inclusive, NULL = no limit
+    price DECIMAL(12,2) NOT NULL,
+    free_from DECIMAL(12,2),  -- overrides the method's free_from, 0 = never free
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK (weight_to IS NULL OR weight_to >= weight_from)
+);
+
+CREATE INDEX IF NOT EXISTS idx_shipping_rates_method ON shipping_rates(method_code);
+
+CREATE TABLE IF NOT EXISTS shipping_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    method_code VARCHAR(50) NOT NULL REFERENCES shipping_methods(code) ON UPDATE CASCADE ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('surcharge', 'exclude')),
+    condition VARCHAR(20) NOT NULL CHECK (condition IN ('large', 'small_pallet', 'country', 'category', 'product', 'weight_over')),
+    value VARCHAR(100) NOT NULL DEFAULT '',  -- country code, category/product ID or kg, by condition
+    country VARCHAR(2),  -- only for this destination, NULL = any
+    amount DECIMAL(12,2) NOT NULL DEFAULT 0,  -- surcharge per parcel
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    note VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_shipping_rules_method ON shipping_rules(method_code);
+
+-- Oversized goods go on a pallet, not in a parcel locker or the post
+INSERT INTO shipping_rules (method_code, action, condition, note)
+SELECT code, 'exclude', c.condition, 'Nadrozmerný tovar'
+FROM shipping_methods, (VALUES ('large'), ('small_pallet')) AS c(condition)
+WHERE code IN ('packeta', 'posta')
+  AND NOT EXISTS (SELECT 1 FROM shipping_rules);
+`
+
+var migration019 = `
+-- Migration 019: Tracking events
+-- Carrier scans of shipped parcels, polled by the tracking sync
+
+CREATE TABLE IF NOT EXISTS tracking_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    carrier VARCHAR(20) NOT NULL,
+    tracking_number VARCHAR(100) NOT NULL,
+    event_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL,  -- normalized: in_transit, ready_for_pickup, delivered, returned, cancelled
+    code VARCHAR(50) NOT NULL DEFAULT '',  -- carrier's own status code
+    description TEXT NOT NULL DEFAULT '',
+    location VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Polling returns the whole history every time, store each scan once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tracking_events_unique ON tracking_events(order_id, tracking_number, event_time, code);
+CREATE INDEX IF NOT EXISTS idx_tracking_events_order ON tracking_events(order_id, event_time);
+
+-- Latest state of the parcel, and when the sync last asked the carrier
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_status VARCHAR(20);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_checked_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_error TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_orders_tracking ON orders(tracking_checked_at NULLS FIRST) WHERE status = 'shipped';
+`
+
+var migration020 = `
+-- Migration 020: Stock reservations
+-- Checkout reserves stock atomically, unpaid orders release it when they expire
+
+-- Backorders: per product, NULL follows the product's suppliers
+ALTER TABLE products ADD COLUMN IF NOT EXISTS allow_backorder BOOLEAN;
+ALTER TABLE suppliers ADD COLUMN IF NOT EXISTS allow_backorder BOOLEAN NOT NULL DEFAULT false;
+
+-- Pieces ordered over the stock of a backorder product
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS backordered INTEGER NOT NULL DEFAULT 0;
+
+-- Unpaid orders are cancelled after this, returning their goods to stock
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS reserved_until TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_orders_reserved_until ON orders(reserved_until) WHERE status = 'pending';
+`
+
+var migration021 = `
+-- Migration 021: Stock movements
+-- Ledger of every change of products.stock, written by a trigger so that no
+-- path (orders, supplier linking, admin edits, bulk imports) can skip it.
+-- The writer tags its transaction with set_config('megashop.stock_source', ...)
+-- and optionally megashop.stock_reference / megashop.stock_note; untagged
+-- changes count as manual.
+
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    source VARCHAR(20) NOT NULL CHECK (source IN ('order', 'cancel', 'supplier_import', 'manual')),
+    delta INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,  -- stock after the movement
+    reference_id UUID,  -- order for order/cancel, supplier for supplier_import, admin for manual
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_product ON stock_movements(product_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_reference ON stock_movements(reference_id) WHERE reference_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION record_stock_movement()
+RETURNS TRIGGER AS $$
+DECLARE
+    old_stock INTEGER := 0;
+    new_stock INTEGER := COALESCE(NEW.stock, 0);
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        old_stock := COALESCE(OLD.stock, 0);
+    END IF;
+    IF new_stock = old_stock THEN
+        RETURN NEW;
+    END IF;
+
+    INSERT INTO stock_movements (product_id, source, delta, quantity, reference_id, note)
+    VALUES (
+        NEW.id,
+        COALESCE(NULLIF(current_setting('megashop.stock_source', true), ''), 'manual'),
+        new_stock - old_stock,
+        new_stock,
+        NULLIF(current_setting('megashop.stock_reference', true), '')::uuid,
+        NULLIF(current_setting('megashop.stock_note', true), '')
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_products_stock_movement ON products;
+CREATE TRIGGER trg_products_stock_movement
+    AFTER INSERT OR UPDATE OF stock ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION record_stock_movement();
+`
+
+var migration022 = `
+-- Migration 022: Supplier offers
+-- Supplier products with the same EAN (or manufacturer part number and
+-- brand) are linked to one main product; the offer selection rules pick the
+-- offer that sets its price, stock and delivery days.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS active_offer_id UUID REFERENCES supplier_products(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_supplier_products_mpn_producer ON supplier_products(manufacturer_part_number, lower(producer_name))
+    WHERE manufacturer_part_number IS NOT NULL AND manufacturer_part_number <> '';
+
+-- Criteria applied in order until one offer wins:
+-- in_stock, cheapest, priority (supplier priority), fastest (shipping time)
+INSERT INTO settings (id, key, value, "group") VALUES
+    (uuid_generate_v4(), 'offer_selection', '{"rules": ["in_stock", "cheapest", "priority", "fastest"]}', 'suppliers')
+ON CONFLICT (key) DO NOTHING;
+`
+
+var migration023 = `
+-- Migration 023: Pricing rules
+-- Retail prices of supplier products computed from the purchase price.
+-- Every condition left NULL matches anything; among the matching rules the
+-- highest priority wins, then the most specific one.
+
+CREATE TABLE IF NOT EXISTS pricing_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+
+    -- Conditions
+    supplier_id UUID REFERENCES suppliers(id) ON DELETE CASCADE,
+    category_id UUID REFERENCES categories(id) ON DELETE CASCADE,  -- includes subcategories
+    brand_id UUID REFERENCES brands(id) ON DELETE CASCADE,
+    price_from DECIMAL(12, 2) NOT NULL DEFAULT 0,  -- purchase price without VAT
+    price_to DECIMAL(12, 2),  -- exclusive, NULL = no upper limit
+
+    -- Computation, on prices without VAT
+    markup_percent DECIMAL(6, 2) NOT NULL DEFAULT 0,
+    min_margin DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    fixed_surcharge DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    cap_at_srp BOOLEAN NOT NULL DEFAULT false,  -- never above the supplier's SRP
+    rounding VARCHAR(10) NOT NULL DEFAULT 'none' CHECK (rounding IN ('none', 'whole', 'x.90', 'x.99')),
+
+    priority INTEGER NOT NULL DEFAULT 0,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pricing_rules_active ON pricing_rules(is_active);
+`
+
+var migration024 = `
+-- Migration 024: Price history
+-- Every change of products.price / sale_price, written by a trigger like the
+-- stock ledger. For the EU Omnibus directive a discount must be shown against
+-- the lowest price of the 30 days before it; that price is kept on the
+-- product in lowest_price_30d, fixed when the price changes. NULL until the
+-- first recorded change.
+
+CREATE TABLE IF NOT EXISTS price_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    price DECIMAL(12, 2) NOT NULL,
+    sale_price DECIMAL(12, 2),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_history_product ON price_history(product_id, created_at DESC);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS lowest_price_30d DECIMAL(12, 2);
+
+-- Prices known when history starts
+INSERT INTO price_history (product_id, price, sale_price)
+SELECT p.id, p.price, p.sale_price FROM products p
+WHERE NOT EXISTS (SELECT 1 FROM price_history h WHERE h.product_id = p.id);
+
+-- Lowest price paid in the 30 days before the change: the old price, every
+-- price set within the window and the one in effect when the window opened
+CREATE OR REPLACE FUNCTION set_lowest_price_30d()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.price IS NOT DISTINCT FROM OLD.price AND NEW.sale_price IS NOT DISTINCT FROM OLD.sale_price THEN
+        RETURN NEW;
+    END IF;
+
+    NEW.lowest_price_30d := LEAST(
+        COALESCE(OLD.sale_price, OLD.price),
+        (SELECT MIN(COALESCE(h.sale_price, h.price)) FROM price_history h
+         WHERE h.product_id = OLD.id AND h.created_at >= NOW() - INTERVAL '30 days'),
+        (SELECT COALESCE(h.sale_price, h.price) FROM price_history h
+         WHERE h.product_id = OLD.id AND h.created_at < NOW() - INTERVAL '30 days'
+         ORDER BY h.created_at DESC LIMIT 1)
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_products_lowest_price ON products;
+CREATE TRIGGER trg_products_lowest_price
+    BEFORE UPDATE OF price, sale_price ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION set_lowest_price_30d();
+
+CREATE OR REPLACE FUNCTION record_price_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.price IS NOT DISTINCT FROM OLD.price
+       AND NEW.sale_price IS NOT DISTINCT FROM OLD.sale_price THEN
+        RETURN NEW;
+    END IF;
+
+    INSERT INTO price_history (product_id, price, sale_price)
+    VALUES (NEW.id, NEW.price, NEW.sale_price);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_products_price_history ON products;
+CREATE TRIGGER trg_products_price_history
+    AFTER INSERT OR UPDATE OF price, sale_price ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION record_price_change();
+`
+
+var migration025 = `
+-- Migration 025: Scheduled supplier pipeline
+-- Suppliers with a cron schedule get their feed downloaded, imported, linked
+-- and the Heureka feed regenerated on that schedule. Every run is recorded
+-- with the outcome of each step; at most one run per supplier is running.
+
+ALTER TABLE suppliers ADD COLUMN IF NOT EXISTS schedule VARCHAR(100);  -- cron expression, NULL = manual only
+
+CREATE TABLE IF NOT EXISTS supplier_pipeline_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    supplier_id UUID NOT NULL REFERENCES suppliers(id) ON DELETE CASCADE,
+    triggered_by VARCHAR(20) NOT NULL DEFAULT 'scheduled' CHECK (triggered_by IN ('manual', 'scheduled', 'api')),
+    status VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'completed', 'failed', 'skipped')),
+    steps JSONB NOT NULL DEFAULT '[]',  -- [{"name": "download", "status": "completed", "message": ...}, ...]
+    error_message TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_supplier_pipeline_runs_supplier ON supplier_pipeline_runs(supplier_id, started_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_supplier_pipeline_runs_running ON supplier_pipeline_runs(supplier_id) WHERE status = 'running';
+`
+
+var migration026 = `
+-- Migration 026: Variant groups of supplier products
+-- Heureka (ITEMGROUP_ID) and Google (item_group_id) feeds group the variants
+-- of a product; the group is carried over to products.itemgroup_id on linking.
+
+ALTER TABLE supplier_products ADD COLUMN IF NOT EXISTS item_group_id VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_supplier_products_item_group ON supplier_products(supplier_id, item_group_id) WHERE item_group_id IS NOT NULL;
+`
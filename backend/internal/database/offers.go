@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"megashop/internal/models"
+	"megashop/internal/offers"
+	"megashop/internal/pricing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ==================== SUPPLIER OFFERS ====================
+
+// GetOfferRules returns the offer selection rules, the defaults if not configured
+func (p *Postgres) GetOfferRules(ctx context.Context) ([]string, error) {
+	var value struct {
+		Rules []string `json:"rules"`
+	}
+	var raw json.RawMessage
+	err := p.pool.QueryRow(ctx, `SELECT value FROM settings WHERE key = 'offer_selection'`).Scan(&raw)
+	if err == pgx.ErrNoRows {
+		return offers.DefaultRules, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get offer rules: %w", err)
+	}
+	if err := json.Unmarshal(raw, &value); err != nil || offers.ValidateRules(value.Rules) != nil {
+		return offers.DefaultRules, nil
+	}
+	return value.Rules, nil
+}
+
+// SaveOfferRules stores the offer selection rules
+func (p *Postgres) SaveOfferRules(ctx context.Context, rules []string) error {
+	value, err := json.Marshal(map[string][]string{"rules": rules})
+	if err != nil {
+		return err
+	}
+	_, err = p.pool.Exec(ctx, `
+		INSERT INTO settings (id, key, value, "group") VALUES (gen_random_uuid(), 'offer_selection', $1, 'suppliers')
+		ON CONFLICT (key) DO UPDATE SET value = $1, updated_at = NOW()
+	`, value)
+	if err != nil {
+		return fmt.Errorf("save offer rules: %w", err)
+	}
+	return nil
+}
+
+// FindOfferProduct returns the main product a supplier product belongs to:
+// one with the same EAN, or linked to another supplier's product with the
+// same EAN or with the same manufacturer part number and brand. Nil if none.
+func (p *Postgres) FindOfferProduct(ctx context.Context, sp *models.SupplierProduct) (*uuid.UUID, error) {
+	ean := offers.NormalizeCode(sp.EAN)
+	mpn := offers.NormalizeCode(sp.ManufacturerPartNumber)
+	if ean == "" && mpn == "" {
+		return nil, nil
+	}
+
+	var id uuid.UUID
+	err := p.pool.QueryRow(ctx, `
+		SELECT product_id FROM (
+			SELECT p.id AS product_id, 1 AS rank
+			FROM products p
+			WHERE $1 <> '' AND p.ean = $1
+			UNION ALL
+			SELECT sp.linked_product_id, 2
+			FROM supplier_products sp
+			WHERE $1 <> '' AND sp.ean = $1 AND sp.linked_product_id IS NOT NULL AND sp.id <> $4
+			UNION ALL
+			SELECT sp.linked_product_id, 3
+			FROM supplier_products sp
+			WHERE $2 <> '' AND sp.manufacturer_part_number = $2
+			  AND lower(COALESCE(sp.producer_name, '')) = lower($3)
+			  AND sp.linked_product_id IS NOT NULL AND sp.id <> $4
+		) m
+		ORDER BY rank
+		LIMIT 1
+	`, ean, mpn, sp.ProducerName, sp.ID).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find offer product: %w", err)
+	}
+	return &id, nil
+}
+
+// ListProductOffers returns the supplier offers of a main product, the
+// active one marked
+func (p *Postgres) ListProductOffers(ctx context.Context, productID uuid.UUID) ([]models.SupplierOffer, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT sp.id, s.id, s.code, s.name, COALESCE(s.is_active, true), COALESCE(s.priority, 0),
+			   sp.external_id, COALESCE(sp.ean, ''), COALESCE(sp.price_net, 0), COALESCE(sp.price_vat, 0),
+			   COALESCE(sp.vat_rate, 0), COALESCE(sp.srp, 0),
+			   COALESCE(sp.stock, 0), COALESCE(sp.shipping_time_hours, 0),
+			   sp.id = p.active_offer_id, sp.updated_at
+		FROM supplier_products sp
+		JOIN suppliers s ON s.id = sp.supplier_id
+		JOIN products p ON p.id = $1
+		WHERE sp.linked_product_id = $1 OR sp.product_id = $1
+		ORDER BY s.priority DESC, s.name, sp.external_id
+	`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("list product offers: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.SupplierOffer{}
+	for rows.Next() {
+		var o models.SupplierOffer
+		var active *bool
+		err := rows.Scan(&o.ID, &o.SupplierID, &o.SupplierCode, &o.SupplierName, &o.SupplierActive, &o.Priority,
+			&o.ExternalID, &o.EAN, &o.PriceNet, &o.PriceVAT, &o.VATRate, &o.SRP, &o.Stock, &o.ShippingTimeHours,
+			&active, &o.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan product offer: %w", err)
+		}
+		o.Active = active != nil && *active
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+// OfferSelection picks and prices the offers of products
+type OfferSelection struct {
+	Rules   []string        // offer selection rules
+	Pricing *pricing.Engine // retail prices from purchase prices
+}
+
+// LoadOfferSelection loads the offer selection rules and the pricing engine
+func (p *Postgres) LoadOfferSelection(ctx context.Context) (*OfferSelection, error) {
+	rules, err := p.GetOfferRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := p.PricingEngine(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &OfferSelection{Rules: rules, Pricing: engine}, nil
+}
+
+// price returns the product price set by the offer: computed by the
+// pricing rules, or the supplier's price with VAT when no rule matches
+func (sel *OfferSelection) price(o models.SupplierOffer, categoryID, brandID *uuid.UUID) (float64, *float64, *pricing.Result) {
+	res := sel.Pricing.Price(pricing.Input{
+		SupplierID: o.SupplierID,
+		CategoryID: categoryID,
+		BrandID:    brandID,
+		PriceNet:   o.PriceNet,
+		PriceVAT:   o.PriceVAT,
+		VATRate:    o.VATRate,
+		SRP:        o.SRP,
+	})
+	if res != nil {
+		return res.Price, res.SalePrice, res
+	}
+	price, salePrice := offers.Pricing(o)
+	return price, salePrice, nil
+}
+
+// RefreshProductOffer selects the product's best offer and copies its
+// price, stock (less the pieces held by open orders) and delivery days to
+// the product. Returns the selected offer, nil when the product has no
+// offer from an active supplier (the product is left as it is).
+func (p *Postgres) RefreshProductOffer(ctx context.Context, productID uuid.UUID, sel *OfferSelection) (*models.SupplierOffer, error) {
+	list, err := p.ListProductOffers(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	i := offers.Select(list, sel.Rules)
+	if i < 0 {
+		return nil, nil
+	}
+	best := list[i]
+	best.Active = true
+
+	var categoryID, brandID *uuid.UUID
+	err = p.pool.QueryRow(ctx, `SELECT category_id, brand_id FROM products WHERE id = $1`, productID).Scan(&categoryID, &brandID)
+	if err != nil {
+		return nil, fmt.Errorf("get product: %w", err)
+	}
+	price, salePrice, _ := sel.price(best, categoryID, brandID)
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tagStockChanges(ctx, tx, models.StockSourceSupplierImport, &best.SupplierID, "Ponuka "+best.SupplierCode); err != nil {
+		return nil, err
+	}
+
+	// The offer's stock less the pieces open orders hold
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM products WHERE id = $1 FOR UPDATE`, productID); err != nil {
+		return nil, fmt.Errorf("lock product: %w", err)
+	}
+	reserved, err := reservedQuantity(ctx, tx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A price of 0 means the feed has none, keep ours
+	_, err = tx.Exec(ctx, `
+		UPDATE products SET
+			active_offer_id = $2,
+			price = CASE WHEN $3::numeric > 0 THEN $3 ELSE price END,
+			sale_price = CASE WHEN $3::numeric > 0 THEN $4 ELSE sale_price END,
+			stock = $5,
+			delivery_days = CASE WHEN $6::int > 0 THEN $6 ELSE delivery_days END,
+			updated_at = NOW()
+		WHERE id = $1 AND (
+			active_offer_id IS DISTINCT FROM $2
+			OR ($3::numeric > 0 AND (price <> $3 OR sale_price IS DISTINCT FROM $4::numeric))
+			OR stock <> $5
+			OR ($6::int > 0 AND delivery_days IS DISTINCT FROM $6)
+		)
+	`, productID, best.ID, price, salePrice, best.Stock-reserved, offers.DeliveryDays(best))
+	if err != nil {
+		return nil, fmt.Errorf("apply offer: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit offer: %w", err)
+	}
+	return &best, nil
+}
+
+// RefreshOffers reselects the offers of the products linked to the
+// supplier, or of all linked products when supplierID is nil. Returns the
+// number of products refreshed.
+func (p *Postgres) RefreshOffers(ctx context.Context, supplierID *uuid.UUID) (int, error) {
+	sel, err := p.LoadOfferSelection(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := p.pool.Query(ctx, `
+		SELECT DISTINCT linked_product_id FROM supplier_products
+		WHERE linked_product_id IS NOT NULL AND ($1::uuid IS NULL OR supplier_id = $1)
+	`, supplierID)
+	if err != nil {
+		return 0, fmt.Errorf("list offer products: %w", err)
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan offer product: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("list offer products: %w", err)
+	}
+
+	refreshed := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return refreshed, ctx.Err()
+		}
+		if _, err := p.RefreshProductOffer(ctx, id, sel); err != nil {
+			return refreshed, err
+		}
+		refreshed++
+	}
+	return refreshed, nil
+}
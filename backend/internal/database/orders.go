@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ==================== ORDER STATUS ====================
+
+var (
+	ErrOrderNotFound           = errors.New("order not found")
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+)
+
+// StatusUpdate describes a requested order status change
+type StatusUpdate struct {
+	Status         string
+	ActorType      string
+	ActorID        *uuid.UUID
+	Note           string
+	TrackingNumber string // stored when not empty
+}
+
+// ChangeOrderStatus moves the order to a new status if the transition is
+// allowed, records it in the order timeline and applies its side effects
+// (shipped_at, stock returned on cancellation). Returns the previous status,
+// also with ErrInvalidStatusTransition so callers can list the allowed ones.
+func (p *Postgres) ChangeOrderStatus(ctx context.Context, orderID uuid.UUID, update StatusUpdate) (string, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var from string
+	err = tx.QueryRow(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&from)
+	if err == pgx.ErrNoRows {
+		return "", ErrOrderNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("lock order: %w", err)
+	}
+
+	if update.TrackingNumber != "" {
+		_, err = tx.Exec(ctx, `UPDATE orders SET tracking_number = $2, updated_at = NOW() WHERE id = $1`, orderID, update.TrackingNumber)
+		if err != nil {
+			return "", fmt.Errorf("set tracking number: %w", err)
+		}
+	}
+
+	// Only the tracking number changes
+	if update.Status == from && update.TrackingNumber != "" {
+		return from, tx.Commit(ctx)
+	}
+
+	if err := changeOrderStatus(ctx, tx, orderID, from, update); err != nil {
+		if errors.Is(err, ErrInvalidStatusTransition) {
+			return from, err
+		}
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("commit status change: %w", err)
+	}
+	return from, nil
+}
+
+// changeOrderStatus applies a validated transition inside tx. The order row
+// must already be locked and from must be its current status.
+func changeOrderStatus(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, from string, update StatusUpdate) error {
+	if !models.CanTransitionOrder(from, update.Status) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, from, update.Status)
+	}
+
+	_, err := tx.Exec(ctx, `
+		UPDATE orders SET
+			status = $2,
+			shipped_at = CASE WHEN $2 = 'shipped' THEN COALESCE(shipped_at, NOW()) ELSE shipped_at END,
+			updated_at = NOW()
+		WHERE id = $1
+	`, orderID, update.Status)
+	if err != nil {
+		return fmt.Errorf("update order status: %w", err)
+	}
+
+	// Goods of a cancelled order were never shipped, put them back on stock.
+	// Returned goods are restocked by hand after inspection.
+	if update.Status == models.OrderStatusCancelled {
+		if err := tagStockChanges(ctx, tx, models.StockSourceCancel, &orderID, update.Note); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE products p SET stock = p.stock + oi.quantity, updated_at = NOW()
+			FROM (
+				SELECT product_id, SUM(quantity) AS quantity
+				FROM order_items WHERE order_id = $1
+				GROUP BY product_id
+			) oi
+			WHERE p.id = oi.product_id
+		`, orderID)
+		if err != nil {
+			return fmt.Errorf("restore stock: %w", err)
+		}
+	}
+
+	return recordOrderStatus(ctx, tx, orderID, from, update)
+}
+
+// recordOrderStatus appends an entry to the order timeline
+func recordOrderStatus(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, from string, update StatusUpdate) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor_type, actor_id, note)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, NULLIF($6, ''))
+	`, orderID, from, update.Status, update.ActorType, update.ActorID, update.Note)
+	if err != nil {
+		return fmt.Errorf("record order status: %w", err)
+	}
+	return nil
+}
+
+// ListOrderStatusHistory returns the order timeline, oldest first
+func (p *Postgres) ListOrderStatusHistory(ctx context.Context, orderID uuid.UUID) ([]models.OrderStatusChange, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT h.id, h.order_id, COALESCE(h.from_status, ''), h.to_status, h.actor_type, h.actor_id,
+			   COALESCE(u.email, ''), COALESCE(h.note, ''), h.created_at
+		FROM order_status_history h
+		LEFT JOIN users u ON u.id = h.actor_id
+		WHERE h.order_id = $1
+		ORDER BY h.created_at, h.id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("list order status history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []models.OrderStatusChange
+	for rows.Next() {
+		var h models.OrderStatusChange
+		err := rows.Scan(&h.ID, &h.OrderID, &h.FromStatus, &h.ToStatus, &h.ActorType, &h.ActorID,
+			&h.ActorEmail, &h.Note, &h.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan order status: %w", err)
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,372 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ==================== ORDER PAYMENTS ====================
+
+// GetOrderByNumber returns an order (with items) by its order number
+func (p *Postgres) GetOrderByNumber(ctx context.Context, orderNumber string) (*models.Order, error) {
+	var id uuid.UUID
+	err := p.pool.QueryRow(ctx, `SELECT id FROM orders WHERE order_number = $1`, orderNumber).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get order by number: %w", err)
+	}
+	return p.GetOrder(ctx, id)
+}
+
+// ==================== PAYMENT LEDGER ====================
+
+// ErrRefundExceedsPayment is returned when a refund is larger than the refundable remainder
+var ErrRefundExceedsPayment = errors.New("refund exceeds the refundable amount")
+
+const paymentTransactionColumns = `
+	id, order_id, parent_id, gateway, type, status, amount, COALESCE(currency, 'EUR'),
+	COALESCE(external_id, ''), COALESCE(note, ''), COALESCE(error_message, ''),
+	created_by, created_at, updated_at
+`
+
+func scanPaymentTransaction(row pgx.Row) (*models.PaymentTransaction, error) {
+	var t models.PaymentTransaction
+	err := row.Scan(
+		&t.ID, &t.OrderID, &t.ParentID, &t.Gateway, &t.Type, &t.Status, &t.Amount, &t.Currency,
+		&t.ExternalID, &t.Note, &t.ErrorMessage, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListPaymentTransactions returns the payment ledger of an order, oldest first
+func (p *Postgres) ListPaymentTransactions(ctx context.Context, orderID uuid.UUID) ([]models.PaymentTransaction, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+paymentTransactionColumns+`
+		FROM payment_transactions WHERE order_id = $1
+		ORDER BY created_at, id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("list payment transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := []models.PaymentTransaction{}
+	for rows.Next() {
+		t, err := scanPaymentTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan payment transaction: %w", err)
+		}
+		transactions = append(transactions, *t)
+	}
+	return transactions, rows.Err()
+}
+
+// GetPaymentTransaction returns a single ledger entry
+func (p *Postgres) GetPaymentTransaction(ctx context.Context, id uuid.UUID) (*models.PaymentTransaction, error) {
+	t, err := scanPaymentTransaction(p.pool.QueryRow(ctx, `
+		SELECT `+paymentTransactionColumns+` FROM payment_transactions WHERE id = $1
+	`, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get payment transaction: %w", err)
+	}
+	return t, nil
+}
+
+// ListPendingRefunds returns refunds the gateway accepted but has not
+// settled yet, oldest first
+func (p *Postgres) ListPendingRefunds(ctx context.Context, limit int) ([]models.PaymentTransaction, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+paymentTransactionColumns+`
+		FROM payment_transactions
+		WHERE type = 'refund' AND status = 'pending' AND external_id IS NOT NULL
+		ORDER BY created_at, id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list pending refunds: %w", err)
+	}
+	defer rows.Close()
+
+	var refunds []models.PaymentTransaction
+	for rows.Next() {
+		t, err := scanPaymentTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan payment transaction: %w", err)
+		}
+		refunds = append(refunds, *t)
+	}
+	return refunds, rows.Err()
+}
+
+// RecordPaymentAttempt stores a pending gateway payment and makes it the
+// order's current transaction. Re-initialising the same transaction is a no-op.
+func (p *Postgres) RecordPaymentAttempt(ctx context.Context, orderID uuid.UUID, gateway, externalID string, amount float64, currency string) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO payment_transactions (order_id, gateway, type, status, amount, currency, external_id)
+		VALUES ($1, $2, 'payment', 'pending', $3, $4, $5)
+		ON CONFLICT (gateway, external_id) WHERE type = 'payment' AND external_id IS NOT NULL DO NOTHING
+	`, orderID, gateway, amount, currency, externalID)
+	if err != nil {
+		return fmt.Errorf("insert payment transaction: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE orders SET payment_transaction_id = $2, updated_at = NOW() WHERE id = $1
+	`, orderID, externalID)
+	if err != nil {
+		return fmt.Errorf("set payment transaction: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SettlePayment records the final state of a gateway payment reported by a
+// callback and re-derives the order payment status. A pending entry can move
+// to any state, a failed/cancelled one only to succeeded (late payment).
+// Returns false if nothing changed (repeated notification).
+func (p *Postgres) SettlePayment(ctx context.Context, orderID uuid.UUID, gateway, externalID, status string, amount float64, currency string) (bool, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		INSERT INTO payment_transactions (order_id, gateway, type, status, amount, currency, external_id)
+		VALUES ($1, $2, 'payment', $4, $5, $6, $3)
+		ON CONFLICT (gateway, external_id) WHERE type = 'payment' AND external_id IS NOT NULL
+		DO UPDATE SET status = EXCLUDED.status, amount = EXCLUDED.amount, updated_at = NOW()
+		WHERE payment_transactions.order_id = EXCLUDED.order_id
+		  AND payment_transactions.status <> EXCLUDED.status
+		  AND (payment_transactions.status = 'pending' OR EXCLUDED.status = 'succeeded')
+	`, orderID, gateway, externalID, status, amount, currency)
+	if err != nil {
+		return false, fmt.Errorf("settle payment: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if err := syncOrderPaymentStatus(ctx, tx, orderID, time.Now()); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// CreateRefund adds a pending refund of the given payment. The order row is
+// locked so concurrent refunds cannot exceed the captured amount.
+func (p *Postgres) CreateRefund(ctx context.Context, paymentID uuid.UUID, amount float64, note string, createdBy *uuid.UUID) (*models.PaymentTransaction, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	parent, err := scanPaymentTransaction(tx.QueryRow(ctx, `
+		SELECT `+paymentTransactionColumns+` FROM payment_transactions WHERE id = $1
+	`, paymentID))
+	if err != nil {
+		return nil, fmt.Errorf("get payment: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM orders WHERE id = $1 FOR UPDATE`, parent.OrderID); err != nil {
+		return nil, fmt.Errorf("lock order: %w", err)
+	}
+
+	var refunded float64
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount), 0) FROM payment_transactions
+		WHERE parent_id = $1 AND type = 'refund' AND status IN ('pending', 'succeeded')
+	`, paymentID).Scan(&refunded)
+	if err != nil {
+		return nil, fmt.Errorf("sum refunds: %w", err)
+	}
+	if amount <= 0 || math.Round((parent.Amount-refunded-amount)*100) < 0 {
+		return nil, ErrRefundExceedsPayment
+	}
+
+	refund, err := scanPaymentTransaction(tx.QueryRow(ctx, `
+		INSERT INTO payment_transactions (order_id, parent_id, gateway, type, status, amount, currency, note, created_by)
+		VALUES ($1, $2, $3, 'refund', 'pending', $4, $5, NULLIF($6, ''), $7)
+		RETURNING `+paymentTransactionColumns+`
+	`, parent.OrderID, parent.ID, parent.Gateway, amount, parent.Currency, note, createdBy))
+	if err != nil {
+		return nil, fmt.Errorf("insert refund: %w", err)
+	}
+
+	return refund, tx.Commit(ctx)
+}
+
+// UpdatePaymentTransactionStatus sets the outcome of a ledger entry (e.g. the
+// gateway's answer to a refund) and re-derives the order payment status
+func (p *Postgres) UpdatePaymentTransactionStatus(ctx context.Context, id uuid.UUID, status, externalID, errorMessage string) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var orderID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		UPDATE payment_transactions SET
+			status = $2,
+			external_id = COALESCE(NULLIF($3, ''), external_id),
+			error_message = NULLIF($4, ''),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING order_id
+	`, id, status, externalID, errorMessage).Scan(&orderID)
+	if err != nil {
+		return fmt.Errorf("update payment transaction: %w", err)
+	}
+
+	if err := syncOrderPaymentStatus(ctx, tx, orderID, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// syncOrderPaymentStatus derives orders.payment_status from the ledger:
+// partially_paid until the captured amount covers the total, then paid,
+// partially_refunded or refunded; without captured money the state of the
+// latest attempt. A pending order becomes paid once fully paid, paidAt is
+// used if paid_at is not set yet.
+func syncOrderPaymentStatus(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, paidAt time.Time) error {
+	var paid, refunded, total float64
+	var lastStatus string
+	err := tx.QueryRow(ctx, `
+		SELECT
+			COALESCE(SUM(pt.amount) FILTER (WHERE pt.type = 'payment' AND pt.status = 'succeeded'), 0),
+			COALESCE(SUM(pt.amount) FILTER (WHERE pt.type = 'refund' AND pt.status = 'succeeded'), 0),
+			o.total,
+			COALESCE((
+				SELECT status FROM payment_transactions
+				WHERE order_id = o.id AND type = 'payment'
+				ORDER BY created_at DESC, id DESC LIMIT 1
+			), 'pending')
+		FROM orders o
+		LEFT JOIN payment_transactions pt ON pt.order_id = o.id
+		WHERE o.id = $1
+		GROUP BY o.id, o.total
+	`, orderID).Scan(&paid, &refunded, &total, &lastStatus)
+	if err != nil {
+		return fmt.Errorf("sum payment transactions: %w", err)
+	}
+
+	fullyPaid := paid > 0 && math.Round((paid-total)*100) >= 0
+
+	var status string
+	switch {
+	case paid > 0 && math.Round((paid-refunded)*100) <= 0:
+		status = "refunded"
+	case paid > 0 && refunded > 0:
+		status = "partially_refunded"
+	case fullyPaid:
+		status = "paid"
+	case paid > 0:
+		status = "partially_paid"
+	case lastStatus == models.PaymentTxFailed || lastStatus == models.PaymentTxCancelled:
+		status = lastStatus
+	default:
+		status = "pending"
+	}
+
+	var orderStatus string
+	err = tx.QueryRow(ctx, `
+		UPDATE orders SET
+			payment_status = $2,
+			paid_at = CASE WHEN $3 THEN COALESCE(paid_at, $4) ELSE paid_at END,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING status
+	`, orderID, status, fullyPaid, paidAt).Scan(&orderStatus)
+	if err != nil {
+		return fmt.Errorf("sync order payment status: %w", err)
+	}
+
+	if fullyPaid && orderStatus == models.OrderStatusPending {
+		return changeOrderStatus(ctx, tx, orderID, orderStatus, StatusUpdate{
+			Status:    models.OrderStatusPaid,
+			ActorType: models.OrderActorSystem,
+			Note:      "Platba prijatá",
+		})
+	}
+	return nil
+}
+
+// ==================== BANK TRANSFERS ====================
+
+// GetTransferOrderByVariableSymbol returns the bank transfer order with the given variable symbol
+func (p *Postgres) GetTransferOrderByVariableSymbol(ctx context.Context, variableSymbol string) (*models.Order, error) {
+	var id uuid.UUID
+	err := p.pool.QueryRow(ctx, `
+		SELECT id FROM orders WHERE variable_symbol = $1 AND payment_method = 'transfer'
+	`, variableSymbol).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get order by variable symbol: %w", err)
+	}
+	return p.GetOrder(ctx, id)
+}
+
+// RecordTransferPayment adds a received bank transfer to the ledger and
+// re-derives the order payment status. externalID is the bank reference of
+// the statement entry; returns false if it was already recorded. paid is the
+// total captured for the order afterwards.
+func (p *Postgres) RecordTransferPayment(ctx context.Context, orderID uuid.UUID, externalID string, amount float64, currency, note string, bookedAt time.Time) (recorded bool, paid float64, err error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return false, 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		INSERT INTO payment_transactions (order_id, gateway, type, status, amount, currency, external_id, note)
+		VALUES ($1, 'transfer', 'payment', 'succeeded', $2, $3, $4, NULLIF($5, ''))
+		ON CONFLICT (gateway, external_id) WHERE type = 'payment' AND external_id IS NOT NULL DO NOTHING
+	`, orderID, amount, currency, externalID, note)
+	if err != nil {
+		return false, 0, fmt.Errorf("insert transfer payment: %w", err)
+	}
+	recorded = result.RowsAffected() > 0
+
+	if recorded {
+		if err := syncOrderPaymentStatus(ctx, tx, orderID, bookedAt); err != nil {
+			return false, 0, err
+		}
+	}
+
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount), 0) FROM payment_transactions
+		WHERE order_id = $1 AND type = 'payment' AND status = 'succeeded'
+	`, orderID).Scan(&paid)
+	if err != nil {
+		return false, 0, fmt.Errorf("sum transfer payments: %w", err)
+	}
+
+	return recorded, paid, tx.Commit(ctx)
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ==================== SUPPLIER PIPELINE ====================
+
+// ErrPipelineRunning is returned when the supplier's pipeline is already running
+var ErrPipelineRunning = errors.New("supplier pipeline already running")
+
+// ListScheduledSuppliers returns the active suppliers with a schedule, only
+// ID, code and schedule filled in
+func (p *Postgres) ListScheduledSuppliers(ctx context.Context) ([]models.Supplier, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, code, schedule FROM suppliers
+		WHERE COALESCE(is_active, true) AND COALESCE(schedule, '') <> ''
+		ORDER BY priority DESC, name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list scheduled suppliers: %w", err)
+	}
+	defer rows.Close()
+
+	var suppliers []models.Supplier
+	for rows.Next() {
+		var s models.Supplier
+		if err := rows.Scan(&s.ID, &s.Code, &s.Schedule); err != nil {
+			return nil, fmt.Errorf("scan scheduled supplier: %w", err)
+		}
+		suppliers = append(suppliers, s)
+	}
+	return suppliers, rows.Err()
+}
+
+// StartPipelineRun records a running pipeline run. Returns
+// ErrPipelineRunning when the supplier has one running already.
+func (p *Postgres) StartPipelineRun(ctx context.Context, supplierID uuid.UUID, triggeredBy string) (*models.PipelineRun, error) {
+	run := &models.PipelineRun{
+		SupplierID:  supplierID,
+		TriggeredBy: triggeredBy,
+		Status:      models.PipelineRunning,
+		Steps:       []models.PipelineStep{},
+	}
+	err := p.pool.QueryRow(ctx, `
+		INSERT INTO supplier_pipeline_runs (supplier_id, triggered_by, status)
+		VALUES ($1, $2, 'running')
+		RETURNING id, started_at
+	`, supplierID, triggeredBy).Scan(&run.ID, &run.StartedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrPipelineRunning
+		}
+		return nil, fmt.Errorf("start pipeline run: %w", err)
+	}
+	return run, nil
+}
+
+// RecordSkippedPipelineRun records a run that did not start, e.g. because
+// the previous one is still running
+func (p *Postgres) RecordSkippedPipelineRun(ctx context.Context, supplierID uuid.UUID, triggeredBy, reason string) (*models.PipelineRun, error) {
+	run := &models.PipelineRun{
+		SupplierID:   supplierID,
+		TriggeredBy:  triggeredBy,
+		Status:       models.PipelineSkipped,
+		Steps:        []models.PipelineStep{},
+		ErrorMessage: reason,
+	}
+	err := p.pool.QueryRow(ctx, `
+		INSERT INTO supplier_pipeline_runs (supplier_id, triggered_by, status, error_message, finished_at)
+		VALUES ($1, $2, 'skipped', $3, NOW())
+		RETURNING id, started_at, finished_at
+	`, supplierID, triggeredBy, reason).Scan(&run.ID, &run.StartedAt, &run.FinishedAt)
+	if err != nil {
+		return nil, fmt.Errorf("record skipped pipeline run: %w", err)
+	}
+	return run, nil
+}
+
+// UpdatePipelineRun saves the steps, status and error of a run
+func (p *Postgres) UpdatePipelineRun(ctx context.Context, run *models.PipelineRun) error {
+	steps, err := json.Marshal(run.Steps)
+	if err != nil {
+		return err
+	}
+	_, err = p.pool.Exec(ctx, `
+		UPDATE supplier_pipeline_runs SET
+			status = $2, steps = $3, error_message = NULLIF($4, ''), finished_at = $5
+		WHERE id = $1
+	`, run.ID, run.Status, steps, run.ErrorMessage, run.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("update pipeline run: %w", err)
+	}
+	return nil
+}
+
+// ListPipelineRuns returns the latest pipeline runs of a supplier
+func (p *Postgres) ListPipelineRuns(ctx context.Context, supplierID uuid.UUID, limit int) ([]models.PipelineRun, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, supplier_id, triggered_by, status, steps, COALESCE(error_message, ''), started_at, finished_at
+		FROM supplier_pipeline_runs
+		WHERE supplier_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2
+	`, supplierID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list pipeline runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []models.PipelineRun{}
+	for rows.Next() {
+		var run models.PipelineRun
+		var steps []byte
+		err := rows.Scan(&run.ID, &run.SupplierID, &run.TriggeredBy, &run.Status, &steps,
+			&run.ErrorMessage, &run.StartedAt, &run.FinishedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan pipeline run: %w", err)
+		}
+		if err := json.Unmarshal(steps, &run.Steps); err != nil {
+			return nil, fmt.Errorf("decode pipeline steps: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// FailInterruptedPipelineRuns marks the runs left running by a restart as
+// failed. Returns the number of runs.
+func (p *Postgres) FailInterruptedPipelineRuns(ctx context.Context) (int, error) {
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE supplier_pipeline_runs SET
+			status = 'failed', error_message = 'Interrupted by a server restart', finished_at = NOW()
+		WHERE status = 'running'
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("fail interrupted pipeline runs: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -170,7 +171,7 @@ func (p *Postgres) ListProducts(ctx context.Context, filter models.ProductFilter
 			   COALESCE(currency, 'EUR'), stock, 
 			   category_id, brand_id, COALESCE(images, '[]'), COALESCE(attributes, '[]'), 
 			   COALESCE(meta_title, ''), COALESCE(meta_description, ''),
-			   status, weight, created_at, updated_at
+			   status, weight, lowest_price_30d, created_at, updated_at
 		FROM products 
 		WHERE %s 
 		ORDER BY %s 
@@ -193,7 +194,7 @@ func (p *Postgres) ListProducts(ctx context.Context, filter models.ProductFilter
 			&prod.Price, &prod.SalePrice, &prod.Currency, &prod.Stock,
 			&prod.CategoryID, &prod.BrandID, &prod.Images, &prod.Attributes,
 			&prod.MetaTitle, &prod.MetaDesc, &prod.Status, &prod.Weight,
-			&prod.CreatedAt, &prod.UpdatedAt,
+			&prod.LowestPrice30d, &prod.CreatedAt, &prod.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan product: %w", err)
@@ -217,7 +218,7 @@ func (p *Postgres) GetProduct(ctx context.Context, id uuid.UUID) (*models.Produc
 			   COALESCE(currency, 'EUR'), stock, 
 			   category_id, brand_id, COALESCE(images, '[]'), COALESCE(attributes, '[]'), 
 			   COALESCE(variants, '[]'), COALESCE(meta_title, ''), COALESCE(meta_description, ''),
-			   status, weight, created_at, updated_at
+			   status, weight, allow_backorder, active_offer_id, lowest_price_30d, created_at, updated_at
 		FROM products 
 		WHERE id = $1
 	`
@@ -228,7 +229,7 @@ func (p *Postgres) GetProduct(ctx context.Context, id uuid.UUID) (*models.Produc
 		&prod.Price, &prod.SalePrice, &prod.Currency, &prod.Stock,
 		&prod.CategoryID, &prod.BrandID, &prod.Images, &prod.Attributes,
 		&prod.Variants, &prod.MetaTitle, &prod.MetaDesc, &prod.Status,
-		&prod.Weight, &prod.CreatedAt, &prod.UpdatedAt,
+		&prod.Weight, &prod.AllowBackorder, &prod.ActiveOfferID, &prod.LowestPrice30d, &prod.CreatedAt, &prod.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -247,7 +248,7 @@ func (p *Postgres) GetProductBySlug(ctx context.Context, slug string) (*models.P
 			   COALESCE(currency, 'EUR'), stock, 
 			   category_id, brand_id, COALESCE(images, '[]'), COALESCE(attributes, '[]'), 
 			   COALESCE(variants, '[]'), COALESCE(meta_title, ''), COALESCE(meta_description, ''),
-			   status, weight, created_at, updated_at
+			   status, weight, allow_backorder, lowest_price_30d, created_at, updated_at
 		FROM products 
 		WHERE slug = $1 AND status = 'active'
 	`
@@ -258,7 +259,7 @@ func (p *Postgres) GetProductBySlug(ctx context.Context, slug string) (*models.P
 		&prod.Price, &prod.SalePrice, &prod.Currency, &prod.Stock,
 		&prod.CategoryID, &prod.BrandID, &prod.Images, &prod.Attributes,
 		&prod.Variants, &prod.MetaTitle, &prod.MetaDesc, &prod.Status,
-		&prod.Weight, &prod.CreatedAt, &prod.UpdatedAt,
+		&prod.Weight, &prod.AllowBackorder, &prod.LowestPrice30d, &prod.CreatedAt, &prod.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -280,9 +281,9 @@ func (p *Postgres) CreateProduct(ctx context.Context, prod *models.Product) erro
 		INSERT INTO products (
 			id, sku, slug, name, description, price, sale_price, currency, stock,
 			category_id, brand_id, images, attributes, variants, meta_title, meta_description,
-			status, feed_id, external_id, weight, created_at, updated_at
+			status, feed_id, external_id, weight, created_at, updated_at, allow_backorder
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23
 		)
 	`
 
@@ -291,7 +292,7 @@ func (p *Postgres) CreateProduct(ctx context.Context, prod *models.Product) erro
 		prod.Price, prod.SalePrice, prod.Currency, prod.Stock,
 		prod.CategoryID, prod.BrandID, prod.Images, prod.Attributes,
 		prod.Variants, prod.MetaTitle, prod.MetaDesc, prod.Status,
-		prod.FeedID, prod.ExternalID, prod.Weight, prod.CreatedAt, prod.UpdatedAt,
+		prod.FeedID, prod.ExternalID, prod.Weight, prod.CreatedAt, prod.UpdatedAt, prod.AllowBackorder,
 	)
 
 	return err
@@ -306,7 +307,7 @@ func (p *Postgres) UpdateProduct(ctx context.Context, prod *models.Product) erro
 			sku = $2, slug = $3, name = $4, description = $5, price = $6, sale_price = $7,
 			currency = $8, stock = $9, category_id = $10, brand_id = $11, images = $12,
 			attributes = $13, variants = $14, meta_title = $15, meta_description = $16,
-			status = $17, weight = $18, updated_at = $19
+			status = $17, weight = $18, updated_at = $19, allow_backorder = $20
 		WHERE id = $1
 	`
 
@@ -315,7 +316,7 @@ func (p *Postgres) UpdateProduct(ctx context.Context, prod *models.Product) erro
 		prod.Price, prod.SalePrice, prod.Currency, prod.Stock,
 		prod.CategoryID, prod.BrandID, prod.Images, prod.Attributes,
 		prod.Variants, prod.MetaTitle, prod.MetaDesc, prod.Status,
-		prod.Weight, prod.UpdatedAt,
+		prod.Weight, prod.UpdatedAt, prod.AllowBackorder,
 	)
 
 	return err
@@ -469,14 +470,25 @@ func (p *Postgres) CreateOrder(ctx context.Context, order *models.Order) error {
 	}
 	defer tx.Rollback(ctx)
 
+	// Bank transfers are matched by a numeric variable symbol
+	if order.PaymentMethod == "transfer" {
+		var vs int64
+		if err := tx.QueryRow(ctx, "SELECT nextval('order_variable_symbol_seq')").Scan(&vs); err != nil {
+			return fmt.Errorf("next variable symbol: %w", err)
+		}
+		order.VariableSymbol = strconv.FormatInt(vs, 10)
+	}
+
 	// Insert order
 	query := `
 		INSERT INTO orders (
 			id, order_number, user_id, status, payment_status, payment_method,
 			shipping_method, shipping_price, subtotal, tax, total, currency,
-			billing_address, shipping_address, note, created_at, updated_at
+			billing_address, shipping_address, note, variable_symbol, created_at, updated_at,
+			pickup_point_id, pickup_point_name, reserved_until
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, ''), $17, $18,
+			NULLIF($19, ''), NULLIF($20, ''), $21
 		)
 	`
 
@@ -487,34 +499,47 @@ func (p *Postgres) CreateOrder(ctx context.Context, order *models.Order) error {
 		order.ID, order.OrderNumber, order.UserID, order.Status, order.PaymentStatus,
 		order.PaymentMethod, order.ShippingMethod, order.ShippingPrice,
 		order.Subtotal, order.Tax, order.Total, order.Currency,
-		billingJSON, shippingJSON, order.Note, order.CreatedAt, order.UpdatedAt,
+		billingJSON, shippingJSON, order.Note, order.VariableSymbol, order.CreatedAt, order.UpdatedAt,
+		order.PickupPointID, order.PickupPointName, order.ReservedUntil,
 	)
 	if err != nil {
 		return fmt.Errorf("insert order: %w", err)
 	}
 
+	// Take the goods off stock, fails the order when they are not available
+	if err := tagStockChanges(ctx, tx, models.StockSourceOrder, &order.ID, ""); err != nil {
+		return err
+	}
+	if err := reserveStock(ctx, tx, order.Items); err != nil {
+		return err
+	}
+
 	// Insert order items
 	for _, item := range order.Items {
 		item.ID = uuid.New()
 		item.OrderID = order.ID
 
 		itemQuery := `
-			INSERT INTO order_items (id, order_id, product_id, variant_id, sku, name, price, quantity, total)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			INSERT INTO order_items (id, order_id, product_id, variant_id, sku, name, price, quantity, total, backordered)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		`
 		_, err = tx.Exec(ctx, itemQuery,
 			item.ID, item.OrderID, item.ProductID, item.VariantID,
-			item.SKU, item.Name, item.Price, item.Quantity, item.Total,
+			item.SKU, item.Name, item.Price, item.Quantity, item.Total, item.Backordered,
 		)
 		if err != nil {
 			return fmt.Errorf("insert order item: %w", err)
 		}
+	}
 
-		// Decrease stock
-		_, err = tx.Exec(ctx, "UPDATE products SET stock = stock - $1 WHERE id = $2", item.Quantity, item.ProductID)
-		if err != nil {
-			return fmt.Errorf("update stock: %w", err)
-		}
+	err = recordOrderStatus(ctx, tx, order.ID, "", StatusUpdate{
+		Status:    order.Status,
+		ActorType: models.OrderActorCustomer,
+		ActorID:   order.UserID,
+		Note:      "Objednávka vytvorená",
+	})
+	if err != nil {
+		return err
 	}
 
 	return tx.Commit(ctx)
@@ -522,21 +547,25 @@ func (p *Postgres) CreateOrder(ctx context.Context, order *models.Order) error {
 
 func (p *Postgres) GetOrder(ctx context.Context, id uuid.UUID) (*models.Order, error) {
 	query := `
-		SELECT id, order_number, user_id, status, payment_status, payment_method,
-			   shipping_method, shipping_price, subtotal, tax, total, currency,
-			   billing_address, shipping_address, note, tracking_number, invoice_number,
-			   created_at, updated_at, paid_at, shipped_at
+		SELECT id, order_number, user_id, status, payment_status, COALESCE(payment_method, ''),
+			   COALESCE(payment_transaction_id, ''), COALESCE(variable_symbol, ''),
+			   COALESCE(shipping_method, ''), COALESCE(pickup_point_id, ''), COALESCE(pickup_point_name, ''),
+			   shipping_price, subtotal, tax, total, currency,
+			   billing_address, shipping_address, COALESCE(note, ''),
+			   COALESCE(tracking_number, ''), COALESCE(invoice_number, ''),
+			   created_at, updated_at, paid_at, shipped_at, reserved_until
 		FROM orders WHERE id = $1
 	`
 
 	var order models.Order
 	err := p.pool.QueryRow(ctx, query, id).Scan(
 		&order.ID, &order.OrderNumber, &order.UserID, &order.Status, &order.PaymentStatus,
-		&order.PaymentMethod, &order.ShippingMethod, &order.ShippingPrice,
+		&order.PaymentMethod, &order.PaymentTransactionID, &order.VariableSymbol, &order.ShippingMethod,
+		&order.PickupPointID, &order.PickupPointName, &order.ShippingPrice,
 		&order.Subtotal, &order.Tax, &order.Total, &order.Currency,
 		&order.BillingAddress, &order.ShippingAddress, &order.Note,
 		&order.TrackingNumber, &order.InvoiceNumber,
-		&order.CreatedAt, &order.UpdatedAt, &order.PaidAt, &order.ShippedAt,
+		&order.CreatedAt, &order.UpdatedAt, &order.PaidAt, &order.ShippedAt, &order.ReservedUntil,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -547,7 +576,7 @@ func (p *Postgres) GetOrder(ctx context.Context, id uuid.UUID) (*models.Order, e
 
 	// Get items
 	itemsQuery := `
-		SELECT id, order_id, product_id, variant_id, sku, name, price, quantity, total
+		SELECT id, order_id, product_id, variant_id, sku, name, price, quantity, total, backordered
 		FROM order_items WHERE order_id = $1
 	`
 	rows, err := p.pool.Query(ctx, itemsQuery, id)
@@ -560,7 +589,7 @@ func (p *Postgres) GetOrder(ctx context.Context, id uuid.UUID) (*models.Order, e
 		var item models.OrderItem
 		err := rows.Scan(
 			&item.ID, &item.OrderID, &item.ProductID, &item.VariantID,
-			&item.SKU, &item.Name, &item.Price, &item.Quantity, &item.Total,
+			&item.SKU, &item.Name, &item.Price, &item.Quantity, &item.Total, &item.Backordered,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan order item: %w", err)
@@ -949,6 +978,26 @@ func (p *Postgres) Migrate() error {
 		{"001_schema.sql", migration001},
 		{"002_suppliers.sql", migration002},
 		{"003_heureka_export.sql", migration003},
+		{"007_comgate_payments.sql", migration007},
+		{"008_payment_transactions.sql", migration008},
+		{"009_bank_transfer.sql", migration009},
+		{"010_bank_statement_import.sql", migration010},
+		{"011_invoices.sql", migration011},
+		{"012_credit_notes.sql", migration012},
+		{"013_order_status_history.sql", migration013},
+		{"014_email_templates.sql", migration014},
+		{"015_email_outbox.sql", migration015},
+		{"016_packeta_points.sql", migration016},
+		{"017_shipments.sql", migration017},
+		{"018_shipping_rates.sql", migration018},
+		{"019_tracking_events.sql", migration019},
+		{"020_stock_reservations.sql", migration020},
+		{"021_stock_movements.sql", migration021},
+		{"022_supplier_offers.sql", migration022},
+		{"023_pricing_rules.sql", migration023},
+		{"024_price_history.sql", migration024},
+		{"025_supplier_pipeline.sql", migration025},
+		{"026_supplier_item_groups.sql", migration026},
 	}
 
 	for _, m := range migrations {
@@ -0,0 +1,339 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"megashop/internal/models"
+	"megashop/internal/offers"
+	"megashop/internal/pricing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ==================== PRICING RULES ====================
+
+// ErrPricingRuleNotFound is returned when updating or deleting a missing rule
+var ErrPricingRuleNotFound = errors.New("pricing rule not found")
+
+const pricingRuleColumns = `
+	id, name, supplier_id, category_id, brand_id, price_from, price_to,
+	markup_percent, min_margin, fixed_surcharge, cap_at_srp, rounding,
+	priority, is_active, COALESCE(note, ''), created_at, updated_at`
+
+func scanPricingRule(row pgx.Row) (*models.PricingRule, error) {
+	var r models.PricingRule
+	err := row.Scan(&r.ID, &r.Name, &r.SupplierID, &r.CategoryID, &r.BrandID, &r.PriceFrom, &r.PriceTo,
+		&r.MarkupPercent, &r.MinMargin, &r.FixedSurcharge, &r.CapAtSRP, &r.Rounding,
+		&r.Priority, &r.IsActive, &r.Note, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListPricingRules returns all pricing rules, the highest priority first
+func (p *Postgres) ListPricingRules(ctx context.Context) ([]models.PricingRule, error) {
+	rows, err := p.pool.Query(ctx, `SELECT `+pricingRuleColumns+` FROM pricing_rules ORDER BY priority DESC, name`)
+	if err != nil {
+		return nil, fmt.Errorf("list pricing rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.PricingRule{}
+	for rows.Next() {
+		r, err := scanPricingRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan pricing rule: %w", err)
+		}
+		rules = append(rules, *r)
+	}
+	return rules, rows.Err()
+}
+
+// GetPricingRule returns a pricing rule, or nil
+func (p *Postgres) GetPricingRule(ctx context.Context, id uuid.UUID) (*models.PricingRule, error) {
+	r, err := scanPricingRule(p.pool.QueryRow(ctx, `SELECT `+pricingRuleColumns+` FROM pricing_rules WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get pricing rule: %w", err)
+	}
+	return r, nil
+}
+
+// CreatePricingRule stores a new pricing rule
+func (p *Postgres) CreatePricingRule(ctx context.Context, r *models.PricingRule) error {
+	err := p.pool.QueryRow(ctx, `
+		INSERT INTO pricing_rules (name, supplier_id, category_id, brand_id, price_from, price_to,
+			markup_percent, min_margin, fixed_surcharge, cap_at_srp, rounding, priority, is_active, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''))
+		RETURNING id, created_at, updated_at
+	`, r.Name, r.SupplierID, r.CategoryID, r.BrandID, r.PriceFrom, r.PriceTo,
+		r.MarkupPercent, r.MinMargin, r.FixedSurcharge, r.CapAtSRP, r.Rounding, r.Priority, r.IsActive, r.Note,
+	).Scan(&r.ID, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create pricing rule: %w", err)
+	}
+	return nil
+}
+
+// UpdatePricingRule replaces a pricing rule
+func (p *Postgres) UpdatePricingRule(ctx context.Context, r *models.PricingRule) error {
+	err := p.pool.QueryRow(ctx, `
+		UPDATE pricing_rules SET
+			name = $2, supplier_id = $3, category_id = $4, brand_id = $5, price_from = $6, price_to = $7,
+			markup_percent = $8, min_margin = $9, fixed_surcharge = $10, cap_at_srp = $11, rounding = $12,
+			priority = $13, is_active = $14, note = NULLIF($15, ''), updated_at = NOW()
+		WHERE id = $1
+		RETURNING created_at, updated_at
+	`, r.ID, r.Name, r.SupplierID, r.CategoryID, r.BrandID, r.PriceFrom, r.PriceTo,
+		r.MarkupPercent, r.MinMargin, r.FixedSurcharge, r.CapAtSRP, r.Rounding, r.Priority, r.IsActive, r.Note,
+	).Scan(&r.CreatedAt, &r.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPricingRuleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("update pricing rule: %w", err)
+	}
+	return nil
+}
+
+// DeletePricingRule deletes a pricing rule
+func (p *Postgres) DeletePricingRule(ctx context.Context, id uuid.UUID) error {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM pricing_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete pricing rule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPricingRuleNotFound
+	}
+	return nil
+}
+
+// categoryParents maps every subcategory to its parent
+func (p *Postgres) categoryParents(ctx context.Context) (map[uuid.UUID]uuid.UUID, error) {
+	rows, err := p.pool.Query(ctx, `SELECT id, parent_id FROM categories WHERE parent_id IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("query category parents: %w", err)
+	}
+	defer rows.Close()
+
+	parents := make(map[uuid.UUID]uuid.UUID)
+	for rows.Next() {
+		var id, parent uuid.UUID
+		if err := rows.Scan(&id, &parent); err != nil {
+			return nil, fmt.Errorf("scan category parent: %w", err)
+		}
+		parents[id] = parent
+	}
+	return parents, rows.Err()
+}
+
+// PricingEngine loads the pricing engine over the stored rules
+func (p *Postgres) PricingEngine(ctx context.Context) (*pricing.Engine, error) {
+	rules, err := p.ListPricingRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.PricingEngineFor(ctx, rules)
+}
+
+// PricingEngineFor builds a pricing engine over the given rules, e.g. ones
+// not stored yet
+func (p *Postgres) PricingEngineFor(ctx context.Context, rules []models.PricingRule) (*pricing.Engine, error) {
+	parents, err := p.categoryParents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pricing.NewEngine(rules, parents), nil
+}
+
+// PricingPreviewFilter narrows the products of a pricing preview
+type PricingPreviewFilter struct {
+	SupplierID *uuid.UUID // products with an offer from the supplier
+	CategoryID *uuid.UUID // includes subcategories
+	BrandID    *uuid.UUID
+	Limit      int // changes returned, the summary counts all
+}
+
+// PricingPreview is what refreshing the offers would do to product prices
+type PricingPreview struct {
+	Checked   int                  `json:"checked"`
+	Changed   int                  `json:"changed"`
+	Increased int                  `json:"increased"`
+	Decreased int                  `json:"decreased"`
+	NoRule    int                  `json:"no_rule"` // priced from the supplier's price with VAT
+	Changes   []models.PriceChange `json:"changes"`
+}
+
+// PreviewPricing computes the prices RefreshOffers would set with sel,
+// without changing anything
+func (p *Postgres) PreviewPricing(ctx context.Context, filter PricingPreviewFilter, sel *OfferSelection) (*PricingPreview, error) {
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 200
+	}
+
+	rows, err := p.pool.Query(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT id FROM categories WHERE id = $2
+			UNION ALL
+			SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+		)
+		SELECT p.id, COALESCE(p.sku, ''), p.name, p.price, p.sale_price, p.category_id, p.brand_id,
+			   sp.id, s.id, s.code, s.name, COALESCE(s.is_active, true), COALESCE(s.priority, 0),
+			   sp.external_id, COALESCE(sp.ean, ''), COALESCE(sp.price_net, 0), COALESCE(sp.price_vat, 0),
+			   COALESCE(sp.vat_rate, 0), COALESCE(sp.srp, 0),
+			   COALESCE(sp.stock, 0), COALESCE(sp.shipping_time_hours, 0), sp.updated_at
+		FROM products p
+		JOIN supplier_products sp ON sp.linked_product_id = p.id
+		JOIN suppliers s ON s.id = sp.supplier_id
+		WHERE ($1::uuid IS NULL OR p.id IN (SELECT linked_product_id FROM supplier_products WHERE supplier_id = $1))
+		  AND ($2::uuid IS NULL OR p.category_id IN (SELECT id FROM tree))
+		  AND ($3::uuid IS NULL OR p.brand_id = $3)
+		ORDER BY p.id, s.priority DESC, s.name, sp.external_id
+	`, filter.SupplierID, filter.CategoryID, filter.BrandID)
+	if err != nil {
+		return nil, fmt.Errorf("query pricing preview: %w", err)
+	}
+	defer rows.Close()
+
+	type product struct {
+		change     models.PriceChange
+		categoryID *uuid.UUID
+		brandID    *uuid.UUID
+		offers     []models.SupplierOffer
+	}
+	preview := &PricingPreview{Changes: []models.PriceChange{}}
+	var cur *product
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		preview.add(cur.change, cur.offers, cur.categoryID, cur.brandID, sel, filter.Limit)
+	}
+
+	for rows.Next() {
+		var pr product
+		var o models.SupplierOffer
+		err := rows.Scan(&pr.change.ProductID, &pr.change.SKU, &pr.change.Name, &pr.change.OldPrice, &pr.change.OldSalePrice,
+			&pr.categoryID, &pr.brandID,
+			&o.ID, &o.SupplierID, &o.SupplierCode, &o.SupplierName, &o.SupplierActive, &o.Priority,
+			&o.ExternalID, &o.EAN, &o.PriceNet, &o.PriceVAT, &o.VATRate, &o.SRP, &o.Stock, &o.ShippingTimeHours, &o.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan pricing preview: %w", err)
+		}
+		if cur == nil || cur.change.ProductID != pr.change.ProductID {
+			flush()
+			cur = &pr
+		}
+		cur.offers = append(cur.offers, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query pricing preview: %w", err)
+	}
+	flush()
+	return preview, nil
+}
+
+// add prices a product the way RefreshProductOffer would and records the
+// change, if any
+func (pp *PricingPreview) add(change models.PriceChange, list []models.SupplierOffer, categoryID, brandID *uuid.UUID, sel *OfferSelection, limit int) {
+	i := offers.Select(list, sel.Rules)
+	if i < 0 {
+		return
+	}
+	pp.Checked++
+
+	best := list[i]
+	price, salePrice, res := sel.price(best, categoryID, brandID)
+	if res == nil {
+		pp.NoRule++
+	}
+	if price <= 0 {
+		return // RefreshProductOffer keeps the price
+	}
+
+	oldSelling := change.OldPrice
+	if change.OldSalePrice != nil {
+		oldSelling = *change.OldSalePrice
+	}
+	newSelling := price
+	if salePrice != nil {
+		newSelling = *salePrice
+	}
+	if price == change.OldPrice && floatPtrEqual(salePrice, change.OldSalePrice) {
+		return
+	}
+
+	pp.Changed++
+	switch {
+	case newSelling > oldSelling:
+		pp.Increased++
+	case newSelling < oldSelling:
+		pp.Decreased++
+	}
+	if len(pp.Changes) >= limit {
+		return
+	}
+
+	change.SupplierCode = best.SupplierCode
+	change.NewPrice = price
+	change.NewSalePrice = salePrice
+	if res != nil {
+		change.PurchasePrice = res.PurchasePrice
+		change.Margin = res.Margin
+		change.RuleID = &res.Rule.ID
+		change.RuleName = res.Rule.Name
+		change.CappedBySRP = res.CappedBySRP
+		change.BelowMinMargin = res.BelowMinMargin
+	} else {
+		change.PurchasePrice = best.PriceNet
+	}
+	pp.Changes = append(pp.Changes, change)
+}
+
+func floatPtrEqual(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// ==================== PRICE HISTORY ====================
+
+// ListPriceHistory returns the price changes of a product since the given
+// time, oldest first, starting with the price in effect at that time
+func (p *Postgres) ListPriceHistory(ctx context.Context, productID uuid.UUID, since time.Time) ([]models.PricePoint, error) {
+	rows, err := p.pool.Query(ctx, `
+		(SELECT price, sale_price, created_at FROM price_history
+		 WHERE product_id = $1 AND created_at < $2
+		 ORDER BY created_at DESC LIMIT 1)
+		UNION ALL
+		(SELECT price, sale_price, created_at FROM price_history
+		 WHERE product_id = $1 AND created_at >= $2)
+		ORDER BY created_at
+	`, productID, since)
+	if err != nil {
+		return nil, fmt.Errorf("list price history: %w", err)
+	}
+	defer rows.Close()
+
+	points := []models.PricePoint{}
+	for rows.Next() {
+		var pt models.PricePoint
+		if err := rows.Scan(&pt.Price, &pt.SalePrice, &pt.ChangedAt); err != nil {
+			return nil, fmt.Errorf("scan price history: %w", err)
+		}
+		pt.Effective = pt.Price
+		if pt.SalePrice != nil {
+			pt.Effective = *pt.SalePrice
+		}
+		points = append(points, pt)
+	}
+	return points, rows.Err()
+}
@@ -0,0 +1,684 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"megashop/internal/models"
+	"megashop/internal/shipping"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ==================== PACKETA PICKUP POINTS ====================
+
+// SyncPacketaPoints upserts the branch feed into packeta_points in one
+// transaction. Points missing from the feed are deactivated, not deleted,
+// so orders keep a readable pickup point.
+func (p *Postgres) SyncPacketaPoints(ctx context.Context, points []models.PacketaPoint) (int, error) {
+	if len(points) == 0 {
+		return 0, fmt.Errorf("sync packeta points: empty feed")
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	syncedAt := time.Now()
+	batchSize := 1000
+	for i := 0; i < len(points); i += batchSize {
+		end := i + batchSize
+		if end > len(points) {
+			end = len(points)
+		}
+
+		b := &pgx.Batch{}
+		for _, pt := range points[i:end] {
+			hours, _ := json.Marshal(pt.OpeningHours)
+			b.Queue(`
+				INSERT INTO packeta_points (
+					id, name, place, street, city, zip, country, type, latitude, longitude,
+					directions, url, photo, max_weight, opening_hours, search_text, is_active, synced_at
+				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, true, $17)
+				ON CONFLICT (id) DO UPDATE SET
+					name = EXCLUDED.name,
+					place = EXCLUDED.place,
+					street = EXCLUDED.street,
+					city = EXCLUDED.city,
+					zip = EXCLUDED.zip,
+					country = EXCLUDED.country,
+					type = EXCLUDED.type,
+					latitude = EXCLUDED.latitude,
+					longitude = EXCLUDED.longitude,
+					directions = EXCLUDED.directions,
+					url = EXCLUDED.url,
+					photo = EXCLUDED.photo,
+					max_weight = EXCLUDED.max_weight,
+					opening_hours = EXCLUDED.opening_hours,
+					search_text = EXCLUDED.search_text,
+					is_active = true,
+					synced_at = EXCLUDED.synced_at
+			`, pt.ID, pt.Name, pt.Place, pt.Street, pt.City, pt.Zip, pt.Country, pt.Type,
+				pt.Latitude, pt.Longitude, pt.Directions, pt.URL, pt.Photo, pt.MaxWeight,
+				hours, packetaSearchText(pt), syncedAt)
+		}
+
+		br := tx.SendBatch(ctx, b)
+		for range points[i:end] {
+			if _, err := br.Exec(); err != nil {
+				br.Close()
+				return 0, fmt.Errorf("upsert packeta point: %w", err)
+			}
+		}
+		br.Close()
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE packeta_points SET is_active = false WHERE synced_at < $1 AND is_active`, syncedAt)
+	if err != nil {
+		return 0, fmt.Errorf("deactivate packeta points: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit packeta sync: %w", err)
+	}
+	return len(points), nil
+}
+
+func packetaSearchText(pt models.PacketaPoint) string {
+	return shipping.FoldText(strings.Join([]string{pt.Name, pt.Place, pt.Street, pt.City, pt.Zip}, " "))
+}
+
+// SearchPacketaPoints returns active pickup points matching the filter,
+// nearest first when coordinates are given, else by city and name
+func (p *Postgres) SearchPacketaPoints(ctx context.Context, filter models.PacketaPointFilter) ([]models.PacketaPoint, error) {
+	var conditions []string
+	var args []interface{}
+	argNum := 1
+
+	conditions = append(conditions, "is_active")
+
+	if filter.Country != "" {
+		conditions = append(conditions, fmt.Sprintf("country = $%d", argNum))
+		args = append(args, strings.ToLower(filter.Country))
+		argNum++
+	}
+
+	if filter.Type != "" {
+		conditions = append(conditions, fmt.Sprintf("type = $%d", argNum))
+		args = append(args, filter.Type)
+		argNum++
+	}
+
+	if zip := shipping.NormalizeZip(filter.Zip); zip != "" {
+		conditions = append(conditions, fmt.Sprintf("zip LIKE $%d", argNum))
+		args = append(args, zip+"%")
+		argNum++
+	}
+
+	if city := shipping.FoldText(filter.City); city != "" {
+		conditions = append(conditions, fmt.Sprintf("search_text LIKE $%d", argNum))
+		args = append(args, "%"+city+"%")
+		argNum++
+	}
+
+	// Every word must match somewhere
+	for _, word := range strings.Fields(shipping.FoldText(filter.Query)) {
+		conditions = append(conditions, fmt.Sprintf("search_text LIKE $%d", argNum))
+		args = append(args, "%"+word+"%")
+		argNum++
+	}
+
+	distance := "NULL::float8"
+	orderBy := "city, name"
+	if filter.Latitude != nil && filter.Longitude != nil {
+		// Haversine distance in km
+		distance = fmt.Sprintf(`6371 * 2 * asin(sqrt(
+			power(sin(radians(latitude - $%d) / 2), 2) +
+			cos(radians($%d)) * cos(radians(latitude)) * power(sin(radians(longitude - $%d) / 2), 2)
+		))`, argNum, argNum, argNum+1)
+		args = append(args, *filter.Latitude, *filter.Longitude)
+		argNum += 2
+		conditions = append(conditions, "latitude <> 0")
+		orderBy = "distance"
+	}
+
+	limit := filter.Limit
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s AS distance
+		FROM packeta_points
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d
+	`, packetaPointColumns, distance, strings.Join(conditions, " AND "), orderBy, argNum)
+
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search packeta points: %w", err)
+	}
+	defer rows.Close()
+
+	points := []models.PacketaPoint{}
+	for rows.Next() {
+		pt, err := scanPacketaPoint(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, *pt)
+	}
+	return points, rows.Err()
+}
+
+// GetPacketaPoint returns a pickup point by Packeta ID (also an inactive one), or nil
+func (p *Postgres) GetPacketaPoint(ctx context.Context, id string) (*models.PacketaPoint, error) {
+	row := p.pool.QueryRow(ctx, `SELECT `+packetaPointColumns+` FROM packeta_points WHERE id = $1`, id)
+	pt, err := scanPacketaPoint(row, false)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return pt, err
+}
+
+// PacketaPointStats returns the number of active points and the last sync time
+func (p *Postgres) PacketaPointStats(ctx context.Context) (int, *time.Time, error) {
+	var count int
+	var lastSync *time.Time
+	err := p.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE is_active), MAX(synced_at) FROM packeta_points
+	`).Scan(&count, &lastSync)
+	if err != nil {
+		return 0, nil, fmt.Errorf("packeta point stats: %w", err)
+	}
+	return count, lastSync, nil
+}
+
+const packetaPointColumns = `
+	id, name, COALESCE(place, ''), COALESCE(street, ''), COALESCE(city, ''), COALESCE(zip, ''),
+	country, type, latitude, longitude, COALESCE(directions, ''), COALESCE(url, ''), COALESCE(photo, ''),
+	max_weight, opening_hours, is_active, synced_at
+`
+
+func scanPacketaPoint(row pgx.Row, withDistance bool) (*models.PacketaPoint, error) {
+	var pt models.PacketaPoint
+	var hours []byte
+	dest := []interface{}{
+		&pt.ID, &pt.Name, &pt.Place, &pt.Street, &pt.City, &pt.Zip,
+		&pt.Country, &pt.Type, &pt.Latitude, &pt.Longitude, &pt.Directions, &pt.URL, &pt.Photo,
+		&pt.MaxWeight, &hours, &pt.IsActive, &pt.SyncedAt,
+	}
+	if withDistance {
+		dest = append(dest, &pt.Distance)
+	}
+	if err := row.Scan(dest...); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan packeta point: %w", err)
+	}
+	json.Unmarshal(hours, &pt.OpeningHours)
+	return &pt, nil
+}
+
+// ==================== SHIPPING METHODS ====================
+
+// GetShippingMethod returns a shipping method with its carrier config, or nil
+func (p *Postgres) GetShippingMethod(ctx context.Context, code string) (*models.ShippingMethod, error) {
+	var m models.ShippingMethod
+	err := p.pool.QueryRow(ctx, `
+		SELECT id, code, name, COALESCE(description, ''), price, COALESCE(free_from, 0), is_active, COALESCE(config, '{}')
+		FROM shipping_methods WHERE code = $1
+	`, code).Scan(&m.ID, &m.Code, &m.Name, &m.Description, &m.Price, &m.FreeFrom, &m.IsActive, &m.Config)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get shipping method: %w", err)
+	}
+	return &m, nil
+}
+
+// ShippingRateTables returns all shipping methods with their rates and rules
+func (p *Postgres) ShippingRateTables(ctx context.Context) ([]models.ShippingMethod, []models.ShippingRate, []models.ShippingRule, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, code, name, COALESCE(description, ''), price, COALESCE(free_from, 0), is_active, COALESCE(config, '{}')
+		FROM shipping_methods ORDER BY price, code
+	`)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("query shipping methods: %w", err)
+	}
+	var methods []models.ShippingMethod
+	for rows.Next() {
+		var m models.ShippingMethod
+		if err := rows.Scan(&m.ID, &m.Code, &m.Name, &m.Description, &m.Price, &m.FreeFrom, &m.IsActive, &m.Config); err != nil {
+			rows.Close()
+			return nil, nil, nil, fmt.Errorf("scan shipping method: %w", err)
+		}
+		methods = append(methods, m)
+	}
+	rows.Close()
+
+	rates, err := p.queryShippingRates(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rules, err := p.queryShippingRules(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return methods, rates, rules, nil
+}
+
+// ShippingRateEngine loads the rate engine used by checkout and the feeds
+func (p *Postgres) ShippingRateEngine(ctx context.Context) (*shipping.RateEngine, error) {
+	methods, rates, rules, err := p.ShippingRateTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return shipping.NewRateEngine(methods, rates, rules), nil
+}
+
+// ShippingRateItems adds the weight, category and supplier size flags of
+// the ordered products
+func (p *Postgres) ShippingRateItems(ctx context.Context, items []models.OrderItem) ([]shipping.RateItem, error) {
+	ids := make([]uuid.UUID, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, it.ProductID)
+	}
+
+	rows, err := p.pool.Query(ctx, `
+		SELECT p.id, p.category_id, COALESCE(p.weight, 0),
+		       COALESCE(bool_or(sp.is_large), false), COALESCE(bool_or(sp.small_pallet), false)
+		FROM products p
+		LEFT JOIN supplier_products sp ON sp.linked_product_id = p.id OR sp.product_id = p.id
+		WHERE p.id = ANY($1)
+		GROUP BY p.id
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("query rate items: %w", err)
+	}
+	defer rows.Close()
+
+	products := make(map[uuid.UUID]shipping.RateItem)
+	for rows.Next() {
+		var it shipping.RateItem
+		if err := rows.Scan(&it.ProductID, &it.CategoryID, &it.Weight, &it.IsLarge, &it.SmallPallet); err != nil {
+			return nil, fmt.Errorf("scan rate item: %w", err)
+		}
+		products[it.ProductID] = it
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]shipping.RateItem, 0, len(items))
+	for _, oi := range items {
+		it, ok := products[oi.ProductID]
+		if !ok {
+			it = shipping.RateItem{ProductID: oi.ProductID}
+		}
+		it.Quantity = oi.Quantity
+		result = append(result, it)
+	}
+	return result, nil
+}
+
+// ReplaceShippingRates replaces the rates and rules of a shipping method
+func (p *Postgres) ReplaceShippingRates(ctx context.Context, code string, rates []models.ShippingRate, rules []models.ShippingRule) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM shipping_rates WHERE method_code = $1`, code); err != nil {
+		return fmt.Errorf("delete shipping rates: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM shipping_rules WHERE method_code = $1`, code); err != nil {
+		return fmt.Errorf("delete shipping rules: %w", err)
+	}
+
+	batch := &pgx.Batch{}
+	for _, r := range rates {
+		batch.Queue(`
+			INSERT INTO shipping_rates (method_code, country, weight_from, weight_to, price, free_from)
+			VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)
+		`, code, r.Country, r.WeightFrom, r.WeightTo, r.Price, r.FreeFrom)
+	}
+	for _, r := range rules {
+		batch.Queue(`
+			INSERT INTO shipping_rules (method_code, action, condition, value, country, amount, is_active, note)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, NULLIF($8, ''))
+		`, code, r.Action, r.Condition, r.Value, r.Country, r.Amount, r.IsActive, r.Note)
+	}
+	if batch.Len() > 0 {
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("insert shipping rates: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit shipping rates: %w", err)
+	}
+	return nil
+}
+
+func (p *Postgres) queryShippingRates(ctx context.Context) ([]models.ShippingRate, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, method_code, COALESCE(country, ''), weight_from, weight_to, price, free_from
+		FROM shipping_rates
+		ORDER BY method_code, country NULLS FIRST, weight_from
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query shipping rates: %w", err)
+	}
+	defer rows.Close()
+
+	var rates []models.ShippingRate
+	for rows.Next() {
+		var r models.ShippingRate
+		if err := rows.Scan(&r.ID, &r.MethodCode, &r.Country, &r.WeightFrom, &r.WeightTo, &r.Price, &r.FreeFrom); err != nil {
+			return nil, fmt.Errorf("scan shipping rate: %w", err)
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+func (p *Postgres) queryShippingRules(ctx context.Context) ([]models.ShippingRule, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, method_code, action, condition, value, COALESCE(country, ''), amount, is_active, COALESCE(note, '')
+		FROM shipping_rules
+		ORDER BY method_code, created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query shipping rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []models.ShippingRule
+	for rows.Next() {
+		var r models.ShippingRule
+		if err := rows.Scan(&r.ID, &r.MethodCode, &r.Action, &r.Condition, &r.Value, &r.Country, &r.Amount, &r.IsActive, &r.Note); err != nil {
+			return nil, fmt.Errorf("scan shipping rule: %w", err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// ==================== SHIPMENTS ====================
+
+// ErrShipmentExists is returned when the order already has a live shipment
+var ErrShipmentExists = errors.New("order already has a shipment")
+
+// OrderWeight returns the weight of the order's products in kg (0 when unknown)
+func (p *Postgres) OrderWeight(ctx context.Context, orderID uuid.UUID) (float64, error) {
+	var weight float64
+	err := p.pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(COALESCE(pr.weight, 0) * oi.quantity), 0)
+		FROM order_items oi
+		LEFT JOIN products pr ON pr.id = oi.product_id
+		WHERE oi.order_id = $1
+	`, orderID).Scan(&weight)
+	if err != nil {
+		return 0, fmt.Errorf("order weight: %w", err)
+	}
+	return weight, nil
+}
+
+// CreateShipment stores a parcel registered with the carrier and puts its
+// tracking number on the order
+func (p *Postgres) CreateShipment(ctx context.Context, s *models.Shipment) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO shipments (
+			order_id, carrier, packet_id, tracking_number, status, pickup_point_id,
+			value, cod_amount, weight, label_path, created_by
+		) VALUES ($1, $2, $3, $4, 'created', NULLIF($5, ''), $6, $7, $8, NULLIF($9, ''), $10)
+		RETURNING id, status, created_at
+	`, s.OrderID, s.Carrier, s.PacketID, s.TrackingNumber, s.PickupPointID,
+		s.Value, s.CODAmount, s.Weight, s.LabelPath, s.CreatedBy,
+	).Scan(&s.ID, &s.Status, &s.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrShipmentExists
+		}
+		return fmt.Errorf("insert shipment: %w", err)
+	}
+
+	if s.TrackingNumber != "" {
+		_, err = tx.Exec(ctx, `UPDATE orders SET tracking_number = $2, updated_at = NOW() WHERE id = $1`, s.OrderID, s.TrackingNumber)
+		if err != nil {
+			return fmt.Errorf("set tracking number: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit shipment: %w", err)
+	}
+	return nil
+}
+
+// SetShipmentLabel remembers where the label PDF is stored
+func (p *Postgres) SetShipmentLabel(ctx context.Context, id uuid.UUID, path string) error {
+	_, err := p.pool.Exec(ctx, `UPDATE shipments SET label_path = $2 WHERE id = $1`, id, path)
+	if err != nil {
+		return fmt.Errorf("set shipment label: %w", err)
+	}
+	return nil
+}
+
+// GetActiveShipment returns the order's live shipment, or nil
+func (p *Postgres) GetActiveShipment(ctx context.Context, orderID uuid.UUID) (*models.Shipment, error) {
+	shipments, err := p.queryShipments(ctx, `WHERE s.order_id = $1 AND s.status = 'created'`, orderID)
+	if err != nil || len(shipments) == 0 {
+		return nil, err
+	}
+	return &shipments[0], nil
+}
+
+// ListOrderShipments returns all shipments of an order, cancelled ones included
+func (p *Postgres) ListOrderShipments(ctx context.Context, orderID uuid.UUID) ([]models.Shipment, error) {
+	return p.queryShipments(ctx, `WHERE s.order_id = $1 ORDER BY s.created_at`, orderID)
+}
+
+// CancelShipment marks the shipment cancelled and removes its tracking
+// number from the order
+func (p *Postgres) CancelShipment(ctx context.Context, s *models.Shipment) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		UPDATE shipments SET status = 'cancelled', cancelled_at = NOW()
+		WHERE id = $1
+		RETURNING status, cancelled_at
+	`, s.ID).Scan(&s.Status, &s.CancelledAt)
+	if err != nil {
+		return fmt.Errorf("cancel shipment: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE orders SET tracking_number = NULL, updated_at = NOW()
+		WHERE id = $1 AND tracking_number = $2
+	`, s.OrderID, s.TrackingNumber)
+	if err != nil {
+		return fmt.Errorf("clear tracking number: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit shipment cancel: %w", err)
+	}
+	return nil
+}
+
+const shipmentColumns = `
+	s.id, s.order_id, o.order_number, s.carrier, s.packet_id, s.tracking_number, s.status,
+	COALESCE(s.pickup_point_id, ''), s.value, s.cod_amount, s.weight, COALESCE(s.label_path, ''),
+	s.created_by, s.created_at, s.cancelled_at
+`
+
+func (p *Postgres) queryShipments(ctx context.Context, where string, args ...interface{}) ([]models.Shipment, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+shipmentColumns+`
+		FROM shipments s
+		JOIN orders o ON o.id = s.order_id
+		`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query shipments: %w", err)
+	}
+	defer rows.Close()
+
+	var shipments []models.Shipment
+	for rows.Next() {
+		var s models.Shipment
+		err := rows.Scan(&s.ID, &s.OrderID, &s.OrderNumber, &s.Carrier, &s.PacketID, &s.TrackingNumber, &s.Status,
+			&s.PickupPointID, &s.Value, &s.CODAmount, &s.Weight, &s.LabelPath,
+			&s.CreatedBy, &s.CreatedAt, &s.CancelledAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan shipment: %w", err)
+		}
+		shipments = append(shipments, s)
+	}
+	return shipments, rows.Err()
+}
+
+// ==================== TRACKING ====================
+
+// ListTrackedParcels returns parcels of shipped orders not checked within
+// recheck, least recently checked first. Orders shipped more than maxAge
+// ago are given up on.
+func (p *Postgres) ListTrackedParcels(ctx context.Context, recheck, maxAge time.Duration, limit int) ([]models.TrackedParcel, error) {
+	return p.queryTrackedParcels(ctx, `
+		AND o.status = 'shipped'
+		AND (o.tracking_checked_at IS NULL OR o.tracking_checked_at < $1)
+		AND COALESCE(o.shipped_at, o.updated_at) > $2
+		ORDER BY o.tracking_checked_at NULLS FIRST
+		LIMIT $3
+	`, time.Now().Add(-recheck), time.Now().Add(-maxAge), limit)
+}
+
+// GetTrackedParcel returns the parcel of an order, or nil if it has no tracking number
+func (p *Postgres) GetTrackedParcel(ctx context.Context, orderID uuid.UUID) (*models.TrackedParcel, error) {
+	parcels, err := p.queryTrackedParcels(ctx, `AND o.id = $1`, orderID)
+	if err != nil || len(parcels) == 0 {
+		return nil, err
+	}
+	return &parcels[0], nil
+}
+
+// queryTrackedParcels returns orders with a tracking number, filtered by cond
+func (p *Postgres) queryTrackedParcels(ctx context.Context, cond string, args ...interface{}) ([]models.TrackedParcel, error) {
+	// Tracking numbers typed in by staff have no shipment row
+	rows, err := p.pool.Query(ctx, `
+		SELECT o.id, o.order_number, COALESCE(s.carrier, o.shipping_method),
+		       COALESCE(s.packet_id, o.tracking_number), o.tracking_number
+		FROM orders o
+		LEFT JOIN shipments s ON s.order_id = o.id AND s.status = 'created'
+		WHERE COALESCE(o.tracking_number, '') <> ''
+		`+cond, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query tracked parcels: %w", err)
+	}
+	defer rows.Close()
+
+	var parcels []models.TrackedParcel
+	for rows.Next() {
+		var tp models.TrackedParcel
+		if err := rows.Scan(&tp.OrderID, &tp.OrderNumber, &tp.Carrier, &tp.ParcelID, &tp.TrackingNumber); err != nil {
+			return nil, fmt.Errorf("scan tracked parcel: %w", err)
+		}
+		parcels = append(parcels, tp)
+	}
+	return parcels, rows.Err()
+}
+
+// SaveTrackingEvents stores new scans of the parcel and its latest state on
+// the order. trackErr is remembered when the carrier could not be asked.
+// Returns the number of new events.
+func (p *Postgres) SaveTrackingEvents(ctx context.Context, parcel models.TrackedParcel, events []models.TrackingEvent, trackErr string) (int, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	added := 0
+	for _, e := range events {
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO tracking_events (order_id, carrier, tracking_number, event_time, status, code, description, location)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+			ON CONFLICT (order_id, tracking_number, event_time, code) DO NOTHING
+		`, parcel.OrderID, parcel.Carrier, parcel.TrackingNumber, e.Time, e.Status, e.Code, e.Description, e.Location)
+		if err != nil {
+			return 0, fmt.Errorf("insert tracking event: %w", err)
+		}
+		added += int(tag.RowsAffected())
+	}
+
+	// The latest scan by time, not by arrival, is the state of the parcel
+	_, err = tx.Exec(ctx, `
+		UPDATE orders SET
+			tracking_status = COALESCE((
+				SELECT status FROM tracking_events
+				WHERE order_id = $1 AND tracking_number = $2
+				ORDER BY event_time DESC, created_at DESC LIMIT 1
+			), tracking_status),
+			tracking_checked_at = NOW(),
+			tracking_error = NULLIF($3, '')
+		WHERE id = $1
+	`, parcel.OrderID, parcel.TrackingNumber, trackErr)
+	if err != nil {
+		return 0, fmt.Errorf("update tracking status: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit tracking events: %w", err)
+	}
+	return added, nil
+}
+
+// ListTrackingEvents returns the scans of the order's current tracking number, oldest first
+func (p *Postgres) ListTrackingEvents(ctx context.Context, orderID uuid.UUID) ([]models.TrackingEvent, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT e.event_time, e.status, e.code, e.description, COALESCE(e.location, '')
+		FROM tracking_events e
+		JOIN orders o ON o.id = e.order_id AND o.tracking_number = e.tracking_number
+		WHERE e.order_id = $1
+		ORDER BY e.event_time, e.created_at
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("query tracking events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.TrackingEvent{}
+	for rows.Next() {
+		var e models.TrackingEvent
+		if err := rows.Scan(&e.Time, &e.Status, &e.Code, &e.Description, &e.Location); err != nil {
+			return nil, fmt.Errorf("scan tracking event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,406 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ==================== STOCK RESERVATION ====================
+
+// StockShortage is an ordered product that is not on stock and cannot be backordered
+type StockShortage struct {
+	ProductID uuid.UUID `json:"product_id"`
+	SKU       string    `json:"sku"`
+	Name      string    `json:"name"`
+	Requested int       `json:"requested"`
+	Available int       `json:"available"`
+}
+
+// InsufficientStockError is returned by CreateOrder when some items cannot be reserved
+type InsufficientStockError struct {
+	Items []StockShortage
+}
+
+func (e *InsufficientStockError) Error() string {
+	parts := make([]string, 0, len(e.Items))
+	for _, s := range e.Items {
+		name := s.Name
+		if name == "" {
+			name = s.ProductID.String()
+		}
+		parts = append(parts, fmt.Sprintf("%s (requested %d, available %d)", name, s.Requested, s.Available))
+	}
+	return "insufficient stock: " + strings.Join(parts, ", ")
+}
+
+// reserveStock takes the items off stock inside tx. The product rows are
+// locked first, so concurrent checkouts cannot both take the last piece.
+// Products that allow backorders (their own flag, or any of their suppliers
+// when the product has none) may go below zero; the pieces over the stock
+// are recorded in the items' Backordered. Fails with InsufficientStockError
+// listing every item that cannot be reserved.
+func reserveStock(ctx context.Context, tx pgx.Tx, items []models.OrderItem) error {
+	requested := make(map[uuid.UUID]int)
+	var ids []uuid.UUID
+	for _, item := range items {
+		if _, ok := requested[item.ProductID]; !ok {
+			ids = append(ids, item.ProductID)
+		}
+		requested[item.ProductID] += item.Quantity
+	}
+
+	type stockRow struct {
+		stock     int
+		backorder bool
+	}
+	// Lock in a fixed order, two carts with the same products must not deadlock
+	rows, err := tx.Query(ctx, `
+		SELECT p.id, p.stock, COALESCE(p.allow_backorder, EXISTS (
+			SELECT 1 FROM supplier_products sp
+			JOIN suppliers s ON s.id = sp.supplier_id
+			WHERE (sp.linked_product_id = p.id OR sp.product_id = p.id) AND s.allow_backorder
+		))
+		FROM products p
+		WHERE p.id = ANY($1)
+		ORDER BY p.id
+		FOR UPDATE OF p
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("lock stock: %w", err)
+	}
+	stock := make(map[uuid.UUID]stockRow)
+	for rows.Next() {
+		var id uuid.UUID
+		var r stockRow
+		if err := rows.Scan(&id, &r.stock, &r.backorder); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan stock: %w", err)
+		}
+		stock[id] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("lock stock: %w", err)
+	}
+
+	// Check everything first so the customer sees all problems at once
+	var shortages []StockShortage
+	reported := make(map[uuid.UUID]bool)
+	for _, item := range items {
+		r, found := stock[item.ProductID]
+		available := r.stock
+		if available < 0 {
+			available = 0
+		}
+		if found && (r.backorder || requested[item.ProductID] <= available) {
+			continue
+		}
+		if reported[item.ProductID] {
+			continue
+		}
+		reported[item.ProductID] = true
+		shortages = append(shortages, StockShortage{
+			ProductID: item.ProductID,
+			SKU:       item.SKU,
+			Name:      item.Name,
+			Requested: requested[item.ProductID],
+			Available: available,
+		})
+	}
+	if len(shortages) > 0 {
+		return &InsufficientStockError{Items: shortages}
+	}
+
+	// Items of one product take the remaining stock in order
+	remaining := make(map[uuid.UUID]int)
+	for id, r := range stock {
+		if r.stock > 0 {
+			remaining[id] = r.stock
+		}
+	}
+	for i := range items {
+		item := &items[i]
+		take := item.Quantity
+		if take > remaining[item.ProductID] {
+			take = remaining[item.ProductID]
+		}
+		remaining[item.ProductID] -= take
+		item.Backordered = item.Quantity - take
+	}
+
+	batch := &pgx.Batch{}
+	for _, id := range ids {
+		batch.Queue(`UPDATE products SET stock = stock - $1, updated_at = NOW() WHERE id = $2`, requested[id], id)
+	}
+	br := tx.SendBatch(ctx, batch)
+	for range ids {
+		if _, err := br.Exec(); err != nil {
+			br.Close()
+			return fmt.Errorf("reserve stock: %w", err)
+		}
+	}
+	if err := br.Close(); err != nil {
+		return fmt.Errorf("reserve stock: %w", err)
+	}
+	return nil
+}
+
+// reservedQuantity returns the pieces of a product held by open orders.
+// They are already off the product's stock, so writers of supplier stock
+// store the supplier's stock less these; the caller locks the product row
+// first so no checkout reserves in between.
+func reservedQuantity(ctx context.Context, tx pgx.Tx, productID uuid.UUID) (int, error) {
+	var reserved int
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(oi.quantity), 0)::int
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		WHERE oi.product_id = $1 AND o.status IN ('pending', 'paid', 'processing')
+	`, productID).Scan(&reserved)
+	if err != nil {
+		return 0, fmt.Errorf("get reserved stock: %w", err)
+	}
+	return reserved, nil
+}
+
+// ListExpiredReservations returns pending, unpaid orders whose reservation
+// ran out, oldest first
+func (p *Postgres) ListExpiredReservations(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT id FROM orders
+		WHERE status = 'pending' AND reserved_until < NOW()
+		  AND COALESCE(payment_status, '') NOT IN ('paid', 'partially_refunded', 'refunded')
+		ORDER BY reserved_until
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list expired reservations: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan expired reservation: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ExpireReservation cancels the order, returning its goods to stock, if it
+// is still pending, unpaid and past its reservation. A payment arriving in
+// the meantime wins. Reports whether the order was cancelled.
+func (p *Postgres) ExpireReservation(ctx context.Context, orderID uuid.UUID, note string) (bool, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var expired bool
+	err = tx.QueryRow(ctx, `
+		SELECT status = 'pending' AND COALESCE(reserved_until < NOW(), false)
+		   AND COALESCE(payment_status, '') NOT IN ('paid', 'partially_refunded', 'refunded')
+		FROM orders WHERE id = $1 FOR UPDATE
+	`, orderID).Scan(&expired)
+	if err == pgx.ErrNoRows {
+		return false, ErrOrderNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("lock order: %w", err)
+	}
+	if !expired {
+		return false, nil
+	}
+
+	err = changeOrderStatus(ctx, tx, orderID, models.OrderStatusPending, StatusUpdate{
+		Status:    models.OrderStatusCancelled,
+		ActorType: models.OrderActorSystem,
+		Note:      note,
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit expiry: %w", err)
+	}
+	return true, nil
+}
+
+// ==================== STOCK MOVEMENTS ====================
+
+// ErrProductNotFound is returned by AdjustStock for unknown products
+var ErrProductNotFound = errors.New("product not found")
+
+// tagStockChanges names the source of the stock changes made by tx. The
+// stock_movements trigger reads it; untagged changes are recorded as manual.
+func tagStockChanges(ctx context.Context, tx pgx.Tx, source string, referenceID *uuid.UUID, note string) error {
+	ref := ""
+	if referenceID != nil {
+		ref = referenceID.String()
+	}
+	_, err := tx.Exec(ctx, `
+		SELECT set_config('megashop.stock_source', $1, true),
+			   set_config('megashop.stock_reference', $2, true),
+			   set_config('megashop.stock_note', $3, true)
+	`, source, ref, note)
+	if err != nil {
+		return fmt.Errorf("tag stock changes: %w", err)
+	}
+	return nil
+}
+
+// AdjustStock changes a product's stock by delta as a manual movement.
+// Returns the new stock.
+func (p *Postgres) AdjustStock(ctx context.Context, productID uuid.UUID, delta int, actorID *uuid.UUID, note string) (int, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tagStockChanges(ctx, tx, models.StockSourceManual, actorID, note); err != nil {
+		return 0, err
+	}
+	var stock int
+	err = tx.QueryRow(ctx, `
+		UPDATE products SET stock = stock + $2, updated_at = NOW() WHERE id = $1 RETURNING stock
+	`, productID, delta).Scan(&stock)
+	if err == pgx.ErrNoRows {
+		return 0, ErrProductNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("adjust stock: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit stock adjustment: %w", err)
+	}
+	return stock, nil
+}
+
+// ListStockMovements returns the stock history of a product, newest first
+func (p *Postgres) ListStockMovements(ctx context.Context, productID uuid.UUID, page, limit int) (*models.PaginatedResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	var total int64
+	err := p.pool.QueryRow(ctx, `SELECT COUNT(*) FROM stock_movements WHERE product_id = $1`, productID).Scan(&total)
+	if err != nil {
+		return nil, fmt.Errorf("count stock movements: %w", err)
+	}
+
+	// The reference is an order, a supplier or an admin depending on the source
+	rows, err := p.pool.Query(ctx, `
+		SELECT m.id, m.product_id, m.source, m.delta, m.quantity, m.reference_id,
+			   COALESCE(o.order_number, s.code, u.email, ''), COALESCE(m.note, ''), m.created_at
+		FROM stock_movements m
+		LEFT JOIN orders o ON m.source IN ('order', 'cancel') AND o.id = m.reference_id
+		LEFT JOIN suppliers s ON m.source = 'supplier_import' AND s.id = m.reference_id
+		LEFT JOIN users u ON m.source = 'manual' AND u.id = m.reference_id
+		WHERE m.product_id = $1
+		ORDER BY m.created_at DESC, m.id
+		LIMIT $2 OFFSET $3
+	`, productID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, fmt.Errorf("list stock movements: %w", err)
+	}
+	defer rows.Close()
+
+	movements := []models.StockMovement{}
+	for rows.Next() {
+		var m models.StockMovement
+		err := rows.Scan(&m.ID, &m.ProductID, &m.Source, &m.Delta, &m.Quantity, &m.ReferenceID,
+			&m.Reference, &m.Note, &m.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan stock movement: %w", err)
+		}
+		movements = append(movements, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list stock movements: %w", err)
+	}
+
+	return &models.PaginatedResponse{
+		Items:      movements,
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	}, nil
+}
+
+// StockDiscrepancyFilter narrows the discrepancy report
+type StockDiscrepancyFilter struct {
+	SupplierCode  string // only products whose active offer is this supplier's
+	MinDifference int    // absolute difference, at least 1
+	Limit         int
+}
+
+// ListStockDiscrepancies compares the stock of products with the stock of
+// their active offer (the supplier item the offer selection copies stock
+// from) less the pieces held by open orders, largest difference first
+func (p *Postgres) ListStockDiscrepancies(ctx context.Context, filter StockDiscrepancyFilter) ([]models.StockDiscrepancy, error) {
+	if filter.MinDifference < 1 {
+		filter.MinDifference = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 1000 {
+		filter.Limit = 200
+	}
+
+	rows, err := p.pool.Query(ctx, `
+		WITH supplier_stock AS (
+			-- The active offer of an active supplier, as RefreshProductOffer selects it
+			SELECT p.id AS product_id, COALESCE(sp.stock, 0) AS stock, ARRAY[s.code] AS suppliers
+			FROM products p
+			JOIN supplier_products sp ON sp.id = p.active_offer_id
+			JOIN suppliers s ON s.id = sp.supplier_id
+			WHERE COALESCE(s.is_active, true) AND ($1 = '' OR s.code = $1)
+		), reserved AS (
+			SELECT oi.product_id, SUM(oi.quantity) AS quantity
+			FROM order_items oi
+			JOIN orders o ON o.id = oi.order_id
+			WHERE o.status IN ('pending', 'paid', 'processing')
+			GROUP BY oi.product_id
+		)
+		SELECT p.id, COALESCE(p.sku, ''), p.name, p.stock, ss.stock::int, COALESCE(r.quantity, 0)::int,
+			   ss.suppliers,
+			   (SELECT MAX(m.created_at) FROM stock_movements m WHERE m.product_id = p.id)
+		FROM products p
+		JOIN supplier_stock ss ON ss.product_id = p.id
+		LEFT JOIN reserved r ON r.product_id = p.id
+		WHERE ABS(p.stock - (ss.stock - COALESCE(r.quantity, 0))) >= $2
+		ORDER BY ABS(p.stock - (ss.stock - COALESCE(r.quantity, 0))) DESC, p.name
+		LIMIT $3
+	`, filter.SupplierCode, filter.MinDifference, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list stock discrepancies: %w", err)
+	}
+	defer rows.Close()
+
+	report := []models.StockDiscrepancy{}
+	for rows.Next() {
+		var d models.StockDiscrepancy
+		err := rows.Scan(&d.ProductID, &d.SKU, &d.Name, &d.Stock, &d.SupplierStock, &d.Reserved,
+			&d.Suppliers, &d.LastMovedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan stock discrepancy: %w", err)
+		}
+		d.Expected = d.SupplierStock - d.Reserved
+		d.Difference = d.Stock - d.Expected
+		report = append(report, d)
+	}
+	return report, rows.Err()
+}
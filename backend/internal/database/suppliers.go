@@ -26,7 +26,7 @@ func (p *Postgres) ListSuppliers(ctx context.Context) ([]*models.Supplier, error
 			   COALESCE(s.max_downloads_per_day, 8), COALESCE(s.download_count_today, 0), s.last_download_date,
 			   COALESCE(s.auth_type, 'none'), COALESCE(s.auth_credentials, '{}'), 
 			   COALESCE(s.is_active, true), COALESCE(s.priority, 0), COALESCE(s.field_mappings, '{}'),
-			   s.created_at, s.updated_at,
+			   s.allow_backorder, COALESCE(s.schedule, ''), s.created_at, s.updated_at,
 			   COALESCE((SELECT COUNT(*) FROM supplier_products sp WHERE sp.supplier_id = s.id), 0) as product_count
 		FROM suppliers s
 		ORDER BY s.priority DESC, s.name ASC
@@ -49,7 +49,7 @@ func (p *Postgres) ListSuppliers(ctx context.Context) ([]*models.Supplier, error
 			&s.FeedURL, &s.FeedType, &s.FeedFormat, &s.XMLItemPath, &s.CategorySeparator,
 			&s.MaxDownloadsPerDay, &s.DownloadCountToday, &s.LastDownloadDate,
 			&s.AuthType, &s.AuthCredentials, &s.IsActive, &s.Priority, &s.FieldMappings,
-			&s.CreatedAt, &s.UpdatedAt,
+			&s.AllowBackorder, &s.Schedule, &s.CreatedAt, &s.UpdatedAt,
 			&productCount,
 		)
 		if err != nil {
@@ -77,7 +77,7 @@ func (p *Postgres) GetSupplier(ctx context.Context, id uuid.UUID) (*models.Suppl
 			   COALESCE(s.max_downloads_per_day, 8), COALESCE(s.download_count_today, 0), s.last_download_date,
 			   COALESCE(s.auth_type, 'none'), COALESCE(s.auth_credentials, '{}'),
 			   COALESCE(s.is_active, true), COALESCE(s.priority, 0), COALESCE(s.field_mappings, '{}'),
-			   s.created_at, s.updated_at,
+			   s.allow_backorder, COALESCE(s.schedule, ''), s.created_at, s.updated_at,
 			   COALESCE((SELECT COUNT(*) FROM supplier_products sp WHERE sp.supplier_id = s.id), 0) as product_count
 		FROM suppliers s
 		WHERE s.id = $1
@@ -91,7 +91,7 @@ func (p *Postgres) GetSupplier(ctx context.Context, id uuid.UUID) (*models.Suppl
 		&s.FeedURL, &s.FeedType, &s.FeedFormat, &s.XMLItemPath, &s.CategorySeparator,
 		&s.MaxDownloadsPerDay, &s.DownloadCountToday, &s.LastDownloadDate,
 		&s.AuthType, &s.AuthCredentials, &s.IsActive, &s.Priority, &s.FieldMappings,
-		&s.CreatedAt, &s.UpdatedAt,
+		&s.AllowBackorder, &s.Schedule, &s.CreatedAt, &s.UpdatedAt,
 		&productCount,
 	)
 	if err == pgx.ErrNoRows {
@@ -131,13 +131,13 @@ func (p *Postgres) CreateSupplier(ctx context.Context, s *models.Supplier) error
 			feed_url, feed_type, feed_format, xml_item_path, category_separator,
 			max_downloads_per_day, download_count_today, last_download_date,
 			auth_type, auth_credentials, is_active, priority, field_mappings,
-			created_at, updated_at
+			created_at, updated_at, allow_backorder, schedule
 		) VALUES (
 			$1, $2, $3, $4, $5, $6, $7, $8,
 			$9, $10, $11, $12, $13,
 			$14, $15, $16,
 			$17, $18, $19, $20, $21,
-			$22, $23
+			$22, $23, $24, NULLIF($25, '')
 		)
 	`
 
@@ -146,7 +146,7 @@ func (p *Postgres) CreateSupplier(ctx context.Context, s *models.Supplier) error
 		s.FeedURL, s.FeedType, s.FeedFormat, s.XMLItemPath, s.CategorySeparator,
 		s.MaxDownloadsPerDay, s.DownloadCountToday, s.LastDownloadDate,
 		s.AuthType, s.AuthCredentials, s.IsActive, s.Priority, s.FieldMappings,
-		s.CreatedAt, s.UpdatedAt,
+		s.CreatedAt, s.UpdatedAt, s.AllowBackorder, s.Schedule,
 	)
 
 	return err
@@ -161,7 +161,7 @@ func (p *Postgres) UpdateSupplier(ctx context.Context, s *models.Supplier) error
 			feed_url = $8, feed_type = $9, feed_format = $10, xml_item_path = $11, category_separator = $12,
 			max_downloads_per_day = $13,
 			auth_type = $14, auth_credentials = $15, is_active = $16, priority = $17, field_mappings = $18,
-			updated_at = $19
+			updated_at = $19, allow_backorder = $20, schedule = NULLIF($21, '')
 		WHERE id = $1
 	`
 
@@ -171,7 +171,7 @@ func (p *Postgres) UpdateSupplier(ctx context.Context, s *models.Supplier) error
 		s.FeedURL, s.FeedType, s.FeedFormat, s.XMLItemPath, s.CategorySeparator,
 		s.MaxDownloadsPerDay,
 		s.AuthType, s.AuthCredentials, s.IsActive, s.Priority, s.FieldMappings,
-		s.UpdatedAt,
+		s.UpdatedAt, s.AllowBackorder, s.Schedule,
 	)
 
 	return err
@@ -535,7 +535,7 @@ func (p *Postgres) UpsertSupplierProduct(ctx context.Context, product *models.Su
 			weight, weight_unit, width, length, height, size_unit, dimensional_weight,
 			special_offer, is_large, small_pallet,
 			warranty, date_added, product_id, raw_data,
-			last_seen_at, created_at, updated_at
+			last_seen_at, created_at, updated_at, item_group_id
 		) VALUES (
 			$1, $2, $3, $4, $5,
 			$6, $7,
@@ -547,7 +547,7 @@ func (p *Postgres) UpsertSupplierProduct(ctx context.Context, product *models.Su
 			$28, $29, $30, $31, $32, $33, $34,
 			$35, $36, $37,
 			$38, $39, $40, $41,
-			$42, $43, $44
+			$42, $43, $44, NULLIF($45, '')
 		)
 		ON CONFLICT (supplier_id, external_id) DO UPDATE SET
 			ean = EXCLUDED.ean,
@@ -586,6 +586,7 @@ func (p *Postgres) UpsertSupplierProduct(ctx context.Context, product *models.Su
 			small_pallet = EXCLUDED.small_pallet,
 			warranty = EXCLUDED.warranty,
 			date_added = EXCLUDED.date_added,
+			item_group_id = EXCLUDED.item_group_id,
 			last_seen_at = EXCLUDED.last_seen_at,
 			updated_at = EXCLUDED.updated_at
 		RETURNING (xmax = 0) as is_new
@@ -603,7 +604,7 @@ func (p *Postgres) UpsertSupplierProduct(ctx context.Context, product *models.Su
 		product.Weight, product.WeightUnit, product.Width, product.Length, product.Height, product.SizeUnit, product.DimensionalWeight,
 		product.SpecialOffer, product.IsLarge, product.SmallPallet,
 		product.Warranty, product.DateAdded, product.ProductID, product.RawData,
-		product.LastSeenAt, product.CreatedAt, product.UpdatedAt,
+		product.LastSeenAt, product.CreatedAt, product.UpdatedAt, product.ItemGroupID,
 	).Scan(&isNew)
 
 	return isNew, err
@@ -858,14 +859,14 @@ func (p *Postgres) ListSupplierBrands(ctx context.Context, supplierID uuid.UUID)
 // GetUnlinkedSupplierProducts returns supplier products not yet linked to main catalog
 func (p *Postgres) GetUnlinkedSupplierProducts(ctx context.Context, supplierID uuid.UUID) ([]*models.SupplierProduct, error) {
 	query := `
-		SELECT id, supplier_id, external_id, ean, manufacturer_part_number,
-			   name, description,
+		SELECT id, supplier_id, external_id, COALESCE(ean, ''), COALESCE(manufacturer_part_number, ''),
+			   name, COALESCE(description, ''),
 			   COALESCE(price_net, 0), COALESCE(price_vat, 0), COALESCE(vat_rate, 0), COALESCE(srp, 0),
 			   COALESCE(stock, 0), COALESCE(stock_status, ''), COALESCE(on_order, false),
 			   COALESCE(main_category_tree, ''), COALESCE(category_tree, ''), COALESCE(sub_category_tree, ''),
 			   COALESCE(producer_id_external, ''), COALESCE(producer_name, ''),
 			   COALESCE(images, '[]'), COALESCE(technical_specs, '{}'),
-			   COALESCE(weight, 0)
+			   COALESCE(weight, 0), COALESCE(item_group_id, '')
 		FROM supplier_products
 		WHERE supplier_id = $1 AND linked_product_id IS NULL
 		ORDER BY name
@@ -890,7 +891,7 @@ func (p *Postgres) GetUnlinkedSupplierProducts(ctx context.Context, supplierID u
 			&sp.MainCategoryTree, &sp.CategoryTree, &sp.SubCategoryTree,
 			&sp.ProducerIDExternal, &sp.ProducerName,
 			&imagesJSON, &specsJSON,
-			&sp.Weight,
+			&sp.Weight, &sp.ItemGroupID,
 		)
 		if err != nil {
 			return nil, err
@@ -1042,29 +1043,45 @@ func (p *Postgres) GetOrCreateBrand(ctx context.Context, name string) (*models.B
 	return &brand, nil
 }
 
-// UpsertProduct creates or updates a main catalog product
-func (p *Postgres) UpsertProduct(ctx context.Context, product *models.Product) (bool, error) {
+// UpsertProduct creates or updates a main catalog product from a supplier
+// product; its stock changes are recorded as the supplier's import
+func (p *Postgres) UpsertProduct(ctx context.Context, product *models.Product, supplierID uuid.UUID) (bool, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tagStockChanges(ctx, tx, models.StockSourceSupplierImport, &supplierID, ""); err != nil {
+		return false, err
+	}
+
 	// First check if product with this external_id exists
 	var existingID uuid.UUID
-	err := p.pool.QueryRow(ctx, `SELECT id FROM products WHERE external_id = $1`, product.ExternalID).Scan(&existingID)
+	err = tx.QueryRow(ctx, `SELECT id FROM products WHERE external_id = $1 FOR UPDATE`, product.ExternalID).Scan(&existingID)
 	
 	if err == nil {
-		// Product exists - update it
-		_, err = p.pool.Exec(ctx, `
+		// Product exists - update it, keeping the pieces open orders hold
+		reserved, err := reservedQuantity(ctx, tx, existingID)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(ctx, `
 			UPDATE products SET
 				name = $1, description = $2, price = $3, sale_price = $4,
 				stock = $5, category_id = $6, brand_id = $7, images = $8,
-				attributes = $9, weight = $10, updated_at = NOW()
+				attributes = $9, weight = $10, ean = COALESCE(NULLIF($12, ''), ean),
+				itemgroup_id = COALESCE(NULLIF($13, ''), itemgroup_id), updated_at = NOW()
 			WHERE id = $11
 		`, product.Name, product.Description, product.Price, product.SalePrice,
-			product.Stock, product.CategoryID, product.BrandID, product.Images,
-			product.Attributes, product.Weight, existingID)
+			product.Stock-reserved, product.CategoryID, product.BrandID, product.Images,
+			product.Attributes, product.Weight, existingID, product.EAN, product.ItemGroupID)
 		
 		if err != nil {
 			return false, fmt.Errorf("update failed: %w", err)
 		}
 		product.ID = existingID
-		return false, nil
+		return false, tx.Commit(ctx)
 	}
 	
 	// Product doesn't exist - insert it
@@ -1072,28 +1089,28 @@ func (p *Postgres) UpsertProduct(ctx context.Context, product *models.Product) (
 		INSERT INTO products (
 			id, sku, slug, name, description, price, sale_price, currency,
 			stock, category_id, brand_id, images, attributes, 
-			external_id, status, weight, created_at, updated_at
+			external_id, status, weight, created_at, updated_at, ean, itemgroup_id
 		) VALUES (
 			$1, $2, $3, $4, $5, $6, $7, 'EUR',
 			$8, $9, $10, $11, $12,
-			$13, $14, $15, $16, $17
+			$13, $14, $15, $16, $17, NULLIF($18, ''), NULLIF($19, '')
 		)
 	`
 	
-	_, err = p.pool.Exec(ctx, query,
+	_, err = tx.Exec(ctx, query,
 		product.ID, product.SKU, product.Slug, product.Name, product.Description,
 		product.Price, product.SalePrice,
 		product.Stock, product.CategoryID, product.BrandID,
 		product.Images, product.Attributes,
 		product.ExternalID, product.Status, product.Weight,
-		product.CreatedAt, product.UpdatedAt,
+		product.CreatedAt, product.UpdatedAt, product.EAN, product.ItemGroupID,
 	)
 	
 	if err != nil {
 		return false, fmt.Errorf("insert failed: %w", err)
 	}
 	
-	return true, nil
+	return true, tx.Commit(ctx)
 }
 
 // LinkSupplierProduct links a supplier product to a main product
@@ -2,34 +2,73 @@ package email
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
-	"net/smtp"
 	"strings"
 	"time"
 
 	"megashop/internal/config"
 	"megashop/internal/models"
+	"megashop/internal/payment"
 )
 
-// Service handles email sending
+// Service renders customer emails and hands them to the outbox (or sends
+// them right away when there is none)
 type Service struct {
-	cfg *config.Config
+	cfg    *config.Config
+	store  Store
+	sender Sender
 }
 
-// NewService creates a new email service
-func NewService(cfg *config.Config) *Service {
-	return &Service{cfg: cfg}
+// Store keeps admin templates and the email outbox
+type Store interface {
+	TemplateStore
+	EnqueueEmail(ctx context.Context, email *models.OutboxEmail) error
 }
 
-// IsConfigured returns true if SMTP is properly configured
+// NewService creates a new email service. store may be nil, then the
+// built-in templates are used and emails are sent synchronously.
+func NewService(cfg *config.Config, store Store) *Service {
+	return &Service{cfg: cfg, store: store, sender: NewSender(cfg)}
+}
+
+// Sender returns the delivery backend (SMTP, directory or memory sink)
+func (s *Service) Sender() Sender {
+	return s.sender
+}
+
+// IsConfigured returns true if SMTP is properly configured or a test mode is used
 func (s *Service) IsConfigured() bool {
+	if s.cfg.EmailMode == EmailModeDir || s.cfg.EmailMode == EmailModeMemory {
+		return true
+	}
 	return s.cfg.SMTPHost != "" && s.cfg.SMTPUser != "" && s.cfg.SMTPPassword != ""
 }
 
+// send queues the message in the outbox, the worker delivers it
+func (s *Service) send(msg Message) error {
+	if s.store == nil {
+		return s.sender.Send(context.Background(), msg)
+	}
+
+	images, err := json.Marshal(msg.Images)
+	if err != nil {
+		return fmt.Errorf("encode images: %w", err)
+	}
+	return s.store.EnqueueEmail(context.Background(), &models.OutboxEmail{
+		Kind:        msg.Kind,
+		OrderID:     msg.OrderID,
+		ToAddress:   msg.To,
+		Subject:     msg.Subject,
+		BodyHTML:    msg.HTML,
+		Images:      images,
+		MaxAttempts: DefaultMaxAttempts,
+	})
+}
+
 // SendOrderConfirmation sends order confirmation email to customer
 func (s *Service) SendOrderConfirmation(order *models.Order) error {
 	if !s.IsConfigured() {
@@ -37,22 +76,63 @@ func (s *Service) SendOrderConfirmation(order *models.Order) error {
 		return nil
 	}
 
+	data, err := s.newOrderEmailData(order)
+	if err != nil {
+		return err
+	}
+
+	// Bank transfer: payment details and PAY by square QR code as inline image
+	var images []InlineImage
+	transfer, err := payment.NewBankTransferInstructions(s.cfg, order, false)
+	if err != nil {
+		log.Printf("[EMAIL] Failed to build transfer instructions for #%s: %v", order.OrderNumber, err)
+	}
+	if transfer != nil {
+		data.BankTransfer = transfer
+		data.BankTransferDueDate = transfer.DueDate.Format("02.01.2006")
+		if png, err := payment.BankTransferQRCode(transfer); err != nil {
+			log.Printf("[EMAIL] Failed to render PAY by square for #%s: %v", order.OrderNumber, err)
+		} else {
+			data.BankTransferQR = true
+			images = append(images, InlineImage{ContentID: payBySquareContentID, ContentType: "image/png", Data: png})
+		}
+	}
+
+	// Render template
+	html, err := renderOrderConfirmationHTML(data)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	subject := fmt.Sprintf("Potvrdenie objednávky #%s | %s", order.OrderNumber, s.cfg.ShopName)
+
+	return s.send(Message{
+		Kind:    KindOrderConfirmation,
+		OrderID: &order.ID,
+		To:      data.BillingAddress.Email,
+		Subject: subject,
+		HTML:    html,
+		Images:  images,
+	})
+}
+
+// newOrderEmailData builds the template data shared by all order emails
+func (s *Service) newOrderEmailData(order *models.Order) (OrderEmailData, error) {
 	// Parse billing address to get email
 	var billingAddr models.Address
 	if err := json.Unmarshal(order.BillingAddress, &billingAddr); err != nil {
-		return fmt.Errorf("failed to parse billing address: %w", err)
+		return OrderEmailData{}, fmt.Errorf("failed to parse billing address: %w", err)
 	}
 
 	if billingAddr.Email == "" {
-		return fmt.Errorf("no email address in billing address")
+		return OrderEmailData{}, fmt.Errorf("no email address in billing address")
 	}
 
 	// Parse shipping address
 	var shippingAddr models.Address
 	json.Unmarshal(order.ShippingAddress, &shippingAddr)
 
-	// Build template data
-	data := OrderEmailData{
+	return OrderEmailData{
 		ShopName:        s.cfg.ShopName,
 		ShopURL:         s.cfg.ShopURL,
 		OrderNumber:     order.OrderNumber,
@@ -71,92 +151,10 @@ func (s *Service) SendOrderConfirmation(order *models.Order) error {
 		BillingAddress:  billingAddr,
 		ShippingAddress: shippingAddr,
 		Year:            time.Now().Year(),
-	}
-
-	// Render template
-	html, err := renderOrderConfirmationHTML(data)
-	if err != nil {
-		return fmt.Errorf("failed to render email template: %w", err)
-	}
-
-	subject := fmt.Sprintf("Potvrdenie objednávky #%s | %s", order.OrderNumber, s.cfg.ShopName)
-
-	return s.sendHTML(billingAddr.Email, subject, html)
+	}, nil
 }
 
-// sendHTML sends an HTML email
-func (s *Service) sendHTML(to, subject, htmlBody string) error {
-	from := s.cfg.SMTPFrom
-	addr := fmt.Sprintf("%s:%s", s.cfg.SMTPHost, s.cfg.SMTPPort)
-
-	headers := map[string]string{
-		"From":                      fmt.Sprintf("%s <%s>", s.cfg.ShopName, from),
-		"To":                        to,
-		"Subject":                   subject,
-		"MIME-Version":              "1.0",
-		"Content-Type":              "text/html; charset=\"UTF-8\"",
-		"X-Mailer":                  "ProfiBuy-Mailer",
-		"List-Unsubscribe":         fmt.Sprintf("<%s/unsubscribe>", s.cfg.ShopURL),
-	}
-
-	var msg bytes.Buffer
-	for k, v := range headers {
-		fmt.Fprintf(&msg, "%s: %s\r\n", k, v)
-	}
-	msg.WriteString("\r\n")
-	msg.WriteString(htmlBody)
-
-	auth := smtp.PlainAuth("", s.cfg.SMTPUser, s.cfg.SMTPPassword, s.cfg.SMTPHost)
-
-	// Try TLS first
-	tlsConfig := &tls.Config{
-		ServerName: s.cfg.SMTPHost,
-	}
-
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
-	if err != nil {
-		// Fallback to STARTTLS
-		log.Printf("[EMAIL] TLS dial failed, trying STARTTLS: %v", err)
-		return smtp.SendMail(addr, auth, from, []string{to}, msg.Bytes())
-	}
-
-	client, err := smtp.NewClient(conn, s.cfg.SMTPHost)
-	if err != nil {
-		return fmt.Errorf("SMTP client error: %w", err)
-	}
-	defer client.Close()
-
-	if err := client.Auth(auth); err != nil {
-		return fmt.Errorf("SMTP auth error: %w", err)
-	}
-
-	if err := client.Mail(from); err != nil {
-		return fmt.Errorf("SMTP MAIL FROM error: %w", err)
-	}
-
-	if err := client.Rcpt(to); err != nil {
-		return fmt.Errorf("SMTP RCPT TO error: %w", err)
-	}
-
-	w, err := client.Data()
-	if err != nil {
-		return fmt.Errorf("SMTP DATA error: %w", err)
-	}
-
-	_, err = w.Write(msg.Bytes())
-	if err != nil {
-		return fmt.Errorf("SMTP write error: %w", err)
-	}
-
-	if err := w.Close(); err != nil {
-		return fmt.Errorf("SMTP close error: %w", err)
-	}
-
-	log.Printf("[EMAIL] ✅ Order confirmation sent to %s for order #%s", to, subject)
-	return client.Quit()
-}
-
-// OrderEmailData holds data for order confirmation template
+// OrderEmailData holds data for the order email templates
 type OrderEmailData struct {
 	ShopName        string
 	ShopURL         string
@@ -176,8 +174,22 @@ type OrderEmailData struct {
 	BillingAddress  models.Address
 	ShippingAddress models.Address
 	Year            int
+
+	// Bank transfer only
+	BankTransfer        *models.BankTransferInstructions
+	BankTransferDueDate string
+	BankTransferQR      bool
+
+	// Status change emails
+	StatusNote     string
+	TrackingNumber string
+	TrackingURL    string
+	RefundAmount   string
 }
 
+// payBySquareContentID references the inline QR code image in the email
+const payBySquareContentID = "paybysquare@profibuy"
+
 func formatEUR(amount float64) string {
 	return fmt.Sprintf("%.2f €", amount)
 }
@@ -190,6 +202,7 @@ func translateStatus(status string) string {
 		"shipped":    "Odoslaná",
 		"delivered":  "Doručená",
 		"cancelled":  "Zrušená",
+		"returned":   "Vrátená",
 	}
 	if v, ok := m[status]; ok {
 		return v
@@ -346,6 +359,33 @@ const orderConfirmationTemplate = `<!DOCTYPE html>
 </td>
 </tr>
 
+{{if .BankTransfer}}
+<!-- Bank transfer -->
+<tr>
+<td style="padding:0 40px 24px;">
+  <table role="presentation" width="100%" cellspacing="0" cellpadding="0" border="0" style="background:#eff6ff;border:1px solid #bfdbfe;border-radius:12px;">
+  <tr>
+    <td style="padding:20px 24px;vertical-align:top;">
+      <p style="margin:0 0 12px;color:#1e3a5f;font-size:15px;font-weight:700;">Platobné údaje pre bankový prevod</p>
+      <p style="margin:0 0 4px;color:#374151;font-size:14px;">IBAN: <strong>{{.BankTransfer.IBAN}}</strong></p>
+      {{if .BankTransfer.BIC}}<p style="margin:0 0 4px;color:#374151;font-size:14px;">SWIFT/BIC: <strong>{{.BankTransfer.BIC}}</strong></p>{{end}}
+      <p style="margin:0 0 4px;color:#374151;font-size:14px;">Suma: <strong>{{.Total}}</strong></p>
+      <p style="margin:0 0 4px;color:#374151;font-size:14px;">Variabilný symbol: <strong>{{.BankTransfer.VariableSymbol}}</strong></p>
+      <p style="margin:0 0 4px;color:#374151;font-size:14px;">Príjemca: {{.BankTransfer.BeneficiaryName}}</p>
+      <p style="margin:0;color:#374151;font-size:14px;">Splatnosť: {{.BankTransferDueDate}}</p>
+    </td>
+    {{if .BankTransferQR}}
+    <td style="padding:20px 24px 20px 0;width:160px;text-align:center;vertical-align:top;">
+      <img src="cid:paybysquare@profibuy" width="160" height="160" alt="PAY by square" style="display:block;border:0;">
+      <p style="margin:6px 0 0;color:#6b7280;font-size:11px;">Naskenujte v bankovej aplikácii</p>
+    </td>
+    {{end}}
+  </tr>
+  </table>
+</td>
+</tr>
+{{end}}
+
 <!-- Items header -->
 <tr>
 <td style="padding:0 40px 12px;">
@@ -0,0 +1,129 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"time"
+
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Outbox retry policy
+const (
+	DefaultMaxAttempts = 10
+	retryBaseDelay     = time.Minute
+	retryMaxDelay      = 6 * time.Hour
+	claimLease         = 5 * time.Minute // a crashed worker's messages are retried after this
+	outboxBatchSize    = 20
+)
+
+// OutboxStore is the persisted queue processed by the worker
+type OutboxStore interface {
+	// ClaimEmails marks up to limit due messages as sending, counts the
+	// attempt and hides them from other workers for lease
+	ClaimEmails(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEmail, error)
+	MarkEmailSent(ctx context.Context, id uuid.UUID) error
+	// MarkEmailFailed schedules the next attempt, or moves the message to
+	// the dead state when retryAt is nil
+	MarkEmailFailed(ctx context.Context, id uuid.UUID, lastError string, retryAt *time.Time) error
+}
+
+// RetryDelay is the exponential backoff after the given failed attempt:
+// 1 min, 2 min, 4 min ... capped at 6 hours
+func RetryDelay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := time.Duration(float64(retryBaseDelay) * math.Pow(2, float64(attempt-1)))
+	if d > retryMaxDelay || d <= 0 {
+		return retryMaxDelay
+	}
+	return d
+}
+
+// OutboxWorker delivers queued emails in the background
+type OutboxWorker struct {
+	store    OutboxStore
+	sender   Sender
+	interval time.Duration
+}
+
+// NewOutboxWorker creates a worker polling the outbox every interval
+func NewOutboxWorker(store OutboxStore, sender Sender, interval time.Duration) *OutboxWorker {
+	return &OutboxWorker{store: store, sender: sender, interval: interval}
+}
+
+// Run processes the outbox until ctx is cancelled
+func (w *OutboxWorker) Run(ctx context.Context) {
+	log.Printf("[EMAIL] Outbox worker started (every %v)", w.interval)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, _, err := w.ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[EMAIL] Outbox error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("[EMAIL] Outbox worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue delivers all messages that are due now and returns how many
+// were sent and how many failed
+func (w *OutboxWorker) ProcessDue(ctx context.Context) (sent, failed int, err error) {
+	for ctx.Err() == nil {
+		batch, err := w.store.ClaimEmails(ctx, outboxBatchSize, claimLease)
+		if err != nil {
+			return sent, failed, err
+		}
+		if len(batch) == 0 {
+			return sent, failed, nil
+		}
+
+		for _, e := range batch {
+			if w.deliver(ctx, e) {
+				sent++
+			} else {
+				failed++
+			}
+		}
+	}
+	return sent, failed, ctx.Err()
+}
+
+func (w *OutboxWorker) deliver(ctx context.Context, e models.OutboxEmail) bool {
+	msg := Message{Kind: e.Kind, OrderID: e.OrderID, To: e.ToAddress, Subject: e.Subject, HTML: e.BodyHTML}
+	if len(e.Images) > 0 {
+		json.Unmarshal(e.Images, &msg.Images)
+	}
+
+	sendErr := w.sender.Send(ctx, msg)
+	if sendErr == nil {
+		if err := w.store.MarkEmailSent(ctx, e.ID); err != nil {
+			log.Printf("[EMAIL] Sent %s but failed to mark it: %v", e.ID, err)
+		}
+		return true
+	}
+
+	var retryAt *time.Time
+	if e.Attempts < e.MaxAttempts {
+		t := time.Now().Add(RetryDelay(e.Attempts))
+		retryAt = &t
+		log.Printf("[EMAIL] %s to %s failed (attempt %d/%d), retry at %s: %v",
+			e.Kind, e.ToAddress, e.Attempts, e.MaxAttempts, t.Format(time.RFC3339), sendErr)
+	} else {
+		log.Printf("[EMAIL] %s to %s failed %d times, giving up: %v", e.Kind, e.ToAddress, e.Attempts, sendErr)
+	}
+	if err := w.store.MarkEmailFailed(ctx, e.ID, sendErr.Error(), retryAt); err != nil {
+		log.Printf("[EMAIL] Failed to record failure of %s: %v", e.ID, err)
+	}
+	return false
+}
@@ -0,0 +1,270 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"megashop/internal/config"
+
+	"github.com/google/uuid"
+)
+
+// Delivery modes (EMAIL_MODE)
+const (
+	EmailModeSMTP   = "smtp"
+	EmailModeDir    = "dir"    // write .eml files to EMAIL_OUTPUT_DIR
+	EmailModeMemory = "memory" // keep messages in memory, for integration tests
+)
+
+// KindOrderConfirmation is the outbox kind of the order confirmation, other
+// emails use their template key
+const KindOrderConfirmation = "order_confirmation"
+
+// InlineImage is an image embedded in the HTML body and referenced as cid:<ContentID>
+type InlineImage struct {
+	ContentID   string `json:"content_id"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// Message is a rendered email ready for delivery
+type Message struct {
+	Kind    string
+	OrderID *uuid.UUID
+	To      string
+	Subject string
+	HTML    string
+	Images  []InlineImage
+}
+
+// Sender delivers a rendered message
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewSender returns the delivery backend selected by EMAIL_MODE
+func NewSender(cfg *config.Config) Sender {
+	switch cfg.EmailMode {
+	case EmailModeDir:
+		return &DirSender{cfg: cfg, Dir: cfg.EmailOutputDir}
+	case EmailModeMemory:
+		return NewMemorySink()
+	default:
+		return &SMTPSender{cfg: cfg}
+	}
+}
+
+// ==================== SMTP ====================
+
+// SMTPSender sends over SMTP with implicit TLS, falling back to STARTTLS
+type SMTPSender struct {
+	cfg *config.Config
+}
+
+// Send delivers the message to the SMTP server
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	from := s.cfg.SMTPFrom
+	addr := fmt.Sprintf("%s:%s", s.cfg.SMTPHost, s.cfg.SMTPPort)
+
+	data, err := buildMIME(s.cfg, msg)
+	if err != nil {
+		return err
+	}
+
+	auth := smtp.PlainAuth("", s.cfg.SMTPUser, s.cfg.SMTPPassword, s.cfg.SMTPHost)
+
+	// Try TLS first
+	tlsConfig := &tls.Config{
+		ServerName: s.cfg.SMTPHost,
+	}
+
+	dialer := &tls.Dialer{Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		// Fallback to STARTTLS
+		log.Printf("[EMAIL] TLS dial failed, trying STARTTLS: %v", err)
+		return smtp.SendMail(addr, auth, from, []string{msg.To}, data)
+	}
+
+	client, err := smtp.NewClient(conn, s.cfg.SMTPHost)
+	if err != nil {
+		return fmt.Errorf("SMTP client error: %w", err)
+	}
+	defer client.Close()
+
+	if err := client.Auth(auth); err != nil {
+		return fmt.Errorf("SMTP auth error: %w", err)
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM error: %w", err)
+	}
+
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("SMTP RCPT TO error: %w", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA error: %w", err)
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return fmt.Errorf("SMTP write error: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP close error: %w", err)
+	}
+
+	log.Printf("[EMAIL] ✅ Email sent to %s: %s", msg.To, msg.Subject)
+	return client.Quit()
+}
+
+// ==================== TEST MODES ====================
+
+// DirSender writes every message as an .eml file, for local development
+type DirSender struct {
+	cfg *config.Config
+	Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// Send writes the message to Dir
+func (d *DirSender) Send(ctx context.Context, msg Message) error {
+	data, err := buildMIME(d.cfg, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d.Dir, 0755); err != nil {
+		return fmt.Errorf("create email dir: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s-%s.eml", time.Now().Format("20060102-150405.000000"), msg.Kind, msg.To)
+	path := filepath.Join(d.Dir, unsafeFileChars.ReplaceAllString(name, "_"))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write email: %w", err)
+	}
+	log.Printf("[EMAIL] Written to %s: %s", path, msg.Subject)
+	return nil
+}
+
+// MemorySink keeps sent messages in memory, for integration tests
+type MemorySink struct {
+	mu       sync.Mutex
+	messages []Message
+	fail     error
+}
+
+// NewMemorySink creates an empty sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Send stores the message, or returns the error set by FailWith
+func (m *MemorySink) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail != nil {
+		return m.fail
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of the stored messages
+func (m *MemorySink) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// FailWith makes every following Send fail with err (nil to recover), to
+// simulate an SMTP outage
+func (m *MemorySink) FailWith(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fail = err
+}
+
+// Reset drops the stored messages
+func (m *MemorySink) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+// ==================== MIME ====================
+
+// buildMIME builds the raw message, with inline images as multipart/related
+func buildMIME(cfg *config.Config, msg Message) ([]byte, error) {
+	headers := map[string]string{
+		"From":             fmt.Sprintf("%s <%s>", cfg.ShopName, cfg.SMTPFrom),
+		"To":               msg.To,
+		"Subject":          msg.Subject,
+		"MIME-Version":     "1.0",
+		"Content-Type":     "text/html; charset=\"UTF-8\"",
+		"X-Mailer":         "ProfiBuy-Mailer",
+		"List-Unsubscribe": fmt.Sprintf("<%s/unsubscribe>", cfg.ShopURL),
+	}
+
+	var body bytes.Buffer
+	if len(msg.Images) == 0 {
+		body.WriteString(msg.HTML)
+	} else {
+		mw := multipart.NewWriter(&body)
+		headers["Content-Type"] = fmt.Sprintf("multipart/related; boundary=%q", mw.Boundary())
+
+		part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=\"UTF-8\""}})
+		if err != nil {
+			return nil, fmt.Errorf("build email: %w", err)
+		}
+		part.Write([]byte(msg.HTML))
+
+		for _, img := range msg.Images {
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {img.ContentType},
+				"Content-Transfer-Encoding": {"base64"},
+				"Content-ID":                {"<" + img.ContentID + ">"},
+				"Content-Disposition":       {"inline"},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("build email: %w", err)
+			}
+			writeBase64Lines(part, img.Data)
+		}
+		mw.Close()
+	}
+
+	var data bytes.Buffer
+	for k, v := range headers {
+		fmt.Fprintf(&data, "%s: %s\r\n", k, v)
+	}
+	data.WriteString("\r\n")
+	data.Write(body.Bytes())
+	return data.Bytes(), nil
+}
+
+// writeBase64Lines writes data base64 encoded in 76 character lines (RFC 2045)
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		fmt.Fprintf(w, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(w, "%s\r\n", encoded)
+}
@@ -0,0 +1,63 @@
+package email
+
+import (
+	"context"
+	"log"
+
+	"megashop/internal/models"
+)
+
+// SendOrderStatusEmail tells the customer that the order moved to its
+// current status. note is the admin's note shown in the email.
+func (s *Service) SendOrderStatusEmail(order *models.Order, note string) error {
+	key, ok := statusTemplates[order.Status]
+	if !ok {
+		return nil
+	}
+	return s.sendOrderTemplate(key, order, func(data *OrderEmailData) {
+		data.StatusNote = note
+	})
+}
+
+// SendRefundIssued tells the customer that money was sent back
+func (s *Service) SendRefundIssued(order *models.Order, amount float64, note string) error {
+	return s.sendOrderTemplate(TemplateRefundIssued, order, func(data *OrderEmailData) {
+		data.RefundAmount = formatEUR(amount)
+		data.StatusNote = note
+	})
+}
+
+// sendOrderTemplate renders an admin-editable template with the order data
+func (s *Service) sendOrderTemplate(key string, order *models.Order, fill func(*OrderEmailData)) error {
+	if !s.IsConfigured() {
+		log.Printf("[EMAIL] SMTP not configured, skipping %s for %s", key, order.OrderNumber)
+		return nil
+	}
+
+	data, err := s.newOrderEmailData(order)
+	if err != nil {
+		return err
+	}
+	data.TrackingNumber = order.TrackingNumber
+	data.TrackingURL = trackingURL(order.ShippingMethod, order.TrackingNumber)
+	if fill != nil {
+		fill(&data)
+	}
+
+	t, err := s.template(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	subject, html, err := RenderTemplate(t, data)
+	if err != nil {
+		return err
+	}
+
+	return s.send(Message{
+		Kind:    key,
+		OrderID: &order.ID,
+		To:      data.BillingAddress.Email,
+		Subject: subject,
+		HTML:    html,
+	})
+}
@@ -0,0 +1,232 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"megashop/internal/models"
+)
+
+// Keys of the templates editable in admin
+const (
+	TemplatePaymentReceived = "payment_received"
+	TemplateOrderShipped    = "order_shipped"
+	TemplateOrderDelivered  = "order_delivered"
+	TemplateOrderCancelled  = "order_cancelled"
+	TemplateRefundIssued    = "refund_issued"
+)
+
+// TemplateStore loads templates customized in admin. GetEmailTemplate
+// returns nil when the built-in default is used.
+type TemplateStore interface {
+	GetEmailTemplate(ctx context.Context, key string) (*models.EmailTemplate, error)
+}
+
+// statusTemplates maps order statuses to the email sent on entering them
+var statusTemplates = map[string]string{
+	models.OrderStatusPaid:      TemplatePaymentReceived,
+	models.OrderStatusShipped:   TemplateOrderShipped,
+	models.OrderStatusDelivered: TemplateOrderDelivered,
+	models.OrderStatusCancelled: TemplateOrderCancelled,
+}
+
+// NotifiesStatus reports whether the customer gets an email when the order moves to status
+func NotifiesStatus(status string) bool {
+	_, ok := statusTemplates[status]
+	return ok
+}
+
+// DefaultTemplate returns the built-in version of a template
+func DefaultTemplate(key string) (models.EmailTemplate, bool) {
+	t, ok := defaultTemplates[key]
+	if ok {
+		t.Key = key
+	}
+	return t, ok
+}
+
+// DefaultTemplates returns all built-in templates sorted by key
+func DefaultTemplates() []models.EmailTemplate {
+	var list []models.EmailTemplate
+	for key := range defaultTemplates {
+		t, _ := DefaultTemplate(key)
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// template returns the admin version of a template, or the default
+func (s *Service) template(ctx context.Context, key string) (models.EmailTemplate, error) {
+	def, ok := DefaultTemplate(key)
+	if !ok {
+		return models.EmailTemplate{}, fmt.Errorf("unknown email template %q", key)
+	}
+	if s.store == nil {
+		return def, nil
+	}
+	t, err := s.store.GetEmailTemplate(ctx, key)
+	if err != nil {
+		return models.EmailTemplate{}, err
+	}
+	if t == nil {
+		return def, nil
+	}
+	t.Name = def.Name
+	return *t, nil
+}
+
+// RenderTemplate renders subject and body of a template with the order data
+func RenderTemplate(t models.EmailTemplate, data OrderEmailData) (string, string, error) {
+	subjectTmpl, err := texttemplate.New("subject").Parse(t.Subject)
+	if err != nil {
+		return "", "", fmt.Errorf("parse subject: %w", err)
+	}
+	bodyTmpl, err := template.New("body").Funcs(template.FuncMap{
+		"itemTotal": itemTotal,
+		"itemPrice": itemPrice,
+		"upper":     strings.ToUpper,
+	}).Parse(t.BodyHTML)
+	if err != nil {
+		return "", "", fmt.Errorf("parse body: %w", err)
+	}
+
+	var subject, body bytes.Buffer
+	if err := subjectTmpl.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("render subject: %w", err)
+	}
+	if err := bodyTmpl.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("render body: %w", err)
+	}
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
+
+// SampleOrderEmailData is used to validate and preview templates in admin
+func SampleOrderEmailData(shopName, shopURL string) OrderEmailData {
+	return OrderEmailData{
+		ShopName:       shopName,
+		ShopURL:        shopURL,
+		OrderNumber:    "ORD-1767225600-1a2b3c4d",
+		OrderDate:      "01.01.2026",
+		OrderTime:      "10:00",
+		Status:         translateStatus(models.OrderStatusShipped),
+		PaymentMethod:  translatePaymentMethod("card"),
+		ShippingMethod: translateShippingMethod("packeta"),
+		Items: []models.OrderItem{
+			{SKU: "SAMPLE-1", Name: "Ukážkový produkt", Price: 19.99, Quantity: 2, Total: 39.98},
+		},
+		Subtotal:      formatEUR(39.98),
+		ShippingPrice: formatEUR(2.90),
+		Tax:           formatEUR(8.00),
+		Total:         formatEUR(50.88),
+		Currency:      "EUR",
+		BillingAddress: models.Address{
+			FirstName: "Ján", LastName: "Novák", Email: "jan.novak@example.com",
+			Street: "Hlavná 1", City: "Bratislava", PostalCode: "81101", Country: "SK",
+		},
+		Year:           2026,
+		StatusNote:     "Poznámka k zmene stavu",
+		TrackingNumber: "Z1234567890",
+		TrackingURL:    trackingURL("packeta", "Z1234567890"),
+		RefundAmount:   formatEUR(19.99),
+	}
+}
+
+// trackingURL links the carrier's shipment tracking page
+func trackingURL(shippingMethod, trackingNumber string) string {
+	if trackingNumber == "" {
+		return ""
+	}
+	m := map[string]string{
+		"packeta": "https://tracking.packeta.com/sk/?id=%s",
+		"dpd":     "https://tracking.dpd.de/status/sk_SK/parcel/%s",
+		"gls":     "https://gls-group.com/SK/sk/sledovanie-zasielok?match=%s",
+		"posta":   "https://tandt.posta.sk/zasielky/%s",
+	}
+	if f, ok := m[shippingMethod]; ok {
+		return fmt.Sprintf(f, trackingNumber)
+	}
+	return ""
+}
+
+// ==================== DEFAULT TEMPLATES ====================
+
+var defaultTemplates = map[string]models.EmailTemplate{
+	TemplatePaymentReceived: {
+		Name:    "Platba prijatá",
+		Subject: "Prijali sme platbu za objednávku #{{.OrderNumber}} | {{.ShopName}}",
+		BodyHTML: statusLayout("Platba prijatá", `
+  <p style="margin:0;color:#374151;font-size:15px;line-height:1.6;">Prijali sme vašu platbu <strong>{{.Total}}</strong> ({{.PaymentMethod}}). Objednávku začneme čoskoro spracovávať.</p>`),
+	},
+	TemplateOrderShipped: {
+		Name:    "Objednávka odoslaná",
+		Subject: "Objednávka #{{.OrderNumber}} bola odoslaná | {{.ShopName}}",
+		BodyHTML: statusLayout("Objednávka odoslaná", `
+  <p style="margin:0;color:#374151;font-size:15px;line-height:1.6;">Vaša objednávka bola odovzdaná dopravcovi {{.ShippingMethod}} a je na ceste k vám.</p>
+  {{if .TrackingNumber}}<p style="margin:16px 0 0;color:#374151;font-size:14px;">Číslo zásielky: <strong>{{.TrackingNumber}}</strong></p>{{end}}
+  {{if .TrackingURL}}<p style="margin:16px 0 0;"><a href="{{.TrackingURL}}" style="display:inline-block;background:#2563eb;color:#ffffff;text-decoration:none;font-size:14px;font-weight:600;padding:12px 24px;border-radius:8px;">Sledovať zásielku</a></p>{{end}}`),
+	},
+	TemplateOrderDelivered: {
+		Name:    "Objednávka doručená",
+		Subject: "Objednávka #{{.OrderNumber}} bola doručená | {{.ShopName}}",
+		BodyHTML: statusLayout("Objednávka doručená", `
+  <p style="margin:0;color:#374151;font-size:15px;line-height:1.6;">Vaša objednávka bola doručená. Ďakujeme za nákup a tešíme sa na vás znova!</p>`),
+	},
+	TemplateOrderCancelled: {
+		Name:    "Objednávka zrušená",
+		Subject: "Objednávka #{{.OrderNumber}} bola zrušená | {{.ShopName}}",
+		BodyHTML: statusLayout("Objednávka zrušená", `
+  <p style="margin:0;color:#374151;font-size:15px;line-height:1.6;">Vaša objednávka bola zrušená. Ak ste ju už zaplatili, peniaze vám vrátime rovnakým spôsobom, akým ste platili.</p>`),
+	},
+	TemplateRefundIssued: {
+		Name:    "Peniaze vrátené",
+		Subject: "Vrátenie platby k objednávke #{{.OrderNumber}} | {{.ShopName}}",
+		BodyHTML: statusLayout("Vrátenie platby", `
+  <p style="margin:0;color:#374151;font-size:15px;line-height:1.6;">Vrátili sme vám <strong>{{.RefundAmount}}</strong> ({{.PaymentMethod}}). Na vašom účte by sa peniaze mali objaviť do niekoľkých pracovných dní.</p>`),
+	},
+}
+
+// statusLayout wraps the content of a default template in the shop layout
+func statusLayout(title, content string) string {
+	return `<!DOCTYPE html>
+<html lang="sk">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>Objednávka #{{.OrderNumber}}</title>
+</head>
+<body style="margin:0;padding:0;background-color:#f4f6f9;font-family:'Segoe UI',Roboto,'Helvetica Neue',Arial,sans-serif;">
+<table role="presentation" width="100%" cellspacing="0" cellpadding="0" border="0" style="background-color:#f4f6f9;">
+<tr><td align="center" style="padding:24px 16px;">
+<table role="presentation" width="600" cellspacing="0" cellpadding="0" border="0" style="max-width:600px;width:100%;background-color:#ffffff;border-radius:16px;overflow:hidden;">
+<tr>
+<td style="background:linear-gradient(135deg,#1e3a5f 0%,#2563eb 50%,#3b82f6 100%);padding:32px 40px;text-align:center;">
+  <h1 style="margin:0;color:#ffffff;font-size:24px;font-weight:800;">{{.ShopName}}</h1>
+</td>
+</tr>
+<tr>
+<td style="padding:32px 40px 16px;">
+  <p style="margin:0 0 4px;color:#94a3b8;font-size:11px;text-transform:uppercase;letter-spacing:1px;font-weight:600;">Objednávka #{{.OrderNumber}}</p>
+  <h2 style="margin:0 0 16px;color:#111827;font-size:22px;font-weight:700;">` + title + `</h2>` + content + `
+  {{if .StatusNote}}<p style="margin:16px 0 0;color:#374151;font-size:14px;line-height:1.6;background:#f8fafc;border:1px solid #e2e8f0;border-radius:8px;padding:12px 16px;">{{.StatusNote}}</p>{{end}}
+</td>
+</tr>
+<tr>
+<td style="padding:16px 40px 32px;">
+  <a href="{{.ShopURL}}" style="color:#2563eb;font-size:14px;font-weight:600;">Prejsť do obchodu</a>
+</td>
+</tr>
+<tr>
+<td style="padding:20px 40px;background:#f8fafc;text-align:center;color:#94a3b8;font-size:12px;">&copy; {{.Year}} {{.ShopName}}</td>
+</tr>
+</table>
+</td></tr>
+</table>
+</body>
+</html>`
+}
@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"megashop/internal/config"
+	"megashop/internal/database"
+	"megashop/internal/shipping"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -93,6 +95,7 @@ type ExportProduct struct {
 	Currency    string
 	Stock       int
 	Weight      float64
+	CategoryID  *uuid.UUID
 	Images      json.RawMessage
 	Attributes  json.RawMessage
 	Variants    json.RawMessage
@@ -111,14 +114,8 @@ type ExportProduct struct {
 	SupplierDescription string
 	ItemGroupID         string
 	DeliveryDays        int
-}
-
-type ExportShippingMethod struct {
-	Code     string
-	Name     string
-	Price    float64
-	FreeFrom float64
-	IsActive bool
+	IsLarge             bool
+	SmallPallet         bool
 }
 
 type ProductImage struct {
@@ -138,13 +135,15 @@ type ProductAttribute struct {
 // ==================== EXPORTER ====================
 
 type HeurekaExporter struct {
+	db   *database.Postgres
 	pool *pgxpool.Pool
 	cfg  *config.Config
 }
 
-func NewHeurekaExporter(pool *pgxpool.Pool, cfg *config.Config) *HeurekaExporter {
+func NewHeurekaExporter(db *database.Postgres, cfg *config.Config) *HeurekaExporter {
 	return &HeurekaExporter{
-		pool: pool,
+		db:   db,
+		pool: db.Pool(),
 		cfg:  cfg,
 	}
 }
@@ -162,11 +161,11 @@ func (e *HeurekaExporter) WriteXML(ctx context.Context, w io.Writer) error {
 		return fmt.Errorf("write shop open: %w", err)
 	}
 
-	// Load shipping methods once
-	shippingMethods, err := e.loadShippingMethods(ctx)
+	// Load shipping rates once, the same engine prices checkout
+	shippingRates, err := e.db.ShippingRateEngine(ctx)
 	if err != nil {
-		log.Printf("[EXPORT] Warning: could not load shipping methods: %v", err)
-		shippingMethods = nil
+		log.Printf("[EXPORT] Warning: could not load shipping rates: %v", err)
+		shippingRates = nil
 	}
 
 	// Stream products in batches
@@ -185,7 +184,7 @@ func (e *HeurekaExporter) WriteXML(ctx context.Context, w io.Writer) error {
 		}
 
 		for _, prod := range products {
-			item := e.convertToHeurekaItem(prod, shippingMethods)
+			item := e.convertToHeurekaItem(prod, shippingRates)
 			xmlBytes, err := xml.MarshalIndent(item, "  ", "    ")
 			if err != nil {
 				log.Printf("[EXPORT] Warning: failed to marshal product %s: %v", prod.ID, err)
@@ -233,6 +232,7 @@ func (e *HeurekaExporter) loadProductBatch(ctx context.Context, limit, offset in
 			COALESCE(p.currency, 'EUR') as currency,
 			p.stock,
 			COALESCE(p.weight, 0) as weight,
+			p.category_id,
 			COALESCE(p.images, '[]') as images,
 			COALESCE(p.attributes, '[]') as attributes,
 			COALESCE(p.variants, '[]') as variants,
@@ -251,7 +251,9 @@ func (e *HeurekaExporter) loadProductBatch(ctx context.Context, limit, offset in
 					WHEN p.stock > 0 THEN 3
 					ELSE 14
 				END
-			) as delivery_days
+			) as delivery_days,
+			COALESCE(flags.is_large, false) as is_large,
+			COALESCE(flags.small_pallet, false) as small_pallet
 		FROM products p
 		LEFT JOIN brands b ON p.brand_id = b.id
 		LEFT JOIN LATERAL (
@@ -261,6 +263,11 @@ func (e *HeurekaExporter) loadProductBatch(ctx context.Context, limit, offset in
 			ORDER BY sp2.updated_at DESC
 			LIMIT 1
 		) sp ON true
+		LEFT JOIN LATERAL (
+			SELECT bool_or(sp3.is_large) as is_large, bool_or(sp3.small_pallet) as small_pallet
+			FROM supplier_products sp3
+			WHERE sp3.linked_product_id = p.id OR sp3.product_id = p.id
+		) flags ON true
 		LEFT JOIN LATERAL (
 			SELECT string_agg(cat.name, ' | ' ORDER BY cat.depth) as category_path
 			FROM (
@@ -301,6 +308,7 @@ func (e *HeurekaExporter) loadProductBatch(ctx context.Context, limit, offset in
 			&prod.Currency,
 			&prod.Stock,
 			&prod.Weight,
+			&prod.CategoryID,
 			&prod.Images,
 			&prod.Attributes,
 			&prod.Variants,
@@ -314,6 +322,8 @@ func (e *HeurekaExporter) loadProductBatch(ctx context.Context, limit, offset in
 			&prod.SupplierDescription,
 			&prod.ItemGroupID,
 			&prod.DeliveryDays,
+			&prod.IsLarge,
+			&prod.SmallPallet,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan product: %w", err)
@@ -341,36 +351,8 @@ func (e *HeurekaExporter) loadProductBatch(ctx context.Context, limit, offset in
 	return products, nil
 }
 
-// loadShippingMethods loads all active shipping methods
-func (e *HeurekaExporter) loadShippingMethods(ctx context.Context) ([]ExportShippingMethod, error) {
-	query := `
-		SELECT code, name, price, COALESCE(free_from, 0)
-		FROM shipping_methods 
-		WHERE is_active = true
-		ORDER BY price ASC
-	`
-
-	rows, err := e.pool.Query(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var methods []ExportShippingMethod
-	for rows.Next() {
-		var m ExportShippingMethod
-		if err := rows.Scan(&m.Code, &m.Name, &m.Price, &m.FreeFrom); err != nil {
-			return nil, err
-		}
-		m.IsActive = true
-		methods = append(methods, m)
-	}
-
-	return methods, nil
-}
-
 // convertToHeurekaItem converts an ExportProduct to a HeurekaShopItem
-func (e *HeurekaExporter) convertToHeurekaItem(prod ExportProduct, shippingMethods []ExportShippingMethod) HeurekaShopItem {
+func (e *HeurekaExporter) convertToHeurekaItem(prod ExportProduct, shippingRates *shipping.RateEngine) HeurekaShopItem {
 	shopURL := strings.TrimRight(e.cfg.ShopURL, "/")
 	cdnURL := strings.TrimRight(e.cfg.CDNUrl, "/")
 
@@ -469,25 +451,33 @@ func (e *HeurekaExporter) convertToHeurekaItem(prod ExportProduct, shippingMetho
 	// Delivery date from DB or computed from stock
 	deliveryDate := fmt.Sprintf("%d", prod.DeliveryDays)
 
-	// Build delivery methods
+	// Build delivery methods: rates of one piece shipped within Slovakia,
+	// methods that cannot ship the product are left out
 	var deliveries []HeurekaDelivery
-	for _, sm := range shippingMethods {
-		heurekaDeliveryID := mapShippingCodeToHeureka(sm.Code)
-		if heurekaDeliveryID == "" {
-			continue
-		}
-
-		// Calculate shipping price (free shipping threshold)
-		shipPrice := sm.Price
-		if sm.FreeFrom > 0 && finalPrice >= sm.FreeFrom {
-			shipPrice = 0
-		}
-
-		deliveries = append(deliveries, HeurekaDelivery{
-			DeliveryID:       heurekaDeliveryID,
-			DeliveryPrice:    formatPrice(shipPrice),
-			DeliveryPriceCOD: formatPrice(shipPrice + 1.50), // COD surcharge
+	if shippingRates != nil {
+		rates := shippingRates.Rates(shipping.RateRequest{
+			Country:  shipping.DefaultCountry,
+			Subtotal: finalPrice,
+			Items: []shipping.RateItem{{
+				ProductID:   prod.ID,
+				CategoryID:  prod.CategoryID,
+				Quantity:    1,
+				Weight:      prod.Weight,
+				IsLarge:     prod.IsLarge,
+				SmallPallet: prod.SmallPallet,
+			}},
 		})
+		for _, rate := range rates {
+			heurekaDeliveryID := mapShippingCodeToHeureka(rate.Method)
+			if heurekaDeliveryID == "" {
+				continue
+			}
+			deliveries = append(deliveries, HeurekaDelivery{
+				DeliveryID:       heurekaDeliveryID,
+				DeliveryPrice:    formatPrice(rate.Price),
+				DeliveryPriceCOD: formatPrice(rate.Price + 1.50), // COD surcharge
+			})
+		}
 	}
 
 	// Clean description (strip HTML tags, limit length)
@@ -0,0 +1,109 @@
+package feeds
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+// CSVOptions describes how a CSV feed is written
+type CSVOptions struct {
+	Delimiter string `json:"delimiter,omitempty"` // one character, "tab" for tabs; default ","
+	Quotes    string `json:"quotes,omitempty"`    // "strict" (RFC 4180, default) or "lazy" to accept stray quotes
+	NoHeader  bool   `json:"no_header,omitempty"` // columns are then named "1", "2", ...
+	Encoding  string `json:"encoding,omitempty"`  // charset, default UTF-8
+}
+
+func (o *CSVOptions) delimiter() (rune, error) {
+	switch o.Delimiter {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(o.Delimiter)
+	if size != len(o.Delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, fmt.Errorf("%w: invalid CSV delimiter %q", ErrInvalidMapping, o.Delimiter)
+	}
+	return r, nil
+}
+
+func (o *CSVOptions) validate() error {
+	if _, err := o.delimiter(); err != nil {
+		return err
+	}
+	switch o.Quotes {
+	case "", "strict", "lazy":
+		return nil
+	}
+	return fmt.Errorf("%w: CSV quotes must be strict or lazy", ErrInvalidMapping)
+}
+
+// CSVItems streams the rows of a CSV feed. Each row is an item whose
+// children are named after the header columns.
+type CSVItems struct {
+	reader *csv.Reader
+	header []string
+}
+
+// NewCSVItems reads the header row, if any, and returns the rows after it
+func NewCSVItems(r io.Reader, opts *CSVOptions) (*CSVItems, error) {
+	if opts == nil {
+		opts = &CSVOptions{}
+	}
+	delimiter, err := opts.delimiter()
+	if err != nil {
+		return nil, err
+	}
+
+	if isUTF8(strings.ToLower(opts.Encoding)) {
+		r = transform.NewReader(r, utf8Repair{})
+	} else if r, err = CharsetReader(opts.Encoding, r); err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.LazyQuotes = opts.Quotes == "lazy"
+	reader.FieldsPerRecord = -1
+	items := &CSVItems{reader: reader}
+
+	if !opts.NoHeader {
+		header, err := reader.Read()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, name := range header {
+			if i == 0 {
+				name = strings.TrimPrefix(name, "\ufeff")
+			}
+			items.header = append(items.header, strings.TrimSpace(name))
+		}
+	}
+	return items, nil
+}
+
+// Next returns the next row, io.EOF after the last one
+func (c *CSVItems) Next() (*Node, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	node := &Node{Name: "row", Children: make([]*Node, 0, len(record))}
+	for i, value := range record {
+		name := strconv.Itoa(i + 1)
+		if i < len(c.header) && c.header[i] != "" {
+			name = c.header[i]
+		}
+		node.Children = append(node.Children, &Node{Name: name, Text: value})
+	}
+	return node, nil
+}
@@ -0,0 +1,37 @@
+package feeds
+
+import (
+	"fmt"
+	"io"
+)
+
+// Feed types, the supplier's feed_type
+const (
+	TypeXML       = "xml"
+	TypeCSV       = "csv"
+	TypeJSON      = "json"
+	TypeJSONLines = "jsonl"
+)
+
+// Items streams the items of a feed
+type Items interface {
+	// Next returns the next item, io.EOF after the last one
+	Next() (*Node, error)
+}
+
+// NewItems returns the items of a feed opened with NewReader. itemPath
+// locates the items in XML and JSON feeds; CSV feeds are read with the
+// mapping's CSV options.
+func NewItems(r io.Reader, feedType, itemPath string, m *Mapping) (Items, error) {
+	switch feedType {
+	case "", TypeXML:
+		return NewXMLItems(r, itemPath), nil
+	case TypeCSV:
+		return NewCSVItems(r, m.CSV)
+	case TypeJSON:
+		return NewJSONItems(r, itemPath, false), nil
+	case TypeJSONLines:
+		return NewJSONItems(r, "", true), nil
+	}
+	return nil, fmt.Errorf("unsupported feed type %q", feedType)
+}
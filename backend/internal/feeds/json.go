@@ -0,0 +1,152 @@
+package feeds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONItems streams the items of a JSON feed: the elements of the root
+// array, of the array at the item path (object keys separated by "/", e.g.
+// "data/products"), or, in JSON lines, every top-level object. Object keys
+// become child nodes; arrays become repeated children of the same name,
+// so lists of images or parameters are read like repeated XML elements.
+type JSONItems struct {
+	decoder *json.Decoder
+	path    []string
+	lines   bool
+	started bool
+}
+
+// NewJSONItems returns the items in r
+func NewJSONItems(r io.Reader, itemPath string, lines bool) *JSONItems {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var path []string
+	for _, step := range strings.Split(itemPath, "/") {
+		if step != "" {
+			path = append(path, step)
+		}
+	}
+	return &JSONItems{decoder: decoder, path: path, lines: lines}
+}
+
+// Next returns the next item, io.EOF after the last one
+func (j *JSONItems) Next() (*Node, error) {
+	if !j.started {
+		j.started = true
+		if !j.lines {
+			if err := j.seek(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !j.decoder.More() {
+		return nil, io.EOF
+	}
+	var v interface{}
+	if err := j.decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return jsonNode("item", v), nil
+}
+
+// seek moves the decoder into the item array. A root array is the item
+// array whatever the path.
+func (j *JSONItems) seek() error {
+	token, err := j.decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == json.Delim('[') {
+		return nil
+	}
+
+	for _, key := range j.path {
+		if token != json.Delim('{') {
+			return fmt.Errorf("item path %q: %q is not inside an object", strings.Join(j.path, "/"), key)
+		}
+		found := false
+		for j.decoder.More() {
+			k, err := j.decoder.Token()
+			if err != nil {
+				return err
+			}
+			if k == key {
+				found = true
+				break
+			}
+			if err := skipJSONValue(j.decoder); err != nil {
+				return err
+			}
+		}
+		if !found {
+			return fmt.Errorf("item path %q not found", strings.Join(j.path, "/"))
+		}
+		if token, err = j.decoder.Token(); err != nil {
+			return err
+		}
+	}
+	if token != json.Delim('[') {
+		return fmt.Errorf("item path %q is not an array", strings.Join(j.path, "/"))
+	}
+	return nil
+}
+
+// skipJSONValue skips the next value without holding it in memory
+func skipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func jsonNode(name string, v interface{}) *Node {
+	node := &Node{Name: name}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			node.Children = append(node.Children, jsonChildren(key, v[key])...)
+		}
+	case string:
+		node.Text = v
+	case json.Number:
+		node.Text = v.String()
+	case bool:
+		node.Text = strconv.FormatBool(v)
+	}
+	return node
+}
+
+// jsonChildren returns a node per array element, or one for other values
+func jsonChildren(name string, v interface{}) []*Node {
+	list, ok := v.([]interface{})
+	if !ok {
+		return []*Node{jsonNode(name, v)}
+	}
+	var nodes []*Node
+	for _, item := range list {
+		nodes = append(nodes, jsonChildren(name, item)...)
+	}
+	return nodes
+}
@@ -0,0 +1,338 @@
+package feeds
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"megashop/internal/models"
+	"megashop/internal/pricing"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidMapping is returned for field mappings that cannot be applied
+var ErrInvalidMapping = errors.New("invalid field mapping")
+
+// Mapping maps the values of a feed item onto a supplier product. It is
+// the supplier's field_mappings, e.g. for a Heureka-like feed:
+//
+//	{
+//	  "fields": {
+//	    "external_id": "ITEM_ID", "name": "PRODUCTNAME", "ean": "EAN",
+//	    "price_vat": "PRICE_VAT", "category": "CATEGORYTEXT",
+//	    "producer_name": "MANUFACTURER", "stock": "STOCK/AMOUNT"
+//	  },
+//	  "images": ["IMGURL", "IMGURL_ALTERNATIVE"],
+//	  "parameters": [{"path": "PARAM", "name": "PARAM_NAME", "value": "VAL"}],
+//	  "defaults": {"vat_rate": "21"}
+//	}
+//
+// Fields are named after the JSON fields of models.SupplierProduct, plus
+// "category", the full category path split by the supplier's category
+// separator. Values are item paths as understood by Node.Values, in CSV
+// feeds the column names; "a|b" takes the first of the paths with a value.
+type Mapping struct {
+	Fields       map[string]string `json:"fields"`
+	Images       []string          `json:"images,omitempty"`        // each path may repeat, the first image is the main one
+	Parameters   []ParamMapping    `json:"parameters,omitempty"`    // stored in the technical_specs section "Parameters"
+	Defaults     map[string]string `json:"defaults,omitempty"`      // values of fields the item lacks
+	DecimalComma *bool             `json:"decimal_comma,omitempty"` // numbers use "," as decimal point; guessed per value when unset
+	CSV          *CSVOptions       `json:"csv,omitempty"`
+
+	CategorySeparator string `json:"-"`
+	ItemPath          string `json:"-"` // where presets find their items
+
+	// adjust lets presets read what fields cannot express, before prices
+	// and stock status are completed
+	adjust func(p *models.SupplierProduct, item *Node, params map[string]string)
+}
+
+// parametersSection is the technical_specs section mapped parameters are
+// stored in, laid out like Action's sections: {"parameters": {name: value}}
+const parametersSection = "Parameters"
+
+// availableStock is the stock of items reported in stock without a
+// quantity, as for Action's "greater than" availability
+const availableStock = 200
+
+// ParamMapping reads a list of name/value parameters: Path selects the
+// repeated parameter nodes, Name and Value are paths within each of them
+type ParamMapping struct {
+	Path  string `json:"path"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// fieldSetters sets a text, flag or date product field from its feed value
+var fieldSetters = map[string]func(p *models.SupplierProduct, v string){
+	"external_id":                  func(p *models.SupplierProduct, v string) { p.ExternalID = v },
+	"item_group_id":                func(p *models.SupplierProduct, v string) { p.ItemGroupID = v },
+	"ean":                          func(p *models.SupplierProduct, v string) { p.EAN = v },
+	"manufacturer_part_number":     func(p *models.SupplierProduct, v string) { p.ManufacturerPartNumber = v },
+	"name":                         func(p *models.SupplierProduct, v string) { p.Name = v },
+	"description":                  func(p *models.SupplierProduct, v string) { p.Description = v },
+	"on_order":                     func(p *models.SupplierProduct, v string) { p.OnOrder = parseBool(v) },
+	"additional_availability_info": func(p *models.SupplierProduct, v string) { p.AdditionalAvailabilityInfo = v },
+	"eta":                          func(p *models.SupplierProduct, v string) { p.ETA = parseDate(v) },
+	"main_category_tree":           func(p *models.SupplierProduct, v string) { p.MainCategoryTree = v },
+	"category_tree":                func(p *models.SupplierProduct, v string) { p.CategoryTree = v },
+	"sub_category_tree":            func(p *models.SupplierProduct, v string) { p.SubCategoryTree = v },
+	"category_id_external":         func(p *models.SupplierProduct, v string) { p.CategoryIDExternal = v },
+	"producer_id_external":         func(p *models.SupplierProduct, v string) { p.ProducerIDExternal = v },
+	"producer_name":                func(p *models.SupplierProduct, v string) { p.ProducerName = v },
+	"weight_unit":                  func(p *models.SupplierProduct, v string) { p.WeightUnit = v },
+	"size_unit":                    func(p *models.SupplierProduct, v string) { p.SizeUnit = v },
+	"special_offer":                func(p *models.SupplierProduct, v string) { p.SpecialOffer = parseBool(v) },
+	"is_large":                     func(p *models.SupplierProduct, v string) { p.IsLarge = parseBool(v) },
+	"small_pallet":                 func(p *models.SupplierProduct, v string) { p.SmallPallet = parseBool(v) },
+	"warranty":                     func(p *models.SupplierProduct, v string) { p.Warranty = v },
+	"date_added":                   func(p *models.SupplierProduct, v string) { p.DateAdded = parseDate(v) },
+}
+
+// numberSetters sets a numeric product field
+var numberSetters = map[string]func(p *models.SupplierProduct, v float64){
+	"price_net":           func(p *models.SupplierProduct, v float64) { p.PriceNet = v },
+	"price_vat":           func(p *models.SupplierProduct, v float64) { p.PriceVAT = v },
+	"vat_rate":            func(p *models.SupplierProduct, v float64) { p.VATRate = v },
+	"srp":                 func(p *models.SupplierProduct, v float64) { p.SRP = v },
+	"stock":               func(p *models.SupplierProduct, v float64) { p.Stock = int(v) },
+	"shipping_time_hours": func(p *models.SupplierProduct, v float64) { p.ShippingTimeHours = int(v) },
+	"incoming_stock":      func(p *models.SupplierProduct, v float64) { p.IncomingStock = int(v) },
+	"weight":              func(p *models.SupplierProduct, v float64) { p.Weight = v },
+	"width":               func(p *models.SupplierProduct, v float64) { p.Width = v },
+	"length":              func(p *models.SupplierProduct, v float64) { p.Length = v },
+	"height":              func(p *models.SupplierProduct, v float64) { p.Height = v },
+	"dimensional_weight":  func(p *models.SupplierProduct, v float64) { p.DimensionalWeight = v },
+}
+
+// categoryField is split into the three category trees
+const categoryField = "category"
+
+// ParseMapping parses and validates field mappings
+func ParseMapping(raw json.RawMessage) (*Mapping, error) {
+	m, err := decodeMapping(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func decodeMapping(raw json.RawMessage) (*Mapping, error) {
+	m := &Mapping{}
+	if len(bytes.TrimSpace(raw)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(m); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMapping, err)
+		}
+	}
+	return m, nil
+}
+
+func (m *Mapping) validate() error {
+	for _, fields := range []map[string]string{m.Fields, m.Defaults} {
+		for field := range fields {
+			if !isField(field) {
+				return fmt.Errorf("%w: unknown field %q", ErrInvalidMapping, field)
+			}
+		}
+	}
+	for _, field := range []string{"external_id", "name"} {
+		if m.Fields[field] == "" {
+			return fmt.Errorf("%w: %s must be mapped", ErrInvalidMapping, field)
+		}
+	}
+	for _, pm := range m.Parameters {
+		if pm.Path == "" || pm.Name == "" {
+			return fmt.Errorf("%w: parameters need a path and a name", ErrInvalidMapping)
+		}
+	}
+	if m.CSV != nil {
+		if err := m.CSV.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isField(field string) bool {
+	_, text := fieldSetters[field]
+	_, number := numberSetters[field]
+	return text || number || field == categoryField
+}
+
+// Map builds the supplier product of a feed item
+func (m *Mapping) Map(supplierID uuid.UUID, item *Node) *models.SupplierProduct {
+	product := &models.SupplierProduct{
+		ID:         uuid.New(),
+		SupplierID: supplierID,
+		LastSeenAt: time.Now(),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	for field, set := range fieldSetters {
+		if v := m.value(item, field); v != "" {
+			set(product, v)
+		}
+	}
+	for field, set := range numberSetters {
+		if v := m.value(item, field); v != "" {
+			set(product, parseNumber(v, m.DecimalComma))
+		}
+	}
+
+	if category := m.value(item, categoryField); category != "" {
+		separator := m.CategorySeparator
+		if separator == "" {
+			separator = ">"
+		}
+		setCategoryTrees(product, category, separator)
+	}
+
+	product.Multimedia = []models.ProductMultimedia{}
+	product.Images = []models.ProductImage{}
+	for _, path := range m.Images {
+		for _, url := range item.Values(path) {
+			product.Images = append(product.Images, models.ProductImage{
+				URL:      url,
+				Position: len(product.Images),
+				IsMain:   len(product.Images) == 0,
+			})
+		}
+	}
+
+	params := make(map[string]string)
+	for _, pm := range m.Parameters {
+		for _, node := range item.Find(pm.Path) {
+			if name := node.Value(pm.Name); name != "" {
+				params[name] = node.Value(pm.Value)
+			}
+		}
+	}
+
+	if m.adjust != nil {
+		m.adjust(product, item, params)
+	}
+
+	product.TechnicalSpecs = map[string]interface{}{}
+	if len(params) > 0 {
+		product.TechnicalSpecs[parametersSection] = map[string]interface{}{"parameters": params}
+	}
+
+	// Feeds carry either price, the other one follows from the VAT rate
+	vat := product.VATRate
+	if vat == 0 {
+		vat = pricing.DefaultVATRate
+	}
+	switch {
+	case product.PriceVAT == 0 && product.PriceNet > 0:
+		product.PriceVAT = product.PriceNet * (1 + vat/100)
+	case product.PriceNet == 0 && product.PriceVAT > 0:
+		product.PriceNet = product.PriceVAT / (1 + vat/100)
+	}
+
+	switch {
+	case product.Stock > 0:
+		product.StockStatus = "in_stock"
+	case product.OnOrder:
+		product.StockStatus = "on_order"
+	default:
+		product.StockStatus = "out_of_stock"
+	}
+
+	return product
+}
+
+// setCategoryTrees splits a category path into the product's three
+// category trees; deeper levels stay together in the last one
+func setCategoryTrees(p *models.SupplierProduct, category, separator string) {
+	var trees []string
+	for _, part := range strings.Split(category, separator) {
+		if part = strings.TrimSpace(part); part != "" {
+			trees = append(trees, part)
+		}
+	}
+	if len(trees) > 3 {
+		trees = append(trees[:2], strings.Join(trees[2:], " > "))
+	}
+	for i, tree := range []*string{&p.MainCategoryTree, &p.CategoryTree, &p.SubCategoryTree} {
+		if i < len(trees) {
+			*tree = trees[i]
+		}
+	}
+}
+
+// value returns the item's value of a field, or its default
+func (m *Mapping) value(item *Node, field string) string {
+	for _, path := range strings.Split(m.Fields[field], "|") {
+		if path == "" {
+			continue
+		}
+		if v := item.Value(path); v != "" {
+			return v
+		}
+	}
+	return m.Defaults[field]
+}
+
+// parseNumber reads numbers as suppliers write them: "1 299,90 Kč",
+// "1.299,90", "21%", "> 100". Without decimalComma the last of "," and "."
+// is the decimal point when both occur, a separator repeated is a
+// thousands separator, and a lone "," is taken for the decimal point.
+// Unreadable values are 0.
+func parseNumber(s string, decimalComma *bool) float64 {
+	s = strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' || r == '-' {
+			return r
+		}
+		return -1
+	}, s)
+	comma, dot := strings.LastIndex(s, ","), strings.LastIndex(s, ".")
+	if decimalComma == nil {
+		guess := comma > dot // with both, the last one is the decimal point
+		switch {
+		case comma >= 0 && dot >= 0:
+		case strings.Count(s, ",") > 1:
+			guess = false
+		case strings.Count(s, ".") > 1:
+			guess = true
+		}
+		decimalComma = &guess
+	}
+	if *decimalComma {
+		s = strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func parseBool(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "y", "yes", "true", "t", "ano", "áno":
+		return true
+	}
+	return false
+}
+
+func parseDate(s string) time.Time {
+	for _, format := range []string{time.RFC3339, "2006-01-02T15:04Z0700", "2006-01-02 15:04:05", "2006-01-02", "02.01.2006", "2.1.2006", "01/02/2006"} {
+		if t, err := time.Parse(format, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
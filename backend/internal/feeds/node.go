@@ -0,0 +1,64 @@
+package feeds
+
+import "strings"
+
+// Node is one feed item as a tree of named values: an XML element with its
+// attributes, text and child elements, a CSV row with a child per column or
+// a JSON object with a child per key
+type Node struct {
+	Name     string            `json:"name"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Text     string            `json:"text,omitempty"`
+	Children []*Node           `json:"children,omitempty"`
+}
+
+// Find returns the descendants at a slash-separated path of element names,
+// e.g. "IMAGES/IMAGE". Every repetition of every step is followed, so
+// repeated nodes come back in feed order. "" and "." are the node itself.
+func (n *Node) Find(path string) []*Node {
+	nodes := []*Node{n}
+	for _, step := range strings.Split(path, "/") {
+		if step == "" || step == "." {
+			continue
+		}
+		var next []*Node
+		for _, node := range nodes {
+			for _, child := range node.Children {
+				if child.Name == step {
+					next = append(next, child)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// Values returns the texts at path; a last step of "@name" selects that
+// attribute instead, e.g. "IMAGES/IMAGE/@url". Empty values are skipped.
+func (n *Node) Values(path string) []string {
+	attr := ""
+	if i := strings.LastIndex(path, "@"); i >= 0 && (i == 0 || path[i-1] == '/') {
+		path, attr = path[:i], path[i+1:]
+	}
+
+	var values []string
+	for _, node := range n.Find(path) {
+		v := node.Text
+		if attr != "" {
+			v = node.Attrs[attr]
+		}
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Value returns the first value at path, "" if there is none
+func (n *Node) Value(path string) string {
+	if values := n.Values(path); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
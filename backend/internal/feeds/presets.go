@@ -0,0 +1,177 @@
+package feeds
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"megashop/internal/models"
+)
+
+// Feed formats with a built-in mapping, the supplier's feed_format
+const (
+	FormatHeureka = "heureka" // Heureka.cz/.sk product feed, SHOPITEM elements
+	FormatGoogle  = "google"  // Google Merchant Center RSS feed, item elements
+)
+
+// IsPreset reports whether a feed format comes with a built-in mapping
+func IsPreset(format string) bool {
+	return format == FormatHeureka || format == FormatGoogle
+}
+
+// Preset returns the built-in mapping of a feed format, nil if it has none
+func Preset(format string) *Mapping {
+	switch format {
+	case FormatHeureka:
+		return &Mapping{
+			Fields: map[string]string{
+				"external_id":              "ITEM_ID",
+				"name":                     "PRODUCTNAME|PRODUCT",
+				"description":              "DESCRIPTION",
+				"ean":                      "EAN",
+				"manufacturer_part_number": "PRODUCTNO",
+				"producer_name":            "MANUFACTURER",
+				"price_vat":                "PRICE_VAT",
+				"vat_rate":                 "VAT",
+				"stock":                    "STOCK/AMOUNT",
+				"item_group_id":            "ITEMGROUP_ID",
+			},
+			Images:     []string{"IMGURL", "IMGURL_ALTERNATIVE"},
+			Parameters: []ParamMapping{{Path: "PARAM", Name: "PARAM_NAME", Value: "VAL"}},
+			ItemPath:   "SHOPITEM",
+			adjust:     adjustHeureka,
+		}
+	case FormatGoogle:
+		// Element names are matched without their namespace prefix, so
+		// g:id and id are the same
+		return &Mapping{
+			Fields: map[string]string{
+				"external_id":              "id",
+				"name":                     "title",
+				"description":              "description",
+				"ean":                      "gtin",
+				"manufacturer_part_number": "mpn",
+				"producer_name":            "brand",
+				"price_vat":                "sale_price|price",
+				"srp":                      "price",
+				"category":                 "product_type",
+				"category_id_external":     "google_product_category",
+				"item_group_id":            "item_group_id",
+				"weight":                   "shipping_weight|product_weight",
+				"eta":                      "availability_date",
+			},
+			Images:            []string{"image_link", "additional_image_link"},
+			Parameters:        []ParamMapping{{Path: "product_detail", Name: "attribute_name", Value: "attribute_value"}},
+			CategorySeparator: ">",
+			ItemPath:          "item",
+			adjust:            adjustGoogle,
+		}
+	}
+	return nil
+}
+
+// PresetMapping returns the preset of a feed format with the supplier's
+// field mappings on top: mapped fields and defaults replace the preset's,
+// images, parameters and options replace them when given
+func PresetMapping(format string, raw json.RawMessage) (*Mapping, error) {
+	m := Preset(format)
+	custom, err := decodeMapping(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for field, path := range custom.Fields {
+		m.Fields[field] = path
+	}
+	if len(custom.Defaults) > 0 {
+		m.Defaults = custom.Defaults
+	}
+	if len(custom.Images) > 0 {
+		m.Images = custom.Images
+	}
+	if len(custom.Parameters) > 0 {
+		m.Parameters = custom.Parameters
+	}
+	if custom.DecimalComma != nil {
+		m.DecimalComma = custom.DecimalComma
+	}
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// adjustHeureka reads CATEGORYTEXT and DELIVERY_DATE. The category path is
+// separated by "|", older feeds use ">", and usually starts with the
+// Heureka portal ("Heureka.cz | Elektronika | ..."), which is dropped.
+// DELIVERY_DATE is the number of days to dispatch, 0 meaning in stock, or
+// the date the item is available from.
+func adjustHeureka(p *models.SupplierProduct, item *Node, params map[string]string) {
+	if category := item.Value("CATEGORYTEXT"); category != "" {
+		separator := "|"
+		if !strings.Contains(category, separator) && strings.Contains(category, ">") {
+			separator = ">"
+		}
+		parts := strings.SplitN(category, separator, 2)
+		if root := strings.ToLower(strings.TrimSpace(parts[0])); strings.HasPrefix(root, "heureka.") {
+			category = ""
+			if len(parts) == 2 {
+				category = parts[1]
+			}
+		}
+		setCategoryTrees(p, category, separator)
+	}
+
+	delivery := item.Value("DELIVERY_DATE")
+	if days, err := strconv.Atoi(delivery); err == nil {
+		if days == 0 && item.Value("STOCK/AMOUNT") == "" {
+			p.Stock = availableStock
+		}
+		if days > 0 {
+			p.ShippingTimeHours = days * 24
+			p.OnOrder = p.Stock == 0
+		}
+	} else if eta := parseDate(delivery); !eta.IsZero() {
+		p.ETA = eta
+		p.OnOrder = p.Stock == 0
+	}
+}
+
+// googleVariantAttributes are the attributes Google feeds tell variants of
+// one item group apart by, kept as parameters
+var googleVariantAttributes = []struct{ path, name string }{
+	{"color", "Color"},
+	{"size", "Size"},
+	{"material", "Material"},
+	{"pattern", "Pattern"},
+	{"gender", "Gender"},
+	{"age_group", "Age group"},
+}
+
+// adjustGoogle reads availability, the weight unit ("1.5 kg") and the
+// variant attributes
+func adjustGoogle(p *models.SupplierProduct, item *Node, params map[string]string) {
+	switch strings.ReplaceAll(strings.ToLower(item.Value("availability")), "_", " ") {
+	case "in stock":
+		if p.Stock == 0 {
+			p.Stock = availableStock
+		}
+	case "preorder", "backorder":
+		p.OnOrder = true
+	}
+
+	weight := item.Value("shipping_weight")
+	if weight == "" {
+		weight = item.Value("product_weight")
+	}
+	if unit := strings.TrimLeft(weight, "0123456789.,- "); unit != "" {
+		p.WeightUnit = unit
+	}
+
+	for _, attr := range googleVariantAttributes {
+		if v := item.Value(attr.path); v != "" {
+			params[attr.name] = v
+		}
+	}
+}
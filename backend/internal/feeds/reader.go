@@ -0,0 +1,250 @@
+package feeds
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// peekSize is how much of the feed is looked at for the XML declaration
+const peekSize = 1024
+
+var encodingDecl = regexp.MustCompile(`encoding=["']([A-Za-z0-9._-]+)["']`)
+
+// Reader streams a supplier feed cleaned up for parsing, without holding
+// more than a small buffer of it in memory:
+//   - gzip compression is detected from the magic bytes and removed
+//   - in XML feeds declared (or assumed) UTF-8 and in JSON feeds, bytes
+//     that are not valid UTF-8 are read as Windows-1252, which is what
+//     suppliers like Action send
+//   - in XML feeds, control characters illegal in XML are dropped and
+//     ampersands that do not start an entity are escaped
+//
+// CSV feeds are only decompressed: their charset is a CSV option.
+type Reader struct {
+	io.Reader
+	gz *gzip.Reader
+}
+
+// NewReader wraps a raw feed of the given type, compressed or not
+func NewReader(r io.Reader, feedType string) (*Reader, error) {
+	br := bufio.NewReaderSize(r, peekSize)
+	fr := &Reader{}
+
+	magic, _ := br.Peek(2)
+	var src io.Reader = br
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		fr.gz = gz
+		src = gz
+	}
+
+	switch feedType {
+	case TypeCSV:
+		fr.Reader = src
+	case TypeJSON, TypeJSONLines:
+		fr.Reader = transform.NewReader(src, utf8Repair{})
+	default:
+		plain := bufio.NewReaderSize(src, peekSize)
+		head, _ := plain.Peek(peekSize)
+
+		transforms := []transform.Transformer{}
+		if isUTF8(declaredEncoding(head)) {
+			transforms = append(transforms, utf8Repair{})
+		}
+		transforms = append(transforms, controlStripper{}, ampersandFixer{})
+		fr.Reader = transform.NewReader(plain, transform.Chain(transforms...))
+	}
+	return fr, nil
+}
+
+// Close releases the gzip reader; the underlying reader is the caller's
+func (r *Reader) Close() error {
+	if r.gz != nil {
+		return r.gz.Close()
+	}
+	return nil
+}
+
+// declaredEncoding returns the encoding of the XML declaration, "" if none
+func declaredEncoding(head []byte) string {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(head, []byte("<?xml")) {
+		return ""
+	}
+	if end := bytes.Index(head, []byte("?>")); end >= 0 {
+		head = head[:end]
+	}
+	m := encodingDecl.FindSubmatch(head)
+	if m == nil {
+		return ""
+	}
+	return strings.ToLower(string(m[1]))
+}
+
+func isUTF8(encoding string) bool {
+	return encoding == "" || encoding == "utf-8" || encoding == "utf8"
+}
+
+// utf8Repair passes valid UTF-8 through and decodes every other byte as
+// Windows-1252
+type utf8Repair struct{ transform.NopResetter }
+
+func (utf8Repair) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		c := src[nSrc]
+		if c < utf8.RuneSelf {
+			if nDst >= len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = c
+			nDst++
+			nSrc++
+			continue
+		}
+
+		if !atEOF && !utf8.FullRune(src[nSrc:]) {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		r, size := utf8.DecodeRune(src[nSrc:])
+		if r == utf8.RuneError && size == 1 {
+			r = charmap.Windows1252.DecodeByte(c)
+			if nDst+utf8.RuneLen(r) > len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			nDst += utf8.EncodeRune(dst[nDst:], r)
+			nSrc++
+			continue
+		}
+		if nDst+size > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], src[nSrc:nSrc+size])
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+// controlStripper drops the control characters XML 1.0 does not allow.
+// Works on bytes: in UTF-8 and the single-byte charsets they never occur
+// inside a multi-byte character.
+type controlStripper struct{ transform.NopResetter }
+
+func (controlStripper) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for ; nSrc < len(src); nSrc++ {
+		c := src[nSrc]
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			continue
+		}
+		if nDst >= len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = c
+		nDst++
+	}
+	return nDst, nSrc, nil
+}
+
+// maxEntityLen is the longest entity after the ampersand: "#x10FFFF;"
+const maxEntityLen = 9
+
+// ampersandFixer escapes "&" unless it starts one of the predefined XML
+// entities or a character reference
+type ampersandFixer struct{ transform.NopResetter }
+
+func (ampersandFixer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for ; nSrc < len(src); nSrc++ {
+		c := src[nSrc]
+		if c != '&' {
+			if nDst >= len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = c
+			nDst++
+			continue
+		}
+
+		entity, decided := isEntity(src[nSrc+1:], atEOF)
+		if !decided {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		out := "&amp;"
+		if entity {
+			out = "&"
+		}
+		if nDst+len(out) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], out)
+	}
+	return nDst, nSrc, nil
+}
+
+// isEntity reports whether s, the text after an ampersand, starts with an
+// entity name and ";". decided is false when more input is needed to tell.
+func isEntity(s []byte, atEOF bool) (entity, decided bool) {
+	end := bytes.IndexByte(s[:min(len(s), maxEntityLen+1)], ';')
+	if end < 0 {
+		if len(s) <= maxEntityLen && !atEOF {
+			return false, false
+		}
+		return false, true
+	}
+
+	name := s[:end]
+	switch string(name) {
+	case "amp", "lt", "gt", "quot", "apos":
+		return true, true
+	}
+	if len(name) < 2 || name[0] != '#' {
+		return false, true
+	}
+	digits, isHex := name[1:], false
+	if digits[0] == 'x' {
+		digits, isHex = digits[1:], true
+	}
+	if len(digits) == 0 {
+		return false, true
+	}
+	for _, d := range digits {
+		switch {
+		case d >= '0' && d <= '9':
+		case isHex && (d >= 'a' && d <= 'f' || d >= 'A' && d <= 'F'):
+		default:
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// CountingReader counts the bytes read through it, for progress reporting
+type CountingReader struct {
+	r io.Reader
+	n int64
+}
+
+// NewCountingReader wraps r
+func NewCountingReader(r io.Reader) *CountingReader {
+	return &CountingReader{r: r}
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Count returns the number of bytes read so far
+func (c *CountingReader) Count() int64 {
+	return c.n
+}
@@ -0,0 +1,138 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"io"
+	"log"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// NewXMLDecoder returns a lenient decoder for supplier XML: unknown
+// entities and sloppy markup are tolerated and the common European
+// charsets are converted to UTF-8
+func NewXMLDecoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.CharsetReader = CharsetReader
+	return decoder
+}
+
+// CharsetReader converts various charsets to UTF-8
+func CharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	charset = strings.ToLower(charset)
+	switch charset {
+	case "utf-8", "utf8":
+		return input, nil
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
+		return transform.NewReader(input, charmap.ISO8859_1.NewDecoder()), nil
+	case "iso-8859-2", "iso8859-2", "latin2", "latin-2":
+		return transform.NewReader(input, charmap.ISO8859_2.NewDecoder()), nil
+	case "windows-1250", "cp1250":
+		return transform.NewReader(input, charmap.Windows1250.NewDecoder()), nil
+	case "windows-1252", "cp1252":
+		return transform.NewReader(input, charmap.Windows1252.NewDecoder()), nil
+	default:
+		// Try Windows-1252 as fallback (common for European content)
+		log.Printf("[FEEDS] Unknown charset '%s', trying Windows-1252", charset)
+		return transform.NewReader(input, charmap.Windows1252.NewDecoder()), nil
+	}
+}
+
+// XMLItems streams the items of an XML feed one at a time. The item path
+// names the item element and optionally its ancestors, e.g. "SHOPITEM" or
+// "SHOP/SHOPITEM"; a leading "/" anchors it at the document root.
+type XMLItems struct {
+	decoder  *xml.Decoder
+	path     []string
+	anchored bool
+	stack    []string
+}
+
+// NewXMLItems returns the items at itemPath in r
+func NewXMLItems(r io.Reader, itemPath string) *XMLItems {
+	itemPath = strings.TrimSpace(itemPath)
+	anchored := strings.HasPrefix(itemPath, "/") && !strings.HasPrefix(itemPath, "//")
+	var path []string
+	for _, step := range strings.Split(itemPath, "/") {
+		if step != "" {
+			path = append(path, step)
+		}
+	}
+	return &XMLItems{decoder: NewXMLDecoder(r), path: path, anchored: anchored}
+}
+
+// Next returns the next item, io.EOF after the last one
+func (x *XMLItems) Next() (*Node, error) {
+	if len(x.path) == 0 {
+		return nil, io.EOF
+	}
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			x.stack = append(x.stack, t.Name.Local)
+			if x.matches() {
+				x.stack = x.stack[:len(x.stack)-1]
+				return readNode(x.decoder, t)
+			}
+		case xml.EndElement:
+			if len(x.stack) > 0 {
+				x.stack = x.stack[:len(x.stack)-1]
+			}
+		}
+	}
+}
+
+func (x *XMLItems) matches() bool {
+	if len(x.stack) < len(x.path) || (x.anchored && len(x.stack) != len(x.path)) {
+		return false
+	}
+	tail := x.stack[len(x.stack)-len(x.path):]
+	for i, step := range x.path {
+		if tail[i] != step {
+			return false
+		}
+	}
+	return true
+}
+
+// readNode reads the element opened by start up to its end
+func readNode(decoder *xml.Decoder, start xml.StartElement) (*Node, error) {
+	node := &Node{Name: start.Name.Local}
+	if len(start.Attr) > 0 {
+		node.Attrs = make(map[string]string, len(start.Attr))
+		for _, a := range start.Attr {
+			node.Attrs[a.Name.Local] = a.Value
+		}
+	}
+
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := readNode(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			node.Text = strings.TrimSpace(text.String())
+			return node, nil
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"megashop/internal/database"
+	"megashop/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== EMAIL OUTBOX ====================
+
+// ListEmailOutbox handles GET /api/admin/email-outbox
+// Query: status (pending, sending, sent, dead, or "failed" for everything
+// that failed at least once), page, limit
+func ListEmailOutbox(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := c.Query("status")
+		switch status {
+		case "", "failed", models.OutboxPending, models.OutboxSending, models.OutboxSent, models.OutboxDead:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+		result, err := db.ListOutboxEmails(c.Request.Context(), status, page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetEmailOutboxMessage handles GET /api/admin/email-outbox/:id
+// Returns the message including its HTML body
+func GetEmailOutboxMessage(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email ID"})
+			return
+		}
+
+		msg, err := db.GetOutboxEmail(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if msg == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Email not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, msg)
+	}
+}
+
+// ResendEmail handles POST /api/admin/email-outbox/:id/resend
+// Queues a dead or sent message again with a fresh set of attempts
+func ResendEmail(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email ID"})
+			return
+		}
+
+		ok, err := db.ResendEmail(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			msg, err := db.GetOutboxEmail(ctx, id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if msg == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Email not found"})
+				return
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is still queued", "status": msg.Status})
+			return
+		}
+
+		msg, err := db.GetOutboxEmail(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, msg)
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"megashop/internal/config"
+	"megashop/internal/database"
+	"megashop/internal/email"
+	"megashop/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== EMAIL TEMPLATES ====================
+
+// ListEmailTemplates handles GET /api/admin/email-templates
+// Returns every editable template, customized or default
+func ListEmailTemplates(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var list []models.EmailTemplate
+		for _, def := range email.DefaultTemplates() {
+			t, err := db.GetEmailTemplate(ctx, def.Key)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if t == nil {
+				t = &def
+			}
+			t.Name = def.Name
+			list = append(list, *t)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list})
+	}
+}
+
+// GetEmailTemplate handles GET /api/admin/email-templates/:key
+func GetEmailTemplate(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Param("key")
+		def, ok := email.DefaultTemplate(key)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown template"})
+			return
+		}
+
+		t, err := db.GetEmailTemplate(c.Request.Context(), key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if t == nil {
+			t = &def
+		}
+		t.Name = def.Name
+
+		c.JSON(http.StatusOK, gin.H{"template": t, "default": def})
+	}
+}
+
+// UpdateEmailTemplate handles PUT /api/admin/email-templates/:key
+// Body: {"subject": "...", "body_html": "..."}. The template is rendered with
+// sample order data first, so a broken template is never stored.
+func UpdateEmailTemplate(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Param("key")
+		def, ok := email.DefaultTemplate(key)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown template"})
+			return
+		}
+
+		var req struct {
+			Subject  string `json:"subject" binding:"required"`
+			BodyHTML string `json:"body_html" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		t := models.EmailTemplate{Key: key, Name: def.Name, Subject: req.Subject, BodyHTML: req.BodyHTML}
+		if _, _, err := email.RenderTemplate(t, email.SampleOrderEmailData(cfg.ShopName, cfg.ShopURL)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid template: %v", err)})
+			return
+		}
+
+		var updatedBy *uuid.UUID
+		if userID, ok := c.Get("user_id"); ok {
+			if uid, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+				updatedBy = &uid
+			}
+		}
+
+		if err := db.SaveEmailTemplate(c.Request.Context(), &t, updatedBy); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// ResetEmailTemplate handles DELETE /api/admin/email-templates/:key
+// Goes back to the built-in template
+func ResetEmailTemplate(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Param("key")
+		def, ok := email.DefaultTemplate(key)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown template"})
+			return
+		}
+
+		if err := db.DeleteEmailTemplate(c.Request.Context(), key); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, def)
+	}
+}
+
+// PreviewEmailTemplate handles POST /api/admin/email-templates/:key/preview
+// Renders the posted (or else the current) template with sample order data
+func PreviewEmailTemplate(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Param("key")
+		def, ok := email.DefaultTemplate(key)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown template"})
+			return
+		}
+
+		var req struct {
+			Subject  string `json:"subject"`
+			BodyHTML string `json:"body_html"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		t := def
+		if stored, err := db.GetEmailTemplate(c.Request.Context(), key); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		} else if stored != nil {
+			t = *stored
+		}
+		if req.Subject != "" {
+			t.Subject = req.Subject
+		}
+		if req.BodyHTML != "" {
+			t.BodyHTML = req.BodyHTML
+		}
+
+		subject, html, err := email.RenderTemplate(t, email.SampleOrderEmailData(cfg.ShopName, cfg.ShopURL))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid template: %v", err)})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"subject": subject, "html": html})
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -100,11 +101,14 @@ func RegenerateHeurekaXML(db *database.Postgres, cfg *config.Config) gin.Handler
 	}
 }
 
-func regenerateFeed(db *database.Postgres, cfg *config.Config) {
+// errFeedGenerating is returned by regenerateFeed when a generation is already running
+var errFeedGenerating = errors.New("feed is already being generated")
+
+func regenerateFeed(db *database.Postgres, cfg *config.Config) error {
 	feedCache.Lock()
 	if feedCache.generating {
 		feedCache.Unlock()
-		return
+		return errFeedGenerating
 	}
 	feedCache.generating = true
 	feedCache.Unlock()
@@ -121,12 +125,12 @@ func regenerateFeed(db *database.Postgres, cfg *config.Config) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	exporter := export.NewHeurekaExporter(db.Pool(), cfg)
+	exporter := export.NewHeurekaExporter(db, cfg)
 
 	data, err := exporter.GenerateXMLBytes(ctx)
 	if err != nil {
 		log.Printf("[EXPORT] Error generating feed: %v", err)
-		return
+		return err
 	}
 
 	// Save to memory cache
@@ -142,6 +146,7 @@ func regenerateFeed(db *database.Postgres, cfg *config.Config) {
 
 	elapsed := time.Since(startTime)
 	log.Printf("[EXPORT] Feed generated: %d bytes in %v", len(data), elapsed)
+	return nil
 }
 
 // ExportInfo handles GET /api/export/info
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,7 +16,9 @@ import (
 	"megashop/internal/database"
 	"megashop/internal/email"
 	"megashop/internal/models"
+	"megashop/internal/payment"
 	"megashop/internal/search"
+	"megashop/internal/shipping"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -1114,6 +1117,7 @@ func CreateOrder(db *database.Postgres, cfg *config.Config, emailSvc *email.Serv
 			Items           []OrderItemReq  `json:"items,omitempty"`
 			PaymentMethod   string          `json:"payment_method"`
 			ShippingMethod  string          `json:"shipping_method"`
+			PickupPointID   string          `json:"pickup_point_id,omitempty"` // Packeta point for shipping_method packeta
 			BillingAddress  models.Address  `json:"billing_address"`
 			ShippingAddress models.Address  `json:"shipping_address"`
 			Note            string          `json:"note"`
@@ -1156,6 +1160,10 @@ func CreateOrder(db *database.Postgres, cfg *config.Config, emailSvc *email.Serv
 				if err != nil {
 					continue
 				}
+				if item.Quantity < 1 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity"})
+					return
+				}
 				// Fetch product to get name/SKU
 				product, err := db.GetProduct(ctx, productID)
 				name := ""
@@ -1194,8 +1202,47 @@ func CreateOrder(db *database.Postgres, cfg *config.Config, emailSvc *email.Serv
 			return
 		}
 
-		// Determine shipping price from method
-		shippingPrice := getShippingPrice(req.ShippingMethod, subtotal)
+		// Packeta parcels go to the pickup point chosen in checkout
+		var pickupPointID, pickupPointName string
+		if req.ShippingMethod == "packeta" {
+			point, err := db.GetPacketaPoint(ctx, strings.TrimSpace(req.PickupPointID))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if point == nil || !point.IsActive {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Select a valid Packeta pickup point"})
+				return
+			}
+			pickupPointID = point.ID
+			pickupPointName = fmt.Sprintf("%s, %s %s", point.Name, point.Zip, point.City)
+		}
+
+		// Shipping price from the method's rates and rules
+		rates, err := db.ShippingRateEngine(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		rateItems, err := db.ShippingRateItems(ctx, orderItems)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		destination := req.ShippingAddress
+		if destination.Country == "" && destination.CountryCode == "" {
+			destination = req.BillingAddress
+		}
+		rate, err := rates.Rate(req.ShippingMethod, shipping.RateRequest{
+			Country:  shipping.AddressCountry(destination),
+			Subtotal: subtotal,
+			Items:    rateItems,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shippingPrice := rate.Price
 		paymentFee := getPaymentFee(req.PaymentMethod)
 		tax := subtotal * 0.20 // 20% DPH
 		total := subtotal + shippingPrice + paymentFee + tax
@@ -1209,6 +1256,8 @@ func CreateOrder(db *database.Postgres, cfg *config.Config, emailSvc *email.Serv
 			PaymentStatus:   "pending",
 			PaymentMethod:   req.PaymentMethod,
 			ShippingMethod:  req.ShippingMethod,
+			PickupPointID:   pickupPointID,
+			PickupPointName: pickupPointName,
 			ShippingPrice:   shippingPrice,
 			Subtotal:        subtotal,
 			Tax:             tax,
@@ -1218,9 +1267,15 @@ func CreateOrder(db *database.Postgres, cfg *config.Config, emailSvc *email.Serv
 			ShippingAddress: shippingJSON,
 			Note:            req.Note,
 			Items:           orderItems,
+			ReservedUntil:   payment.ReservationExpiry(cfg, req.PaymentMethod, time.Now()),
 		}
 
 		if err := db.CreateOrder(ctx, order); err != nil {
+			var stockErr *database.InsufficientStockError
+			if errors.As(err, &stockErr) {
+				c.JSON(http.StatusConflict, gin.H{"error": stockErr.Error(), "items": stockErr.Items})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -1230,12 +1285,17 @@ func CreateOrder(db *database.Postgres, cfg *config.Config, emailSvc *email.Serv
 			db.Pool().Exec(ctx, "DELETE FROM cart_items WHERE cart_id = $1", req.CartID)
 		}
 
-		// Send confirmation email asynchronously
-		go func() {
-			if err := emailSvc.SendOrderConfirmation(order); err != nil {
-				log.Printf("[ORDER] Failed to send confirmation email for #%s: %v", order.OrderNumber, err)
-			}
-		}()
+		// Bank transfer: IBAN, variable symbol and PAY by square QR code for the thank-you page
+		instructions, err := payment.NewBankTransferInstructions(cfg, order, true)
+		if err != nil {
+			log.Printf("[ORDER] Failed to build transfer instructions for #%s: %v", order.OrderNumber, err)
+		}
+		order.PaymentInstructions = instructions
+
+		// Queue the confirmation email, the outbox worker delivers it
+		if err := emailSvc.SendOrderConfirmation(order); err != nil {
+			log.Printf("[ORDER] Failed to queue confirmation email for #%s: %v", order.OrderNumber, err)
+		}
 
 		c.JSON(http.StatusCreated, order)
 	}
@@ -1248,24 +1308,6 @@ type OrderItemReq struct {
 	Price     float64 `json:"price"`
 }
 
-// getShippingPrice returns shipping price based on method and order subtotal
-func getShippingPrice(method string, subtotal float64) float64 {
-	freeFrom := 50.0
-	if subtotal >= freeFrom {
-		return 0
-	}
-	prices := map[string]float64{
-		"packeta": 2.99,
-		"dpd":     4.49,
-		"gls":     3.99,
-		"posta":   2.49,
-	}
-	if p, ok := prices[method]; ok {
-		return p
-	}
-	return 4.99
-}
-
 // getPaymentFee returns fee for payment method
 func getPaymentFee(method string) float64 {
 	if method == "cod" {
@@ -1275,7 +1317,7 @@ func getPaymentFee(method string) float64 {
 }
 
 // GetOrder handles GET /api/orders/:id
-func GetOrder(db *database.Postgres) gin.HandlerFunc {
+func GetOrder(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		id, err := uuid.Parse(c.Param("id"))
@@ -1294,6 +1336,15 @@ func GetOrder(db *database.Postgres) gin.HandlerFunc {
 			return
 		}
 
+		// Payment details are only useful while the transfer is still awaited
+		if order.PaymentStatus == "pending" {
+			instructions, err := payment.NewBankTransferInstructions(cfg, order, true)
+			if err != nil {
+				log.Printf("[ORDER] Failed to build transfer instructions for #%s: %v", order.OrderNumber, err)
+			}
+			order.PaymentInstructions = instructions
+		}
+
 		c.JSON(http.StatusOK, order)
 	}
 }
@@ -1305,17 +1356,39 @@ func TrackOrder(db *database.Postgres) gin.HandlerFunc {
 		orderNumber := c.Param("number")
 
 		var order models.Order
+		var trackingStatus string
+		var trackedAt *time.Time
 		err := db.Pool().QueryRow(ctx, `
-			SELECT id, order_number, status, tracking_number, created_at, shipped_at
+			SELECT id, order_number, status, COALESCE(shipping_method, ''), COALESCE(tracking_number, ''),
+			       COALESCE(tracking_status, ''), tracking_checked_at, created_at, shipped_at
 			FROM orders WHERE order_number = $1
-		`, orderNumber).Scan(&order.ID, &order.OrderNumber, &order.Status, &order.TrackingNumber, &order.CreatedAt, &order.ShippedAt)
+		`, orderNumber).Scan(&order.ID, &order.OrderNumber, &order.Status, &order.ShippingMethod, &order.TrackingNumber,
+			&trackingStatus, &trackedAt, &order.CreatedAt, &order.ShippedAt)
 
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 			return
 		}
 
-		c.JSON(http.StatusOK, order)
+		// Carrier scans stored by the tracking sync, oldest first
+		events, err := db.ListTrackingEvents(ctx, order.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":                  order.ID,
+			"order_number":        order.OrderNumber,
+			"status":              order.Status,
+			"shipping_method":     order.ShippingMethod,
+			"tracking_number":     order.TrackingNumber,
+			"tracking_status":     trackingStatus,
+			"tracking_checked_at": trackedAt,
+			"tracking_events":     events,
+			"created_at":          order.CreatedAt,
+			"shipped_at":          order.ShippedAt,
+		})
 	}
 }
 
@@ -1337,41 +1410,119 @@ func ListOrders(db *database.Postgres) gin.HandlerFunc {
 }
 
 // UpdateOrderStatus handles PUT /api/admin/orders/:id/status
-func UpdateOrderStatus(db *database.Postgres) gin.HandlerFunc {
+// Moves the order along the status state machine, records the change in the
+// timeline and notifies the customer. Body: {"status": "shipped",
+// "tracking_number": "...", "note": "..."}; the status may stay the same to
+// only set the tracking number.
+func UpdateOrderStatus(db *database.Postgres, emailSvc *email.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
-		id, _ := uuid.Parse(c.Param("id"))
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
 
 		var req struct {
-			Status         string `json:"status"`
+			Status         string `json:"status" binding:"required"`
 			TrackingNumber string `json:"tracking_number"`
+			Note           string `json:"note"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if !models.IsOrderStatus(req.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown status %q", req.Status)})
+			return
+		}
 
-		query := `UPDATE orders SET status = $1, tracking_number = $2, updated_at = $3 WHERE id = $4`
-		if req.Status == "shipped" {
-			query = `UPDATE orders SET status = $1, tracking_number = $2, updated_at = $3, shipped_at = $3 WHERE id = $4`
+		update := database.StatusUpdate{
+			Status:         req.Status,
+			ActorType:      models.OrderActorAdmin,
+			Note:           strings.TrimSpace(req.Note),
+			TrackingNumber: strings.TrimSpace(req.TrackingNumber),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			if uid, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+				update.ActorID = &uid
+			}
+		}
+
+		from, err := db.ChangeOrderStatus(ctx, id, update)
+		if errors.Is(err, database.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		if errors.Is(err, database.ErrInvalidStatusTransition) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   err.Error(),
+				"allowed": models.NextOrderStatuses(from),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
-		_, err := db.Pool().Exec(ctx, query, req.Status, req.TrackingNumber, time.Now(), id)
+		order, err := db.GetOrder(ctx, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		order, _ := db.GetOrder(ctx, id)
+		if from != order.Status {
+			log.Printf("[ORDER] #%s: %s -> %s", order.OrderNumber, from, order.Status)
+			notifyStatusChange(emailSvc, order, from, update.Note)
+		}
+
 		c.JSON(http.StatusOK, order)
 	}
 }
 
-// GenerateInvoice handles POST /api/admin/orders/:id/invoice
-func GenerateInvoice(db *database.Postgres) gin.HandlerFunc {
+// notifyStatusChange queues an email to the customer when the order entered
+// a status with a customer email (paid, shipped, delivered, cancelled)
+func notifyStatusChange(emailSvc *email.Service, order *models.Order, from, note string) {
+	if order == nil || order.Status == from || !email.NotifiesStatus(order.Status) {
+		return
+	}
+	if err := emailSvc.SendOrderStatusEmail(order, note); err != nil {
+		log.Printf("[ORDER] Failed to queue %s email for #%s: %v", order.Status, order.OrderNumber, err)
+	}
+}
+
+// GetOrderTimeline handles GET /api/admin/orders/:id/timeline
+func GetOrderTimeline(db *database.Postgres) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: Generate PDF invoice
-		c.JSON(http.StatusOK, gin.H{"message": "Invoice generated"})
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		order, err := db.GetOrder(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if order == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+
+		history, err := db.ListOrderStatusHistory(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":        order.Status,
+			"next_statuses": models.NextOrderStatuses(order.Status),
+			"data":          history,
+		})
 	}
 }
 
@@ -1694,48 +1845,6 @@ func GetShippingMethods(db *database.Postgres) gin.HandlerFunc {
 	}
 }
 
-// GetPacketaPoints handles POST /api/shipping/packeta/points
-func GetPacketaPoints(cfg *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// TODO: Call Packeta API
-		c.JSON(http.StatusOK, gin.H{"points": []interface{}{}})
-	}
-}
-
-// ==================== PAYMENTS ====================
-
-// InitComgatePayment handles POST /api/payments/comgate/init
-func InitComgatePayment(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// TODO: Initialize Comgate payment
-		c.JSON(http.StatusOK, gin.H{"redirect_url": ""})
-	}
-}
-
-// ComgateCallback handles POST /api/payments/comgate/callback
-func ComgateCallback(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// TODO: Handle Comgate callback
-		c.JSON(http.StatusOK, gin.H{"success": true})
-	}
-}
-
-// InitGoPayPayment handles POST /api/payments/gopay/init
-func InitGoPayPayment(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// TODO: Initialize GoPay payment
-		c.JSON(http.StatusOK, gin.H{"redirect_url": ""})
-	}
-}
-
-// GoPayCallback handles POST /api/payments/gopay/callback
-func GoPayCallback(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// TODO: Handle GoPay callback
-		c.JSON(http.StatusOK, gin.H{"success": true})
-	}
-}
-
 // ==================== CACHE ====================
 
 // ClearCache handles POST /api/admin/cache/clear
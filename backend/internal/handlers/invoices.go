@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/database"
+	"megashop/internal/invoice"
+	"megashop/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== INVOICES ====================
+
+// GenerateInvoice handles POST /api/admin/orders/:id/invoice
+// Issues the invoice of an order (once) and stores its PDF. Optional body:
+// {"issue_date": "2026-01-31", "supply_date": "...", "due_date": "..."}
+func GenerateInvoice(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		var req struct {
+			IssueDate  string `json:"issue_date"`
+			SupplyDate string `json:"supply_date"`
+			DueDate    string `json:"due_date"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		var opts invoice.Options
+		for _, d := range []struct {
+			value  string
+			target *time.Time
+		}{{req.IssueDate, &opts.IssueDate}, {req.SupplyDate, &opts.SupplyDate}, {req.DueDate, &opts.DueDate}} {
+			if d.value == "" {
+				continue
+			}
+			if *d.target, err = time.Parse("2006-01-02", d.value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid date %q, expected YYYY-MM-DD", d.value)})
+				return
+			}
+		}
+
+		order, err := db.GetOrder(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if order == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		if order.Status == "cancelled" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cancelled orders cannot be invoiced"})
+			return
+		}
+
+		inv, err := invoice.Build(cfg, order, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		inv, created, err := db.CreateInvoice(ctx, inv, invoice.NumberFormat, func(inv *models.Invoice) error {
+			return storeInvoicePDF(cfg, inv)
+		})
+		if err != nil {
+			log.Printf("[INVOICE] Failed to issue invoice for order %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !created {
+			c.JSON(http.StatusOK, inv)
+			return
+		}
+		log.Printf("[INVOICE] Issued invoice %s for order #%s", inv.Number, inv.OrderNumber)
+		c.JSON(http.StatusCreated, inv)
+	}
+}
+
+// GetOrderInvoice handles GET /api/admin/orders/:id/invoice
+func GetOrderInvoice(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		inv, err := db.GetInvoiceByOrder(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if inv == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order has no invoice"})
+			return
+		}
+
+		c.JSON(http.StatusOK, inv)
+	}
+}
+
+// DownloadInvoicePDF handles GET /api/admin/orders/:id/invoice/pdf and the
+// customer's GET /api/orders/:id/invoice.pdf (the order ID is the customer's key,
+// as for GET /api/orders/:id)
+func DownloadInvoicePDF(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		inv, err := db.GetInvoiceByOrder(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if inv == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return
+		}
+
+		data, err := os.ReadFile(inv.PDFPath)
+		if os.IsNotExist(err) {
+			// Storage lost (e.g. new volume) - re-render from the stored snapshot
+			log.Printf("[INVOICE] PDF of %s missing, rendering again", inv.Number)
+			if err = storeInvoicePDF(cfg, inv); err == nil {
+				data, err = os.ReadFile(inv.PDFPath)
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=faktura-%s.pdf", inv.Number))
+		c.Data(http.StatusOK, "application/pdf", data)
+	}
+}
+
+// storeInvoicePDF renders the invoice into storage/invoices/<year>/<number>.pdf
+func storeInvoicePDF(cfg *config.Config, inv *models.Invoice) error {
+	data, err := invoice.RenderPDF(inv)
+	if err != nil {
+		return err
+	}
+	path, err := writeDocumentPDF(cfg, "invoices", inv.Year, inv.Number, data)
+	if err != nil {
+		return err
+	}
+	inv.PDFPath = path
+	return nil
+}
+
+// writeDocumentPDF stores a rendered document under the storage path
+func writeDocumentPDF(cfg *config.Config, kind string, year int, number string, data []byte) (string, error) {
+	dir := filepath.Join(cfg.StoragePath, kind, strconv.Itoa(year))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create %s dir: %w", kind, err)
+	}
+	path := filepath.Join(dir, number+".pdf")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("write %s pdf: %w", kind, err)
+	}
+	return path, nil
+}
+
+// ==================== CREDIT NOTES ====================
+
+// CreateCreditNote handles POST /api/admin/orders/:id/credit-notes
+// Issues a credit note (dobropis) to the order's invoice. Body:
+// {"reason": "Vrátenie tovaru", "lines": [{"line": 0, "quantity": 1}, {"line": 2, "amount": 5.0}],
+// "issue_date": "...", "supply_date": "..."}. Without lines everything not
+// yet credited is credited, as for a cancelled order.
+func CreateCreditNote(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		var req struct {
+			Reason     string               `json:"reason" binding:"required"`
+			Lines      []invoice.CreditLine `json:"lines"`
+			IssueDate  string               `json:"issue_date"`
+			SupplyDate string               `json:"supply_date"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		opts := invoice.CreditOptions{Reason: strings.TrimSpace(req.Reason), Lines: req.Lines}
+		for _, d := range []struct {
+			value  string
+			target *time.Time
+		}{{req.IssueDate, &opts.IssueDate}, {req.SupplyDate, &opts.SupplyDate}} {
+			if d.value == "" {
+				continue
+			}
+			if *d.target, err = time.Parse("2006-01-02", d.value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid date %q, expected YYYY-MM-DD", d.value)})
+				return
+			}
+		}
+
+		inv, err := db.GetInvoiceByOrder(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if inv == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order has no invoice to correct"})
+			return
+		}
+
+		var createdBy *uuid.UUID
+		if userID, ok := c.Get("user_id"); ok {
+			if uid, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+				createdBy = &uid
+			}
+		}
+
+		cn, err := db.CreateCreditNote(ctx, inv.ID, createdBy,
+			func(inv *models.Invoice, previous []models.CreditNote) (*models.CreditNote, error) {
+				return invoice.BuildCreditNote(cfg, inv, previous, opts)
+			},
+			invoice.CreditNoteNumberFormat,
+			func(cn *models.CreditNote) error {
+				return storeCreditNotePDF(cfg, cn)
+			})
+		if errors.Is(err, invoice.ErrInvalidCreditNote) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("[INVOICE] Failed to issue credit note for order %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		log.Printf("[INVOICE] Issued credit note %s (%.2f %s) to invoice %s", cn.Number, cn.Total, cn.Currency, cn.InvoiceNumber)
+		c.JSON(http.StatusCreated, cn)
+	}
+}
+
+// ListOrderCreditNotes handles GET /api/admin/orders/:id/credit-notes
+func ListOrderCreditNotes(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		notes, err := db.ListOrderCreditNotes(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": notes})
+	}
+}
+
+// DownloadCreditNotePDF handles GET /api/admin/credit-notes/:id/pdf
+func DownloadCreditNotePDF(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credit note ID"})
+			return
+		}
+
+		cn, err := db.GetCreditNote(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if cn == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Credit note not found"})
+			return
+		}
+
+		data, err := os.ReadFile(cn.PDFPath)
+		if os.IsNotExist(err) {
+			log.Printf("[INVOICE] PDF of %s missing, rendering again", cn.Number)
+			if err = storeCreditNotePDF(cfg, cn); err == nil {
+				data, err = os.ReadFile(cn.PDFPath)
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=dobropis-%s.pdf", cn.Number))
+		c.Data(http.StatusOK, "application/pdf", data)
+	}
+}
+
+// storeCreditNotePDF renders the credit note into storage/credit-notes/<year>/<number>.pdf
+func storeCreditNotePDF(cfg *config.Config, cn *models.CreditNote) error {
+	data, err := invoice.RenderCreditNotePDF(cn)
+	if err != nil {
+		return err
+	}
+	path, err := writeDocumentPDF(cfg, "credit-notes", cn.Year, cn.Number, data)
+	if err != nil {
+		return err
+	}
+	cn.PDFPath = path
+	return nil
+}
+
+// ==================== ACCOUNTING EXPORT ====================
+
+// ExportAccounting handles GET /api/admin/accounting/export?from=2026-01-01&to=2026-01-31
+// Invoices and credit notes issued in the period as CSV for the accountant.
+// Defaults to the current month.
+func ExportAccounting(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		now := time.Now()
+		from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		to := from.AddDate(0, 1, -1)
+		for _, d := range []struct {
+			value  string
+			target *time.Time
+		}{{c.Query("from"), &from}, {c.Query("to"), &to}} {
+			if d.value == "" {
+				continue
+			}
+			t, err := time.Parse("2006-01-02", d.value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid date %q, expected YYYY-MM-DD", d.value)})
+				return
+			}
+			*d.target = t
+		}
+		if to.Before(from) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "'to' must not be before 'from'"})
+			return
+		}
+
+		invoices, err := db.ListInvoices(ctx, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		notes, err := db.ListCreditNotes(ctx, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString("\xef\xbb\xbf") // BOM so Excel reads UTF-8
+		if err := invoice.WriteAccountingCSV(&buf, invoices, notes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=doklady-%s-%s.csv", from.Format("20060102"), to.Format("20060102")))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"megashop/internal/cache"
+	"megashop/internal/database"
+	"megashop/internal/offers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== SUPPLIER OFFERS ====================
+
+// ListProductOffers handles GET /api/admin/products/:id/offers
+func ListProductOffers(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid product ID"})
+			return
+		}
+
+		list, err := db.ListProductOffers(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": list})
+	}
+}
+
+// RefreshProductOffer handles POST /api/admin/products/:id/offers/refresh
+// Reselects the product's offer right away.
+func RefreshProductOffer(db *database.Postgres, redisCache *cache.Redis) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid product ID"})
+			return
+		}
+
+		sel, err := db.LoadOfferSelection(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		offer, err := db.RefreshProductOffer(ctx, id, sel)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if offer == nil {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Product has no offer from an active supplier"})
+			return
+		}
+
+		if redisCache != nil {
+			redisCache.InvalidateProduct(ctx, id.String())
+			redisCache.InvalidateProductLists(ctx)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": offer})
+	}
+}
+
+// GetOfferRules handles GET /api/admin/offer-rules
+func GetOfferRules(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := db.GetOfferRules(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+			"rules":     rules,
+			"available": []string{offers.RuleInStock, offers.RuleCheapest, offers.RulePriority, offers.RuleFastest},
+		}})
+	}
+}
+
+// UpdateOfferRules handles PUT /api/admin/offer-rules
+// Body: {"rules": ["in_stock", "cheapest", "priority", "fastest"]}, applied
+// in order until one offer wins. All products are reselected in the background.
+func UpdateOfferRules(db *database.Postgres, redisCache *cache.Redis) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Rules []string `json:"rules"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if err := offers.ValidateRules(req.Rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+
+		if err := db.SaveOfferRules(c.Request.Context(), req.Rules); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+
+		go func() {
+			ctx := context.Background()
+			n, err := db.RefreshOffers(ctx, nil)
+			if err != nil {
+				log.Printf("[OFFERS] Reselecting offers failed after %d products: %v", n, err)
+				return
+			}
+			log.Printf("[OFFERS] Reselected offers of %d products", n)
+			if redisCache != nil {
+				redisCache.InvalidateProductLists(ctx)
+			}
+		}()
+
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"rules": req.Rules}})
+	}
+}
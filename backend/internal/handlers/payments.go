@@ -0,0 +1,638 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/database"
+	"megashop/internal/email"
+	"megashop/internal/models"
+	"megashop/internal/payment"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== PAYMENTS ====================
+
+// InitComgatePayment handles POST /api/payments/comgate/init
+func InitComgatePayment(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	client := payment.NewComgateClient(cfg)
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		if !client.IsConfigured() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Comgate is not configured"})
+			return
+		}
+
+		var req struct {
+			OrderID uuid.UUID `json:"order_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		order, err := db.GetOrder(ctx, req.OrderID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if order == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		if isPaymentCaptured(order.PaymentStatus) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order is already paid"})
+			return
+		}
+
+		var billing models.Address
+		json.Unmarshal(order.BillingAddress, &billing)
+
+		result, err := client.CreatePayment(ctx, order, billing.Email)
+		if err != nil {
+			log.Printf("[PAYMENT] Comgate create failed for #%s: %v", order.OrderNumber, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Payment gateway error"})
+			return
+		}
+
+		if err := db.RecordPaymentAttempt(ctx, order.ID, payment.GatewayComgate, result.TransID, order.Total, order.Currency); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"redirect_url": result.RedirectURL,
+			"trans_id":     result.TransID,
+		})
+	}
+}
+
+// ComgateCallback handles POST /api/payments/comgate/callback
+// Comgate expects a url-encoded "code=0&message=OK" body on success.
+func ComgateCallback(db *database.Postgres, cfg *config.Config, emailSvc *email.Service) gin.HandlerFunc {
+	client := payment.NewComgateClient(cfg)
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		if err := c.Request.ParseForm(); err != nil {
+			c.String(http.StatusBadRequest, "code=1&message=Invalid request")
+			return
+		}
+
+		status, err := client.VerifyCallback(c.Request.PostForm)
+		if err != nil {
+			log.Printf("[PAYMENT] Comgate callback rejected from %s: %v", c.ClientIP(), err)
+			c.String(http.StatusUnauthorized, "code=1&message=Invalid merchant or secret")
+			return
+		}
+
+		order, err := db.GetOrderByNumber(ctx, status.RefID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "code=1&message=Database error")
+			return
+		}
+		if order == nil {
+			log.Printf("[PAYMENT] Comgate callback for unknown order %q (trans %s)", status.RefID, status.TransID)
+			c.String(http.StatusNotFound, "code=1&message=Order not found")
+			return
+		}
+
+		// A newer transaction replaced this one - only a late payment still counts
+		if order.PaymentTransactionID != "" && order.PaymentTransactionID != status.TransID && status.Status != payment.ComgateStatusPaid {
+			log.Printf("[PAYMENT] Ignoring Comgate %s for superseded transaction %s of #%s", status.Status, status.TransID, order.OrderNumber)
+			c.String(http.StatusOK, "code=0&message=OK")
+			return
+		}
+
+		switch status.Status {
+		case payment.ComgateStatusPaid:
+			if status.Price != payment.ToCents(order.Total) {
+				log.Printf("[PAYMENT] Comgate amount mismatch for #%s: got %d, expected %d", order.OrderNumber, status.Price, payment.ToCents(order.Total))
+				c.String(http.StatusBadRequest, "code=1&message=Amount mismatch")
+				return
+			}
+			updated, err := db.SettlePayment(ctx, order.ID, payment.GatewayComgate, status.TransID, models.PaymentTxSucceeded, order.Total, order.Currency)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "code=1&message=Database error")
+				return
+			}
+			if updated {
+				log.Printf("[PAYMENT] Order #%s paid via Comgate (trans %s)", order.OrderNumber, status.TransID)
+				notifyPaymentReceived(ctx, db, emailSvc, order)
+			}
+		case payment.ComgateStatusCancelled:
+			updated, err := db.SettlePayment(ctx, order.ID, payment.GatewayComgate, status.TransID, models.PaymentTxCancelled, order.Total, order.Currency)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "code=1&message=Database error")
+				return
+			}
+			if updated {
+				log.Printf("[PAYMENT] Comgate payment cancelled for #%s (trans %s)", order.OrderNumber, status.TransID)
+			}
+		}
+
+		c.String(http.StatusOK, "code=0&message=OK")
+	}
+}
+
+// InitGoPayPayment handles POST /api/payments/gopay/init
+func InitGoPayPayment(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	client := payment.NewGoPayClient(cfg)
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		if !client.IsConfigured() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "GoPay is not configured"})
+			return
+		}
+
+		var req struct {
+			OrderID uuid.UUID `json:"order_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		order, err := db.GetOrder(ctx, req.OrderID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if order == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		if isPaymentCaptured(order.PaymentStatus) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order is already paid"})
+			return
+		}
+
+		var billing models.Address
+		json.Unmarshal(order.BillingAddress, &billing)
+
+		shopURL := strings.TrimRight(cfg.ShopURL, "/")
+		returnURL := fmt.Sprintf("%s/checkout/success?order=%s", shopURL, url.QueryEscape(order.OrderNumber))
+		notifyURL := shopURL + "/api/payments/gopay/callback"
+
+		result, err := client.CreatePayment(ctx, order, billing, returnURL, notifyURL)
+		if err != nil {
+			log.Printf("[PAYMENT] GoPay create failed for #%s: %v", order.OrderNumber, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Payment gateway error"})
+			return
+		}
+
+		if err := db.RecordPaymentAttempt(ctx, order.ID, payment.GatewayGoPay, strconv.FormatInt(result.ID, 10), order.Total, order.Currency); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"redirect_url": result.GwURL,
+			"payment_id":   result.ID,
+		})
+	}
+}
+
+// GoPayCallback handles GET/POST /api/payments/gopay/callback
+// GoPay only sends the payment ID, the state is always fetched from the API.
+// Repeated notifications are harmless: the ledger entry is only updated once.
+func GoPayCallback(db *database.Postgres, cfg *config.Config, emailSvc *email.Service) gin.HandlerFunc {
+	client := payment.NewGoPayClient(cfg)
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		rawID := c.Query("id")
+		if rawID == "" {
+			rawID = c.PostForm("id")
+		}
+		paymentID, err := strconv.ParseInt(rawID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+			return
+		}
+
+		gp, err := client.GetPayment(ctx, paymentID)
+		if err != nil {
+			log.Printf("[PAYMENT] GoPay status query failed for %d: %v", paymentID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Payment gateway error"})
+			return
+		}
+
+		order, err := db.GetOrderByNumber(ctx, gp.OrderNumber)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if order == nil {
+			log.Printf("[PAYMENT] GoPay notification for unknown order %q (payment %d)", gp.OrderNumber, gp.ID)
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+
+		// A newer payment replaced this one - only a late payment still counts
+		if order.PaymentTransactionID != rawID && gp.State != payment.GoPayStatePaid {
+			log.Printf("[PAYMENT] Ignoring GoPay %s for superseded payment %d of #%s", gp.State, gp.ID, order.OrderNumber)
+			c.JSON(http.StatusOK, gin.H{"success": true})
+			return
+		}
+
+		switch gp.State {
+		case payment.GoPayStatePaid:
+			if gp.Amount != payment.ToCents(order.Total) {
+				log.Printf("[PAYMENT] GoPay amount mismatch for #%s: got %d, expected %d", order.OrderNumber, gp.Amount, payment.ToCents(order.Total))
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Amount mismatch"})
+				return
+			}
+			updated, err := db.SettlePayment(ctx, order.ID, payment.GatewayGoPay, rawID, models.PaymentTxSucceeded, order.Total, order.Currency)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if updated {
+				log.Printf("[PAYMENT] Order #%s paid via GoPay (payment %d)", order.OrderNumber, gp.ID)
+				notifyPaymentReceived(ctx, db, emailSvc, order)
+			}
+		case payment.GoPayStateCanceled, payment.GoPayStateTimeouted:
+			updated, err := db.SettlePayment(ctx, order.ID, payment.GatewayGoPay, rawID, models.PaymentTxCancelled, order.Total, order.Currency)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if updated {
+				log.Printf("[PAYMENT] GoPay payment %s for #%s (payment %d)", gp.State, order.OrderNumber, gp.ID)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// notifyPaymentReceived sends the payment received email if the settled
+// payment moved the order from pending to paid
+func notifyPaymentReceived(ctx context.Context, db *database.Postgres, emailSvc *email.Service, before *models.Order) {
+	after, err := db.GetOrder(ctx, before.ID)
+	if err != nil {
+		log.Printf("[PAYMENT] Failed to reload order #%s: %v", before.OrderNumber, err)
+		return
+	}
+	notifyStatusChange(emailSvc, after, before.Status, "")
+}
+
+// isPaymentCaptured reports whether money was already taken for the order
+func isPaymentCaptured(status string) bool {
+	return status == "paid" || status == "partially_refunded" || status == "refunded"
+}
+
+// ListOrderPayments handles GET /api/admin/orders/:id/payments
+func ListOrderPayments(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		transactions, err := db.ListPaymentTransactions(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": transactions})
+	}
+}
+
+// RefundOrder handles POST /api/admin/orders/:id/refund
+// Refunds through the gateway that captured the payment. Amount 0 refunds
+// everything that was not refunded yet.
+func RefundOrder(db *database.Postgres, cfg *config.Config, emailSvc *email.Service) gin.HandlerFunc {
+	refunders := payment.NewRefunders(cfg)
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		var req struct {
+			Amount float64 `json:"amount"`
+			Note   string  `json:"note"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Amount < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must not be negative"})
+			return
+		}
+
+		transactions, err := db.ListPaymentTransactions(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Latest captured gateway payment and what is still refundable on it
+		var captured *models.PaymentTransaction
+		for i := range transactions {
+			t := &transactions[i]
+			if t.Type == models.PaymentTxPayment && t.Status == models.PaymentTxSucceeded && refunders[t.Gateway] != nil {
+				captured = t
+			}
+		}
+		if captured == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order has no captured gateway payment"})
+			return
+		}
+		remaining := captured.Amount
+		for _, t := range transactions {
+			if t.ParentID != nil && *t.ParentID == captured.ID && t.Type == models.PaymentTxRefund &&
+				(t.Status == models.PaymentTxPending || t.Status == models.PaymentTxSucceeded) {
+				remaining -= t.Amount
+			}
+		}
+		amount := req.Amount
+		if amount == 0 {
+			amount = math.Round(remaining*100) / 100
+		}
+
+		var createdBy *uuid.UUID
+		if userID, ok := c.Get("user_id"); ok {
+			if uid, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+				createdBy = &uid
+			}
+		}
+
+		refund, err := db.CreateRefund(ctx, captured.ID, amount, req.Note, createdBy)
+		if errors.Is(err, database.ErrRefundExceedsPayment) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Refundable amount is %.2f", math.Max(remaining, 0))})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := refunders[captured.Gateway].Refund(ctx, captured.ExternalID, amount, captured.Currency)
+		if err != nil {
+			log.Printf("[PAYMENT] %s refund of %.2f for order %s failed: %v", captured.Gateway, amount, id, err)
+			if err := db.UpdatePaymentTransactionStatus(ctx, refund.ID, models.PaymentTxFailed, "", err.Error()); err != nil {
+				log.Printf("[PAYMENT] Failed to record refund failure %s: %v", refund.ID, err)
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Payment gateway error: " + err.Error()})
+			return
+		}
+
+		status := models.PaymentTxSucceeded
+		if result.Pending {
+			status = models.PaymentTxPending
+		}
+		if err := db.UpdatePaymentTransactionStatus(ctx, refund.ID, status, result.ExternalID, ""); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[PAYMENT] Refunded %.2f %s for order %s via %s (%s)", amount, captured.Currency, id, captured.Gateway, status)
+
+		order, err := db.GetOrder(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		transactions, _ = db.ListPaymentTransactions(ctx, id)
+
+		// Pending refunds are announced by the refund worker once they settle
+		if order != nil && status == models.PaymentTxSucceeded {
+			if err := emailSvc.SendRefundIssued(order, amount, req.Note); err != nil {
+				log.Printf("[PAYMENT] Failed to queue refund email for #%s: %v", order.OrderNumber, err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"order":        order,
+			"transactions": transactions,
+		})
+	}
+}
+
+// ==================== BANK STATEMENTS ====================
+
+// maxStatementSize limits uploaded bank statements
+const maxStatementSize = 20 << 20
+
+// Reconciliation results of a statement entry
+const (
+	reconcileMatched   = "matched"
+	reconcileUnderpaid = "underpaid"
+	reconcileOverpaid  = "overpaid"
+	reconcileDuplicate = "duplicate"
+	reconcileUnmatched = "unmatched"
+	reconcileCurrency  = "currency_mismatch"
+)
+
+// BankReconciliationLine is the outcome for one incoming payment of the statement
+type BankReconciliationLine struct {
+	payment.StatementEntry
+	Result        string     `json:"result"`
+	NeedsReview   bool       `json:"needs_review"`
+	OrderID       *uuid.UUID `json:"order_id,omitempty"`
+	OrderNumber   string     `json:"order_number,omitempty"`
+	OrderTotal    float64    `json:"order_total,omitempty"`
+	PaidTotal     float64    `json:"paid_total,omitempty"` // all payments of the order incl. this one
+	Difference    float64    `json:"difference,omitempty"` // paid_total - order_total
+	PaymentStatus string     `json:"payment_status,omitempty"`
+	Note          string     `json:"note,omitempty"`
+}
+
+// BankReconciliationReport summarizes a bank statement import
+type BankReconciliationReport struct {
+	Filename    string                   `json:"filename"`
+	Format      string                   `json:"format"`
+	Entries     int                      `json:"entries"`
+	Credits     int                      `json:"credits"`
+	Matched     int                      `json:"matched"`
+	Underpaid   int                      `json:"underpaid"`
+	Overpaid    int                      `json:"overpaid"`
+	Duplicates  int                      `json:"duplicates"`
+	Unmatched   int                      `json:"unmatched"`
+	NeedsReview int                      `json:"needs_review"`
+	Lines       []BankReconciliationLine `json:"lines"`
+}
+
+// ImportBankStatement handles POST /api/admin/payments/bank-statement
+// Accepts a camt.053 XML or bank CSV export (multipart field "file") and
+// matches incoming credits to transfer orders by variable symbol and amount.
+// Re-importing the same statement is safe, known entries are reported as duplicates.
+func ImportBankStatement(db *database.Postgres, emailSvc *email.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Statement file is required"})
+			return
+		}
+		if fileHeader.Size > maxStatementSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Statement file is too large"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, maxStatementSize))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		format, entries, err := payment.ParseStatement(fileHeader.Filename, data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		report := BankReconciliationReport{
+			Filename: fileHeader.Filename,
+			Format:   format,
+			Entries:  len(entries),
+			Lines:    []BankReconciliationLine{},
+		}
+
+		for _, entry := range entries {
+			if !entry.IsCredit() {
+				continue
+			}
+			report.Credits++
+
+			line, err := reconcileStatementEntry(ctx, db, emailSvc, entry)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+				return
+			}
+
+			switch line.Result {
+			case reconcileMatched:
+				report.Matched++
+			case reconcileUnderpaid:
+				report.Underpaid++
+			case reconcileOverpaid:
+				report.Overpaid++
+			case reconcileDuplicate:
+				report.Duplicates++
+			default:
+				report.Unmatched++
+			}
+			if line.NeedsReview {
+				report.NeedsReview++
+			}
+			report.Lines = append(report.Lines, line)
+		}
+
+		log.Printf("[PAYMENT] Bank statement %s (%s): %d credits, %d matched, %d need review",
+			fileHeader.Filename, format, report.Credits, report.Matched, report.NeedsReview)
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// reconcileStatementEntry matches one credit to its order and records it in the payment ledger
+func reconcileStatementEntry(ctx context.Context, db *database.Postgres, emailSvc *email.Service, entry payment.StatementEntry) (BankReconciliationLine, error) {
+	line := BankReconciliationLine{StatementEntry: entry}
+
+	if entry.VariableSymbol == "" {
+		line.Result, line.NeedsReview = reconcileUnmatched, true
+		line.Note = "No variable symbol"
+		return line, nil
+	}
+
+	order, err := db.GetTransferOrderByVariableSymbol(ctx, entry.VariableSymbol)
+	if err != nil {
+		return line, err
+	}
+	if order == nil {
+		line.Result, line.NeedsReview = reconcileUnmatched, true
+		line.Note = "No transfer order with this variable symbol"
+		return line, nil
+	}
+
+	line.OrderID = &order.ID
+	line.OrderNumber = order.OrderNumber
+	line.OrderTotal = order.Total
+
+	if !strings.EqualFold(entry.Currency, order.Currency) {
+		line.Result, line.NeedsReview = reconcileCurrency, true
+		line.Note = fmt.Sprintf("Order is in %s", order.Currency)
+		line.PaymentStatus = order.PaymentStatus
+		return line, nil
+	}
+
+	note := strings.TrimSpace(entry.CounterpartyName + " " + entry.Message)
+	bookedAt := entry.BookingDate
+	if bookedAt.IsZero() {
+		bookedAt = time.Now()
+	}
+
+	recorded, paid, err := db.RecordTransferPayment(ctx, order.ID, entry.ExternalID(), entry.Amount, entry.Currency, note, bookedAt)
+	if err != nil {
+		return line, err
+	}
+
+	line.PaidTotal = paid
+	line.Difference = math.Round((paid-order.Total)*100) / 100
+
+	switch {
+	case !recorded:
+		line.Result = reconcileDuplicate
+		line.Note = "Already imported"
+	case line.Difference < 0:
+		line.Result, line.NeedsReview = reconcileUnderpaid, true
+		line.Note = fmt.Sprintf("Missing %.2f %s", -line.Difference, order.Currency)
+	case line.Difference > 0:
+		line.Result, line.NeedsReview = reconcileOverpaid, true
+		line.Note = fmt.Sprintf("Overpaid by %.2f %s", line.Difference, order.Currency)
+	default:
+		line.Result = reconcileMatched
+	}
+
+	if recorded && order.Status == "cancelled" {
+		line.NeedsReview = true
+		line.Note = strings.TrimSpace(line.Note + " Order is cancelled")
+	}
+
+	if updated, err := db.GetOrder(ctx, order.ID); err == nil && updated != nil {
+		line.PaymentStatus = updated.PaymentStatus
+		if recorded {
+			notifyStatusChange(emailSvc, updated, order.Status, "")
+		}
+	}
+	if recorded {
+		log.Printf("[PAYMENT] Transfer %.2f %s (VS %s) recorded for #%s: %s", entry.Amount, entry.Currency, entry.VariableSymbol, order.OrderNumber, line.Result)
+	}
+
+	return line, nil
+}
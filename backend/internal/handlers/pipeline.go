@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/database"
+	"megashop/internal/models"
+	"megashop/internal/scheduler"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== SUPPLIER PIPELINE ====================
+
+// SupplierPipeline returns the pipeline the scheduler runs for a supplier:
+// download the feed, import it, link the products and regenerate the
+// Heureka feed, each step only after the previous one succeeded
+func SupplierPipeline(db *database.Postgres, cfg *config.Config) scheduler.PipelineFunc {
+	return func(ctx context.Context, supplierID uuid.UUID, triggeredBy string) (*models.PipelineRun, error) {
+		supplier, err := db.GetSupplier(ctx, supplierID)
+		if err != nil {
+			return nil, err
+		}
+		if supplier == nil {
+			return nil, fmt.Errorf("supplier %s not found", supplierID)
+		}
+		run, err := db.StartPipelineRun(ctx, supplierID, triggeredBy)
+		if err != nil {
+			return nil, err
+		}
+		runPipeline(ctx, db, cfg, supplier, run)
+		return run, nil
+	}
+}
+
+// RunSupplierPipeline handles POST /api/admin/suppliers/:id/pipeline
+// Runs the scheduled pipeline right away, in the background.
+func RunSupplierPipeline(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		supplierID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid supplier ID"})
+			return
+		}
+
+		supplier, err := db.GetSupplier(ctx, supplierID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if supplier == nil {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Supplier not found"})
+			return
+		}
+
+		run, err := db.StartPipelineRun(ctx, supplierID, "manual")
+		if errors.Is(err, database.ErrPipelineRunning) {
+			c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Pipeline already running"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+
+		started := *run
+		go runPipeline(context.Background(), db, cfg, supplier, run)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"success": true,
+			"message": "Pipeline started. Use GET /pipeline-runs to track progress.",
+			"data":    started,
+		})
+	}
+}
+
+// ListPipelineRuns handles GET /api/admin/suppliers/:id/pipeline-runs
+// The latest runs with the outcome of each step, and the next scheduled run.
+func ListPipelineRuns(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		supplierID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid supplier ID"})
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+		supplier, err := db.GetSupplier(ctx, supplierID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if supplier == nil {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Supplier not found"})
+			return
+		}
+
+		runs, err := db.ListPipelineRuns(ctx, supplierID, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+
+		var nextRun *time.Time
+		if supplier.IsActive {
+			nextRun = scheduler.NextRun(supplier.Schedule, time.Now())
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+			"schedule":    supplier.Schedule,
+			"next_run_at": nextRun,
+			"runs":        runs,
+		}})
+	}
+}
+
+// runPipeline runs the steps in order and records the outcome of each on
+// the run. A failed step stops the run; so does a skipped download, as
+// there is nothing new to import.
+func runPipeline(ctx context.Context, db *database.Postgres, cfg *config.Config, supplier *models.Supplier, run *models.PipelineRun) {
+	var feedID uuid.UUID
+	steps := []struct {
+		name string
+		run  func() (status, message string)
+	}{
+		{models.PipelineStepDownload, func() (string, string) { return pipelineDownload(ctx, db, supplier, &feedID) }},
+		{models.PipelineStepImport, func() (string, string) { return pipelineImport(ctx, db, supplier, feedID, run.TriggeredBy) }},
+		{models.PipelineStepLink, func() (string, string) { return pipelineLink(db, supplier) }},
+		{models.PipelineStepHeureka, func() (string, string) { return pipelineHeureka(db, cfg) }},
+	}
+
+	save := func() {
+		if err := db.UpdatePipelineRun(ctx, run); err != nil {
+			log.Printf("[PIPELINE] %s: %v", supplier.Code, err)
+		}
+	}
+
+	for _, st := range steps {
+		run.Steps = append(run.Steps, models.PipelineStep{
+			Name:      st.name,
+			Status:    models.PipelineRunning,
+			StartedAt: time.Now(),
+		})
+		save()
+
+		status, message := st.run()
+		now := time.Now()
+		step := &run.Steps[len(run.Steps)-1]
+		step.Status, step.Message, step.FinishedAt = status, message, &now
+		log.Printf("[PIPELINE] %s: %s %s %s", supplier.Code, st.name, status, message)
+
+		if status == models.PipelineFailed || (status == models.PipelineSkipped && st.name == models.PipelineStepDownload) {
+			run.Status = status
+			run.ErrorMessage = fmt.Sprintf("%s: %s", st.name, message)
+			break
+		}
+	}
+
+	if run.Status == models.PipelineRunning {
+		run.Status = models.PipelineCompleted
+	}
+	finished := time.Now()
+	run.FinishedAt = &finished
+	save()
+}
+
+func pipelineDownload(ctx context.Context, db *database.Postgres, supplier *models.Supplier, feedID *uuid.UUID) (string, string) {
+	if supplier.FeedURL == "" {
+		return models.PipelineFailed, "Feed URL not configured"
+	}
+	canDownload, err := db.CanSupplierDownload(ctx, supplier.ID)
+	if err != nil {
+		return models.PipelineFailed, err.Error()
+	}
+	if !canDownload {
+		return models.PipelineSkipped, fmt.Sprintf("Download limit of %d per day reached", supplier.MaxDownloadsPerDay)
+	}
+
+	status := &DownloadStatus{
+		SupplierID: supplier.ID,
+		Status:     "downloading",
+		StartedAt:  time.Now(),
+	}
+	downloadProgressMu.Lock()
+	if existing, ok := downloadProgress[supplier.ID]; ok && existing.Status == "downloading" {
+		downloadProgressMu.Unlock()
+		return models.PipelineSkipped, "Download already in progress"
+	}
+	downloadProgress[supplier.ID] = status
+	downloadProgressMu.Unlock()
+
+	runDownload(db, supplier, status)
+
+	downloadProgressMu.RLock()
+	defer downloadProgressMu.RUnlock()
+	if status.Status != "completed" {
+		return models.PipelineFailed, status.Error
+	}
+	*feedID = status.FeedID
+	return models.PipelineCompleted, fmt.Sprintf("%.1f MB downloaded", float64(status.BytesDown)/1024/1024)
+}
+
+func pipelineImport(ctx context.Context, db *database.Postgres, supplier *models.Supplier, feedID uuid.UUID, triggeredBy string) (string, string) {
+	storedFeed, err := db.GetStoredFeed(ctx, feedID)
+	if err != nil {
+		return models.PipelineFailed, err.Error()
+	}
+	if storedFeed == nil {
+		return models.PipelineFailed, "Downloaded feed not found"
+	}
+
+	feedImport := &models.FeedImport{
+		ID:           uuid.New(),
+		SupplierID:   supplier.ID,
+		StoredFeedID: storedFeed.ID,
+		StartedAt:    time.Now(),
+		Status:       "running",
+		TriggeredBy:  triggeredBy,
+		Logs:         []string{"Import started..."},
+		CreatedAt:    time.Now(),
+	}
+	if err := db.CreateFeedImport(ctx, feedImport); err != nil {
+		return models.PipelineFailed, err.Error()
+	}
+	importProgressMu.Lock()
+	importProgress[feedImport.ID] = feedImport
+	importProgressMu.Unlock()
+
+	runImport(db, supplier, storedFeed, feedImport)
+
+	importProgressMu.RLock()
+	defer importProgressMu.RUnlock()
+	if feedImport.Status != "completed" {
+		return models.PipelineFailed, feedImport.ErrorMessage
+	}
+	return models.PipelineCompleted, fmt.Sprintf("Created: %d, Updated: %d, Errors: %d",
+		feedImport.Created, feedImport.Updated, feedImport.Errors)
+}
+
+func pipelineLink(db *database.Postgres, supplier *models.Supplier) (string, string) {
+	linkID := uuid.New().String()
+	runLinkAll(db, supplier, linkID)
+
+	linkProgressMu.Lock()
+	progress := linkProgress[linkID]
+	linkProgressMu.Unlock()
+	if progress == nil {
+		return models.PipelineFailed, "Linking did not start"
+	}
+	if progress.Status != "completed" {
+		return models.PipelineFailed, progress.Message
+	}
+	return models.PipelineCompleted, progress.Message
+}
+
+func pipelineHeureka(db *database.Postgres, cfg *config.Config) (string, string) {
+	err := regenerateFeed(db, cfg)
+	if errors.Is(err, errFeedGenerating) {
+		return models.PipelineSkipped, "Feed is already being generated"
+	}
+	if err != nil {
+		return models.PipelineFailed, err.Error()
+	}
+	return models.PipelineCompleted, "Heureka feed regenerated"
+}
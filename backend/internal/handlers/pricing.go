@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"megashop/internal/cache"
+	"megashop/internal/database"
+	"megashop/internal/models"
+	"megashop/internal/pricing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== PRICING RULES ====================
+
+// PricingRuleReq is the body of creating and updating a pricing rule
+type PricingRuleReq struct {
+	Name           string     `json:"name"`
+	SupplierID     *uuid.UUID `json:"supplier_id"`
+	CategoryID     *uuid.UUID `json:"category_id"`
+	BrandID        *uuid.UUID `json:"brand_id"`
+	PriceFrom      float64    `json:"price_from"`
+	PriceTo        *float64   `json:"price_to"`
+	MarkupPercent  float64    `json:"markup_percent"`
+	MinMargin      float64    `json:"min_margin"`
+	FixedSurcharge float64    `json:"fixed_surcharge"`
+	CapAtSRP       bool       `json:"cap_at_srp"`
+	Rounding       string     `json:"rounding"`
+	Priority       int        `json:"priority"`
+	IsActive       *bool      `json:"is_active"` // default true
+	Note           string     `json:"note"`
+}
+
+func (req PricingRuleReq) rule() models.PricingRule {
+	r := models.PricingRule{
+		Name:           strings.TrimSpace(req.Name),
+		SupplierID:     req.SupplierID,
+		CategoryID:     req.CategoryID,
+		BrandID:        req.BrandID,
+		PriceFrom:      req.PriceFrom,
+		PriceTo:        req.PriceTo,
+		MarkupPercent:  req.MarkupPercent,
+		MinMargin:      req.MinMargin,
+		FixedSurcharge: req.FixedSurcharge,
+		CapAtSRP:       req.CapAtSRP,
+		Rounding:       req.Rounding,
+		Priority:       req.Priority,
+		IsActive:       req.IsActive == nil || *req.IsActive,
+		Note:           strings.TrimSpace(req.Note),
+	}
+	if r.Rounding == "" {
+		r.Rounding = models.PriceRoundNone
+	}
+	return r
+}
+
+// ListPricingRules handles GET /api/admin/pricing/rules
+func ListPricingRules(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := db.ListPricingRules(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": rules})
+	}
+}
+
+// CreatePricingRule handles POST /api/admin/pricing/rules
+// Prices change only when the offers are refreshed (supplier import or
+// POST /api/admin/pricing/apply); check them first with the preview.
+func CreatePricingRule(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req PricingRuleReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		rule := req.rule()
+		if err := pricing.ValidateRule(rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+
+		if err := db.CreatePricingRule(c.Request.Context(), &rule); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"success": true, "data": rule})
+	}
+}
+
+// UpdatePricingRule handles PUT /api/admin/pricing/rules/:id
+func UpdatePricingRule(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid rule ID"})
+			return
+		}
+		var req PricingRuleReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		rule := req.rule()
+		rule.ID = id
+		if err := pricing.ValidateRule(rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+
+		err = db.UpdatePricingRule(c.Request.Context(), &rule)
+		if errors.Is(err, database.ErrPricingRuleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Pricing rule not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": rule})
+	}
+}
+
+// DeletePricingRule handles DELETE /api/admin/pricing/rules/:id
+func DeletePricingRule(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid rule ID"})
+			return
+		}
+
+		err = db.DeletePricingRule(c.Request.Context(), id)
+		if errors.Is(err, database.ErrPricingRuleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Pricing rule not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// PreviewPricing handles POST /api/admin/pricing/preview
+// Dry run: the price changes refreshing the offers would make, nothing is
+// saved. Body (all optional): {"supplier_id", "category_id", "brand_id",
+// "limit", "rules": [...]}; "rules" replaces the stored rules to try out
+// changes before saving them.
+func PreviewPricing(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var req struct {
+			SupplierID *uuid.UUID       `json:"supplier_id"`
+			CategoryID *uuid.UUID       `json:"category_id"`
+			BrandID    *uuid.UUID       `json:"brand_id"`
+			Limit      int              `json:"limit"`
+			Rules      []PricingRuleReq `json:"rules"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+				return
+			}
+		}
+
+		sel, err := db.LoadOfferSelection(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if req.Rules != nil {
+			rules := make([]models.PricingRule, 0, len(req.Rules))
+			for _, r := range req.Rules {
+				rule := r.rule()
+				if err := pricing.ValidateRule(rule); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+					return
+				}
+				rule.ID = uuid.New()
+				rules = append(rules, rule)
+			}
+			if sel.Pricing, err = db.PricingEngineFor(ctx, rules); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+				return
+			}
+		}
+
+		preview, err := db.PreviewPricing(ctx, database.PricingPreviewFilter{
+			SupplierID: req.SupplierID,
+			CategoryID: req.CategoryID,
+			BrandID:    req.BrandID,
+			Limit:      req.Limit,
+		}, sel)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": preview})
+	}
+}
+
+// ApplyPricing handles POST /api/admin/pricing/apply
+// Reprices the products of the supplier, or all linked products, with the
+// stored rules in the background. Body (optional): {"supplier_id": "..."}
+func ApplyPricing(db *database.Postgres, redisCache *cache.Redis) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			SupplierID *uuid.UUID `json:"supplier_id"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+				return
+			}
+		}
+
+		go func() {
+			ctx := context.Background()
+			n, err := db.RefreshOffers(ctx, req.SupplierID)
+			if err != nil {
+				log.Printf("[PRICING] Repricing failed after %d products: %v", n, err)
+				return
+			}
+			log.Printf("[PRICING] Repriced %d products", n)
+			if redisCache != nil {
+				redisCache.InvalidateProductLists(ctx)
+			}
+		}()
+
+		c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Repricing started"})
+	}
+}
+
+// ==================== PRICE HISTORY ====================
+
+// GetPriceHistory handles GET /api/admin/products/:id/price-history
+// Price changes for a chart, oldest first, with the current Omnibus lowest
+// 30-day price. Query: days (default 90, max 730).
+func GetPriceHistory(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+		days, _ := strconv.Atoi(c.DefaultQuery("days", "90"))
+		if days < 1 || days > 730 {
+			days = 90
+		}
+
+		product, err := db.GetProduct(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if product == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		points, err := db.ListPriceHistory(ctx, id, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product_id":       id,
+			"price":            product.Price,
+			"sale_price":       product.SalePrice,
+			"lowest_price_30d": product.LowestPrice30d,
+			"points":           points,
+		})
+	}
+}
@@ -0,0 +1,825 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/database"
+	"megashop/internal/models"
+	"megashop/internal/shipping"
+	"megashop/internal/tracking"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== PACKETA PICKUP POINTS ====================
+
+// GetPacketaPoints handles GET and POST /api/shipping/packeta/points
+// Parameters (query or JSON body): zip, city, q, country, type, lat, lng, limit.
+// With lat/lng the nearest points come first and carry their distance in km.
+func GetPacketaPoints(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Zip       string   `json:"zip" form:"zip"`
+			City      string   `json:"city" form:"city"`
+			Query     string   `json:"q" form:"q"`
+			Country   string   `json:"country" form:"country"`
+			Type      string   `json:"type" form:"type"`
+			Latitude  *float64 `json:"lat" form:"lat"`
+			Longitude *float64 `json:"lng" form:"lng"`
+			Limit     int      `json:"limit" form:"limit"`
+		}
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if (req.Latitude == nil) != (req.Longitude == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Both lat and lng are required"})
+			return
+		}
+		if req.Type != "" && req.Type != models.PacketaPointPickup && req.Type != models.PacketaPointZBox {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type"})
+			return
+		}
+
+		points, err := db.SearchPacketaPoints(c.Request.Context(), models.PacketaPointFilter{
+			Zip:       req.Zip,
+			City:      req.City,
+			Query:     req.Query,
+			Country:   req.Country,
+			Type:      req.Type,
+			Latitude:  req.Latitude,
+			Longitude: req.Longitude,
+			Limit:     req.Limit,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"points": points})
+	}
+}
+
+// GetPacketaPoint handles GET /api/shipping/packeta/points/:id
+func GetPacketaPoint(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		point, err := db.GetPacketaPoint(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if point == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pickup point not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, point)
+	}
+}
+
+// SyncPacketaPoints handles POST /api/admin/shipping/packeta/sync
+// Syncs from an uploaded branch feed ("file", XML or JSON) or from the
+// configured source (PACKETA_BRANCH_FEED or the API export)
+func SyncPacketaPoints(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var points []models.PacketaPoint
+		source := "upload"
+		if fileHeader, err := c.FormFile("file"); err == nil {
+			f, err := fileHeader.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+				return
+			}
+			defer f.Close()
+			points, err = shipping.ParsePacketaPoints(f)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		} else {
+			source = shipping.PacketaFeedSource(cfg.PacketaBranchFeed, cfg.PacketaAPIKey)
+			if source == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Packeta is not configured (set PACKETA_API_KEY or PACKETA_BRANCH_FEED) and no file was uploaded"})
+				return
+			}
+			feed, err := shipping.OpenPacketaFeed(ctx, source)
+			if err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+				return
+			}
+			defer feed.Close()
+			points, err = shipping.ParsePacketaPoints(feed)
+			if err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		n, err := db.SyncPacketaPoints(ctx, points)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[PACKETA] Synced %d pickup points from %s", n, redactAPIKey(source, cfg.PacketaAPIKey))
+
+		c.JSON(http.StatusOK, gin.H{"synced": n})
+	}
+}
+
+// GetPacketaSyncStatus handles GET /api/admin/shipping/packeta/sync
+func GetPacketaSyncStatus(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, lastSync, err := db.PacketaPointStats(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"active_points": count, "last_synced_at": lastSync})
+	}
+}
+
+// redactAPIKey keeps the API key embedded in the feed URL out of logs
+func redactAPIKey(source, apiKey string) string {
+	if apiKey == "" {
+		return source
+	}
+	return strings.ReplaceAll(source, apiKey, "***")
+}
+
+// ==================== SHIPPING RATES ====================
+
+// GetShippingRates handles POST /api/shipping/rates
+// Prices the shipping methods for a cart or items and a destination, for
+// checkout. Body: {"cart_id": "..."} or {"items": [{"product_id": "...",
+// "quantity": 1}]}, plus "country" (ISO code, default SK). Methods that
+// cannot ship the goods are left out.
+func GetShippingRates(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var req struct {
+			CartID  *uuid.UUID     `json:"cart_id,omitempty"`
+			Items   []OrderItemReq `json:"items,omitempty"`
+			Country string         `json:"country"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var items []models.OrderItem
+		var subtotal float64
+		if req.CartID != nil {
+			cart, err := db.GetCart(ctx, *req.CartID)
+			if err != nil || cart == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+				return
+			}
+			subtotal = cart.Total
+			for _, item := range cart.Items {
+				items = append(items, models.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity})
+			}
+		} else {
+			for _, item := range req.Items {
+				productID, err := uuid.Parse(item.ProductID)
+				if err != nil || item.Quantity < 1 {
+					continue
+				}
+				product, err := db.GetProduct(ctx, productID)
+				if err != nil || product == nil {
+					continue
+				}
+				price := product.Price
+				if product.SalePrice != nil && *product.SalePrice > 0 {
+					price = *product.SalePrice
+				}
+				subtotal += price * float64(item.Quantity)
+				items = append(items, models.OrderItem{ProductID: productID, Quantity: item.Quantity})
+			}
+		}
+		if len(items) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No valid items"})
+			return
+		}
+
+		engine, err := db.ShippingRateEngine(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		rateItems, err := db.ShippingRateItems(ctx, items)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		rates := engine.Rates(shipping.RateRequest{Country: req.Country, Subtotal: subtotal, Items: rateItems})
+		if rates == nil {
+			rates = []shipping.Rate{}
+		}
+		c.JSON(http.StatusOK, gin.H{"data": rates, "subtotal": subtotal})
+	}
+}
+
+// GetShippingRateTables handles GET /api/admin/shipping/rates
+// Returns all shipping methods with their rates and rules.
+func GetShippingRateTables(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		methods, rates, rules, err := db.ShippingRateTables(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"methods": methods, "rates": rates, "rules": rules})
+	}
+}
+
+// UpdateShippingRates handles PUT /api/admin/shipping/methods/:code/rates
+// Replaces the method's rates and rules. Body: {"rates": [...], "rules": [...]}.
+func UpdateShippingRates(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		code := c.Param("code")
+
+		var req struct {
+			Rates []models.ShippingRate `json:"rates"`
+			Rules []struct {
+				models.ShippingRule
+				IsActive *bool `json:"is_active"` // default true
+			} `json:"rules"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		method, err := db.GetShippingMethod(ctx, code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if method == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shipping method not found"})
+			return
+		}
+
+		for i := range req.Rates {
+			if err := validateShippingRate(&req.Rates[i]); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rates[%d]: %v", i, err)})
+				return
+			}
+		}
+		rules := make([]models.ShippingRule, 0, len(req.Rules))
+		for i, r := range req.Rules {
+			rule := r.ShippingRule
+			rule.IsActive = r.IsActive == nil || *r.IsActive
+			if err := validateShippingRule(&rule); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rules[%d]: %v", i, err)})
+				return
+			}
+			rules = append(rules, rule)
+		}
+
+		if err := db.ReplaceShippingRates(ctx, code, req.Rates, rules); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[SHIPPING] Rates of %s replaced: %d rates, %d rules", code, len(req.Rates), len(req.Rules))
+
+		c.JSON(http.StatusOK, gin.H{"success": true, "rates": len(req.Rates), "rules": len(req.Rules)})
+	}
+}
+
+func validateShippingRate(r *models.ShippingRate) error {
+	r.Country = strings.ToUpper(strings.TrimSpace(r.Country))
+	switch {
+	case r.Country != "" && len(r.Country) != 2:
+		return fmt.Errorf("country must be an ISO code")
+	case r.Price < 0 || r.WeightFrom < 0:
+		return fmt.Errorf("price and weight must not be negative")
+	case r.WeightTo != nil && *r.WeightTo < r.WeightFrom:
+		return fmt.Errorf("weight_to is below weight_from")
+	}
+	return nil
+}
+
+func validateShippingRule(r *models.ShippingRule) error {
+	r.Country = strings.ToUpper(strings.TrimSpace(r.Country))
+	r.Value = strings.TrimSpace(r.Value)
+	if r.Country != "" && len(r.Country) != 2 {
+		return fmt.Errorf("country must be an ISO code")
+	}
+	switch r.Action {
+	case models.ShippingRuleSurcharge, models.ShippingRuleExclude:
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	switch r.Condition {
+	case models.ShippingCondLarge, models.ShippingCondSmallPallet:
+	case models.ShippingCondCountry:
+		if len(r.Value) != 2 {
+			return fmt.Errorf("country condition needs an ISO code")
+		}
+		r.Value = strings.ToUpper(r.Value)
+	case models.ShippingCondCategory, models.ShippingCondProduct:
+		if _, err := uuid.Parse(r.Value); err != nil {
+			return fmt.Errorf("%s condition needs an ID", r.Condition)
+		}
+	case models.ShippingCondWeightOver:
+		if _, err := strconv.ParseFloat(r.Value, 64); err != nil {
+			return fmt.Errorf("weight_over condition needs kg")
+		}
+	default:
+		return fmt.Errorf("unknown condition %q", r.Condition)
+	}
+	return nil
+}
+
+// ==================== SHIPMENTS ====================
+
+// errShipmentNotAllowed is returned for orders that cannot be shipped (yet)
+var errShipmentNotAllowed = errors.New("shipment not allowed")
+
+// carrierFor returns the carrier integration of a shipping method code
+func carrierFor(ctx context.Context, db *database.Postgres, cfg *config.Config, code string) (shipping.Carrier, error) {
+	method, err := db.GetShippingMethod(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if method == nil {
+		return nil, fmt.Errorf("%w: %s", shipping.ErrNoCarrier, code)
+	}
+	return shipping.NewCarrier(*method, cfg)
+}
+
+// CreateShipment handles POST /api/admin/orders/:id/shipment
+// Registers the order's parcel with the carrier of its shipping method.
+// Body (optional): {"weight": 2.5} in kg, default the products' weight.
+func CreateShipment(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		var req struct {
+			Weight float64 `json:"weight"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		order, err := db.GetOrder(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if order == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+
+		shipment, err := createShipment(ctx, db, cfg, order, req.Weight, actingUserID(c))
+		switch {
+		case errors.Is(err, errShipmentNotAllowed), errors.Is(err, shipping.ErrNoCarrier):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, shipping.ErrNotConfigured):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, database.ErrShipmentExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "shipment": shipment})
+			return
+		case err != nil:
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, shipment)
+	}
+}
+
+// BulkCreateShipments handles POST /api/admin/shipments
+// Registers parcels for many orders at once, each with its own carrier.
+// Body: {"order_ids": [...]}. Orders that already have a shipment are
+// reported with it, not created twice.
+func BulkCreateShipments(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var req struct {
+			OrderIDs []uuid.UUID `json:"order_ids" binding:"required,min=1,max=500"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		type result struct {
+			OrderID  uuid.UUID        `json:"order_id"`
+			Shipment *models.Shipment `json:"shipment,omitempty"`
+			Existing bool             `json:"existing,omitempty"`
+			Error    string           `json:"error,omitempty"`
+		}
+		results := make([]result, 0, len(req.OrderIDs))
+		created, failed := 0, 0
+		createdBy := actingUserID(c)
+
+		for _, id := range req.OrderIDs {
+			r := result{OrderID: id}
+			order, err := db.GetOrder(ctx, id)
+			if err == nil && order == nil {
+				err = fmt.Errorf("order not found")
+			}
+			if err == nil {
+				r.Shipment, err = createShipment(ctx, db, cfg, order, 0, createdBy)
+			}
+			switch {
+			case errors.Is(err, database.ErrShipmentExists):
+				r.Existing = true
+			case err != nil:
+				r.Error = err.Error()
+				failed++
+			default:
+				created++
+			}
+			results = append(results, r)
+		}
+
+		log.Printf("[SHIPPING] Bulk shipment: %d created, %d failed of %d orders", created, failed, len(req.OrderIDs))
+		c.JSON(http.StatusOK, gin.H{"created": created, "failed": failed, "data": results})
+	}
+}
+
+// createShipment registers the order's parcel with its carrier and stores it
+// with its label. Returns the existing shipment with ErrShipmentExists if
+// there is one.
+func createShipment(ctx context.Context, db *database.Postgres, cfg *config.Config,
+	order *models.Order, weight float64, createdBy *uuid.UUID) (*models.Shipment, error) {
+	if existing, err := db.GetActiveShipment(ctx, order.ID); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return existing, database.ErrShipmentExists
+	}
+
+	if order.ShippingMethod == "packeta" && order.PickupPointID == "" {
+		return nil, fmt.Errorf("%w: order #%s has no Packeta pickup point", errShipmentNotAllowed, order.OrderNumber)
+	}
+	switch order.Status {
+	case models.OrderStatusPaid, models.OrderStatusProcessing:
+	case models.OrderStatusPending:
+		if order.PaymentMethod != "cod" {
+			return nil, fmt.Errorf("%w: order #%s is not paid yet", errShipmentNotAllowed, order.OrderNumber)
+		}
+	default:
+		return nil, fmt.Errorf("%w: order #%s is %s", errShipmentNotAllowed, order.OrderNumber, order.Status)
+	}
+
+	carrier, err := carrierFor(ctx, db, cfg, order.ShippingMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	if weight <= 0 {
+		w, err := db.OrderWeight(ctx, order.ID)
+		if err != nil {
+			return nil, err
+		}
+		weight = w
+	}
+	if weight <= 0 {
+		weight = cfg.PacketaDefaultWeight
+	}
+
+	var billing, recipient models.Address
+	json.Unmarshal(order.BillingAddress, &billing)
+	json.Unmarshal(order.ShippingAddress, &recipient)
+	if recipient.FirstName == "" && recipient.LastName == "" {
+		recipient = billing
+	}
+	if recipient.Email == "" {
+		recipient.Email = billing.Email
+	}
+	if recipient.Phone == "" {
+		recipient.Phone = billing.Phone
+	}
+
+	var cod float64
+	if order.PaymentMethod == "cod" {
+		cod = order.Total
+	}
+
+	parcel, err := carrier.CreateShipment(ctx, shipping.ShipmentRequest{
+		Reference:     order.OrderNumber,
+		Recipient:     recipient,
+		PickupPointID: order.PickupPointID,
+		Value:         order.Total,
+		COD:           cod,
+		Currency:      order.Currency,
+		Weight:        weight,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	shipment := &models.Shipment{
+		OrderID:        order.ID,
+		OrderNumber:    order.OrderNumber,
+		Carrier:        carrier.Code(),
+		PacketID:       parcel.ID,
+		TrackingNumber: parcel.TrackingNumber,
+		PickupPointID:  order.PickupPointID,
+		Value:          order.Total,
+		CODAmount:      cod,
+		Weight:         weight,
+		CreatedBy:      createdBy,
+	}
+	if err := db.CreateShipment(ctx, shipment); err != nil {
+		if errors.Is(err, database.ErrShipmentExists) {
+			// Created concurrently by someone else - drop our duplicate parcel
+			if cerr := carrier.Cancel(ctx, parcel.ID); cerr != nil {
+				log.Printf("[SHIPPING] Failed to cancel duplicate %s parcel %s of #%s: %v", carrier.Code(), parcel.ID, order.OrderNumber, cerr)
+			}
+			existing, _ := db.GetActiveShipment(ctx, order.ID)
+			return existing, err
+		}
+		return nil, err
+	}
+	log.Printf("[SHIPPING] %s parcel %s (%s) created for #%s", carrier.Code(), parcel.ID, parcel.TrackingNumber, order.OrderNumber)
+
+	// The label can be fetched again later, a failure here is not fatal
+	if len(parcel.Label) > 0 {
+		err = saveShipmentLabel(ctx, db, cfg, shipment, parcel.Label)
+	} else {
+		err = storeShipmentLabel(ctx, db, cfg, carrier, shipment)
+	}
+	if err != nil {
+		log.Printf("[SHIPPING] Failed to store label of %s parcel %s: %v", carrier.Code(), parcel.ID, err)
+	}
+	return shipment, nil
+}
+
+// storeShipmentLabel fetches the label from the carrier into storage
+func storeShipmentLabel(ctx context.Context, db *database.Postgres, cfg *config.Config, carrier shipping.Carrier, s *models.Shipment) error {
+	data, err := carrier.Labels(ctx, []string{s.PacketID}, shipping.LabelA6)
+	if err != nil {
+		return err
+	}
+	return saveShipmentLabel(ctx, db, cfg, s, data)
+}
+
+// saveShipmentLabel writes the label to storage/labels/<carrier>/<packet>.pdf
+func saveShipmentLabel(ctx context.Context, db *database.Postgres, cfg *config.Config, s *models.Shipment, data []byte) error {
+	dir := filepath.Join(cfg.StoragePath, "labels", s.Carrier)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create labels dir: %w", err)
+	}
+	path := filepath.Join(dir, s.PacketID+".pdf")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write label: %w", err)
+	}
+	s.LabelPath = path
+	return db.SetShipmentLabel(ctx, s.ID, path)
+}
+
+// ListOrderShipments handles GET /api/admin/orders/:id/shipments
+func ListOrderShipments(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		shipments, err := db.ListOrderShipments(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": shipments})
+	}
+}
+
+// DownloadShipmentLabel handles GET /api/admin/orders/:id/shipment/label
+func DownloadShipmentLabel(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		shipment, err := db.GetActiveShipment(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if shipment == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+			return
+		}
+
+		var data []byte
+		if shipment.LabelPath != "" {
+			data, err = os.ReadFile(shipment.LabelPath)
+		}
+		if shipment.LabelPath == "" || os.IsNotExist(err) {
+			// Never fetched or storage lost - ask the carrier again
+			var carrier shipping.Carrier
+			if carrier, err = carrierFor(ctx, db, cfg, shipment.Carrier); err == nil {
+				if err = storeShipmentLabel(ctx, db, cfg, carrier, shipment); err == nil {
+					data, err = os.ReadFile(shipment.LabelPath)
+				}
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=stitok-%s.pdf", shipment.OrderNumber))
+		c.Data(http.StatusOK, "application/pdf", data)
+	}
+}
+
+// BulkShipmentLabels handles POST /api/admin/shipments/labels
+// Returns the labels of the orders' parcels in one PDF for printing. All
+// orders must ship with the same carrier.
+// Body: {"order_ids": [...], "format": "A6", "offset": 0}; format is A6, A4
+// or a carrier's own, offset (Packeta only) skips used positions on the sheet.
+func BulkShipmentLabels(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var req struct {
+			OrderIDs []uuid.UUID `json:"order_ids" binding:"required,min=1,max=500"`
+			Format   string      `json:"format"`
+			Offset   int         `json:"offset"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var carrierCode string
+		var packetIDs []string
+		var missing []uuid.UUID
+		for _, id := range req.OrderIDs {
+			shipment, err := db.GetActiveShipment(ctx, id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if shipment == nil {
+				missing = append(missing, id)
+				continue
+			}
+			if carrierCode != "" && shipment.Carrier != carrierCode {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Orders ship with different carriers, print their labels separately"})
+				return
+			}
+			carrierCode = shipment.Carrier
+			packetIDs = append(packetIDs, shipment.PacketID)
+		}
+		if len(missing) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Some orders have no shipment", "order_ids": missing})
+			return
+		}
+
+		carrier, err := carrierFor(ctx, db, cfg, carrierCode)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var data []byte
+		if o, ok := carrier.(shipping.LabelOffsetter); ok && req.Offset > 0 {
+			data, err = o.LabelsAt(ctx, packetIDs, req.Format, req.Offset)
+		} else {
+			data, err = carrier.Labels(ctx, packetIDs, req.Format)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=stitky-%s.pdf", time.Now().Format("20060102-150405")))
+		c.Data(http.StatusOK, "application/pdf", data)
+	}
+}
+
+// CancelShipment handles DELETE /api/admin/orders/:id/shipment
+// Cancels the parcel at the carrier (possible until it is handed over)
+func CancelShipment(db *database.Postgres, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		shipment, err := db.GetActiveShipment(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if shipment == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+			return
+		}
+
+		carrier, err := carrierFor(ctx, db, cfg, shipment.Carrier)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := carrier.Cancel(ctx, shipment.PacketID); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.CancelShipment(ctx, shipment); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[SHIPPING] %s parcel %s of #%s cancelled", shipment.Carrier, shipment.PacketID, shipment.OrderNumber)
+
+		c.JSON(http.StatusOK, shipment)
+	}
+}
+
+// ==================== TRACKING ====================
+
+// RefreshOrderTracking handles POST /api/admin/orders/:id/tracking/refresh
+// Asks the carrier about the order's parcel now instead of waiting for the
+// tracking sync; a delivered or returned parcel moves the order as well.
+func RefreshOrderTracking(db *database.Postgres, syncer *tracking.Syncer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		parcel, err := db.GetTrackedParcel(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if parcel == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order has no tracking number"})
+			return
+		}
+
+		result, err := syncer.SyncOrder(ctx, *parcel)
+		if errors.Is(err, shipping.ErrNoCarrier) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		events, err := db.ListTrackingEvents(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"result": result, "data": events})
+	}
+}
+
+// actingUserID returns the logged-in admin, if any
+func actingUserID(c *gin.Context) *uuid.UUID {
+	if userID, ok := c.Get("user_id"); ok {
+		if uid, err := uuid.Parse(fmt.Sprint(userID)); err == nil {
+			return &uid
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"megashop/internal/cache"
+	"megashop/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== STOCK ====================
+
+// ListStockMovements handles GET /api/admin/products/:id/stock-movements
+// Stock history of a product, newest first.
+func ListStockMovements(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+		result, err := db.ListStockMovements(c.Request.Context(), id, page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// AdjustStock handles POST /api/admin/products/:id/stock
+// Manual correction, e.g. after a stocktake or damage. Body:
+// {"delta": -2, "note": "..."}
+func AdjustStock(db *database.Postgres, redisCache *cache.Redis) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		var req struct {
+			Delta int    `json:"delta"`
+			Note  string `json:"note"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Delta == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "delta must not be zero"})
+			return
+		}
+
+		stock, err := db.AdjustStock(ctx, id, req.Delta, actingUserID(c), strings.TrimSpace(req.Note))
+		if errors.Is(err, database.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if redisCache != nil {
+			redisCache.InvalidateProduct(ctx, id.String())
+			redisCache.InvalidateProductLists(ctx)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"product_id": id, "stock": stock})
+	}
+}
+
+// ListStockDiscrepancies handles GET /api/admin/stock/discrepancies
+// Products whose stock differs from their suppliers' stock less the pieces
+// held by open orders. Query: supplier (code), min_diff, limit.
+func ListStockDiscrepancies(db *database.Postgres) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		minDiff, _ := strconv.Atoi(c.DefaultQuery("min_diff", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "200"))
+
+		report, err := db.ListStockDiscrepancies(c.Request.Context(), database.StockDiscrepancyFilter{
+			SupplierCode:  strings.TrimSpace(c.Query("supplier")),
+			MinDifference: minDiff,
+			Limit:         limit,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": report})
+	}
+}
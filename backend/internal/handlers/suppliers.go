@@ -1,8 +1,6 @@
 package handlers
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -18,14 +16,14 @@ import (
 	"strings"
 	"sync"
 	"time"
-	"unicode/utf8"
-
-	"golang.org/x/text/encoding/charmap"
-	"golang.org/x/text/transform"
 
 	"megashop/internal/cache"
 	"megashop/internal/database"
+	"megashop/internal/feeds"
 	"megashop/internal/models"
+	"megashop/internal/offers"
+	"megashop/internal/pricing"
+	"megashop/internal/scheduler"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -112,6 +110,15 @@ func CreateSupplier(db *database.Postgres) gin.HandlerFunc {
 			input.AuthType = "none"
 		}
 
+		if err := validateSchedule(input.Schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if err := validateFeedConfig(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+
 		fmt.Printf("[DEBUG] CreateSupplier - After defaults: auth_type=%s, feed_type=%s, max_downloads=%d\n",
 			input.AuthType, input.FeedType, input.MaxDownloadsPerDay)
 
@@ -150,6 +157,15 @@ func UpdateSupplier(db *database.Postgres) gin.HandlerFunc {
 		input.ID = id
 		input.UpdatedAt = time.Now()
 
+		if err := validateSchedule(input.Schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if err := validateFeedConfig(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+
 		if err := db.UpdateSupplier(ctx, &input); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 			return
@@ -159,6 +175,55 @@ func UpdateSupplier(db *database.Postgres) gin.HandlerFunc {
 	}
 }
 
+// validateSchedule checks the supplier's pipeline cron expression, empty is fine
+func validateSchedule(schedule string) error {
+	if strings.TrimSpace(schedule) == "" {
+		return nil
+	}
+	_, err := scheduler.Parse(schedule)
+	return err
+}
+
+// validateFeedConfig checks the feed type and the field mappings feeds
+// other than Action's are imported with; mappings may be left empty until
+// the feed is set up, and are optional for Heureka and Google feeds
+func validateFeedConfig(s *models.Supplier) error {
+	switch s.FeedType {
+	case "", feeds.TypeXML, feeds.TypeCSV, feeds.TypeJSON, feeds.TypeJSONLines:
+	default:
+		return fmt.Errorf("unsupported feed type %q", s.FeedType)
+	}
+	if s.FeedFormat == "action" || feeds.IsPreset(s.FeedFormat) {
+		if s.FeedType != "" && s.FeedType != feeds.TypeXML {
+			return fmt.Errorf("%s feeds are XML", s.FeedFormat)
+		}
+		if s.FeedFormat == "action" {
+			return nil
+		}
+	}
+	switch strings.TrimSpace(string(s.FieldMappings)) {
+	case "", "{}", "null":
+		return nil
+	}
+	_, err := supplierMapping(s)
+	return err
+}
+
+// supplierMapping returns the mapping a feed other than Action's is read
+// with: the built-in one of Heureka and Google feeds, with the supplier's
+// field mappings on top, or the field mappings alone
+func supplierMapping(supplier *models.Supplier) (*feeds.Mapping, error) {
+	if feeds.IsPreset(supplier.FeedFormat) {
+		return feeds.PresetMapping(supplier.FeedFormat, supplier.FieldMappings)
+	}
+	mapping, err := feeds.ParseMapping(supplier.FieldMappings)
+	if err != nil {
+		return nil, err
+	}
+	mapping.CategorySeparator = supplier.CategorySeparator
+	return mapping, nil
+}
+
 // DeleteSupplier handles DELETE /api/admin/suppliers/:id
 func DeleteSupplier(db *database.Postgres) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -834,27 +899,6 @@ type ActionAttrValue struct {
 }
 
 // runImport runs the import process in background
-// makeCharsetReader converts various charsets to UTF-8
-func makeCharsetReader(charset string, input io.Reader) (io.Reader, error) {
-	charset = strings.ToLower(charset)
-	switch charset {
-	case "utf-8", "utf8":
-		return input, nil
-	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
-		return transform.NewReader(input, charmap.ISO8859_1.NewDecoder()), nil
-	case "iso-8859-2", "iso8859-2", "latin2", "latin-2":
-		return transform.NewReader(input, charmap.ISO8859_2.NewDecoder()), nil
-	case "windows-1250", "cp1250":
-		return transform.NewReader(input, charmap.Windows1250.NewDecoder()), nil
-	case "windows-1252", "cp1252":
-		return transform.NewReader(input, charmap.Windows1252.NewDecoder()), nil
-	default:
-		// Try Windows-1252 as fallback (common for European content)
-		fmt.Printf("[Import] Unknown charset '%s', trying Windows-1252\n", charset)
-		return transform.NewReader(input, charmap.Windows1252.NewDecoder()), nil
-	}
-}
-
 func runImport(db *database.Postgres, supplier *models.Supplier, storedFeed *models.StoredFeed, feedImport *models.FeedImport) {
 	// Build: 2026-02-03-v3 - XML preprocessing fix with panic recovery
 	ctx := context.Background()
@@ -884,237 +928,71 @@ func runImport(db *database.Postgres, supplier *models.Supplier, storedFeed *mod
 		fmt.Printf("[Import] %s: %s\n", status, message)
 	}
 
+	fail := func(message string, err error) {
+		fmt.Printf("[Import] ERROR %s: %v\n", message, err)
+		updateProgress("failed", fmt.Sprintf("%s: %v", message, err))
+		feedImport.ErrorMessage = err.Error()
+		feedImport.Status = "failed"
+		feedImport.FinishedAt = time.Now()
+		db.UpdateFeedImport(ctx, feedImport)
+	}
+
 	updateProgress("running", "Opening feed file...")
 
 	// Open feed file
 	file, err := os.Open(storedFeed.FilePath)
 	if err != nil {
-		fmt.Printf("[Import] ERROR opening file %s: %v\n", storedFeed.FilePath, err)
-		updateProgress("failed", fmt.Sprintf("Failed to open feed file: %v", err))
-		feedImport.ErrorMessage = err.Error()
-		feedImport.Status = "failed"
-		feedImport.FinishedAt = time.Now()
-		db.UpdateFeedImport(ctx, feedImport)
+		fail("Failed to open feed file", err)
 		return
 	}
 	defer file.Close()
 
-	fmt.Printf("[Import] File opened successfully, size info from stat...\n")
+	var fileSize int64
 	if fi, err := file.Stat(); err == nil {
-		fmt.Printf("[Import] File size: %d bytes\n", fi.Size())
+		fileSize = fi.Size()
+		fmt.Printf("[Import] File size: %d bytes\n", fileSize)
 	}
 
-	updateProgress("running", "Reading and preprocessing XML...")
-
-	// Read entire file
-	content, err := io.ReadAll(file)
-	if err != nil {
-		fmt.Printf("[Import] ERROR reading file: %v\n", err)
-		updateProgress("failed", fmt.Sprintf("Failed to read file: %v", err))
-		feedImport.ErrorMessage = err.Error()
-		feedImport.Status = "failed"
-		feedImport.FinishedAt = time.Now()
-		db.UpdateFeedImport(ctx, feedImport)
+	// Feeds other than Action's are read through field mappings
+	if err := validateFeedConfig(supplier); err != nil {
+		fail("Invalid feed settings", err)
 		return
 	}
-
-	fmt.Printf("[Import] Read %d bytes, checking if GZIP compressed...\n", len(content))
-
-	// Check if GZIP compressed (magic bytes 1f 8b)
-	if len(content) > 2 && content[0] == 0x1f && content[1] == 0x8b {
-		fmt.Printf("[Import] File is GZIP compressed, decompressing...\n")
-		gzReader, err := gzip.NewReader(bytes.NewReader(content))
-		if err != nil {
-			fmt.Printf("[Import] ERROR creating gzip reader: %v\n", err)
-			updateProgress("failed", fmt.Sprintf("Failed to decompress GZIP: %v", err))
-			feedImport.ErrorMessage = err.Error()
-			feedImport.Status = "failed"
-			feedImport.FinishedAt = time.Now()
-			db.UpdateFeedImport(ctx, feedImport)
-			return
-		}
-		
-		content, err = io.ReadAll(gzReader)
-		gzReader.Close()
+	var mapping *feeds.Mapping
+	if supplier.FeedFormat != "action" {
+		mapping, err = supplierMapping(supplier)
 		if err != nil {
-			fmt.Printf("[Import] ERROR decompressing: %v\n", err)
-			updateProgress("failed", fmt.Sprintf("Failed to decompress: %v", err))
-			feedImport.ErrorMessage = err.Error()
-			feedImport.Status = "failed"
-			feedImport.FinishedAt = time.Now()
-			db.UpdateFeedImport(ctx, feedImport)
+			fail("Invalid field mappings", err)
 			return
 		}
-		fmt.Printf("[Import] Decompressed to %d bytes\n", len(content))
-	}
-
-	fmt.Printf("[Import] Preprocessing XML content...\n")
-
-	// Check if XML declares an encoding and potentially fix it
-	// Action XML often declares utf-8 but contains Windows-1252 characters
-	contentStr := string(content)
-	
-	// If XML declares utf-8 but has invalid bytes, try to re-encode from Windows-1252
-	if strings.Contains(contentStr[:min(500, len(contentStr))], `encoding="utf-8"`) {
-		// Check if there are bytes > 127 that aren't valid UTF-8
-		hasInvalidUTF8 := false
-		for i := 0; i < len(content); i++ {
-			if content[i] > 127 {
-				// Check if it's a valid UTF-8 sequence
-				r, size := utf8.DecodeRune(content[i:])
-				if r == utf8.RuneError && size == 1 {
-					hasInvalidUTF8 = true
-					break
-				}
-				i += size - 1
-			}
-		}
-		
-		if hasInvalidUTF8 {
-			fmt.Printf("[Import] XML declares utf-8 but has invalid bytes, converting from Windows-1252...\n")
-			// Decode as Windows-1252 and re-encode as UTF-8
-			decoder := charmap.Windows1252.NewDecoder()
-			utf8Content, _, err := transform.Bytes(decoder, content)
-			if err == nil {
-				content = utf8Content
-				contentStr = string(content)
-				fmt.Printf("[Import] Converted to UTF-8, now %d bytes\n", len(content))
-			}
-		}
-	}
-
-	// Remove illegal XML control characters
-	var cleanBuilder strings.Builder
-	cleanBuilder.Grow(len(contentStr))
-	for _, r := range contentStr {
-		if r == '\t' || r == '\n' || r == '\r' || r >= 0x20 {
-			cleanBuilder.WriteRune(r)
-		}
 	}
-	contentStr = cleanBuilder.String()
-	fmt.Printf("[Import] Removed control chars, now %d bytes. Fixing ampersands...\n", len(contentStr))
 
-	// Fix unescaped ampersands
-	contentStr = strings.ReplaceAll(contentStr, "&amp;", "___XAMP___")
-	contentStr = strings.ReplaceAll(contentStr, "&lt;", "___XLT___")
-	contentStr = strings.ReplaceAll(contentStr, "&gt;", "___XGT___")
-	contentStr = strings.ReplaceAll(contentStr, "&quot;", "___XQUOT___")
-	contentStr = strings.ReplaceAll(contentStr, "&apos;", "___XAPOS___")
-	contentStr = strings.ReplaceAll(contentStr, "&", "&amp;")
-	contentStr = strings.ReplaceAll(contentStr, "___XAMP___", "&amp;")
-	contentStr = strings.ReplaceAll(contentStr, "___XLT___", "&lt;")
-	contentStr = strings.ReplaceAll(contentStr, "___XGT___", "&gt;")
-	contentStr = strings.ReplaceAll(contentStr, "___XQUOT___", "&quot;")
-	contentStr = strings.ReplaceAll(contentStr, "___XAPOS___", "&apos;")
-	
-	content = []byte(contentStr)
-	fmt.Printf("[Import] Preprocessing done, starting XML decode (%d bytes)...\n", len(content))
-	updateProgress("running", "Parsing XML...")
-
-	// Parse XML
-	var catalog ActionCatalog
-	decoder := xml.NewDecoder(bytes.NewReader(content))
-	decoder.Strict = false
-	decoder.CharsetReader = makeCharsetReader
-	
-	fmt.Printf("[Import] XML decoder created, starting Decode()...\n")
-	if err := decoder.Decode(&catalog); err != nil {
-		fmt.Printf("[Import] ERROR: XML decode failed: %v\n", err)
-		updateProgress("failed", fmt.Sprintf("Failed to parse XML: %v", err))
-		feedImport.ErrorMessage = err.Error()
-		feedImport.Status = "failed"
-		feedImport.FinishedAt = time.Now()
-		db.UpdateFeedImport(ctx, feedImport)
+	// The feed is streamed: gzip, charset repair and the like are handled
+	// by readers in front of the parser, and each item is stored as soon
+	// as it is parsed. Progress is the share of the file read so far.
+	counter := feeds.NewCountingReader(file)
+	feedReader, err := feeds.NewReader(counter, supplier.FeedType)
+	if err != nil {
+		fail("Failed to decompress GZIP", err)
 		return
 	}
+	defer feedReader.Close()
 
-	fmt.Printf("[Import] XML parsed OK! Categories: %d, Producers: %d, Products: %d\n", 
-		len(catalog.Categories.MainCategories), 
-		len(catalog.Producers.Producers), 
-		len(catalog.Products.Products))
-
-	// Process categories
-	updateProgress("running", fmt.Sprintf("Processing %d categories...", len(catalog.Categories.MainCategories)))
-	for _, mainCat := range catalog.Categories.MainCategories {
-		// Create main category
-		supCat := &models.SupplierCategory{
-			ID:         uuid.New(),
-			SupplierID: supplier.ID,
-			ExternalID: mainCat.ID,
-			Name:       mainCat.Name,
-			FullPath:   mainCat.Name,
-			CreatedAt:  time.Now(),
-			UpdatedAt:  time.Now(),
-		}
-		if err := db.UpsertSupplierCategory(ctx, supCat); err == nil {
-			feedImport.CategoriesCreated++
-		}
-
-		// Create subcategories
-		for _, subCat := range mainCat.SubCategories {
-			supSubCat := &models.SupplierCategory{
-				ID:               uuid.New(),
-				SupplierID:       supplier.ID,
-				ExternalID:       subCat.ID,
-				ParentExternalID: mainCat.ID,
-				Name:             subCat.Name,
-				FullPath:         mainCat.Name + " > " + subCat.Name,
-				CreatedAt:        time.Now(),
-				UpdatedAt:        time.Now(),
-			}
-			if err := db.UpsertSupplierCategory(ctx, supSubCat); err == nil {
-				feedImport.CategoriesCreated++
-			}
+	reportProgress := func() {
+		if fileSize > 0 {
+			feedImport.ProgressPercent = min(float64(counter.Count())/float64(fileSize)*100, 100)
 		}
-	}
+		feedImport.TotalItems = feedImport.Processed
+		updateProgress("running", fmt.Sprintf("Processed %d products, %.1f/%.1f MB read (%.1f%%)",
+			feedImport.Processed, float64(counter.Count())/1024/1024, float64(fileSize)/1024/1024, feedImport.ProgressPercent))
 
-	// Process producers/brands
-	updateProgress("running", fmt.Sprintf("Processing %d producers...", len(catalog.Producers.Producers)))
-	producerMap := make(map[string]string)
-	for _, producer := range catalog.Producers.Producers {
-		producerMap[producer.ID] = producer.Name
-		
-		supBrand := &models.SupplierBrand{
-			ID:         uuid.New(),
-			SupplierID: supplier.ID,
-			ExternalID: producer.ID,
-			Name:       producer.Name,
-			CreatedAt:  time.Now(),
-			UpdatedAt:  time.Now(),
-		}
-		if err := db.UpsertSupplierBrand(ctx, supBrand); err == nil {
-			feedImport.BrandsCreated++
-		}
-	}
-
-	// Process products
-	totalProducts := len(catalog.Products.Products)
-	feedImport.TotalItems = totalProducts
-	updateProgress("running", fmt.Sprintf("Processing %d products...", totalProducts))
-
-	// Extract Action CDN config from supplier auth_credentials
-	var cdnConfig *ActionCDNConfig
-	if supplier.FeedFormat == "action" && len(supplier.AuthCredentials) > 0 {
-		var authCreds map[string]string
-		if err := json.Unmarshal(supplier.AuthCredentials, &authCreds); err == nil {
-			if authCreds["action_cid"] != "" && authCreds["action_uid"] != "" && authCreds["action_pid"] != "" {
-				cdnConfig = &ActionCDNConfig{
-					CID: authCreds["action_cid"],
-					UID: authCreds["action_uid"],
-					PID: authCreds["action_pid"],
-				}
-				fmt.Printf("[Import] Using Action CDN config: CID=%s, UID=%s\n", cdnConfig.CID, cdnConfig.UID)
-			}
-		}
+		// Save progress to database periodically
+		db.UpdateFeedImport(ctx, feedImport)
 	}
 
 	batchSize := 500
-	for i, product := range catalog.Products.Products {
-		// Parse product with CDN config
-		supProduct := parseActionProduct(supplier.ID, &product, producerMap, cdnConfig)
-
-		// Upsert to database
-		isNew, err := db.UpsertSupplierProduct(ctx, supProduct)
+	storeProduct := func(product *models.SupplierProduct) {
+		isNew, err := db.UpsertSupplierProduct(ctx, product)
 		if err != nil {
 			feedImport.Errors++
 		} else if isNew {
@@ -1123,18 +1001,32 @@ func runImport(db *database.Postgres, supplier *models.Supplier, storedFeed *mod
 			feedImport.Updated++
 		}
 		feedImport.Processed++
+		feedImport.CurrentItem = product.Name
 
 		// Update progress every batch
-		if (i+1)%batchSize == 0 || i == totalProducts-1 {
-			feedImport.ProgressPercent = float64(i+1) / float64(totalProducts) * 100
-			feedImport.CurrentItem = product.Name
-			updateProgress("running", fmt.Sprintf("Processed %d/%d products (%.1f%%)", i+1, totalProducts, feedImport.ProgressPercent))
-
-			// Save progress to database periodically
-			db.UpdateFeedImport(ctx, feedImport)
+		if feedImport.Processed%batchSize == 0 {
+			reportProgress()
 		}
 	}
 
+	updateProgress("running", "Parsing feed...")
+
+	var brandCount int
+	if mapping != nil {
+		brandCount, err = importMappedFeed(ctx, db, supplier, feedImport, mapping, feedReader, storeProduct)
+	} else {
+		brandCount, err = importActionFeed(ctx, db, supplier, feedImport, feedReader, storeProduct)
+	}
+	if err != nil {
+		fail("Failed to parse feed", err)
+		return
+	}
+
+	totalProducts := feedImport.Processed
+	reportProgress()
+	feedImport.ProgressPercent = 100
+	fmt.Printf("[Import] Feed parsed OK! Brands: %d, Products: %d\n", brandCount, totalProducts)
+
 	// Extract categories from products (Action XML doesn't have Categories section)
 	updateProgress("running", "Extracting categories from products...")
 	catCount, catErr := db.ExtractCategoriesFromProducts(ctx, supplier.ID)
@@ -1145,6 +1037,14 @@ func runImport(db *database.Postgres, supplier *models.Supplier, storedFeed *mod
 		fmt.Printf("[Import] Extracted %d categories from products\n", catCount)
 	}
 
+	// New prices and stock reach the products through their offers
+	updateProgress("running", "Selecting supplier offers...")
+	if n, err := db.RefreshOffers(ctx, &supplier.ID); err != nil {
+		fmt.Printf("[Import] Warning: Failed to select offers: %v\n", err)
+	} else {
+		fmt.Printf("[Import] Selected offers of %d products\n", n)
+	}
+
 	// Complete
 	feedImport.Status = "completed"
 	feedImport.FinishedAt = time.Now()
@@ -1154,7 +1054,7 @@ func runImport(db *database.Postgres, supplier *models.Supplier, storedFeed *mod
 	// Update stored feed stats
 	storedFeed.TotalProducts = totalProducts
 	storedFeed.TotalCategories = catCount
-	storedFeed.TotalBrands = len(catalog.Producers.Producers)
+	storedFeed.TotalBrands = brandCount
 	storedFeed.Status = "imported"
 	db.UpdateStoredFeed(ctx, storedFeed)
 
@@ -1170,6 +1070,180 @@ func runImport(db *database.Postgres, supplier *models.Supplier, storedFeed *mod
 	}()
 }
 
+// importActionFeed streams an Action catalog: categories and producers are
+// stored as they come, products are handed to store. Returns the number of
+// producers.
+func importActionFeed(ctx context.Context, db *database.Postgres, supplier *models.Supplier, feedImport *models.FeedImport, r io.Reader, store func(*models.SupplierProduct)) (int, error) {
+	cdnConfig := actionCDNConfig(supplier)
+	decoder := feeds.NewXMLDecoder(r)
+
+	// Producers precede products in Action feeds, so the map is complete
+	// by the time products refer to it
+	producerMap := make(map[string]string)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return len(producerMap), nil
+		}
+		if err != nil {
+			return len(producerMap), err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "MainCategory":
+			var mainCat ActionMainCategory
+			if err := decoder.DecodeElement(&mainCat, &start); err != nil {
+				return len(producerMap), err
+			}
+			importActionCategory(ctx, db, supplier, feedImport, &mainCat)
+
+		case "Producer":
+			var producer ActionProducer
+			if err := decoder.DecodeElement(&producer, &start); err != nil {
+				return len(producerMap), err
+			}
+			producerMap[producer.ID] = producer.Name
+
+			supBrand := &models.SupplierBrand{
+				ID:         uuid.New(),
+				SupplierID: supplier.ID,
+				ExternalID: producer.ID,
+				Name:       producer.Name,
+				CreatedAt:  time.Now(),
+				UpdatedAt:  time.Now(),
+			}
+			if err := db.UpsertSupplierBrand(ctx, supBrand); err == nil {
+				feedImport.BrandsCreated++
+			}
+
+		case "Product":
+			var product ActionProduct
+			if err := decoder.DecodeElement(&product, &start); err != nil {
+				return len(producerMap), err
+			}
+			// Parse product with CDN config
+			store(parseActionProduct(supplier.ID, &product, producerMap, cdnConfig))
+		}
+	}
+}
+
+// actionCDNConfig extracts the Action CDN config from the supplier's auth_credentials
+func actionCDNConfig(supplier *models.Supplier) *ActionCDNConfig {
+	if supplier.FeedFormat != "action" || len(supplier.AuthCredentials) == 0 {
+		return nil
+	}
+	var authCreds map[string]string
+	if err := json.Unmarshal(supplier.AuthCredentials, &authCreds); err != nil {
+		return nil
+	}
+	if authCreds["action_cid"] == "" || authCreds["action_uid"] == "" || authCreds["action_pid"] == "" {
+		return nil
+	}
+	fmt.Printf("[Import] Using Action CDN config: CID=%s, UID=%s\n", authCreds["action_cid"], authCreds["action_uid"])
+	return &ActionCDNConfig{
+		CID: authCreds["action_cid"],
+		UID: authCreds["action_uid"],
+		PID: authCreds["action_pid"],
+	}
+}
+
+// importMappedFeed streams the items of an XML, CSV or JSON feed and maps
+// each to a product through the field mappings. Brands are collected from
+// the products' producers. Returns the number of brands.
+func importMappedFeed(ctx context.Context, db *database.Postgres, supplier *models.Supplier, feedImport *models.FeedImport, mapping *feeds.Mapping, r io.Reader, store func(*models.SupplierProduct)) (int, error) {
+	items, err := feedItems(supplier, mapping, r)
+	if err != nil {
+		return 0, err
+	}
+
+	brands := make(map[string]bool)
+	for {
+		item, err := items.Next()
+		if err == io.EOF {
+			return len(brands), nil
+		}
+		if err != nil {
+			return len(brands), err
+		}
+
+		product := mapping.Map(supplier.ID, item)
+		if product.ExternalID == "" || product.Name == "" {
+			feedImport.Errors++
+			continue
+		}
+
+		if product.ProducerName != "" && !brands[product.ProducerName] {
+			brands[product.ProducerName] = true
+			externalID := product.ProducerIDExternal
+			if externalID == "" {
+				externalID = product.ProducerName
+			}
+			supBrand := &models.SupplierBrand{
+				ID:         uuid.New(),
+				SupplierID: supplier.ID,
+				ExternalID: externalID,
+				Name:       product.ProducerName,
+				CreatedAt:  time.Now(),
+				UpdatedAt:  time.Now(),
+			}
+			if err := db.UpsertSupplierBrand(ctx, supBrand); err == nil {
+				feedImport.BrandsCreated++
+			}
+		}
+
+		store(product)
+	}
+}
+
+// feedItems returns the items of a mapped feed. XML feeds default to
+// Product elements, Heureka and Google feeds to their own items.
+func feedItems(supplier *models.Supplier, mapping *feeds.Mapping, r io.Reader) (feeds.Items, error) {
+	itemPath := supplier.XMLItemPath
+	if mapping.ItemPath != "" && (itemPath == "" || itemPath == "Product") {
+		itemPath = mapping.ItemPath
+	}
+	if itemPath == "" && (supplier.FeedType == "" || supplier.FeedType == feeds.TypeXML) {
+		itemPath = "Product"
+	}
+	return feeds.NewItems(r, supplier.FeedType, itemPath, mapping)
+}
+
+// importActionCategory stores a main category of an Action feed and its subcategories
+func importActionCategory(ctx context.Context, db *database.Postgres, supplier *models.Supplier, feedImport *models.FeedImport, mainCat *ActionMainCategory) {
+	supCat := &models.SupplierCategory{
+		ID:         uuid.New(),
+		SupplierID: supplier.ID,
+		ExternalID: mainCat.ID,
+		Name:       mainCat.Name,
+		FullPath:   mainCat.Name,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := db.UpsertSupplierCategory(ctx, supCat); err == nil {
+		feedImport.CategoriesCreated++
+	}
+
+	for _, subCat := range mainCat.SubCategories {
+		supSubCat := &models.SupplierCategory{
+			ID:               uuid.New(),
+			SupplierID:       supplier.ID,
+			ExternalID:       subCat.ID,
+			ParentExternalID: mainCat.ID,
+			Name:             subCat.Name,
+			FullPath:         mainCat.Name + " > " + subCat.Name,
+			CreatedAt:        time.Now(),
+			UpdatedAt:        time.Now(),
+		}
+		if err := db.UpsertSupplierCategory(ctx, supSubCat); err == nil {
+			feedImport.CategoriesCreated++
+		}
+	}
+}
+
 // ActionCDNConfig holds credentials for Action.pl image CDN
 type ActionCDNConfig struct {
 	CID string `json:"action_cid"` // Company ID
@@ -1488,8 +1562,17 @@ func ListSupplierBrands(db *database.Postgres) gin.HandlerFunc {
 
 // ==================== PREVIEW FEED ====================
 
+// PreviewFeedReq optionally overrides the supplier's feed settings, to try
+// field mappings before saving them
+type PreviewFeedReq struct {
+	FeedType      string          `json:"feed_type"`
+	XMLItemPath   string          `json:"xml_item_path"`
+	FieldMappings json.RawMessage `json:"field_mappings"`
+}
+
 // PreviewFeed handles POST /api/admin/suppliers/:id/preview
-// Returns sample data from the stored feed without importing
+// Parses the current feed without importing it: totals and the first
+// items, for mapped feeds both as read and as mapped to products.
 func PreviewFeed(db *database.Postgres) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
@@ -1499,6 +1582,45 @@ func PreviewFeed(db *database.Postgres) gin.HandlerFunc {
 			return
 		}
 
+		supplier, err := db.GetSupplier(ctx, supplierID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if supplier == nil {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Supplier not found"})
+			return
+		}
+
+		var req PreviewFeedReq
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+				return
+			}
+		}
+		if req.FeedType != "" {
+			supplier.FeedType = req.FeedType
+		}
+		if req.XMLItemPath != "" {
+			supplier.XMLItemPath = req.XMLItemPath
+		}
+		if len(req.FieldMappings) > 0 {
+			supplier.FieldMappings = req.FieldMappings
+		}
+
+		if err := validateFeedConfig(supplier); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		var mapping *feeds.Mapping
+		if supplier.FeedFormat != "action" {
+			if mapping, err = supplierMapping(supplier); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+				return
+			}
+		}
+
 		// Get current feed
 		storedFeed, err := db.GetCurrentFeed(ctx, supplierID)
 		if err != nil {
@@ -1518,34 +1640,136 @@ func PreviewFeed(db *database.Postgres) gin.HandlerFunc {
 		}
 		defer file.Close()
 
-		var catalog ActionCatalog
-		decoder := xml.NewDecoder(file)
-		if err := decoder.Decode(&catalog); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to parse XML"})
+		feedReader, err := feeds.NewReader(file, supplier.FeedType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to decompress feed"})
 			return
 		}
+		defer feedReader.Close()
 
-		// Get sample products (first 10)
-		sampleProducts := catalog.Products.Products
-		if len(sampleProducts) > 10 {
-			sampleProducts = sampleProducts[:10]
+		var preview gin.H
+		if mapping != nil {
+			preview, err = previewMappedFeed(supplier, mapping, feedReader)
+		} else {
+			preview, err = previewActionFeed(feedReader)
+		}
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "error": fmt.Sprintf("Failed to parse feed: %v", err)})
+			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"data": gin.H{
-				"total_categories":  len(catalog.Categories.MainCategories),
-				"total_producers":   len(catalog.Producers.Producers),
-				"total_products":    len(catalog.Products.Products),
-				"sample_categories": catalog.Categories.MainCategories[:min(5, len(catalog.Categories.MainCategories))],
-				"sample_producers":  catalog.Producers.Producers[:min(10, len(catalog.Producers.Producers))],
-				"sample_products":   sampleProducts,
-			},
-		})
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": preview})
+	}
+}
+
+// previewActionFeed counts the categories, producers and products of an
+// Action catalog and keeps the first of each
+func previewActionFeed(r io.Reader) (gin.H, error) {
+	decoder := feeds.NewXMLDecoder(r)
+	categories := []ActionMainCategory{}
+	producers := []ActionProducer{}
+	products := []ActionProduct{}
+	var totalCategories, totalProducers, totalProducts int
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "MainCategory":
+			var mainCat ActionMainCategory
+			if err := decoder.DecodeElement(&mainCat, &start); err != nil {
+				return nil, err
+			}
+			if totalCategories++; len(categories) < 5 {
+				categories = append(categories, mainCat)
+			}
+		case "Producer":
+			var producer ActionProducer
+			if err := decoder.DecodeElement(&producer, &start); err != nil {
+				return nil, err
+			}
+			if totalProducers++; len(producers) < 10 {
+				producers = append(producers, producer)
+			}
+		case "Product":
+			if totalProducts++; len(products) >= 10 {
+				if err := decoder.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			var product ActionProduct
+			if err := decoder.DecodeElement(&product, &start); err != nil {
+				return nil, err
+			}
+			products = append(products, product)
+		}
 	}
+
+	return gin.H{
+		"total_categories":  totalCategories,
+		"total_producers":   totalProducers,
+		"total_products":    totalProducts,
+		"sample_categories": categories,
+		"sample_producers":  producers,
+		"sample_products":   products,
+	}, nil
 }
 
+// previewMappedFeed counts the items of a mapped feed, those the mappings
+// cannot import and the brands, and keeps the first items with their products
+func previewMappedFeed(supplier *models.Supplier, mapping *feeds.Mapping, r io.Reader) (gin.H, error) {
+	items, err := feedItems(supplier, mapping, r)
+	if err != nil {
+		return nil, err
+	}
+
+	sampleItems := []*feeds.Node{}
+	sampleProducts := []*models.SupplierProduct{}
+	brands := make(map[string]bool)
+	var total, invalid int
+	for {
+		item, err := items.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		total++
+		product := mapping.Map(supplier.ID, item)
+		if product.ExternalID == "" || product.Name == "" {
+			invalid++
+		}
+		if product.ProducerName != "" {
+			brands[product.ProducerName] = true
+		}
+		if len(sampleItems) < 10 {
+			sampleItems = append(sampleItems, item)
+			sampleProducts = append(sampleProducts, product)
+		}
+	}
 
+	return gin.H{
+		"feed_type":       supplier.FeedType,
+		"total_products":  total,
+		"invalid_items":   invalid,
+		"total_producers": len(brands),
+		"sample_items":    sampleItems,
+		"sample_products": sampleProducts,
+	}, nil
+}
 
 // LinkAllProducts links all supplier products to main catalog
 func LinkAllProducts(db *database.Postgres) gin.HandlerFunc {
@@ -1588,6 +1812,7 @@ type LinkProgress struct {
 	Processed   int    `json:"processed"`
 	Created     int    `json:"created"`
 	Updated     int    `json:"updated"`
+	Merged      int    `json:"merged"` // offers added to an existing product
 	Errors      int    `json:"errors"`
 	Message     string `json:"message"`
 }
@@ -1638,12 +1863,36 @@ func runLinkAll(db *database.Postgres, supplier *models.Supplier, linkID string)
 	
 	progress.Total = len(products)
 	progress.Message = fmt.Sprintf("Processing %d products...", len(products))
+
+	priceEngine, err := db.PricingEngine(ctx)
+	if err != nil {
+		progress.Status = "failed"
+		progress.Message = fmt.Sprintf("Failed to load pricing rules: %v", err)
+		return
+	}
 	
 	// Category cache - use FULL PATH as key to avoid collisions
 	categoryCache := make(map[string]uuid.UUID)
 	brandCache := make(map[string]uuid.UUID)
 	
 	for i, sp := range products {
+		// Same EAN or part number as a product we already sell: add this
+		// supplier's offer to it instead of creating a second listing
+		existingID, err := db.FindOfferProduct(ctx, sp)
+		if err != nil {
+			fmt.Printf("[Link] Error matching product %s: %v\n", sp.Name, err)
+		}
+		if existingID != nil {
+			if err := db.LinkSupplierProduct(ctx, sp.ID, *existingID); err != nil {
+				progress.Errors++
+				fmt.Printf("[Link] Error linking product %s: %v\n", sp.Name, err)
+			} else {
+				progress.Merged++
+			}
+			progress.Processed++
+			continue
+		}
+
 		// Get or create category - use full path as cache key
 		var categoryID *uuid.UUID
 		categoryKey := sp.MainCategoryTree + "|" + sp.CategoryTree + "|" + sp.SubCategoryTree
@@ -1696,19 +1945,36 @@ func runLinkAll(db *database.Postgres, supplier *models.Supplier, linkID string)
 			ExternalID:  sp.ExternalID,
 			Status:      "active",
 			Weight:      sp.Weight,
+			EAN:         offers.NormalizeCode(sp.EAN),
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
 		}
+		// Variant groups are the supplier's, so they are kept apart per supplier
+		if sp.ItemGroupID != "" {
+			mainProduct.ItemGroupID = supplier.Code + "-" + sp.ItemGroupID
+		}
 		
-		// Use sale price if available
-		if sp.SRP > 0 && sp.SRP > sp.PriceVAT {
+		// Retail price from the pricing rules, else the supplier's price
+		// with the SRP as the crossed-out price
+		if res := priceEngine.Price(pricing.Input{
+			SupplierID: supplier.ID,
+			CategoryID: categoryID,
+			BrandID:    brandID,
+			PriceNet:   sp.PriceNet,
+			PriceVAT:   sp.PriceVAT,
+			VATRate:    sp.VATRate,
+			SRP:        sp.SRP,
+		}); res != nil {
+			mainProduct.Price = res.Price
+			mainProduct.SalePrice = res.SalePrice
+		} else if sp.SRP > 0 && sp.SRP > sp.PriceVAT {
 			mainProduct.Price = sp.SRP
 			salePrice := sp.PriceVAT
 			mainProduct.SalePrice = &salePrice
 		}
 		
 		// Upsert product
-		isNew, err := db.UpsertProduct(ctx, mainProduct)
+		isNew, err := db.UpsertProduct(ctx, mainProduct, supplier.ID)
 		if err != nil {
 			progress.Errors++
 			fmt.Printf("[Link] Error creating product %s: %v\n", sp.Name, err)
@@ -1730,11 +1996,19 @@ func runLinkAll(db *database.Postgres, supplier *models.Supplier, linkID string)
 		
 		// Update progress every 100 products
 		if (i+1) % 100 == 0 || i == len(products)-1 {
-			progress.Message = fmt.Sprintf("Processed %d/%d (created: %d, updated: %d)", 
-				progress.Processed, progress.Total, progress.Created, progress.Updated)
+			progress.Message = fmt.Sprintf("Processed %d/%d (created: %d, updated: %d, merged: %d)", 
+				progress.Processed, progress.Total, progress.Created, progress.Updated, progress.Merged)
 		}
 	}
 	
+	// Price, stock and delivery days of every product from its best offer
+	progress.Message = "Selecting supplier offers..."
+	if n, err := db.RefreshOffers(ctx, &supplier.ID); err != nil {
+		fmt.Printf("[Link] Error selecting offers: %v\n", err)
+	} else {
+		fmt.Printf("[Link] Selected offers of %d products\n", n)
+	}
+
 	// Update category product counts
 	progress.Message = "Updating category product counts..."
 	if err := db.UpdateAllCategoryProductCounts(ctx); err != nil {
@@ -1747,8 +2021,8 @@ func runLinkAll(db *database.Postgres, supplier *models.Supplier, linkID string)
 	}
 	
 	progress.Status = "completed"
-	progress.Message = fmt.Sprintf("Completed! Created: %d, Updated: %d, Errors: %d", 
-		progress.Created, progress.Updated, progress.Errors)
+	progress.Message = fmt.Sprintf("Completed! Created: %d, Updated: %d, Merged: %d, Errors: %d", 
+		progress.Created, progress.Updated, progress.Merged, progress.Errors)
 }
 
 func generateProductSlug(name, externalID string) string {
@@ -0,0 +1,194 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/models"
+)
+
+// ErrInvalidCreditNote is returned (wrapped) when the requested correction
+// does not fit the invoice: unknown line, more than invoiced, nothing left
+var ErrInvalidCreditNote = errors.New("invalid credit note")
+
+// CreditLine selects what to credit on one invoice line. Quantity returns
+// pieces at the invoiced unit price; Amount (with VAT) credits a fixed sum,
+// e.g. a price correction, optionally together with returned pieces.
+// Quantity and Amount both zero credit everything left on the line.
+type CreditLine struct {
+	Line     int     `json:"line"` // index into the invoice lines
+	Quantity int     `json:"quantity"`
+	Amount   float64 `json:"amount"`
+}
+
+// CreditOptions control a new credit note. Without lines everything not yet
+// credited is credited (cancelled order).
+type CreditOptions struct {
+	IssueDate  time.Time
+	SupplyDate time.Time
+	Reason     string
+	Lines      []CreditLine
+}
+
+// CreditNoteNumberFormat builds the credit note number (D2026000012), the
+// prefix keeps the series apart from invoice numbers
+func CreditNoteNumberFormat(year, sequence int) string {
+	return fmt.Sprintf("D%d%06d", year, sequence)
+}
+
+// BuildCreditNote creates an unnumbered credit note to the invoice. previous
+// are the credit notes already issued to it; together they may not credit
+// more pieces or money than the invoice line had.
+func BuildCreditNote(cfg *config.Config, inv *models.Invoice, previous []models.CreditNote, opts CreditOptions) (*models.CreditNote, error) {
+	issue := dateOnly(opts.IssueDate)
+	if issue.IsZero() {
+		issue = dateOnly(time.Now())
+	}
+	if issue.Before(inv.IssueDate) {
+		return nil, fmt.Errorf("%w: issue date is before the invoice date", ErrInvalidCreditNote)
+	}
+	supply := dateOnly(opts.SupplyDate)
+	if supply.IsZero() {
+		supply = issue
+	}
+
+	remaining := remainingLines(inv, previous)
+
+	requested := opts.Lines
+	if len(requested) == 0 {
+		for i := range inv.Lines {
+			if remaining[i].Net != 0 || remaining[i].VAT != 0 {
+				requested = append(requested, CreditLine{Line: i})
+			}
+		}
+		if len(requested) == 0 {
+			return nil, fmt.Errorf("%w: invoice %s is already fully credited", ErrInvalidCreditNote, inv.Number)
+		}
+	}
+
+	cn := &models.CreditNote{
+		InvoiceID:     inv.ID,
+		InvoiceNumber: inv.Number,
+		OrderID:       inv.OrderID,
+		OrderNumber:   inv.OrderNumber,
+		IssueDate:     issue,
+		SupplyDate:    supply,
+		Reason:        opts.Reason,
+		Supplier:      Supplier(cfg),
+		Customer:      inv.Customer,
+		Currency:      inv.Currency,
+		PaymentMethod: inv.PaymentMethod,
+	}
+
+	for _, req := range requested {
+		if req.Line < 0 || req.Line >= len(inv.Lines) {
+			return nil, fmt.Errorf("%w: invoice has no line %d", ErrInvalidCreditNote, req.Line)
+		}
+		if req.Quantity < 0 || req.Amount < 0 {
+			return nil, fmt.Errorf("%w: quantity and amount must be positive", ErrInvalidCreditNote)
+		}
+		line := inv.Lines[req.Line]
+		rem := &remaining[req.Line]
+		remGross := Round(rem.Net + rem.VAT)
+
+		qty := req.Quantity
+		if qty == 0 && req.Amount == 0 {
+			qty = rem.Quantity
+		}
+		if qty > rem.Quantity {
+			return nil, fmt.Errorf("%w: line %d (%s) has only %d pieces left to credit", ErrInvalidCreditNote, req.Line, line.Name, rem.Quantity)
+		}
+
+		var net, vat float64
+		switch {
+		case req.Amount > 0:
+			if req.Amount > remGross+0.005 {
+				return nil, fmt.Errorf("%w: line %d (%s) has only %.2f left to credit", ErrInvalidCreditNote, req.Line, line.Name, remGross)
+			}
+			if Round(req.Amount) == remGross {
+				net, vat = rem.Net, rem.VAT
+			} else {
+				net = Round(req.Amount / (1 + line.VATRate/100))
+				vat = Round(req.Amount - net)
+			}
+		case qty == rem.Quantity:
+			// Last pieces take what is left, so rounding never leaves cents behind
+			net, vat = rem.Net, rem.VAT
+		default:
+			net = Round(line.UnitPrice * float64(qty))
+			vat = Round(net * line.VATRate / 100)
+		}
+		if net <= 0 && vat <= 0 {
+			return nil, fmt.Errorf("%w: line %d (%s) is already fully credited", ErrInvalidCreditNote, req.Line, line.Name)
+		}
+
+		credit := models.CreditNoteLine{
+			InvoiceLine: models.InvoiceLine{
+				Name:      line.Name,
+				SKU:       line.SKU,
+				ProductID: line.ProductID,
+				Quantity:  -qty,
+				VATRate:   line.VATRate,
+				Net:       -net,
+				VAT:       -vat,
+				Gross:     -Round(net + vat),
+			},
+			InvoiceLineIndex: req.Line,
+		}
+		if qty > 0 {
+			credit.UnitPrice = line.UnitPrice
+		} else {
+			credit.Name = "Oprava ceny - " + line.Name
+		}
+		cn.Lines = append(cn.Lines, credit)
+
+		rem.Quantity -= qty
+		rem.Net = Round(rem.Net - net)
+		rem.VAT = Round(rem.VAT - vat)
+	}
+
+	byRate := map[float64]*models.VATSummary{}
+	for _, l := range cn.Lines {
+		s, ok := byRate[l.VATRate]
+		if !ok {
+			s = &models.VATSummary{Rate: l.VATRate}
+			byRate[l.VATRate] = s
+		}
+		s.Base = Round(s.Base + l.Net)
+		s.VAT = Round(s.VAT + l.VAT)
+	}
+	for _, s := range byRate {
+		s.Total = Round(s.Base + s.VAT)
+		cn.VATSummary = append(cn.VATSummary, *s)
+		cn.Subtotal += s.Base
+		cn.VATTotal += s.VAT
+	}
+	sort.Slice(cn.VATSummary, func(i, j int) bool { return cn.VATSummary[i].Rate > cn.VATSummary[j].Rate })
+	cn.Subtotal = Round(cn.Subtotal)
+	cn.VATTotal = Round(cn.VATTotal)
+	cn.Total = Round(cn.Subtotal + cn.VATTotal)
+
+	return cn, nil
+}
+
+// remainingLines returns what is left to credit on each invoice line
+// (positive pieces and amounts) after the previous credit notes
+func remainingLines(inv *models.Invoice, previous []models.CreditNote) []models.InvoiceLine {
+	remaining := make([]models.InvoiceLine, len(inv.Lines))
+	copy(remaining, inv.Lines)
+	for _, cn := range previous {
+		for _, l := range cn.Lines {
+			if l.InvoiceLineIndex < 0 || l.InvoiceLineIndex >= len(remaining) {
+				continue
+			}
+			rem := &remaining[l.InvoiceLineIndex]
+			rem.Quantity += l.Quantity // credited quantities are negative
+			rem.Net = Round(rem.Net + l.Net)
+			rem.VAT = Round(rem.VAT + l.VAT)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,94 @@
+package invoice
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"megashop/internal/models"
+)
+
+// Document types in the accounting export
+const (
+	DocumentInvoice    = "faktura"
+	DocumentCreditNote = "dobropis"
+)
+
+var accountingHeader = []string{
+	"typ_dokladu", "cislo_dokladu", "povodny_doklad", "objednavka",
+	"datum_vystavenia", "datum_dodania", "datum_splatnosti",
+	"odberatel", "ico", "dic", "ic_dph", "krajina",
+	"sadzba_dph", "zaklad_dane", "dph", "spolu", "mena",
+	"sposob_uhrady", "variabilny_symbol",
+}
+
+type accountingRow struct {
+	date   time.Time
+	number string
+	fields []string
+}
+
+// WriteAccountingCSV writes invoices and credit notes for import into
+// accounting software: one row per document and VAT rate, semicolon
+// separated with decimal commas. Credit notes have negative amounts.
+func WriteAccountingCSV(w io.Writer, invoices []models.Invoice, creditNotes []models.CreditNote) error {
+	var rows []accountingRow
+
+	for _, inv := range invoices {
+		for _, s := range inv.VATSummary {
+			rows = append(rows, accountingRow{inv.IssueDate, inv.Number, []string{
+				DocumentInvoice, inv.Number, "", inv.OrderNumber,
+				csvDate(inv.IssueDate), csvDate(inv.SupplyDate), csvDate(inv.DueDate),
+				inv.Customer.Name, inv.Customer.ICO, inv.Customer.DIC, inv.Customer.ICDPH, inv.Customer.Country,
+				formatRate(s.Rate), csvAmount(s.Base), csvAmount(s.VAT), csvAmount(s.Total), inv.Currency,
+				PaymentMethodName(inv.PaymentMethod), inv.VariableSymbol,
+			}})
+		}
+	}
+
+	for _, cn := range creditNotes {
+		for _, s := range cn.VATSummary {
+			rows = append(rows, accountingRow{cn.IssueDate, cn.Number, []string{
+				DocumentCreditNote, cn.Number, cn.InvoiceNumber, cn.OrderNumber,
+				csvDate(cn.IssueDate), csvDate(cn.SupplyDate), "",
+				cn.Customer.Name, cn.Customer.ICO, cn.Customer.DIC, cn.Customer.ICDPH, cn.Customer.Country,
+				formatRate(s.Rate), csvAmount(s.Base), csvAmount(s.VAT), csvAmount(s.Total), cn.Currency,
+				PaymentMethodName(cn.PaymentMethod), "",
+			}})
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if !rows[i].date.Equal(rows[j].date) {
+			return rows[i].date.Before(rows[j].date)
+		}
+		return rows[i].number < rows[j].number
+	})
+
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	if err := cw.Write(accountingHeader); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := cw.Write(r.fields); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("02.01.2006")
+}
+
+// csvAmount prints 1234,50 - decimal comma without grouping
+func csvAmount(v float64) string {
+	return strings.ReplaceAll(formatMoney(v), " ", "")
+}
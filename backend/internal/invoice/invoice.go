@@ -0,0 +1,237 @@
+package invoice
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/models"
+)
+
+// DefaultVATRate is the standard Slovak VAT rate used for order lines
+const DefaultVATRate = 20.0
+
+// Options control the dates of a new invoice. Zero values use the defaults:
+// issue date today, supply date = shipped (or issue) date, due date from config.
+type Options struct {
+	IssueDate  time.Time
+	SupplyDate time.Time
+	DueDate    time.Time
+}
+
+// NumberFormat builds the invoice number from the year and its sequence (2026000123)
+func NumberFormat(year, sequence int) string {
+	return fmt.Sprintf("%d%06d", year, sequence)
+}
+
+// Supplier returns the shop's company details from the config
+func Supplier(cfg *config.Config) models.InvoiceParty {
+	return models.InvoiceParty{
+		Name:         cfg.CompanyName,
+		Street:       cfg.CompanyStreet,
+		City:         cfg.CompanyCity,
+		PostalCode:   cfg.CompanyPostalCode,
+		Country:      cfg.CompanyCountry,
+		ICO:          cfg.CompanyICO,
+		DIC:          cfg.CompanyDIC,
+		ICDPH:        cfg.CompanyICDPH,
+		Email:        cfg.SMTPFrom,
+		Registration: cfg.CompanyRegistration,
+	}
+}
+
+// Customer converts the order billing address to an invoice party
+func Customer(addr models.Address) models.InvoiceParty {
+	name := strings.TrimSpace(addr.FirstName + " " + addr.LastName)
+	if addr.Company != "" {
+		name = addr.Company
+	}
+	return models.InvoiceParty{
+		Name:       name,
+		Street:     addr.Street,
+		City:       addr.City,
+		PostalCode: addr.PostalCode,
+		Country:    addr.Country,
+		ICO:        addr.ICO,
+		DIC:        addr.DIC,
+		ICDPH:      addr.ICDPH,
+		Email:      addr.Email,
+		Phone:      addr.Phone,
+	}
+}
+
+// Build creates an unnumbered invoice for the order. The number is assigned
+// when the invoice is stored so the series stays without gaps.
+func Build(cfg *config.Config, order *models.Order, opts Options) (*models.Invoice, error) {
+	var billing models.Address
+	if len(order.BillingAddress) > 0 {
+		if err := json.Unmarshal(order.BillingAddress, &billing); err != nil {
+			return nil, fmt.Errorf("parse billing address: %w", err)
+		}
+	}
+
+	issue := dateOnly(opts.IssueDate)
+	if issue.IsZero() {
+		issue = dateOnly(time.Now())
+	}
+	supply := dateOnly(opts.SupplyDate)
+	if supply.IsZero() {
+		supply = issue
+		if order.ShippedAt != nil {
+			supply = dateOnly(*order.ShippedAt)
+		}
+	}
+
+	paid := order.PaymentStatus == "paid" || order.PaymentStatus == "partially_refunded" || order.PaymentStatus == "refunded"
+	due := dateOnly(opts.DueDate)
+	if due.IsZero() {
+		due = issue
+		if !paid {
+			due = issue.AddDate(0, 0, cfg.InvoiceDueDays)
+		}
+	}
+
+	currency := order.Currency
+	if currency == "" {
+		currency = "EUR"
+	}
+
+	inv := &models.Invoice{
+		OrderID:        order.ID,
+		OrderNumber:    order.OrderNumber,
+		IssueDate:      issue,
+		SupplyDate:     supply,
+		DueDate:        due,
+		Supplier:       Supplier(cfg),
+		Customer:       Customer(billing),
+		Currency:       currency,
+		PaymentMethod:  order.PaymentMethod,
+		VariableSymbol: order.VariableSymbol,
+		IBAN:           cfg.BankIBAN,
+		Paid:           paid,
+	}
+
+	inv.Lines, inv.VATSummary = buildLines(order)
+	for _, s := range inv.VATSummary {
+		inv.Subtotal += s.Base
+		inv.VATTotal += s.VAT
+	}
+	inv.Subtotal = Round(inv.Subtotal)
+	inv.VATTotal = Round(inv.VATTotal)
+	inv.Total = Round(inv.Subtotal + inv.VATTotal)
+
+	return inv, nil
+}
+
+// buildLines converts the order into invoice lines. Product prices are
+// without VAT, shipping and the payment fee are final prices including VAT.
+// VAT of product lines is calculated from the base per rate, the same way
+// the order tax was, so the invoice total matches what the customer paid.
+func buildLines(order *models.Order) ([]models.InvoiceLine, []models.VATSummary) {
+	var lines []models.InvoiceLine
+	netBase := map[float64]float64{}   // rate -> sum of net-priced lines
+	grossBase := map[float64]float64{} // rate -> base of gross-priced lines
+	grossVAT := map[float64]float64{}
+
+	for _, item := range order.Items {
+		productID := item.ProductID
+		net := Round(item.Price * float64(item.Quantity))
+		vat := Round(net * DefaultVATRate / 100)
+		lines = append(lines, models.InvoiceLine{
+			Name:      item.Name,
+			SKU:       item.SKU,
+			ProductID: &productID,
+			Quantity:  item.Quantity,
+			UnitPrice: Round(item.Price),
+			VATRate:   DefaultVATRate,
+			Net:       net,
+			VAT:       vat,
+			Gross:     Round(net + vat),
+		})
+		netBase[DefaultVATRate] += net
+	}
+
+	addGross := func(name string, gross float64) {
+		net := Round(gross / (1 + DefaultVATRate/100))
+		lines = append(lines, models.InvoiceLine{
+			Name:      name,
+			Quantity:  1,
+			UnitPrice: net,
+			VATRate:   DefaultVATRate,
+			Net:       net,
+			VAT:       Round(gross - net),
+			Gross:     Round(gross),
+		})
+		grossBase[DefaultVATRate] += net
+		grossVAT[DefaultVATRate] += Round(gross - net)
+	}
+
+	if order.ShippingPrice > 0 {
+		addGross(fmt.Sprintf("Doprava (%s)", shippingName(order.ShippingMethod)), order.ShippingPrice)
+	}
+	if fee := Round(order.Total - order.Subtotal - order.ShippingPrice - order.Tax); fee > 0 {
+		addGross("Poplatok za platbu", fee)
+	}
+
+	rates := map[float64]bool{}
+	for r := range netBase {
+		rates[r] = true
+	}
+	for r := range grossBase {
+		rates[r] = true
+	}
+
+	var summary []models.VATSummary
+	for rate := range rates {
+		base := Round(netBase[rate] + grossBase[rate])
+		vat := Round(Round(netBase[rate]*rate/100) + grossVAT[rate])
+		summary = append(summary, models.VATSummary{Rate: rate, Base: base, VAT: vat, Total: Round(base + vat)})
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Rate > summary[j].Rate })
+
+	return lines, summary
+}
+
+// Round rounds an amount to cents
+func Round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func dateOnly(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func shippingName(method string) string {
+	m := map[string]string{
+		"packeta": "Zásielkovňa",
+		"dpd":     "DPD kuriér",
+		"gls":     "GLS kuriér",
+		"posta":   "Slovenská pošta",
+	}
+	if v, ok := m[method]; ok {
+		return v
+	}
+	return method
+}
+
+// PaymentMethodName returns the Slovak label of a payment method
+func PaymentMethodName(method string) string {
+	m := map[string]string{
+		"card":     "Platba kartou",
+		"comgate":  "Platba kartou",
+		"gopay":    "Platba kartou",
+		"transfer": "Bankový prevod",
+		"cod":      "Dobierka",
+	}
+	if v, ok := m[method]; ok {
+		return v
+	}
+	return method
+}
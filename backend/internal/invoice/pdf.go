@@ -0,0 +1,353 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"megashop/internal/models"
+)
+
+// field is a label/value row in the document header
+type field struct {
+	Label string
+	Value string
+}
+
+// document is the printable form shared by invoices and other tax documents
+type document struct {
+	Title      string
+	Number     string
+	References []field // order number, original document...
+	Dates      []field
+	Payment    []field
+	Supplier   models.InvoiceParty
+	Customer   models.InvoiceParty
+	Lines      []models.InvoiceLine
+	VATSummary []models.VATSummary
+	Subtotal   float64
+	VATTotal   float64
+	Total      float64
+	Currency   string
+	TotalLabel string
+	Note       string
+	CreatedAt  time.Time
+}
+
+// RenderPDF renders the invoice as an A4 PDF
+func RenderPDF(inv *models.Invoice) ([]byte, error) {
+	doc := document{
+		Title:  "Faktúra - daňový doklad",
+		Number: inv.Number,
+		References: []field{
+			{"Objednávka", inv.OrderNumber},
+		},
+		Dates: []field{
+			{"Dátum vystavenia", formatDate(inv.IssueDate)},
+			{"Dátum dodania", formatDate(inv.SupplyDate)},
+			{"Dátum splatnosti", formatDate(inv.DueDate)},
+		},
+		Payment: []field{
+			{"Spôsob úhrady", PaymentMethodName(inv.PaymentMethod)},
+		},
+		Supplier:   inv.Supplier,
+		Customer:   inv.Customer,
+		Lines:      inv.Lines,
+		VATSummary: inv.VATSummary,
+		Subtotal:   inv.Subtotal,
+		VATTotal:   inv.VATTotal,
+		Total:      inv.Total,
+		Currency:   inv.Currency,
+		TotalLabel: "Celkom na úhradu",
+		CreatedAt:  inv.CreatedAt,
+	}
+
+	vs := inv.VariableSymbol
+	if vs == "" {
+		vs = inv.Number
+	}
+	if inv.IBAN != "" {
+		doc.Payment = append(doc.Payment, field{"IBAN", inv.IBAN})
+	}
+	doc.Payment = append(doc.Payment, field{"Variabilný symbol", vs})
+	if inv.Paid {
+		doc.TotalLabel = "Celkom (uhradené)"
+		doc.Note = "Faktúra je už uhradená, neuhrádzajte."
+	}
+
+	return render(doc)
+}
+
+// RenderCreditNotePDF renders the credit note in the same layout as the invoice
+func RenderCreditNotePDF(cn *models.CreditNote) ([]byte, error) {
+	lines := make([]models.InvoiceLine, len(cn.Lines))
+	for i, l := range cn.Lines {
+		lines[i] = l.InvoiceLine
+	}
+
+	doc := document{
+		Title:  "Dobropis - opravný doklad",
+		Number: cn.Number,
+		References: []field{
+			{"K faktúre č.", cn.InvoiceNumber},
+			{"Objednávka", cn.OrderNumber},
+		},
+		Dates: []field{
+			{"Dátum vystavenia", formatDate(cn.IssueDate)},
+			{"Dátum dodania", formatDate(cn.SupplyDate)},
+		},
+		Payment: []field{
+			{"Spôsob úhrady", PaymentMethodName(cn.PaymentMethod)},
+		},
+		Supplier:   cn.Supplier,
+		Customer:   cn.Customer,
+		Lines:      lines,
+		VATSummary: cn.VATSummary,
+		Subtotal:   cn.Subtotal,
+		VATTotal:   cn.VATTotal,
+		Total:      cn.Total,
+		Currency:   cn.Currency,
+		TotalLabel: "Celkom na vrátenie",
+		Note:       "Dôvod opravy: " + cn.Reason,
+		CreatedAt:  cn.CreatedAt,
+	}
+
+	return render(doc)
+}
+
+// render lays out the document: header, parties, dates, lines, VAT summary
+func render(doc document) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes("go", "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes("go", "B", gobold.TTF)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.SetTitle(fmt.Sprintf("%s %s", doc.Title, doc.Number), true)
+	pdf.SetAuthor(doc.Supplier.Name, true)
+	if !doc.CreatedAt.IsZero() {
+		pdf.SetCreationDate(doc.CreatedAt)
+	}
+	pdf.AliasNbPages("{nb}")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-14)
+		pdf.SetFont("go", "", 7)
+		pdf.SetTextColor(120, 120, 120)
+		footer := doc.Supplier.Name
+		if doc.Supplier.Registration != "" {
+			footer += " | " + doc.Supplier.Registration
+		}
+		pdf.CellFormat(150, 4, footer, "", 0, "L", false, 0, "")
+		pdf.CellFormat(30, 4, fmt.Sprintf("Strana %d/{nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Title
+	pdf.SetTextColor(30, 58, 95)
+	pdf.SetFont("go", "B", 16)
+	pdf.CellFormat(110, 9, doc.Title, "", 0, "L", false, 0, "")
+	pdf.CellFormat(70, 9, "č. "+doc.Number, "", 1, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(4)
+
+	// Parties
+	top := pdf.GetY()
+	partyBlock(pdf, 15, top, "Dodávateľ", doc.Supplier)
+	leftBottom := pdf.GetY()
+	partyBlock(pdf, 110, top, "Odberateľ", doc.Customer)
+	if pdf.GetY() < leftBottom {
+		pdf.SetY(leftBottom)
+	}
+	pdf.Ln(4)
+
+	// Dates, references and payment
+	top = pdf.GetY()
+	fieldBlock(pdf, 15, top, append(append([]field{}, doc.References...), doc.Dates...))
+	leftBottom = pdf.GetY()
+	fieldBlock(pdf, 110, top, doc.Payment)
+	if pdf.GetY() < leftBottom {
+		pdf.SetY(leftBottom)
+	}
+	pdf.Ln(6)
+
+	// Lines
+	cols := []struct {
+		title string
+		width float64
+		align string
+	}{
+		{"Položka", 60, "L"},
+		{"Množ.", 12, "R"},
+		{"Cena/ks bez DPH", 30, "R"},
+		{"DPH %", 12, "R"},
+		{"Bez DPH", 22, "R"},
+		{"DPH", 20, "R"},
+		{"S DPH", 24, "R"},
+	}
+	pdf.SetFont("go", "B", 8)
+	pdf.SetFillColor(237, 242, 247)
+	for _, c := range cols {
+		pdf.CellFormat(c.width, 7, c.title, "B", 0, c.align, true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("go", "", 8)
+	for _, line := range doc.Lines {
+		name := line.Name
+		if line.SKU != "" {
+			name += " (" + line.SKU + ")"
+		}
+		nameLines := pdf.SplitText(name, cols[0].width-2)
+		h := float64(len(nameLines)) * 4.5
+		if h < 6 {
+			h = 6
+		}
+		if pdf.GetY()+h > 270 {
+			pdf.AddPage()
+		}
+		x, y := pdf.GetXY()
+		pdf.MultiCell(cols[0].width, h/float64(len(nameLines)), strings.Join(nameLines, "\n"), "", "L", false)
+		pdf.SetXY(x+cols[0].width, y)
+		qty, unit := fmt.Sprintf("%d", line.Quantity), formatMoney(line.UnitPrice)
+		if line.Quantity == 0 {
+			// price correction without returned pieces
+			qty, unit = "", ""
+		}
+		values := []string{
+			qty,
+			unit,
+			formatRate(line.VATRate),
+			formatMoney(line.Net),
+			formatMoney(line.VAT),
+			formatMoney(line.Gross),
+		}
+		for i, v := range values {
+			pdf.CellFormat(cols[i+1].width, h, v, "", 0, cols[i+1].align, false, 0, "")
+		}
+		pdf.SetXY(15, y+h)
+		pdf.SetDrawColor(229, 231, 235)
+		pdf.Line(15, y+h, 195, y+h)
+	}
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.Ln(6)
+
+	// VAT summary (rekapitulácia DPH) and totals
+	if pdf.GetY() > 230 {
+		pdf.AddPage()
+	}
+	pdf.SetFont("go", "B", 8)
+	pdf.CellFormat(30, 6, "Sadzba DPH", "B", 0, "L", true, 0, "")
+	pdf.CellFormat(30, 6, "Základ dane", "B", 0, "R", true, 0, "")
+	pdf.CellFormat(30, 6, "DPH", "B", 0, "R", true, 0, "")
+	pdf.CellFormat(30, 6, "Spolu", "B", 1, "R", true, 0, "")
+	pdf.SetFont("go", "", 8)
+	for _, s := range doc.VATSummary {
+		pdf.CellFormat(30, 6, formatRate(s.Rate)+" %", "", 0, "L", false, 0, "")
+		pdf.CellFormat(30, 6, formatMoney(s.Base), "", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 6, formatMoney(s.VAT), "", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 6, formatMoney(s.Total), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	pdf.SetX(110)
+	pdf.CellFormat(50, 6, "Základ dane spolu", "", 0, "L", false, 0, "")
+	pdf.CellFormat(35, 6, formatMoney(doc.Subtotal)+" "+doc.Currency, "", 1, "R", false, 0, "")
+	pdf.SetX(110)
+	pdf.CellFormat(50, 6, "DPH spolu", "", 0, "L", false, 0, "")
+	pdf.CellFormat(35, 6, formatMoney(doc.VATTotal)+" "+doc.Currency, "", 1, "R", false, 0, "")
+	pdf.SetX(110)
+	pdf.SetFont("go", "B", 11)
+	pdf.CellFormat(50, 9, doc.TotalLabel, "T", 0, "L", false, 0, "")
+	pdf.CellFormat(35, 9, formatMoney(doc.Total)+" "+doc.Currency, "T", 1, "R", false, 0, "")
+
+	if doc.Note != "" {
+		pdf.Ln(6)
+		pdf.SetFont("go", "", 9)
+		pdf.MultiCell(180, 5, doc.Note, "", "L", false)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("render pdf: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func partyBlock(pdf *fpdf.Fpdf, x, y float64, title string, p models.InvoiceParty) {
+	pdf.SetXY(x, y)
+	pdf.SetFont("go", "B", 8)
+	pdf.SetTextColor(120, 120, 120)
+	pdf.CellFormat(85, 5, strings.ToUpper(title), "", 2, "L", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("go", "B", 10)
+	pdf.CellFormat(85, 5.5, p.Name, "", 2, "L", false, 0, "")
+	pdf.SetFont("go", "", 9)
+
+	lines := []string{p.Street, strings.TrimSpace(p.PostalCode + " " + p.City), p.Country}
+	if p.ICO != "" {
+		lines = append(lines, "IČO: "+p.ICO)
+	}
+	if p.DIC != "" {
+		lines = append(lines, "DIČ: "+p.DIC)
+	}
+	if p.ICDPH != "" {
+		lines = append(lines, "IČ DPH: "+p.ICDPH)
+	}
+	if p.Email != "" {
+		lines = append(lines, p.Email)
+	}
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		pdf.CellFormat(85, 4.5, l, "", 2, "L", false, 0, "")
+	}
+}
+
+func fieldBlock(pdf *fpdf.Fpdf, x, y float64, fields []field) {
+	pdf.SetXY(x, y)
+	for _, f := range fields {
+		if f.Value == "" {
+			continue
+		}
+		pdf.SetX(x)
+		pdf.SetFont("go", "", 9)
+		pdf.CellFormat(35, 5, f.Label+":", "", 0, "L", false, 0, "")
+		pdf.SetFont("go", "B", 9)
+		pdf.CellFormat(50, 5, f.Value, "", 1, "L", false, 0, "")
+	}
+}
+
+// formatMoney prints amounts the Slovak way: 1 234,50
+func formatMoney(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intPart, frac := s[:len(s)-3], s[len(s)-2:]
+	var groups []string
+	for len(intPart) > 3 {
+		groups = append([]string{intPart[len(intPart)-3:]}, groups...)
+		intPart = intPart[:len(intPart)-3]
+	}
+	groups = append([]string{intPart}, groups...)
+	out := strings.Join(groups, " ") + "," + frac
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+func formatRate(rate float64) string {
+	return strings.TrimSuffix(strings.TrimSuffix(fmt.Sprintf("%.2f", rate), "0"), ".0")
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("02.01.2006")
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailTemplate is a customer email editable in admin. Subject and body are
+// Go templates rendered with the order email data.
+type EmailTemplate struct {
+	Key        string     `json:"key" db:"key"`
+	Name       string     `json:"name" db:"-"`
+	Subject    string     `json:"subject" db:"subject"`
+	BodyHTML   string     `json:"body_html" db:"body_html"`
+	Customized bool       `json:"customized" db:"-"` // false = built-in default
+	UpdatedBy  *uuid.UUID `json:"updated_by,omitempty" db:"updated_by"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// Outbox email states
+const (
+	OutboxPending = "pending" // waiting for the first or next attempt
+	OutboxSending = "sending" // claimed by the worker
+	OutboxSent    = "sent"
+	OutboxDead    = "dead" // gave up after MaxAttempts
+)
+
+// OutboxEmail is a rendered customer email waiting for or past delivery
+type OutboxEmail struct {
+	ID            uuid.UUID       `json:"id" db:"id"`
+	Kind          string          `json:"kind" db:"kind"` // template key or order_confirmation
+	OrderID       *uuid.UUID      `json:"order_id,omitempty" db:"order_id"`
+	OrderNumber   string          `json:"order_number,omitempty" db:"-"`
+	ToAddress     string          `json:"to" db:"to_address"`
+	Subject       string          `json:"subject" db:"subject"`
+	BodyHTML      string          `json:"body_html,omitempty" db:"body_html"`
+	Images        json.RawMessage `json:"-" db:"images"`
+	Status        string          `json:"status" db:"status"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	MaxAttempts   int             `json:"max_attempts" db:"max_attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     string          `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at" db:"updated_at"`
+	SentAt        *time.Time      `json:"sent_at,omitempty" db:"sent_at"`
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ==================== INVOICE MODELS ====================
+
+// InvoiceParty is the supplier or customer as printed on an invoice
+type InvoiceParty struct {
+	Name         string `json:"name"`
+	Street       string `json:"street,omitempty"`
+	City         string `json:"city,omitempty"`
+	PostalCode   string `json:"postal_code,omitempty"`
+	Country      string `json:"country,omitempty"`
+	ICO          string `json:"ico,omitempty"`
+	DIC          string `json:"dic,omitempty"`
+	ICDPH        string `json:"ic_dph,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Phone        string `json:"phone,omitempty"`
+	Registration string `json:"registration,omitempty"` // e.g. "OR OS Bratislava I, odd. Sro, vl. č. 12345/B"
+}
+
+// InvoiceLine is a single invoice row. UnitPrice and Net are without VAT.
+type InvoiceLine struct {
+	Name      string     `json:"name"`
+	SKU       string     `json:"sku,omitempty"`
+	ProductID *uuid.UUID `json:"product_id,omitempty"`
+	Quantity  int        `json:"quantity"`
+	UnitPrice float64    `json:"unit_price"`
+	VATRate   float64    `json:"vat_rate"`
+	Net       float64    `json:"net"`
+	VAT       float64    `json:"vat"`
+	Gross     float64    `json:"gross"`
+}
+
+// VATSummary is the tax base and VAT of one rate (rekapitulácia DPH)
+type VATSummary struct {
+	Rate  float64 `json:"rate"`
+	Base  float64 `json:"base"`
+	VAT   float64 `json:"vat"`
+	Total float64 `json:"total"`
+}
+
+// Invoice is an issued tax document (faktúra). Parties and lines are a
+// snapshot taken at issue time, later order changes do not affect it.
+type Invoice struct {
+	ID             uuid.UUID     `json:"id" db:"id"`
+	OrderID        uuid.UUID     `json:"order_id" db:"order_id"`
+	OrderNumber    string        `json:"order_number" db:"order_number"`
+	Number         string        `json:"number" db:"number"`
+	Year           int           `json:"year" db:"year"`
+	Sequence       int           `json:"sequence" db:"sequence"`
+	IssueDate      time.Time     `json:"issue_date" db:"issue_date"`
+	SupplyDate     time.Time     `json:"supply_date" db:"supply_date"`
+	DueDate        time.Time     `json:"due_date" db:"due_date"`
+	Supplier       InvoiceParty  `json:"supplier" db:"supplier"`
+	Customer       InvoiceParty  `json:"customer" db:"customer"`
+	Lines          []InvoiceLine `json:"lines" db:"lines"`
+	VATSummary     []VATSummary  `json:"vat_summary" db:"vat_summary"`
+	Subtotal       float64       `json:"subtotal" db:"subtotal"` // without VAT
+	VATTotal       float64       `json:"vat_total" db:"vat_total"`
+	Total          float64       `json:"total" db:"total"`
+	Currency       string        `json:"currency" db:"currency"`
+	PaymentMethod  string        `json:"payment_method" db:"payment_method"`
+	VariableSymbol string        `json:"variable_symbol" db:"variable_symbol"`
+	IBAN           string        `json:"iban,omitempty" db:"iban"`
+	Paid           bool          `json:"paid" db:"paid"`
+	PDFPath        string        `json:"-" db:"pdf_path"`
+	CreatedAt      time.Time     `json:"created_at" db:"created_at"`
+}
+
+// CreditNoteLine is a corrected invoice line. Quantity, Net, VAT and Gross
+// are negative; InvoiceLine points to the corrected line of the invoice.
+type CreditNoteLine struct {
+	InvoiceLine
+	InvoiceLineIndex int `json:"invoice_line"`
+}
+
+// CreditNote is a corrective tax document (dobropis) to an issued invoice,
+// e.g. for a cancelled order or returned items. Amounts are negative.
+type CreditNote struct {
+	ID            uuid.UUID        `json:"id" db:"id"`
+	InvoiceID     uuid.UUID        `json:"invoice_id" db:"invoice_id"`
+	InvoiceNumber string           `json:"invoice_number" db:"invoice_number"`
+	OrderID       uuid.UUID        `json:"order_id" db:"order_id"`
+	OrderNumber   string           `json:"order_number" db:"order_number"`
+	Number        string           `json:"number" db:"number"`
+	Year          int              `json:"year" db:"year"`
+	Sequence      int              `json:"sequence" db:"sequence"`
+	IssueDate     time.Time        `json:"issue_date" db:"issue_date"`
+	SupplyDate    time.Time        `json:"supply_date" db:"supply_date"` // date of the correction (return, cancellation)
+	Reason        string           `json:"reason" db:"reason"`
+	Supplier      InvoiceParty     `json:"supplier" db:"supplier"`
+	Customer      InvoiceParty     `json:"customer" db:"customer"`
+	Lines         []CreditNoteLine `json:"lines" db:"lines"`
+	VATSummary    []VATSummary     `json:"vat_summary" db:"vat_summary"`
+	Subtotal      float64          `json:"subtotal" db:"subtotal"`
+	VATTotal      float64          `json:"vat_total" db:"vat_total"`
+	Total         float64          `json:"total" db:"total"`
+	Currency      string           `json:"currency" db:"currency"`
+	PaymentMethod string           `json:"payment_method" db:"payment_method"`
+	PDFPath       string           `json:"-" db:"pdf_path"`
+	CreatedBy     *uuid.UUID       `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt     time.Time        `json:"created_at" db:"created_at"`
+}
@@ -16,6 +16,7 @@ type Product struct {
 	Description string          `json:"description" db:"description"`
 	Price       float64         `json:"price" db:"price"`
 	SalePrice   *float64        `json:"sale_price,omitempty" db:"sale_price"`
+	LowestPrice30d *float64     `json:"lowest_price_30d,omitempty" db:"lowest_price_30d"` // lowest price of the 30 days before the last price change (Omnibus)
 	Currency    string          `json:"currency" db:"currency"`
 	Stock       int             `json:"stock" db:"stock"`
 	CategoryID  *uuid.UUID      `json:"category_id,omitempty" db:"category_id"`
@@ -34,6 +35,8 @@ type Product struct {
 	HeurekaCPC       *float64   `json:"heureka_cpc,omitempty" db:"heureka_cpc"`
 	ItemGroupID      string     `json:"itemgroup_id,omitempty" db:"itemgroup_id"`
 	ManufacturerName string     `json:"manufacturer_name,omitempty" db:"manufacturer_name"`
+	AllowBackorder   *bool      `json:"allow_backorder,omitempty" db:"allow_backorder"` // nil follows the suppliers
+	ActiveOfferID    *uuid.UUID `json:"active_offer_id,omitempty" db:"active_offer_id"` // supplier product setting price and stock
 	SearchVector string         `json:"-" db:"search_vector"` // tsvector pre full-text search
 	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
@@ -130,10 +133,15 @@ type Order struct {
 	ID              uuid.UUID       `json:"id" db:"id"`
 	OrderNumber     string          `json:"order_number" db:"order_number"`
 	UserID          *uuid.UUID      `json:"user_id,omitempty" db:"user_id"`
-	Status          string          `json:"status" db:"status"` // pending, paid, processing, shipped, delivered, cancelled
+	Status          string          `json:"status" db:"status"` // pending, paid, processing, shipped, delivered, cancelled, returned
 	PaymentStatus   string          `json:"payment_status" db:"payment_status"`
 	PaymentMethod   string          `json:"payment_method" db:"payment_method"`
+	PaymentTransactionID string     `json:"payment_transaction_id,omitempty" db:"payment_transaction_id"`
+	VariableSymbol  string          `json:"variable_symbol,omitempty" db:"variable_symbol"`
+	PaymentInstructions *BankTransferInstructions `json:"payment_instructions,omitempty" db:"-"`
 	ShippingMethod  string          `json:"shipping_method" db:"shipping_method"`
+	PickupPointID   string          `json:"pickup_point_id,omitempty" db:"pickup_point_id"`
+	PickupPointName string          `json:"pickup_point_name,omitempty" db:"pickup_point_name"`
 	ShippingPrice   float64         `json:"shipping_price" db:"shipping_price"`
 	Subtotal        float64         `json:"subtotal" db:"subtotal"`
 	Tax             float64         `json:"tax" db:"tax"`
@@ -149,6 +157,7 @@ type Order struct {
 	UpdatedAt       time.Time       `json:"updated_at" db:"updated_at"`
 	PaidAt          *time.Time      `json:"paid_at,omitempty" db:"paid_at"`
 	ShippedAt       *time.Time      `json:"shipped_at,omitempty" db:"shipped_at"`
+	ReservedUntil   *time.Time      `json:"reserved_until,omitempty" db:"reserved_until"` // unpaid orders are cancelled after this
 }
 
 type OrderItem struct {
@@ -160,6 +169,7 @@ type OrderItem struct {
 	Name      string    `json:"name" db:"name"`
 	Price     float64   `json:"price" db:"price"`
 	Quantity  int       `json:"quantity" db:"quantity"`
+	Backordered int     `json:"backordered,omitempty" db:"backordered"` // pieces over the stock
 	Total     float64   `json:"total" db:"total"`
 }
 
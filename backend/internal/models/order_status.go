@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ==================== ORDER STATUS ====================
+
+// Order statuses
+const (
+	OrderStatusPending    = "pending"
+	OrderStatusPaid       = "paid"
+	OrderStatusProcessing = "processing"
+	OrderStatusShipped    = "shipped"
+	OrderStatusDelivered  = "delivered"
+	OrderStatusCancelled  = "cancelled"
+	OrderStatusReturned   = "returned"
+)
+
+// Who changed the order status
+const (
+	OrderActorAdmin    = "admin"
+	OrderActorCustomer = "customer"
+	OrderActorSystem   = "system" // payment callbacks, carrier tracking, jobs
+)
+
+// orderTransitions lists the statuses an order may move to from each status.
+// Cancelled and returned orders are final.
+var orderTransitions = map[string][]string{
+	OrderStatusPending:    {OrderStatusPaid, OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusPaid:       {OrderStatusProcessing, OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:    {OrderStatusDelivered, OrderStatusReturned},
+	OrderStatusDelivered:  {OrderStatusReturned},
+}
+
+// IsOrderStatus reports whether status is one of the order statuses
+func IsOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusProcessing, OrderStatusShipped,
+		OrderStatusDelivered, OrderStatusCancelled, OrderStatusReturned:
+		return true
+	}
+	return false
+}
+
+// NextOrderStatuses returns the statuses an order in status from may move to
+func NextOrderStatuses(from string) []string {
+	return orderTransitions[from]
+}
+
+// CanTransitionOrder reports whether an order may move from one status to another
+func CanTransitionOrder(from, to string) bool {
+	for _, s := range orderTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusChange is one entry of the order timeline
+type OrderStatusChange struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	OrderID    uuid.UUID  `json:"order_id" db:"order_id"`
+	FromStatus string     `json:"from_status,omitempty" db:"from_status"` // empty for the order creation
+	ToStatus   string     `json:"to_status" db:"to_status"`
+	ActorType  string     `json:"actor_type" db:"actor_type"`
+	ActorID    *uuid.UUID `json:"actor_id,omitempty" db:"actor_id"`
+	ActorEmail string     `json:"actor_email,omitempty" db:"-"`
+	Note       string     `json:"note,omitempty" db:"note"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
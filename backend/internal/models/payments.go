@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ==================== PAYMENT MODELS ====================
+
+// Payment transaction types and statuses
+const (
+	PaymentTxPayment = "payment"
+	PaymentTxRefund  = "refund"
+
+	PaymentTxPending   = "pending"
+	PaymentTxSucceeded = "succeeded"
+	PaymentTxFailed    = "failed"
+	PaymentTxCancelled = "cancelled"
+)
+
+// PaymentTransaction is a single entry in the payment ledger of an order
+// (payment attempt or refund). Order.PaymentStatus is derived from these.
+type PaymentTransaction struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	OrderID      uuid.UUID  `json:"order_id" db:"order_id"`
+	ParentID     *uuid.UUID `json:"parent_id,omitempty" db:"parent_id"` // refund -> original payment
+	Gateway      string     `json:"gateway" db:"gateway"`               // comgate, gopay, transfer, cod
+	Type         string     `json:"type" db:"type"`                     // payment, refund
+	Status       string     `json:"status" db:"status"`                 // pending, succeeded, failed, cancelled
+	Amount       float64    `json:"amount" db:"amount"`
+	Currency     string     `json:"currency" db:"currency"`
+	ExternalID   string     `json:"external_id,omitempty" db:"external_id"`
+	Note         string     `json:"note,omitempty" db:"note"`
+	ErrorMessage string     `json:"error_message,omitempty" db:"error_message"`
+	CreatedBy    *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// BankTransferInstructions tell the customer how to pay an order by bank transfer
+type BankTransferInstructions struct {
+	IBAN            string    `json:"iban"`
+	BIC             string    `json:"bic,omitempty"`
+	BeneficiaryName string    `json:"beneficiary_name"`
+	Amount          float64   `json:"amount"`
+	Currency        string    `json:"currency"`
+	VariableSymbol  string    `json:"variable_symbol"`
+	DueDate         time.Time `json:"due_date"`
+	Note            string    `json:"note"`
+	QRCode          string    `json:"qr_code,omitempty"` // PAY by square PNG as data URI
+}
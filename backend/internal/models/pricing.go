@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ==================== PRICING ====================
+
+// Psychological rounding of retail prices, always upwards
+const (
+	PriceRoundNone  = "none"
+	PriceRoundWhole = "whole" // 12.30 -> 13.00
+	PriceRound90    = "x.90"  // 12.30 -> 12.90
+	PriceRound99    = "x.99"  // 12.30 -> 12.99
+)
+
+// PricingRule computes the retail price of supplier products it matches.
+// Nil conditions match anything.
+type PricingRule struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	Name           string     `json:"name" db:"name"`
+	SupplierID     *uuid.UUID `json:"supplier_id,omitempty" db:"supplier_id"`
+	CategoryID     *uuid.UUID `json:"category_id,omitempty" db:"category_id"` // includes subcategories
+	BrandID        *uuid.UUID `json:"brand_id,omitempty" db:"brand_id"`
+	PriceFrom      float64    `json:"price_from" db:"price_from"`         // purchase price without VAT
+	PriceTo        *float64   `json:"price_to,omitempty" db:"price_to"`   // exclusive
+	MarkupPercent  float64    `json:"markup_percent" db:"markup_percent"` // on the purchase price
+	MinMargin      float64    `json:"min_margin" db:"min_margin"`         // EUR without VAT
+	FixedSurcharge float64    `json:"fixed_surcharge" db:"fixed_surcharge"`
+	CapAtSRP       bool       `json:"cap_at_srp" db:"cap_at_srp"`
+	Rounding       string     `json:"rounding" db:"rounding"`
+	Priority       int        `json:"priority" db:"priority"`
+	IsActive       bool       `json:"is_active" db:"is_active"`
+	Note           string     `json:"note,omitempty" db:"note"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// PriceChange is a product whose price the pricing rules would change
+type PriceChange struct {
+	ProductID      uuid.UUID  `json:"product_id"`
+	SKU            string     `json:"sku"`
+	Name           string     `json:"name"`
+	SupplierCode   string     `json:"supplier_code"`
+	PurchasePrice  float64    `json:"purchase_price"` // without VAT
+	OldPrice       float64    `json:"old_price"`
+	OldSalePrice   *float64   `json:"old_sale_price,omitempty"`
+	NewPrice       float64    `json:"new_price"`
+	NewSalePrice   *float64   `json:"new_sale_price,omitempty"`
+	Margin         float64    `json:"margin"` // without VAT
+	RuleID         *uuid.UUID `json:"rule_id,omitempty"`
+	RuleName       string     `json:"rule_name,omitempty"`
+	CappedBySRP    bool       `json:"capped_by_srp,omitempty"`
+	BelowMinMargin bool       `json:"below_min_margin,omitempty"`
+}
+
+// PricePoint is one entry of a product's price history
+type PricePoint struct {
+	Price     float64   `json:"price"`
+	SalePrice *float64  `json:"sale_price,omitempty"`
+	Effective float64   `json:"effective_price"` // what the customer paid
+	ChangedAt time.Time `json:"changed_at"`
+}
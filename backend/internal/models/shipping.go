@@ -0,0 +1,148 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Packeta pickup point types
+const (
+	PacketaPointPickup = "pickup_point" // staffed shop or branch
+	PacketaPointZBox   = "zbox"         // Z-BOX parcel locker
+)
+
+// PacketaPoint is a Packeta (Zásielkovňa) pickup point from the synced branch feed
+type PacketaPoint struct {
+	ID           string       `json:"id" db:"id"`
+	Name         string       `json:"name" db:"name"`
+	Place        string       `json:"place" db:"place"` // shop or venue name
+	Street       string       `json:"street" db:"street"`
+	City         string       `json:"city" db:"city"`
+	Zip          string       `json:"zip" db:"zip"` // without spaces
+	Country      string       `json:"country" db:"country"`
+	Type         string       `json:"type" db:"type"`
+	Latitude     float64      `json:"latitude" db:"latitude"`
+	Longitude    float64      `json:"longitude" db:"longitude"`
+	Directions   string       `json:"directions,omitempty" db:"directions"`
+	URL          string       `json:"url,omitempty" db:"url"`
+	Photo        string       `json:"photo,omitempty" db:"photo"`
+	MaxWeight    float64      `json:"max_weight,omitempty" db:"max_weight"` // kg, 0 = unknown
+	OpeningHours OpeningHours `json:"opening_hours" db:"opening_hours"`
+	IsActive     bool         `json:"-" db:"is_active"`
+	SyncedAt     time.Time    `json:"synced_at" db:"synced_at"`
+
+	// Distance in km, only set when searching by coordinates
+	Distance *float64 `json:"distance,omitempty" db:"-"`
+}
+
+// OpeningHours of a pickup point. Regular maps lowercase English day names
+// (monday ... sunday) to the hours as Packeta formats them, e.g. "08:00–18:00".
+type OpeningHours struct {
+	Compact string            `json:"compact"`
+	Regular map[string]string `json:"regular"`
+}
+
+// PacketaPointFilter selects pickup points. Latitude and Longitude order
+// the result by distance, the other fields narrow it down.
+type PacketaPointFilter struct {
+	Zip       string
+	City      string
+	Query     string // free text over name, street, city and zip
+	Country   string
+	Type      string
+	Latitude  *float64
+	Longitude *float64
+	Limit     int
+}
+
+// Shipment states
+const (
+	ShipmentCreated   = "created"
+	ShipmentCancelled = "cancelled"
+)
+
+// Shipment is a parcel registered with a carrier for an order
+type Shipment struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	OrderID        uuid.UUID  `json:"order_id" db:"order_id"`
+	OrderNumber    string     `json:"order_number,omitempty" db:"-"`
+	Carrier        string     `json:"carrier" db:"carrier"`
+	PacketID       string     `json:"packet_id" db:"packet_id"` // carrier's shipment ID
+	TrackingNumber string     `json:"tracking_number" db:"tracking_number"`
+	Status         string     `json:"status" db:"status"`
+	PickupPointID  string     `json:"pickup_point_id,omitempty" db:"pickup_point_id"`
+	Value          float64    `json:"value" db:"value"`
+	CODAmount      float64    `json:"cod_amount" db:"cod_amount"`
+	Weight         float64    `json:"weight" db:"weight"` // kg
+	LabelPath      string     `json:"-" db:"label_path"`
+	CreatedBy      *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	CancelledAt    *time.Time `json:"cancelled_at,omitempty" db:"cancelled_at"`
+}
+
+// Normalized tracking states, carrier codes are mapped to these
+const (
+	TrackingInTransit      = "in_transit"
+	TrackingReadyForPickup = "ready_for_pickup" // waiting at the pickup point or post office
+	TrackingDelivered      = "delivered"
+	TrackingReturned       = "returned" // returned to sender
+	TrackingCancelled      = "cancelled"
+)
+
+// TrackingEvent is one scan of a parcel reported by the carrier
+type TrackingEvent struct {
+	Time        time.Time `json:"time" db:"event_time"`
+	Status      string    `json:"status" db:"status"`
+	Code        string    `json:"code" db:"code"` // carrier's own status code
+	Description string    `json:"description" db:"description"`
+	Location    string    `json:"location,omitempty" db:"location"`
+}
+
+// TrackedParcel is a shipped parcel the tracking sync asks the carrier about
+type TrackedParcel struct {
+	OrderID        uuid.UUID
+	OrderNumber    string
+	Carrier        string // shipping method code
+	ParcelID       string // carrier's shipment ID, the tracking number if unknown
+	TrackingNumber string
+}
+
+// ShippingRate is a price of a shipping method for a weight tier and/or
+// destination country
+type ShippingRate struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	MethodCode string    `json:"method_code" db:"method_code"`
+	Country    string    `json:"country,omitempty" db:"country"` // empty = any country
+	WeightFrom float64   `json:"weight_from" db:"weight_from"`   // kg, inclusive
+	WeightTo   *float64  `json:"weight_to,omitempty" db:"weight_to"`
+	Price      float64   `json:"price" db:"price"`
+	FreeFrom   *float64  `json:"free_from,omitempty" db:"free_from"` // overrides the method's
+}
+
+// Shipping rule actions and conditions
+const (
+	ShippingRuleSurcharge = "surcharge"
+	ShippingRuleExclude   = "exclude"
+
+	ShippingCondLarge       = "large"        // supplier flags the product as oversized
+	ShippingCondSmallPallet = "small_pallet" // supplier ships the product on a pallet
+	ShippingCondCountry     = "country"      // value: ISO code of the destination
+	ShippingCondCategory    = "category"     // value: category ID
+	ShippingCondProduct     = "product"      // value: product ID
+	ShippingCondWeightOver  = "weight_over"  // value: kg
+)
+
+// ShippingRule adds a surcharge to or excludes a shipping method for
+// parcels matching its condition
+type ShippingRule struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	MethodCode string    `json:"method_code" db:"method_code"`
+	Action     string    `json:"action" db:"action"`
+	Condition  string    `json:"condition" db:"condition"`
+	Value      string    `json:"value,omitempty" db:"value"`
+	Country    string    `json:"country,omitempty" db:"country"` // empty = any country
+	Amount     float64   `json:"amount,omitempty" db:"amount"`
+	IsActive   bool      `json:"is_active" db:"is_active"`
+	Note       string    `json:"note,omitempty" db:"note"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ==================== STOCK ====================
+
+// Stock movement sources
+const (
+	StockSourceOrder          = "order"           // reserved by a new order
+	StockSourceCancel         = "cancel"          // returned by a cancelled order
+	StockSourceSupplierImport = "supplier_import" // overwritten from a supplier feed
+	StockSourceManual         = "manual"          // admin edits and adjustments
+)
+
+// StockMovement is one change of a product's stock
+type StockMovement struct {
+	ID          uuid.UUID  `json:"id"`
+	ProductID   uuid.UUID  `json:"product_id"`
+	Source      string     `json:"source"`
+	Delta       int        `json:"delta"`
+	Quantity    int        `json:"quantity"` // stock after the movement
+	ReferenceID *uuid.UUID `json:"reference_id,omitempty"`
+	Reference   string     `json:"reference,omitempty"` // order number, supplier code or admin email
+	Note        string     `json:"note,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// StockDiscrepancy compares our stock of a product with what the supplier
+// of its active offer reports, less the pieces held by open orders
+type StockDiscrepancy struct {
+	ProductID     uuid.UUID  `json:"product_id"`
+	SKU           string     `json:"sku"`
+	Name          string     `json:"name"`
+	Stock         int        `json:"stock"`
+	SupplierStock int        `json:"supplier_stock"` // of the active offer
+	Reserved      int        `json:"reserved"`       // ordered, not shipped yet
+	Expected      int        `json:"expected"`       // supplier stock less reserved
+	Difference    int        `json:"difference"`     // stock less expected
+	Suppliers     []string   `json:"suppliers"`
+	LastMovedAt   *time.Time `json:"last_moved_at,omitempty"`
+}
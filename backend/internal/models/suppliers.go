@@ -22,11 +22,13 @@ type Supplier struct {
 	
 	// Feed configuration
 	FeedURL              string          `json:"feed_url" db:"feed_url"`
-	FeedType             string          `json:"feed_type" db:"feed_type"`     // xml, csv, json
-	FeedFormat           string          `json:"feed_format" db:"feed_format"` // action, heureka, custom
+	FeedType             string          `json:"feed_type" db:"feed_type"`     // xml, csv, json, jsonl (JSON lines)
+	FeedFormat           string          `json:"feed_format" db:"feed_format"` // action, heureka, google (Merchant Center), custom
 	XMLItemPath          string          `json:"xml_item_path" db:"xml_item_path"`
 	CategorySeparator    string          `json:"category_separator" db:"category_separator"`
 	
+	Schedule             string          `json:"schedule" db:"schedule"` // cron expression of the pipeline run, empty = manual only
+	
 	// Download limits
 	MaxDownloadsPerDay   int             `json:"max_downloads_per_day" db:"max_downloads_per_day"`
 	DownloadCountToday   int             `json:"download_count_today" db:"download_count_today"`
@@ -42,6 +44,7 @@ type Supplier struct {
 	// Status
 	IsActive             bool            `json:"is_active" db:"is_active"`
 	Priority             int             `json:"priority" db:"priority"`
+	AllowBackorder       bool            `json:"allow_backorder" db:"allow_backorder"` // products may be ordered over stock
 	
 	// Timestamps
 	CreatedAt            time.Time       `json:"created_at" db:"created_at"`
@@ -125,6 +128,44 @@ type FeedImport struct {
 	CreatedAt        time.Time `json:"created_at" db:"created_at"`
 }
 
+// Steps of a supplier pipeline run, in order
+const (
+	PipelineStepDownload = "download"
+	PipelineStepImport   = "import"
+	PipelineStepLink     = "link"
+	PipelineStepHeureka  = "heureka" // Heureka XML regeneration
+)
+
+// Status of a pipeline run and of its steps
+const (
+	PipelineRunning   = "running"
+	PipelineCompleted = "completed"
+	PipelineFailed    = "failed"
+	PipelineSkipped   = "skipped"
+)
+
+// PipelineRun is one run of a supplier's download, import, link and
+// Heureka regeneration pipeline
+type PipelineRun struct {
+	ID           uuid.UUID      `json:"id" db:"id"`
+	SupplierID   uuid.UUID      `json:"supplier_id" db:"supplier_id"`
+	TriggeredBy  string         `json:"triggered_by" db:"triggered_by"` // manual, scheduled, api
+	Status       string         `json:"status" db:"status"`
+	Steps        []PipelineStep `json:"steps" db:"steps"`
+	ErrorMessage string         `json:"error_message,omitempty" db:"error_message"`
+	StartedAt    time.Time      `json:"started_at" db:"started_at"`
+	FinishedAt   *time.Time     `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// PipelineStep is the outcome of one step of a pipeline run
+type PipelineStep struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Message    string     `json:"message,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
 // ==================== SUPPLIER PRODUCT MODELS ====================
 
 // SupplierProduct represents a product from a supplier's feed
@@ -136,6 +177,7 @@ type SupplierProduct struct {
 	ExternalID             string                 `json:"external_id" db:"external_id"`
 	EAN                    string                 `json:"ean" db:"ean"`
 	ManufacturerPartNumber string                 `json:"manufacturer_part_number" db:"manufacturer_part_number"`
+	ItemGroupID            string                 `json:"item_group_id,omitempty" db:"item_group_id"` // variants of one product share it
 	
 	// Basic info
 	Name                   string                 `json:"name" db:"name"`
@@ -263,3 +305,26 @@ type SupplierBrand struct {
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
 }
+
+// ==================== SUPPLIER OFFER MODELS ====================
+
+// SupplierOffer is a supplier product linked to a main product, one of the
+// offers the selection rules choose from
+type SupplierOffer struct {
+	ID                uuid.UUID `json:"id"` // supplier product
+	SupplierID        uuid.UUID `json:"supplier_id"`
+	SupplierCode      string    `json:"supplier_code"`
+	SupplierName      string    `json:"supplier_name"`
+	SupplierActive    bool      `json:"supplier_active"`
+	Priority          int       `json:"priority"`
+	ExternalID        string    `json:"external_id"`
+	EAN               string    `json:"ean,omitempty"`
+	PriceNet          float64   `json:"price_net"`
+	PriceVAT          float64   `json:"price_vat"`
+	VATRate           float64   `json:"vat_rate"`
+	SRP               float64   `json:"srp,omitempty"`
+	Stock             int       `json:"stock"`
+	ShippingTimeHours int       `json:"shipping_time_hours,omitempty"`
+	Active            bool      `json:"active"` // sets the product's price, stock and delivery days
+	UpdatedAt         time.Time `json:"updated_at"`
+}
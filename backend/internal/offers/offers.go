@@ -0,0 +1,129 @@
+package offers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"megashop/internal/models"
+)
+
+// Selection criteria, applied in order until one offer wins
+const (
+	RuleInStock  = "in_stock" // offers with stock first
+	RuleCheapest = "cheapest" // lowest price
+	RulePriority = "priority" // highest supplier priority
+	RuleFastest  = "fastest"  // shortest shipping time
+)
+
+// DefaultRules is used until the rules are configured
+var DefaultRules = []string{RuleInStock, RuleCheapest, RulePriority, RuleFastest}
+
+// ValidateRules checks the rule names and duplicates
+func ValidateRules(rules []string) error {
+	if len(rules) == 0 {
+		return fmt.Errorf("at least one rule is required")
+	}
+	seen := make(map[string]bool)
+	for _, r := range rules {
+		switch r {
+		case RuleInStock, RuleCheapest, RulePriority, RuleFastest:
+		default:
+			return fmt.Errorf("unknown rule %q", r)
+		}
+		if seen[r] {
+			return fmt.Errorf("rule %q listed twice", r)
+		}
+		seen[r] = true
+	}
+	return nil
+}
+
+// Select returns the index of the winning offer, -1 when no offer comes
+// from an active supplier. Offers equal under all rules keep their order.
+func Select(offers []models.SupplierOffer, rules []string) int {
+	var candidates []int
+	for i, o := range offers {
+		if o.SupplierActive {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return better(offers[candidates[a]], offers[candidates[b]], rules)
+	})
+	return candidates[0]
+}
+
+// better reports whether a beats b under the first rule that tells them apart
+func better(a, b models.SupplierOffer, rules []string) bool {
+	for _, rule := range rules {
+		switch rule {
+		case RuleInStock:
+			if (a.Stock > 0) != (b.Stock > 0) {
+				return a.Stock > 0
+			}
+		case RuleCheapest:
+			// Offers without a price go last
+			pa, pb := priceKey(a.PriceVAT), priceKey(b.PriceVAT)
+			if pa != pb {
+				return pa < pb
+			}
+		case RulePriority:
+			if a.Priority != b.Priority {
+				return a.Priority > b.Priority
+			}
+		case RuleFastest:
+			// Unknown shipping time goes last
+			ha, hb := hoursKey(a.ShippingTimeHours), hoursKey(b.ShippingTimeHours)
+			if ha != hb {
+				return ha < hb
+			}
+		}
+	}
+	return false
+}
+
+func priceKey(p float64) float64 {
+	if p <= 0 {
+		return math.Inf(1)
+	}
+	return p
+}
+
+func hoursKey(h int) int {
+	if h <= 0 {
+		return math.MaxInt32
+	}
+	return h
+}
+
+// Pricing returns the product price from the offer: the supplier's price
+// with VAT, shown as a sale against the SRP when the SRP is higher
+func Pricing(o models.SupplierOffer) (price float64, salePrice *float64) {
+	if o.SRP > 0 && o.SRP > o.PriceVAT {
+		sale := o.PriceVAT
+		return o.SRP, &sale
+	}
+	return o.PriceVAT, nil
+}
+
+// DeliveryDays converts the offer's shipping time to whole days, 0 if unknown
+func DeliveryDays(o models.SupplierOffer) int {
+	if o.ShippingTimeHours <= 0 {
+		return 0
+	}
+	return (o.ShippingTimeHours + 23) / 24
+}
+
+// NormalizeCode trims an EAN or part number for matching
+func NormalizeCode(code string) string {
+	code = strings.TrimSpace(code)
+	if strings.Trim(code, "0") == "" {
+		return ""
+	}
+	return code
+}
@@ -0,0 +1,190 @@
+package payment
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// camt.053 (ISO 20022 BankToCustomerStatement) - only the elements needed
+// for matching incoming payments. Namespaces differ between versions
+// (camt.053.001.02 - .08), so elements are matched by local name only.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	Entries []camtEntry `xml:"Ntry"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// camtStatus is plain text in camt.053.001.02, <Cd> in later versions
+type camtStatus struct {
+	Value string `xml:",chardata"`
+	Code  string `xml:"Cd"`
+}
+
+type camtEntry struct {
+	Reference     string       `xml:"NtryRef"`
+	Amount        camtAmount   `xml:"Amt"`
+	CreditDebit   string       `xml:"CdtDbtInd"`
+	Status        camtStatus   `xml:"Sts"`
+	BookingDate   camtDate     `xml:"BookgDt"`
+	ServicerRef   string       `xml:"AcctSvcrRef"`
+	Transactions  []camtTxDtls `xml:"NtryDtls>TxDtls"`
+	AdditionalInf string       `xml:"AddtlNtryInf"`
+}
+
+type camtTxDtls struct {
+	Refs struct {
+		ServicerRef string `xml:"AcctSvcrRef"`
+		EndToEndID  string `xml:"EndToEndId"`
+		InstrID     string `xml:"InstrId"`
+	} `xml:"Refs"`
+	Amount     camtAmount `xml:"Amt"`
+	TxAmount   camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	Debtor     string     `xml:"RltdPties>Dbtr>Nm"`
+	DebtorPty  string     `xml:"RltdPties>Dbtr>Pty>Nm"`
+	DebtorIBAN string     `xml:"RltdPties>DbtrAcct>Id>IBAN"`
+	Ustrd      []string   `xml:"RmtInf>Ustrd"`
+	CdtrRef    string     `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	AddtlInf   string     `xml:"AddtlTxInf"`
+}
+
+// ParseCamt053 reads an ISO 20022 camt.053 statement. Batch entries with
+// several transaction details are split into one entry per transaction.
+func ParseCamt053(r io.Reader) ([]StatementEntry, error) {
+	var doc camtDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse camt.053: %w", err)
+	}
+	if len(doc.Statements) == 0 {
+		return nil, fmt.Errorf("parse camt.053: no statement found")
+	}
+
+	var entries []StatementEntry
+	for _, stmt := range doc.Statements {
+		for _, ntry := range stmt.Entries {
+			// Only booked entries are final
+			status := strings.ToUpper(firstNonEmpty(ntry.Status.Code, ntry.Status.Value))
+			if status != "" && status != "BOOK" {
+				continue
+			}
+
+			sign := 1.0
+			if strings.EqualFold(ntry.CreditDebit, "DBIT") {
+				sign = -1
+			}
+			booked := parseCamtDate(ntry.BookingDate)
+			ref := firstNonEmpty(ntry.ServicerRef, ntry.Reference)
+
+			if len(ntry.Transactions) == 0 {
+				amount, err := parseCamtAmount(ntry.Amount)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, StatementEntry{
+					Reference:      ref,
+					BookingDate:    booked,
+					Amount:         sign * amount,
+					Currency:       camtCurrency(ntry.Amount),
+					VariableSymbol: FindVariableSymbol(ntry.AdditionalInf),
+					Message:        ntry.AdditionalInf,
+				})
+				continue
+			}
+
+			for i, tx := range ntry.Transactions {
+				amt := tx.Amount
+				if amt.Value == "" {
+					amt = tx.TxAmount
+				}
+				if amt.Value == "" {
+					amt = ntry.Amount
+				}
+				amount, err := parseCamtAmount(amt)
+				if err != nil {
+					return nil, err
+				}
+
+				txRef := tx.Refs.ServicerRef
+				if txRef == "" && ref != "" {
+					txRef = ref
+					if len(ntry.Transactions) > 1 {
+						txRef = fmt.Sprintf("%s/%d", ref, i+1)
+					}
+				}
+
+				message := strings.TrimSpace(strings.Join(append(tx.Ustrd, tx.AddtlInf), " "))
+				vs := FindVariableSymbol(tx.Refs.EndToEndID)
+				if vs == "" {
+					vs = normalizeVariableSymbol(tx.CdtrRef)
+				}
+				if vs == "" {
+					vs = FindVariableSymbol(message)
+				}
+
+				entries = append(entries, StatementEntry{
+					Reference:        txRef,
+					BookingDate:      booked,
+					Amount:           sign * amount,
+					Currency:         camtCurrency(amt),
+					VariableSymbol:   vs,
+					CounterpartyName: firstNonEmpty(tx.Debtor, tx.DebtorPty),
+					CounterpartyIBAN: tx.DebtorIBAN,
+					Message:          message,
+				})
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+func parseCamtAmount(a camtAmount) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(a.Value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse camt.053: invalid amount %q", a.Value)
+	}
+	return v, nil
+}
+
+func camtCurrency(a camtAmount) string {
+	if a.Currency == "" {
+		return "EUR"
+	}
+	return strings.ToUpper(a.Currency)
+}
+
+func parseCamtDate(d camtDate) time.Time {
+	if t, err := time.Parse("2006-01-02", strings.TrimSpace(d.Date)); err == nil {
+		return t
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(d.DateTime)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,213 @@
+package payment
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/models"
+)
+
+// Comgate payment statuses as returned by /status and the push callback
+const (
+	ComgateStatusPending    = "PENDING"
+	ComgateStatusPaid       = "PAID"
+	ComgateStatusCancelled  = "CANCELLED"
+	ComgateStatusAuthorized = "AUTHORIZED"
+)
+
+// ErrComgateInvalidSecret is returned when a callback does not carry our merchant credentials
+var ErrComgateInvalidSecret = errors.New("comgate: invalid merchant or secret")
+
+// ComgateClient talks to the Comgate HTTP API (https://apidoc.comgate.cz)
+type ComgateClient struct {
+	BaseURL    string
+	MerchantID string
+	Secret     string
+	TestMode   bool
+	HTTPClient *http.Client
+}
+
+// ComgatePayment is the result of creating a transaction
+type ComgatePayment struct {
+	TransID     string `json:"trans_id"`
+	RedirectURL string `json:"redirect_url"`
+}
+
+// ComgateStatus describes a transaction state (from /status or the callback)
+type ComgateStatus struct {
+	TransID  string
+	RefID    string
+	Status   string
+	Price    int64 // in cents
+	Currency string
+	Email    string
+	Test     bool
+}
+
+// NewComgateClient creates a client from the application config
+func NewComgateClient(cfg *config.Config) *ComgateClient {
+	return &ComgateClient{
+		BaseURL:    strings.TrimRight(cfg.ComgateAPIURL, "/"),
+		MerchantID: cfg.ComgateShopID,
+		Secret:     cfg.ComgateSecret,
+		TestMode:   cfg.ComgateTestMode,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// IsConfigured returns true if merchant credentials are set
+func (c *ComgateClient) IsConfigured() bool {
+	return c.MerchantID != "" && c.Secret != ""
+}
+
+// CreatePayment creates a Comgate transaction for the order and returns the
+// payment gateway redirect URL. The order number is passed as refId so the
+// callback can be matched back to the order.
+func (c *ComgateClient) CreatePayment(ctx context.Context, order *models.Order, email string) (*ComgatePayment, error) {
+	form := url.Values{}
+	form.Set("merchant", c.MerchantID)
+	form.Set("secret", c.Secret)
+	form.Set("test", strconv.FormatBool(c.TestMode))
+	form.Set("country", "SK")
+	form.Set("price", strconv.FormatInt(ToCents(order.Total), 10))
+	form.Set("curr", orderCurrency(order))
+	form.Set("label", fmt.Sprintf("Objednávka %s", order.OrderNumber))
+	form.Set("refId", order.OrderNumber)
+	form.Set("method", "ALL")
+	form.Set("email", email)
+	form.Set("lang", "sk")
+	form.Set("prepareOnly", "true")
+
+	values, err := c.post(ctx, "/create", form)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := &ComgatePayment{
+		TransID:     values.Get("transId"),
+		RedirectURL: values.Get("redirect"),
+	}
+	if payment.TransID == "" || payment.RedirectURL == "" {
+		return nil, fmt.Errorf("comgate: create returned no transaction")
+	}
+
+	return payment, nil
+}
+
+// GetStatus queries the current state of a transaction
+func (c *ComgateClient) GetStatus(ctx context.Context, transID string) (*ComgateStatus, error) {
+	form := url.Values{}
+	form.Set("merchant", c.MerchantID)
+	form.Set("secret", c.Secret)
+	form.Set("transId", transID)
+
+	values, err := c.post(ctx, "/status", form)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseComgateStatus(values), nil
+}
+
+// Refund returns money of a paid transaction (full or partial amount)
+func (c *ComgateClient) Refund(ctx context.Context, transactionID string, amount float64, currency string) (*Refund, error) {
+	form := url.Values{}
+	form.Set("merchant", c.MerchantID)
+	form.Set("secret", c.Secret)
+	form.Set("test", strconv.FormatBool(c.TestMode))
+	form.Set("transId", transactionID)
+	form.Set("amount", strconv.FormatInt(ToCents(amount), 10))
+	form.Set("curr", currency)
+
+	if _, err := c.post(ctx, "/refund", form); err != nil {
+		return nil, err
+	}
+
+	// Comgate has no separate refund ID, the refund belongs to the transaction
+	return &Refund{ExternalID: transactionID}, nil
+}
+
+// VerifyCallback checks the merchant ID and secret sent by Comgate in the
+// push notification and returns the parsed transaction state.
+func (c *ComgateClient) VerifyCallback(form url.Values) (*ComgateStatus, error) {
+	if subtle.ConstantTimeCompare([]byte(form.Get("merchant")), []byte(c.MerchantID)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(form.Get("secret")), []byte(c.Secret)) != 1 {
+		return nil, ErrComgateInvalidSecret
+	}
+
+	status := parseComgateStatus(form)
+	if status.TransID == "" {
+		return nil, fmt.Errorf("comgate: callback without transId")
+	}
+
+	return status, nil
+}
+
+// post sends a form request and decodes the url-encoded Comgate response
+func (c *ComgateClient) post(ctx context.Context, path string, form url.Values) (url.Values, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("comgate: build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/x-www-form-urlencoded")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("comgate: request %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("comgate: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("comgate: %s returned HTTP %d: %s", path, resp.StatusCode, string(body))
+	}
+
+	values, err := url.ParseQuery(strings.TrimSpace(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("comgate: parse response: %w", err)
+	}
+	if code := values.Get("code"); code != "0" {
+		return nil, fmt.Errorf("comgate: %s failed (code %s): %s", path, code, values.Get("message"))
+	}
+
+	return values, nil
+}
+
+func parseComgateStatus(values url.Values) *ComgateStatus {
+	price, _ := strconv.ParseInt(values.Get("price"), 10, 64)
+	return &ComgateStatus{
+		TransID:  values.Get("transId"),
+		RefID:    values.Get("refId"),
+		Status:   strings.ToUpper(values.Get("status")),
+		Price:    price,
+		Currency: values.Get("curr"),
+		Email:    values.Get("email"),
+		Test:     values.Get("test") == "true",
+	}
+}
+
+// ToCents converts an amount in EUR to integer cents
+func ToCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func orderCurrency(order *models.Order) string {
+	if order.Currency == "" {
+		return "EUR"
+	}
+	return order.Currency
+}
@@ -0,0 +1,67 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"megashop/internal/config"
+)
+
+// Gateway names as stored in the payment ledger
+const (
+	GatewayComgate  = "comgate"
+	GatewayGoPay    = "gopay"
+	GatewayTransfer = "transfer"
+)
+
+// Refund is the gateway's answer to a refund request
+type Refund struct {
+	ExternalID string
+	Pending    bool // accepted, but not settled yet
+}
+
+// Refunder is implemented by gateways that can return captured money
+type Refunder interface {
+	// Refund returns amount (in the payment currency) of the captured
+	// transaction identified by transactionID
+	Refund(ctx context.Context, transactionID string, amount float64, currency string) (*Refund, error)
+}
+
+// ErrRefundFailed is returned by RefundState when the gateway rejected a
+// refund it had accepted
+var ErrRefundFailed = errors.New("refund failed")
+
+// RefundTracker is implemented by gateways whose refunds may be accepted
+// before they settle (Refund returning Pending)
+type RefundTracker interface {
+	// RefundState returns the refund refundID of the transaction, still
+	// Pending while the gateway processes it, ErrRefundFailed if it failed
+	RefundState(ctx context.Context, transactionID, refundID string) (*Refund, error)
+}
+
+// NewRefunders returns the refund-capable gateways keyed by ledger gateway name
+func NewRefunders(cfg *config.Config) map[string]Refunder {
+	return map[string]Refunder{
+		GatewayComgate: NewComgateClient(cfg),
+		GatewayGoPay:   NewGoPayClient(cfg),
+	}
+}
+
+// ReservationExpiry returns when an order paid by method is cancelled, and
+// its goods returned to stock, if it is still unpaid. Nil for cash on
+// delivery and for methods whose expiry is switched off.
+func ReservationExpiry(cfg *config.Config, method string, createdAt time.Time) *time.Time {
+	var ttl time.Duration
+	switch method {
+	case "card", GatewayComgate, GatewayGoPay:
+		ttl = cfg.OnlinePaymentExpiry
+	case GatewayTransfer:
+		ttl = cfg.TransferPaymentExpiry
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	until := createdAt.Add(ttl)
+	return &until
+}
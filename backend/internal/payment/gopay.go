@@ -0,0 +1,365 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/models"
+)
+
+// GoPay payment states (https://doc.gopay.com)
+const (
+	GoPayStateCreated           = "CREATED"
+	GoPayStatePaid              = "PAID"
+	GoPayStateCanceled          = "CANCELED"
+	GoPayStateTimeouted         = "TIMEOUTED"
+	GoPayStateAuthorized        = "AUTHORIZED"
+	GoPayStateRefunded          = "REFUNDED"
+	GoPayStatePartiallyRefunded = "PARTIALLY_REFUNDED"
+)
+
+// tokenRefreshMargin renews the OAuth token shortly before it expires
+const tokenRefreshMargin = time.Minute
+
+// GoPayClient talks to the GoPay REST API and caches its OAuth token
+type GoPayClient struct {
+	BaseURL      string
+	ClientID     string
+	ClientSecret string
+	GoID         string
+	HTTPClient   *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// GoPayContact is the payer contact sent with a payment
+type GoPayContact struct {
+	FirstName   string `json:"first_name,omitempty"`
+	LastName    string `json:"last_name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	PhoneNumber string `json:"phone_number,omitempty"`
+	City        string `json:"city,omitempty"`
+	Street      string `json:"street,omitempty"`
+	PostalCode  string `json:"postal_code,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+}
+
+// GoPayItem is a single order line sent with a payment
+type GoPayItem struct {
+	Type    string `json:"type"` // ITEM, DELIVERY, DISCOUNT
+	Name    string `json:"name"`
+	Amount  int64  `json:"amount"` // in cents, total for the line
+	Count   int    `json:"count"`
+	VATRate string `json:"vat_rate,omitempty"`
+}
+
+// GoPayPayment is the payment resource returned by the API
+type GoPayPayment struct {
+	ID          int64  `json:"id"`
+	OrderNumber string `json:"order_number"`
+	State       string `json:"state"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	GwURL       string `json:"gw_url"`
+}
+
+// NewGoPayClient creates a client from the application config
+func NewGoPayClient(cfg *config.Config) *GoPayClient {
+	return &GoPayClient{
+		BaseURL:      strings.TrimRight(cfg.GoPayAPIURL, "/"),
+		ClientID:     cfg.GoPayClientID,
+		ClientSecret: cfg.GoPayClientSecret,
+		GoID:         cfg.GoPayGoID,
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// IsConfigured returns true if OAuth credentials and GoID are set
+func (c *GoPayClient) IsConfigured() bool {
+	return c.ClientID != "" && c.ClientSecret != "" && c.GoID != ""
+}
+
+// CreatePayment creates a GoPay payment for the order. returnURL is where the
+// customer lands after paying, notifyURL receives the ?id= notification.
+func (c *GoPayClient) CreatePayment(ctx context.Context, order *models.Order, billing models.Address, returnURL, notifyURL string) (*GoPayPayment, error) {
+	goID, err := strconv.ParseInt(c.GoID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("gopay: invalid GoID %q", c.GoID)
+	}
+
+	body := map[string]interface{}{
+		"payer": map[string]interface{}{
+			"default_payment_instrument": "PAYMENT_CARD",
+			"contact": GoPayContact{
+				FirstName:   billing.FirstName,
+				LastName:    billing.LastName,
+				Email:       billing.Email,
+				PhoneNumber: billing.Phone,
+				City:        billing.City,
+				Street:      billing.Street,
+				PostalCode:  billing.PostalCode,
+				CountryCode: countryCodeISO3(billing.CountryCode),
+			},
+		},
+		"target": map[string]interface{}{
+			"type": "ACCOUNT",
+			"goid": goID,
+		},
+		"amount":            ToCents(order.Total),
+		"currency":          orderCurrency(order),
+		"order_number":      order.OrderNumber,
+		"order_description": fmt.Sprintf("Objednávka %s", order.OrderNumber),
+		"items":             BuildGoPayItems(order),
+		"callback": map[string]string{
+			"return_url":       returnURL,
+			"notification_url": notifyURL,
+		},
+		"lang": "SK",
+	}
+
+	var payment GoPayPayment
+	if err := c.doJSON(ctx, http.MethodPost, "/payments/payment", body, &payment); err != nil {
+		return nil, err
+	}
+	if payment.ID == 0 || payment.GwURL == "" {
+		return nil, fmt.Errorf("gopay: create returned no payment")
+	}
+
+	return &payment, nil
+}
+
+// GetPayment queries the payment state. Notifications only carry the payment
+// ID, so this is the authoritative source for the callback handler.
+func (c *GoPayClient) GetPayment(ctx context.Context, id int64) (*GoPayPayment, error) {
+	var payment GoPayPayment
+	if err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/payments/payment/%d", id), nil, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// Refund returns money of a paid payment (full or partial amount)
+func (c *GoPayClient) Refund(ctx context.Context, transactionID string, amount float64, currency string) (*Refund, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(ToCents(amount), 10))
+
+	var result struct {
+		ID     int64  `json:"id"`
+		Result string `json:"result"` // FINISHED, ACCEPTED, FAILED
+	}
+	path := fmt.Sprintf("/payments/payment/%s/refund", url.PathEscape(transactionID))
+	if err := c.do(ctx, http.MethodPost, path, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), &result); err != nil {
+		return nil, err
+	}
+
+	switch result.Result {
+	case "FINISHED":
+		return &Refund{ExternalID: strconv.FormatInt(result.ID, 10)}, nil
+	case "ACCEPTED":
+		return &Refund{ExternalID: strconv.FormatInt(result.ID, 10), Pending: true}, nil
+	default:
+		return nil, fmt.Errorf("gopay: refund %s", strings.ToLower(result.Result))
+	}
+}
+
+// RefundState looks up a refund in the payment's refund history
+func (c *GoPayClient) RefundState(ctx context.Context, transactionID, refundID string) (*Refund, error) {
+	var history []struct {
+		ID    int64  `json:"id"`
+		State string `json:"state"` // ACCEPTED, FINISHED, FAILED
+	}
+	path := fmt.Sprintf("/payments/payment/%s/refunds", url.PathEscape(transactionID))
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &history); err != nil {
+		return nil, err
+	}
+
+	for _, r := range history {
+		if strconv.FormatInt(r.ID, 10) != refundID {
+			continue
+		}
+		switch r.State {
+		case "FINISHED":
+			return &Refund{ExternalID: refundID}, nil
+		case "ACCEPTED":
+			return &Refund{ExternalID: refundID, Pending: true}, nil
+		default:
+			return nil, fmt.Errorf("gopay: %w (%s)", ErrRefundFailed, strings.ToLower(r.State))
+		}
+	}
+	return nil, fmt.Errorf("gopay: refund %s not found", refundID)
+}
+
+// BuildGoPayItems converts order lines into GoPay items. Shipping, tax and
+// payment fee are added as separate lines so the items add up to the total.
+func BuildGoPayItems(order *models.Order) []GoPayItem {
+	var items []GoPayItem
+	var sum int64
+
+	for _, item := range order.Items {
+		amount := ToCents(item.Total)
+		items = append(items, GoPayItem{
+			Type:    "ITEM",
+			Name:    item.Name,
+			Amount:  amount,
+			Count:   item.Quantity,
+			VATRate: "20",
+		})
+		sum += amount
+	}
+
+	if order.ShippingPrice > 0 {
+		amount := ToCents(order.ShippingPrice)
+		items = append(items, GoPayItem{Type: "DELIVERY", Name: "Doprava", Amount: amount, Count: 1, VATRate: "20"})
+		sum += amount
+	}
+
+	if order.Tax > 0 {
+		amount := ToCents(order.Tax)
+		items = append(items, GoPayItem{Type: "ITEM", Name: "DPH", Amount: amount, Count: 1})
+		sum += amount
+	}
+
+	// Whatever is left is the payment method fee (or rounding)
+	if rest := ToCents(order.Total) - sum; rest != 0 {
+		items = append(items, GoPayItem{Type: "ITEM", Name: "Poplatok za platbu", Amount: rest, Count: 1, VATRate: "20"})
+	}
+
+	return items
+}
+
+// accessToken returns a cached OAuth token or requests a new one
+func (c *GoPayClient) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Add(tokenRefreshMargin).Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", "payment-all")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("gopay: build token request: %w", err)
+	}
+	req.SetBasicAuth(c.ClientID, c.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("gopay: token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("gopay: token request returned HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("gopay: decode token: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return "", fmt.Errorf("gopay: empty access token")
+	}
+
+	c.token = tok.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// doJSON performs an authorized JSON request and decodes the response into out
+func (c *GoPayClient) doJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	if in == nil {
+		return c.do(ctx, method, path, "", nil, out)
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("gopay: encode request: %w", err)
+	}
+	return c.do(ctx, method, path, "application/json", bytes.NewReader(data), out)
+}
+
+// do performs an authorized request and decodes the JSON response into out
+func (c *GoPayClient) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("gopay: build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("gopay: request %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 256*1024))
+	if err != nil {
+		return fmt.Errorf("gopay: read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		// Token revoked on the GoPay side - force a new one next time
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gopay: %s returned HTTP %d: %s", path, resp.StatusCode, string(respBody))
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("gopay: decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// countryCodeISO3 maps the two-letter codes used in addresses to the ISO 3166-1 alpha-3 codes GoPay expects
+func countryCodeISO3(code string) string {
+	m := map[string]string{
+		"SK": "SVK",
+		"CZ": "CZE",
+		"HU": "HUN",
+		"PL": "POL",
+		"AT": "AUT",
+		"DE": "DEU",
+	}
+	if v, ok := m[strings.ToUpper(code)]; ok {
+		return v
+	}
+	if code == "" {
+		return "SVK"
+	}
+	return strings.ToUpper(code)
+}
@@ -0,0 +1,159 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// PayBySquare is a single payment order encoded into the Slovak banking
+// association "PAY by square" format understood by all Slovak banking apps.
+type PayBySquare struct {
+	Amount          float64
+	Currency        string
+	DueDate         time.Time
+	VariableSymbol  string
+	ConstantSymbol  string
+	SpecificSymbol  string
+	Note            string
+	IBAN            string
+	BIC             string
+	BeneficiaryName string
+}
+
+// base32hex alphabet used by the by square specification
+const bySquareAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUV"
+
+// Encode returns the by square string that is put into the QR code:
+// tab separated fields, CRC32 prefix, raw LZMA1 compression and base32hex.
+func (p PayBySquare) Encode() (string, error) {
+	if p.IBAN == "" {
+		return "", fmt.Errorf("paybysquare: IBAN is required")
+	}
+
+	currency := p.Currency
+	if currency == "" {
+		currency = "EUR"
+	}
+	dueDate := ""
+	if !p.DueDate.IsZero() {
+		dueDate = p.DueDate.Format("20060102")
+	}
+
+	fields := []string{
+		"",  // invoice ID
+		"1", // number of payments
+		"1", // payment order
+		strconv.FormatFloat(p.Amount, 'f', 2, 64),
+		currency,
+		dueDate,
+		p.VariableSymbol,
+		p.ConstantSymbol,
+		p.SpecificSymbol,
+		"", // originator's reference (replaces symbols for SEPA)
+		bySquareField(p.Note, 140),
+		"1", // number of bank accounts
+		strings.ReplaceAll(strings.ToUpper(p.IBAN), " ", ""),
+		strings.ToUpper(p.BIC),
+		"0", // standing order extension
+		"0", // direct debit extension
+		bySquareField(p.BeneficiaryName, 70),
+		"", // beneficiary address line 1
+		"", // beneficiary address line 2
+	}
+	data := []byte(strings.Join(fields, "\t"))
+
+	// CRC32 of the data (little endian) is prepended before compression
+	payload := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint32(payload, crc32.ChecksumIEEE(data))
+	payload = append(payload, data...)
+	if len(payload) > 0xFFFF {
+		return "", fmt.Errorf("paybysquare: payload too large")
+	}
+
+	compressed, err := compressLZMA1Raw(payload)
+	if err != nil {
+		return "", err
+	}
+
+	// Header: by square type, version, document type and reserved nibbles
+	// (all zero for PAY v1.0), followed by the uncompressed length
+	out := make([]byte, 4, 4+len(compressed))
+	binary.LittleEndian.PutUint16(out[2:], uint16(len(payload)))
+	out = append(out, compressed...)
+
+	return base32Hex(out), nil
+}
+
+// QRCodePNG renders the encoded payment as a PNG image of the given size in pixels
+func (p PayBySquare) QRCodePNG(size int) ([]byte, error) {
+	code, err := p.Encode()
+	if err != nil {
+		return nil, err
+	}
+	png, err := qrcode.Encode(code, qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("paybysquare: render QR code: %w", err)
+	}
+	return png, nil
+}
+
+// compressLZMA1Raw compresses with the parameters required by the
+// specification (lc=3, lp=0, pb=2, 128 KiB dictionary) and strips the
+// .lzma header, leaving the raw LZMA1 stream.
+func compressLZMA1Raw(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	cfg := lzma.WriterConfig{
+		Properties: &lzma.Properties{LC: 3, LP: 0, PB: 2},
+		DictCap:    128 * 1024,
+	}
+	w, err := cfg.NewWriter(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("paybysquare: lzma writer: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("paybysquare: lzma write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("paybysquare: lzma close: %w", err)
+	}
+	if buf.Len() < lzma.HeaderLen {
+		return nil, fmt.Errorf("paybysquare: lzma output too short")
+	}
+	return buf.Bytes()[lzma.HeaderLen:], nil
+}
+
+// base32Hex encodes data 5 bits at a time, zero padding the last group
+func base32Hex(data []byte) string {
+	var sb strings.Builder
+	var acc uint32
+	bits := 0
+	for _, b := range data {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			sb.WriteByte(bySquareAlphabet[(acc>>uint(bits))&0x1F])
+		}
+	}
+	if bits > 0 {
+		sb.WriteByte(bySquareAlphabet[(acc<<uint(5-bits))&0x1F])
+	}
+	return sb.String()
+}
+
+// bySquareField removes tabs (the field separator) and limits the length
+func bySquareField(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > max {
+		s = string(r[:max])
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// refundBatch is the number of pending refunds checked per round
+const refundBatch = 100
+
+// RefundStore is the payment ledger the refund worker settles refunds in
+type RefundStore interface {
+	ListPendingRefunds(ctx context.Context, limit int) ([]models.PaymentTransaction, error)
+	GetPaymentTransaction(ctx context.Context, id uuid.UUID) (*models.PaymentTransaction, error)
+	// UpdatePaymentTransactionStatus also re-derives the order payment status
+	UpdatePaymentTransactionStatus(ctx context.Context, id uuid.UUID, status, externalID, errorMessage string) error
+	GetOrder(ctx context.Context, id uuid.UUID) (*models.Order, error)
+}
+
+// RefundNotifier tells the customer that a refund went through
+type RefundNotifier interface {
+	SendRefundIssued(order *models.Order, amount float64, note string) error
+}
+
+// RefundWorker settles refunds a gateway accepted without finishing them,
+// which moves the order to refunded or partially_refunded, and emails the
+// customer about the finished ones
+type RefundWorker struct {
+	db        RefundStore
+	refunders map[string]Refunder
+	notifier  RefundNotifier
+	interval  time.Duration
+}
+
+// NewRefundWorker creates a worker checking pending refunds every interval
+func NewRefundWorker(db RefundStore, refunders map[string]Refunder, notifier RefundNotifier, interval time.Duration) *RefundWorker {
+	return &RefundWorker{db: db, refunders: refunders, notifier: notifier, interval: interval}
+}
+
+// Run checks pending refunds right away and then every interval until ctx is cancelled
+func (w *RefundWorker) Run(ctx context.Context) {
+	log.Printf("[PAYMENT] Refund check started (every %v)", w.interval)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		settled, err := w.CheckAll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[PAYMENT] Refund check failed: %v", err)
+		} else if settled > 0 {
+			log.Printf("[PAYMENT] Settled %d pending refunds", settled)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll asks the gateways about the pending refunds and records the
+// finished and failed ones. Returns the number settled.
+func (w *RefundWorker) CheckAll(ctx context.Context) (int, error) {
+	refunds, err := w.db.ListPendingRefunds(ctx, refundBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	for _, refund := range refunds {
+		if ctx.Err() != nil {
+			return settled, ctx.Err()
+		}
+		tracker, ok := w.refunders[refund.Gateway].(RefundTracker)
+		if !ok || refund.ParentID == nil {
+			continue
+		}
+		captured, err := w.db.GetPaymentTransaction(ctx, *refund.ParentID)
+		if err != nil || captured == nil {
+			log.Printf("[PAYMENT] Payment of refund %s not loaded: %v", refund.ID, err)
+			continue
+		}
+
+		state, err := tracker.RefundState(ctx, captured.ExternalID, refund.ExternalID)
+		status, message := models.PaymentTxSucceeded, ""
+		switch {
+		case errors.Is(err, ErrRefundFailed):
+			status, message = models.PaymentTxFailed, err.Error()
+		case err != nil:
+			log.Printf("[PAYMENT] Failed to check %s refund %s: %v", refund.Gateway, refund.ExternalID, err)
+			continue
+		case state.Pending:
+			continue
+		}
+
+		if err := w.db.UpdatePaymentTransactionStatus(ctx, refund.ID, status, "", message); err != nil {
+			log.Printf("[PAYMENT] Failed to record refund %s: %v", refund.ID, err)
+			continue
+		}
+		settled++
+		log.Printf("[PAYMENT] %s refund %s of %.2f %s for order %s: %s", refund.Gateway, refund.ExternalID,
+			refund.Amount, refund.Currency, refund.OrderID, status)
+
+		if status != models.PaymentTxSucceeded {
+			continue
+		}
+		order, err := w.db.GetOrder(ctx, refund.OrderID)
+		if err != nil || order == nil {
+			log.Printf("[PAYMENT] Order %s of refund %s not loaded for email: %v", refund.OrderID, refund.ID, err)
+			continue
+		}
+		if err := w.notifier.SendRefundIssued(order, refund.Amount, refund.Note); err != nil {
+			log.Printf("[PAYMENT] Failed to queue refund email for #%s: %v", order.OrderNumber, err)
+		}
+	}
+	return settled, nil
+}
@@ -0,0 +1,307 @@
+package payment
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Bank statement formats
+const (
+	StatementCamt053 = "camt053"
+	StatementCSV     = "csv"
+)
+
+// StatementEntry is a single booked movement on the shop's bank account
+type StatementEntry struct {
+	Reference        string    `json:"reference"` // bank transaction ID, unique per account
+	BookingDate      time.Time `json:"booking_date"`
+	Amount           float64   `json:"amount"` // negative for debits
+	Currency         string    `json:"currency"`
+	VariableSymbol   string    `json:"variable_symbol,omitempty"`
+	CounterpartyName string    `json:"counterparty_name,omitempty"`
+	CounterpartyIBAN string    `json:"counterparty_iban,omitempty"`
+	Message          string    `json:"message,omitempty"`
+}
+
+// IsCredit reports whether the entry is incoming money
+func (e StatementEntry) IsCredit() bool {
+	return e.Amount > 0
+}
+
+// ExternalID identifies the entry in the payment ledger. Statements without
+// a bank reference get a stable hash so re-importing the file is harmless.
+func (e StatementEntry) ExternalID() string {
+	if e.Reference != "" {
+		return e.Reference
+	}
+	h := sha1.Sum([]byte(fmt.Sprintf("%s|%.2f|%s|%s|%s|%s",
+		e.BookingDate.Format("2006-01-02"), e.Amount, e.Currency, e.VariableSymbol, e.CounterpartyIBAN, e.Message)))
+	return "stmt-" + hex.EncodeToString(h[:8])
+}
+
+// ParseStatement detects the statement format (camt.053 XML or CSV export)
+// and returns its entries
+func ParseStatement(filename string, data []byte) (string, []StatementEntry, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimSpace(data)
+
+	if strings.HasSuffix(strings.ToLower(filename), ".xml") || bytes.HasPrefix(trimmed, []byte("<")) {
+		entries, err := ParseCamt053(bytes.NewReader(data))
+		return StatementCamt053, entries, err
+	}
+
+	// Slovak banks still export CSV in Windows-1250
+	if !utf8.Valid(data) {
+		decoded, err := charmap.Windows1250.NewDecoder().Bytes(data)
+		if err != nil {
+			return StatementCSV, nil, fmt.Errorf("decode statement: %w", err)
+		}
+		data = decoded
+	}
+
+	entries, err := ParseStatementCSV(bytes.NewReader(data))
+	return StatementCSV, entries, err
+}
+
+// csvColumns maps normalized header names of Slovak bank exports
+// (Tatra banka, SLSP, VÚB, ČSOB, Fio, mBank) to entry fields
+var csvColumns = map[string][]string{
+	"reference": {"id transakcie", "id pohybu", "referencia banky", "referencia", "transaction id", "id"},
+	"date":      {"datum zauctovania", "datum splatnosti", "datum transakcie", "datum", "booking date", "date"},
+	"amount":    {"suma", "ciastka", "objem", "amount", "suma transakcie"},
+	"credit":    {"kredit", "pripisane", "credit"},
+	"debit":     {"debet", "odpisane", "debit"},
+	"currency":  {"mena", "currency", "mena uctu"},
+	"vs":        {"variabilny symbol", "vs", "variable symbol"},
+	"name":      {"nazov protistrany", "nazov uctu protistrany", "protistrana", "platitel", "counterparty", "counterparty name"},
+	"iban":      {"iban protistrany", "ucet protistrany", "protiucet", "cislo uctu protistrany", "counterparty account", "iban"},
+	"message":   {"sprava pre prijemcu", "sprava pre prijimatela", "informacia pre prijemcu", "informacia pre prijimatela", "poznamka", "popis transakcie", "popis", "sprava", "message", "description"},
+	"direction": {"typ transakcie", "typ", "type", "smer"},
+}
+
+// ParseStatementCSV reads a bank CSV export with a header row. The delimiter
+// (semicolon, comma or tab) is detected from the header.
+func ParseStatementCSV(r io.Reader) ([]StatementEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read statement: %w", err)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse csv: %w", err)
+	}
+
+	// Some banks put account info above the table - find the header row
+	headerRow := -1
+	var columns map[string]int
+	for i, record := range records {
+		if cols := mapCSVColumns(record); cols != nil {
+			headerRow, columns = i, cols
+			break
+		}
+	}
+	if headerRow < 0 {
+		return nil, fmt.Errorf("parse csv: no header with amount and variable symbol or message columns")
+	}
+
+	get := func(record []string, field string) string {
+		if i, ok := columns[field]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []StatementEntry
+	for _, record := range records[headerRow+1:] {
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+
+		var amount float64
+		if v := get(record, "amount"); v != "" {
+			amount, err = parseStatementAmount(v)
+		} else if v := get(record, "credit"); v != "" {
+			amount, err = parseStatementAmount(v)
+		} else if v := get(record, "debit"); v != "" {
+			amount, err = parseStatementAmount(v)
+			amount = -absAmount(amount)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse csv: %w", err)
+		}
+		if isDebitDirection(get(record, "direction")) {
+			amount = -absAmount(amount)
+		}
+
+		entry := StatementEntry{
+			Reference:        get(record, "reference"),
+			BookingDate:      parseStatementDate(get(record, "date")),
+			Amount:           amount,
+			Currency:         strings.ToUpper(get(record, "currency")),
+			VariableSymbol:   normalizeVariableSymbol(get(record, "vs")),
+			CounterpartyName: get(record, "name"),
+			CounterpartyIBAN: strings.ReplaceAll(get(record, "iban"), " ", ""),
+			Message:          get(record, "message"),
+		}
+		if entry.Currency == "" {
+			entry.Currency = "EUR"
+		}
+		if entry.VariableSymbol == "" {
+			entry.VariableSymbol = FindVariableSymbol(entry.Message)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func mapCSVColumns(header []string) map[string]int {
+	columns := map[string]int{}
+	for i, h := range header {
+		name := normalizeHeader(h)
+		for field, aliases := range csvColumns {
+			if _, done := columns[field]; done {
+				continue
+			}
+			for _, alias := range aliases {
+				if name == alias {
+					columns[field] = i
+					break
+				}
+			}
+		}
+	}
+
+	_, hasAmount := columns["amount"]
+	_, hasCredit := columns["credit"]
+	_, hasVS := columns["vs"]
+	_, hasMessage := columns["message"]
+	if (!hasAmount && !hasCredit) || (!hasVS && !hasMessage) {
+		return nil
+	}
+	return columns
+}
+
+// normalizeHeader lowercases and strips diacritics ("Dátum zaúčtovania" -> "datum zauctovania")
+func normalizeHeader(s string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(strings.TrimSpace(s))) {
+		if r < 0x300 || r > 0x36f {
+			sb.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+func detectDelimiter(data []byte) rune {
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+	best, bestCount := ';', 0
+	for _, d := range []rune{';', ',', '\t'} {
+		if n := bytes.Count(line, []byte(string(d))); n > bestCount {
+			best, bestCount = d, n
+		}
+	}
+	return best
+}
+
+// parseStatementAmount accepts "1 234,56", "1.234,56", "1234.56" and "+12,00 EUR"
+func parseStatementAmount(s string) (float64, error) {
+	s = strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == ',' || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, s)
+	if s == "" {
+		return 0, nil
+	}
+
+	lastComma, lastDot := strings.LastIndex(s, ","), strings.LastIndex(s, ".")
+	switch {
+	case lastComma > lastDot:
+		// comma is the decimal separator
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	case lastDot > lastComma:
+		s = strings.ReplaceAll(s, ",", "")
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return v, nil
+}
+
+func parseStatementDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"02.01.2006", "2.1.2006", "2006-01-02", "02.01.2006 15:04:05", "2006-01-02T15:04:05", "02/01/2006", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func isDebitDirection(s string) bool {
+	s = normalizeHeader(s)
+	return s == "d" || s == "dbit" || s == "debet" || s == "debit" || s == "odchadzajuca" || s == "odchadzajuca platba"
+}
+
+func absAmount(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+var (
+	// "/VS1234567/SS/KS0308" - end-to-end ID used by Slovak banks
+	endToEndVS = regexp.MustCompile(`(?i)/VS0*(\d{1,10})(?:/|$)`)
+	// "VS: 1234567", "VS1234567", "var. symbol 1234567"
+	messageVS = regexp.MustCompile(`(?i)(?:\bVS|variabiln[yý]\s+symbol|var\.\s*symbol)[\s:.#-]*0*(\d{1,10})\b`)
+)
+
+// FindVariableSymbol extracts a variable symbol from a payment reference or message
+func FindVariableSymbol(text string) string {
+	if m := endToEndVS.FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+	if m := messageVS.FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// normalizeVariableSymbol strips formatting and leading zeros ("0001000001" -> "1000001")
+func normalizeVariableSymbol(s string) string {
+	s = strings.TrimSpace(s)
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return FindVariableSymbol(s)
+		}
+	}
+	return strings.TrimLeft(s, "0")
+}
@@ -0,0 +1,62 @@
+package payment
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/models"
+)
+
+// qrCodeSize is the PAY by square image size in pixels
+const qrCodeSize = 256
+
+// NewBankTransferInstructions returns the payment details for an order paid by
+// bank transfer, or nil if the order is not a transfer or no IBAN is configured.
+// The QR code is only rendered when withQR is set.
+func NewBankTransferInstructions(cfg *config.Config, order *models.Order, withQR bool) (*models.BankTransferInstructions, error) {
+	if order.PaymentMethod != GatewayTransfer || order.VariableSymbol == "" || cfg.BankIBAN == "" {
+		return nil, nil
+	}
+
+	createdAt := order.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	instructions := &models.BankTransferInstructions{
+		IBAN:            cfg.BankIBAN,
+		BIC:             cfg.BankBIC,
+		BeneficiaryName: cfg.BankBeneficiary,
+		Amount:          order.Total,
+		Currency:        orderCurrency(order),
+		VariableSymbol:  order.VariableSymbol,
+		DueDate:         createdAt.AddDate(0, 0, cfg.BankTransferDueDays),
+		Note:            fmt.Sprintf("Objednávka %s", order.OrderNumber),
+	}
+
+	if withQR {
+		png, err := BankTransferQRCode(instructions)
+		if err != nil {
+			return nil, err
+		}
+		instructions.QRCode = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	}
+
+	return instructions, nil
+}
+
+// BankTransferQRCode renders the instructions as a PAY by square PNG
+func BankTransferQRCode(instructions *models.BankTransferInstructions) ([]byte, error) {
+	return PayBySquare{
+		Amount:          instructions.Amount,
+		Currency:        instructions.Currency,
+		DueDate:         instructions.DueDate,
+		VariableSymbol:  instructions.VariableSymbol,
+		Note:            instructions.Note,
+		IBAN:            instructions.IBAN,
+		BIC:             instructions.BIC,
+		BeneficiaryName: instructions.BeneficiaryName,
+	}.QRCodePNG(qrCodeSize)
+}
@@ -0,0 +1,236 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// DefaultVATRate applies when the feed has no VAT rate
+const DefaultVATRate = 20
+
+// Input is a supplier offer to be priced
+type Input struct {
+	SupplierID uuid.UUID
+	CategoryID *uuid.UUID // of the main product
+	BrandID    *uuid.UUID
+	PriceNet   float64 // purchase price without VAT
+	PriceVAT   float64 // used to derive the net price when it is missing
+	VATRate    float64 // percent
+	SRP        float64 // suggested retail price with VAT
+}
+
+// Result is the computed retail price
+type Result struct {
+	Price          float64  // with VAT; the SRP when the price is shown as a sale
+	SalePrice      *float64 // our price when it is below the SRP
+	PurchasePrice  float64  // without VAT
+	Margin         float64  // without VAT
+	Rule           *models.PricingRule
+	CappedBySRP    bool
+	BelowMinMargin bool // the SRP cap pushed the margin under the rule's minimum
+}
+
+// Selling returns the price the customer pays
+func (r *Result) Selling() float64 {
+	if r.SalePrice != nil {
+		return *r.SalePrice
+	}
+	return r.Price
+}
+
+// Engine applies pricing rules. The rule used is the matching one with the
+// highest priority; among equal priorities the most specific one (supplier,
+// nearest category, brand, then the narrowest price band).
+type Engine struct {
+	rules   []models.PricingRule
+	parents map[uuid.UUID]uuid.UUID // category -> parent category
+}
+
+// NewEngine builds an engine over the active rules. parents maps
+// categories to their parents, for rules on a parent category.
+func NewEngine(rules []models.PricingRule, parents map[uuid.UUID]uuid.UUID) *Engine {
+	e := &Engine{parents: parents}
+	for _, r := range rules {
+		if r.IsActive {
+			e.rules = append(e.rules, r)
+		}
+	}
+	return e
+}
+
+// Price computes the retail price. Returns nil when no rule matches or the
+// input has no purchase price.
+func (e *Engine) Price(in Input) *Result {
+	vat := in.VATRate
+	if vat <= 0 {
+		vat = DefaultVATRate
+	}
+	net := in.PriceNet
+	if net <= 0 && in.PriceVAT > 0 {
+		net = in.PriceVAT / (1 + vat/100)
+	}
+	if net <= 0 {
+		return nil
+	}
+
+	rule := e.match(in, net)
+	if rule == nil {
+		return nil
+	}
+
+	retailNet := net*(1+rule.MarkupPercent/100) + rule.FixedSurcharge
+	if retailNet-net < rule.MinMargin {
+		retailNet = net + rule.MinMargin
+	}
+	gross := Round(retailNet*(1+vat/100), rule.Rounding)
+
+	res := &Result{PurchasePrice: roundCents(net), Rule: rule}
+	if rule.CapAtSRP && in.SRP > 0 && gross > in.SRP {
+		gross = in.SRP
+		res.CappedBySRP = true
+	}
+	res.Margin = roundCents(gross/(1+vat/100) - net)
+	res.BelowMinMargin = res.CappedBySRP && res.Margin < rule.MinMargin
+
+	// Below the SRP the SRP is shown crossed out
+	res.Price = gross
+	if in.SRP > gross {
+		sale := gross
+		res.Price = in.SRP
+		res.SalePrice = &sale
+	}
+	return res
+}
+
+func (e *Engine) match(in Input, net float64) *models.PricingRule {
+	type candidate struct {
+		rule  *models.PricingRule
+		depth int // category distance, 0 = the product's own category
+	}
+	var matches []candidate
+	for i := range e.rules {
+		r := &e.rules[i]
+		if r.SupplierID != nil && *r.SupplierID != in.SupplierID {
+			continue
+		}
+		if r.BrandID != nil && (in.BrandID == nil || *r.BrandID != *in.BrandID) {
+			continue
+		}
+		if net < r.PriceFrom || (r.PriceTo != nil && net >= *r.PriceTo) {
+			continue
+		}
+		depth := 0
+		if r.CategoryID != nil {
+			depth = e.categoryDepth(in.CategoryID, *r.CategoryID)
+			if depth < 0 {
+				continue
+			}
+		}
+		matches = append(matches, candidate{r, depth})
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.rule.Priority != b.rule.Priority {
+			return a.rule.Priority > b.rule.Priority
+		}
+		if (a.rule.SupplierID != nil) != (b.rule.SupplierID != nil) {
+			return a.rule.SupplierID != nil
+		}
+		if (a.rule.CategoryID != nil) != (b.rule.CategoryID != nil) {
+			return a.rule.CategoryID != nil
+		}
+		if a.depth != b.depth {
+			return a.depth < b.depth
+		}
+		if (a.rule.BrandID != nil) != (b.rule.BrandID != nil) {
+			return a.rule.BrandID != nil
+		}
+		return bandWidth(a.rule) < bandWidth(b.rule)
+	})
+	return matches[0].rule
+}
+
+// categoryDepth returns how many levels above category the ancestor is, -1
+// if it is not an ancestor
+func (e *Engine) categoryDepth(category *uuid.UUID, ancestor uuid.UUID) int {
+	if category == nil {
+		return -1
+	}
+	id := *category
+	for depth := 0; depth < 32; depth++ {
+		if id == ancestor {
+			return depth
+		}
+		parent, ok := e.parents[id]
+		if !ok {
+			return -1
+		}
+		id = parent
+	}
+	return -1
+}
+
+func bandWidth(r *models.PricingRule) float64 {
+	if r.PriceTo == nil {
+		return math.Inf(1)
+	}
+	return *r.PriceTo - r.PriceFrom
+}
+
+// Round rounds a price with VAT up to the rounding's ending
+func Round(price float64, rounding string) float64 {
+	price = roundCents(price)
+	switch rounding {
+	case models.PriceRoundWhole:
+		return math.Ceil(price)
+	case models.PriceRound90, models.PriceRound99:
+		ending := 0.90
+		if rounding == models.PriceRound99 {
+			ending = 0.99
+		}
+		r := roundCents(math.Floor(price) + ending)
+		if r < price {
+			r = roundCents(r + 1)
+		}
+		return r
+	default:
+		return price
+	}
+}
+
+// ErrInvalidRule is returned by ValidateRule
+var ErrInvalidRule = errors.New("invalid pricing rule")
+
+// ValidateRule checks a rule before it is stored
+func ValidateRule(r models.PricingRule) error {
+	switch {
+	case r.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidRule)
+	case r.PriceFrom < 0 || (r.PriceTo != nil && *r.PriceTo <= r.PriceFrom):
+		return fmt.Errorf("%w: price_to must be above price_from", ErrInvalidRule)
+	case r.MarkupPercent < -100:
+		return fmt.Errorf("%w: markup_percent below -100", ErrInvalidRule)
+	case r.MinMargin < 0 || r.FixedSurcharge < 0:
+		return fmt.Errorf("%w: min_margin and fixed_surcharge cannot be negative", ErrInvalidRule)
+	}
+	switch r.Rounding {
+	case models.PriceRoundNone, models.PriceRoundWhole, models.PriceRound90, models.PriceRound99:
+	default:
+		return fmt.Errorf("%w: unknown rounding %q", ErrInvalidRule, r.Rounding)
+	}
+	return nil
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"megashop/internal/database"
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// PipelineFunc runs the feed pipeline of a supplier to the end
+type PipelineFunc func(ctx context.Context, supplierID uuid.UUID, triggeredBy string) (*models.PipelineRun, error)
+
+// Scheduler starts the pipeline of every active supplier when its cron
+// schedule fires. Runs of one supplier never overlap: a run due while the
+// previous one is still going is recorded as skipped.
+type Scheduler struct {
+	db       *database.Postgres
+	run      PipelineFunc
+	interval time.Duration
+}
+
+// New creates a scheduler checking the schedules every interval (a minute
+// matches cron's resolution)
+func New(db *database.Postgres, run PipelineFunc, interval time.Duration) *Scheduler {
+	return &Scheduler{db: db, run: run, interval: interval}
+}
+
+// Run checks the schedules every interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Printf("[SCHEDULER] Supplier pipeline scheduler started (every %v)", s.interval)
+	if n, err := s.db.FailInterruptedPipelineRuns(ctx); err != nil {
+		log.Printf("[SCHEDULER] %v", err)
+	} else if n > 0 {
+		log.Printf("[SCHEDULER] Marked %d interrupted pipeline runs as failed", n)
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.tick(ctx, last, now)
+			last = now
+		}
+	}
+}
+
+// tick starts the pipelines due in (from, to]
+func (s *Scheduler) tick(ctx context.Context, from, to time.Time) {
+	suppliers, err := s.db.ListScheduledSuppliers(ctx)
+	if err != nil {
+		log.Printf("[SCHEDULER] %v", err)
+		return
+	}
+	for _, sup := range suppliers {
+		sched, err := Parse(sup.Schedule)
+		if err != nil {
+			log.Printf("[SCHEDULER] %s: %v", sup.Code, err)
+			continue
+		}
+		next := sched.Next(from)
+		if next.IsZero() || next.After(to) {
+			continue
+		}
+		go s.start(ctx, sup)
+	}
+}
+
+func (s *Scheduler) start(ctx context.Context, sup models.Supplier) {
+	run, err := s.run(ctx, sup.ID, "scheduled")
+	switch {
+	case errors.Is(err, database.ErrPipelineRunning):
+		log.Printf("[SCHEDULER] %s: previous run still in progress, skipped", sup.Code)
+		if _, err := s.db.RecordSkippedPipelineRun(ctx, sup.ID, "scheduled", "Previous run still in progress"); err != nil {
+			log.Printf("[SCHEDULER] %s: %v", sup.Code, err)
+		}
+	case err != nil:
+		log.Printf("[SCHEDULER] %s: pipeline failed: %v", sup.Code, err)
+	case run.Status != models.PipelineCompleted:
+		log.Printf("[SCHEDULER] %s: pipeline %s: %s", sup.Code, run.Status, run.ErrorMessage)
+	default:
+		log.Printf("[SCHEDULER] %s: pipeline completed in %v", sup.Code, run.FinishedAt.Sub(run.StartedAt).Round(time.Second))
+	}
+}
+
+// NextRun returns when the schedule fires next after now, nil if the
+// schedule is empty or invalid
+func NextRun(schedule string, now time.Time) *time.Time {
+	if schedule == "" {
+		return nil
+	}
+	sched, err := Parse(schedule)
+	if err != nil {
+		return nil
+	}
+	next := sched.Next(now)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
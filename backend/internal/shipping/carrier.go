@@ -0,0 +1,254 @@
+package shipping
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/models"
+)
+
+var (
+	// ErrNoCarrier is returned for shipping methods without a carrier integration (personal pickup)
+	ErrNoCarrier = errors.New("shipping method has no carrier integration")
+	// ErrNotDeliverable is returned by Quote when the parcel cannot be shipped with the method
+	ErrNotDeliverable = errors.New("parcel cannot be shipped with this method")
+	// ErrNotConfigured is returned when the method config lacks the carrier credentials
+	ErrNotConfigured = errors.New("carrier is not configured")
+)
+
+// Generic label formats, each carrier maps them to its own
+const (
+	LabelA6 = "A6" // one label per page, thermal printers
+	LabelA4 = "A4" // several labels per A4 sheet
+)
+
+// Carrier is a shipping provider integration
+type Carrier interface {
+	// Code is the shipping method code the carrier serves
+	Code() string
+	// Quote prices a parcel
+	Quote(ctx context.Context, req QuoteRequest) (*Quote, error)
+	// CreateShipment registers a parcel with the carrier
+	CreateShipment(ctx context.Context, req ShipmentRequest) (*CreatedShipment, error)
+	// Labels returns the labels of the shipments in one PDF
+	Labels(ctx context.Context, shipmentIDs []string, format string) ([]byte, error)
+	// Track returns the scans of a shipment, oldest first
+	Track(ctx context.Context, shipmentID, trackingNumber string) ([]models.TrackingEvent, error)
+	// Cancel cancels a shipment that was not handed over yet
+	Cancel(ctx context.Context, shipmentID string) error
+}
+
+// QuoteRequest describes a parcel to be priced
+type QuoteRequest struct {
+	Country  string // ISO code of the destination
+	Zip      string
+	Weight   float64 // kg
+	Subtotal float64 // goods value, for free shipping
+	COD      bool
+}
+
+// Quote is the price of shipping a parcel
+type Quote struct {
+	Price    float64 `json:"price"`
+	CODFee   float64 `json:"cod_fee,omitempty"`
+	Currency string  `json:"currency"`
+	Free     bool    `json:"free"`
+}
+
+// ShipmentRequest describes a parcel to be registered
+type ShipmentRequest struct {
+	Reference     string // our order number
+	Recipient     models.Address
+	PickupPointID string // Packeta only
+	Value         float64
+	COD           float64 // cash on delivery, 0 if prepaid
+	Currency      string
+	Weight        float64 // kg
+	Note          string
+}
+
+// CreatedShipment is the carrier's answer to CreateShipment
+type CreatedShipment struct {
+	ID             string // used for labels, tracking and cancelling
+	TrackingNumber string // printed on the label, shown to the customer
+	Label          []byte // set when the carrier returns the label right away
+}
+
+// LabelOffsetter is implemented by carriers that can start printing at a
+// given position of a partly used label sheet
+type LabelOffsetter interface {
+	LabelsAt(ctx context.Context, shipmentIDs []string, format string, offset int) ([]byte, error)
+}
+
+// CarrierConfig is the Config JSON of a shipping method. Credentials and
+// the API URL live there, so a local stand-in server can be configured
+// for testing without code changes.
+type CarrierConfig struct {
+	APIURL          string  `json:"api_url"`
+	TrackingURL     string  `json:"tracking_url"`
+	Username        string  `json:"username"`
+	Password        string  `json:"password"`
+	APIKey          string  `json:"api_key"`
+	ClientNumber    string  `json:"client_number"`     // GLS client number, DPD DELIS ID
+	SenderAddressID string  `json:"sender_address_id"` // DPD pickup address registered in the portal
+	BankAccountID   string  `json:"bank_account_id"`   // DPD account for COD payouts
+	Product         string  `json:"product"`           // carrier product or service code
+	CODFee          float64 `json:"cod_fee"`
+	MaxWeight       float64 `json:"max_weight"` // kg, 0 = no limit
+	LabelFormat     string  `json:"label_format"`
+}
+
+// NewCarrier returns the integration for a shipping method, selected by its
+// code and configured from its Config JSON
+func NewCarrier(method models.ShippingMethod, cfg *config.Config) (Carrier, error) {
+	var cc CarrierConfig
+	if len(method.Config) > 0 {
+		if err := json.Unmarshal(method.Config, &cc); err != nil {
+			return nil, fmt.Errorf("shipping method %s: invalid config: %w", method.Code, err)
+		}
+	}
+	t := tariff{price: method.Price, freeFrom: method.FreeFrom, codFee: cc.CODFee, maxWeight: cc.MaxWeight}
+
+	switch method.Code {
+	case "packeta":
+		return newPacketaCarrier(cfg, cc, t), nil
+	case "dpd":
+		return newDPDCarrier(cfg, cc, t), nil
+	case "gls":
+		return newGLSCarrier(cfg, cc, t), nil
+	case "posta":
+		return newPostaCarrier(cfg, cc, t), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNoCarrier, method.Code)
+	}
+}
+
+// tariff is the flat price of a shipping method, shared by the carriers
+// whose APIs have no price calculation
+type tariff struct {
+	price     float64
+	freeFrom  float64
+	codFee    float64
+	maxWeight float64
+}
+
+func (t tariff) quote(req QuoteRequest) (*Quote, error) {
+	if t.maxWeight > 0 && req.Weight > t.maxWeight {
+		return nil, fmt.Errorf("%w: %.2f kg is over the %.2f kg limit", ErrNotDeliverable, req.Weight, t.maxWeight)
+	}
+	q := &Quote{Price: t.price, Currency: "EUR"}
+	if t.freeFrom > 0 && req.Subtotal >= t.freeFrom {
+		q.Price = 0
+		q.Free = true
+	}
+	if req.COD {
+		q.CODFee = t.codFee
+	}
+	return q, nil
+}
+
+// ==================== HTTP ====================
+
+// doJSON sends in as JSON (GET without body when in is nil) and decodes the response into out
+func doJSON(ctx context.Context, client *http.Client, method, url string, header http.Header, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncate(string(bytes.TrimSpace(data)), 200))
+	}
+	if out == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	return nil
+}
+
+// carrierTimeZone is the zone of the local timestamps carrier APIs return
+var carrierTimeZone = func() *time.Location {
+	loc, err := time.LoadLocation("Europe/Bratislava")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}()
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// splitStreet splits "Hlavná 12/A" into street and house number
+func splitStreet(street string) (string, string) {
+	street = strings.TrimSpace(street)
+	i := strings.LastIndex(street, " ")
+	if i < 0 || !strings.ContainsAny(street[i+1:], "0123456789") {
+		return street, ""
+	}
+	return street[:i], street[i+1:]
+}
+
+func recipientName(a models.Address) string {
+	return strings.TrimSpace(a.FirstName + " " + a.LastName)
+}
+
+// AddressCountry returns the ISO code of the address's country, DefaultCountry if unknown
+func AddressCountry(a models.Address) string {
+	code := strings.ToUpper(strings.TrimSpace(firstNonEmpty(a.CountryCode, a.Country)))
+	if len(code) != 2 {
+		return DefaultCountry
+	}
+	return code
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,298 @@
+package shipping
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/models"
+)
+
+// DPD Slovakia shipper API (JSON-RPC 2.0) and the public DPD tracking service
+const (
+	dpdDefaultAPIURL      = "https://api.dpdportal.sk/shipment/json"
+	dpdDefaultTrackingURL = "https://tracking.dpd.de/rest/plc/sk_SK"
+)
+
+// dpdCountries maps ISO codes to the numeric codes the DPD API expects
+var dpdCountries = map[string]int{
+	"SK": 703, "CZ": 203, "HU": 348, "PL": 616, "AT": 40, "DE": 276, "SI": 705, "HR": 191, "RO": 642,
+}
+
+// dpdCarrier creates DPD courier shipments
+type dpdCarrier struct {
+	apiURL      string
+	trackingURL string
+	cc          CarrierConfig
+	tariff      tariff
+	http        *http.Client
+	requestID   atomic.Int64
+}
+
+func newDPDCarrier(cfg *config.Config, cc CarrierConfig, t tariff) *dpdCarrier {
+	return &dpdCarrier{
+		apiURL:      firstNonEmpty(cc.APIURL, dpdDefaultAPIURL),
+		trackingURL: strings.TrimRight(firstNonEmpty(cc.TrackingURL, dpdDefaultTrackingURL), "/"),
+		cc:          cc,
+		tariff:      t,
+		http:        newHTTPClient(),
+	}
+}
+
+func (d *dpdCarrier) Code() string { return "dpd" }
+
+func (d *dpdCarrier) Quote(ctx context.Context, req QuoteRequest) (*Quote, error) {
+	return d.tariff.quote(req)
+}
+
+// dpdResult is the per-shipment answer of create and cancel
+type dpdResult struct {
+	AckCode string `json:"ackCode"`
+	MPSID   string `json:"mpsid"`
+	Parcels struct {
+		Parcel []struct {
+			ParcelNo string `json:"parcelno"`
+		} `json:"parcel"`
+	} `json:"parcels"`
+	Messages []struct {
+		Value string `json:"value"`
+	} `json:"messages"`
+}
+
+func (r dpdResult) err() error {
+	if r.AckCode == "success" {
+		return nil
+	}
+	var msgs []string
+	for _, m := range r.Messages {
+		msgs = append(msgs, m.Value)
+	}
+	return fmt.Errorf("dpd: %s: %s", r.AckCode, strings.Join(msgs, "; "))
+}
+
+func (d *dpdCarrier) CreateShipment(ctx context.Context, req ShipmentRequest) (*CreatedShipment, error) {
+	if d.cc.APIKey == "" || d.cc.Username == "" {
+		return nil, fmt.Errorf("%w: dpd needs api_key and username", ErrNotConfigured)
+	}
+	country, ok := dpdCountries[AddressCountry(req.Recipient)]
+	if !ok {
+		return nil, fmt.Errorf("dpd: unsupported country %s", AddressCountry(req.Recipient))
+	}
+	street, houseNo := splitStreet(req.Recipient.Street)
+
+	shipment := map[string]interface{}{
+		"reference":     req.Reference,
+		"delisId":       d.cc.ClientNumber,
+		"note":          req.Note,
+		"product":       firstNonEmpty(d.cc.Product, "1"), // 1 = DPD Classic
+		"pickup":        map[string]interface{}{"date": nextWorkday(time.Now()).Format("20060102")},
+		"addressSender": map[string]interface{}{"id": d.cc.SenderAddressID},
+		"addressRecipient": map[string]interface{}{
+			"type":        "b2c",
+			"name":        recipientName(req.Recipient),
+			"nameDetail":  req.Recipient.Company,
+			"street":      street,
+			"houseNumber": houseNo,
+			"zip":         strings.ReplaceAll(req.Recipient.PostalCode, " ", ""),
+			"country":     country,
+			"city":        req.Recipient.City,
+			"phone":       req.Recipient.Phone,
+			"email":       req.Recipient.Email,
+		},
+		"parcels": map[string]interface{}{
+			"parcel": []map[string]interface{}{{"reference1": req.Reference, "weight": req.Weight}},
+		},
+	}
+	if req.COD > 0 {
+		shipment["services"] = map[string]interface{}{
+			"cod": map[string]interface{}{
+				"amount":         roundCents(req.COD),
+				"currency":       firstNonEmpty(req.Currency, "EUR"),
+				"bankAccount":    map[string]interface{}{"id": d.cc.BankAccountID},
+				"variableSymbol": codVariableSymbol(req.Reference),
+				"paymentMethod":  1, // cash or card
+			},
+		}
+	}
+
+	var result struct {
+		Result []dpdResult `json:"result"`
+	}
+	if err := d.call(ctx, "create", map[string]interface{}{"shipment": []interface{}{shipment}}, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Result) == 0 {
+		return nil, fmt.Errorf("dpd: create returned no result")
+	}
+	r := result.Result[0]
+	if err := r.err(); err != nil {
+		return nil, err
+	}
+	if len(r.Parcels.Parcel) == 0 {
+		return nil, fmt.Errorf("dpd: create returned no parcel number")
+	}
+	// The parcel number identifies the parcel for labels, tracking and cancelling
+	parcelNo := r.Parcels.Parcel[0].ParcelNo
+	return &CreatedShipment{ID: parcelNo, TrackingNumber: parcelNo}, nil
+}
+
+func (d *dpdCarrier) Labels(ctx context.Context, shipmentIDs []string, format string) ([]byte, error) {
+	switch firstNonEmpty(format, d.cc.LabelFormat) {
+	case LabelA4:
+		format = "A4"
+	default:
+		format = "A6"
+	}
+
+	var result struct {
+		Result struct {
+			AckCode string `json:"ackCode"`
+			PDFFile string `json:"pdfFile"`
+		} `json:"result"`
+	}
+	params := map[string]interface{}{"parcelno": shipmentIDs, "printFormat": format, "printOption": "Pdf"}
+	if err := d.call(ctx, "printLabels", params, &result); err != nil {
+		return nil, err
+	}
+	if result.Result.AckCode != "success" {
+		return nil, fmt.Errorf("dpd: printLabels: %s", result.Result.AckCode)
+	}
+	data, err := base64.StdEncoding.DecodeString(result.Result.PDFFile)
+	if err != nil {
+		return nil, fmt.Errorf("dpd: decode label: %w", err)
+	}
+	return data, nil
+}
+
+func (d *dpdCarrier) Cancel(ctx context.Context, shipmentID string) error {
+	var result struct {
+		Result []dpdResult `json:"result"`
+	}
+	if err := d.call(ctx, "cancel", map[string]interface{}{"parcelno": []string{shipmentID}}, &result); err != nil {
+		return err
+	}
+	if len(result.Result) == 0 {
+		return fmt.Errorf("dpd: cancel returned no result")
+	}
+	return result.Result[0].err()
+}
+
+// Track reads the parcel life cycle from the public tracking service
+func (d *dpdCarrier) Track(ctx context.Context, shipmentID, trackingNumber string) ([]models.TrackingEvent, error) {
+	var resp struct {
+		ParcelLifecycleResponse struct {
+			ParcelLifeCycleData struct {
+				ScanInfo struct {
+					Scan []struct {
+						Date     string `json:"date"`
+						ScanData struct {
+							Location string `json:"location"`
+						} `json:"scanData"`
+						ScanType struct {
+							Code string `json:"code"`
+						} `json:"scanType"`
+						ScanDescription struct {
+							Content []string `json:"content"`
+						} `json:"scanDescription"`
+					} `json:"scan"`
+				} `json:"scanInfo"`
+			} `json:"parcelLifeCycleData"`
+		} `json:"parcellifecycleResponse"`
+	}
+	number := firstNonEmpty(trackingNumber, shipmentID)
+	if err := doJSON(ctx, d.http, http.MethodGet, d.trackingURL+"/"+url.PathEscape(number), nil, nil, &resp); err != nil {
+		return nil, fmt.Errorf("dpd: tracking: %w", err)
+	}
+
+	scans := resp.ParcelLifecycleResponse.ParcelLifeCycleData.ScanInfo.Scan
+	events := make([]models.TrackingEvent, 0, len(scans))
+	for _, s := range scans {
+		t, _ := time.ParseInLocation("2006-01-02T15:04:05", s.Date, carrierTimeZone)
+		events = append(events, models.TrackingEvent{
+			Time:        t,
+			Status:      dpdTrackingStatus(s.ScanType.Code),
+			Code:        s.ScanType.Code,
+			Description: strings.Join(s.ScanDescription.Content, " "),
+			Location:    s.ScanData.Location,
+		})
+	}
+	return events, nil
+}
+
+// dpdTrackingStatus maps DPD scan codes (13 delivered, 23 returned to
+// sender, 18 waiting in a Pickup shop)
+func dpdTrackingStatus(code string) string {
+	switch code {
+	case "13":
+		return models.TrackingDelivered
+	case "23":
+		return models.TrackingReturned
+	case "18":
+		return models.TrackingReadyForPickup
+	default:
+		return models.TrackingInTransit
+	}
+}
+
+// call sends a JSON-RPC request with the DPD security token
+func (d *dpdCarrier) call(ctx context.Context, method string, params map[string]interface{}, result interface{}) error {
+	params["DPDSecurity"] = map[string]interface{}{
+		"SecurityToken": map[string]string{"ClientKey": d.cc.APIKey, "Email": d.cc.Username},
+	}
+	req := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      d.requestID.Add(1),
+	}
+
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := doJSON(ctx, d.http, http.MethodPost, d.apiURL, nil, req, &resp); err != nil {
+		return fmt.Errorf("dpd: %s: %w", method, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("dpd: %s: %s (%d)", method, resp.Error.Message, resp.Error.Code)
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("dpd: %s: parse result: %w", method, err)
+	}
+	return nil
+}
+
+// codVariableSymbol keeps the digits of the order number, at most 10 as banks allow
+func codVariableSymbol(reference string) string {
+	var digits []rune
+	for _, r := range reference {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return string(digits)
+}
+
+// nextWorkday is today, or Monday when today is a weekend day
+func nextWorkday(t time.Time) time.Time {
+	switch t.Weekday() {
+	case time.Saturday:
+		return t.AddDate(0, 0, 2)
+	case time.Sunday:
+		return t.AddDate(0, 0, 1)
+	}
+	return t
+}
@@ -0,0 +1,290 @@
+package shipping
+
+import (
+	"context"
+	"crypto/sha512"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/models"
+)
+
+// MyGLS API (https://api.mygls.sk/ParcelService.svc/json)
+const glsDefaultAPIURL = "https://api.mygls.sk/ParcelService.svc/json"
+
+// glsCarrier creates GLS courier parcels. PrintLabels registers the parcel
+// and returns its label in one call.
+type glsCarrier struct {
+	apiURL string
+	cc     CarrierConfig
+	sender models.Address
+	tariff tariff
+	http   *http.Client
+}
+
+func newGLSCarrier(cfg *config.Config, cc CarrierConfig, t tariff) *glsCarrier {
+	return &glsCarrier{
+		apiURL: strings.TrimRight(firstNonEmpty(cc.APIURL, glsDefaultAPIURL), "/"),
+		cc:     cc,
+		sender: models.Address{
+			Company:    cfg.CompanyName,
+			Street:     cfg.CompanyStreet,
+			City:       cfg.CompanyCity,
+			PostalCode: cfg.CompanyPostalCode,
+			Email:      cfg.SMTPFrom,
+		},
+		tariff: t,
+		http:   newHTTPClient(),
+	}
+}
+
+func (g *glsCarrier) Code() string { return "gls" }
+
+func (g *glsCarrier) Quote(ctx context.Context, req QuoteRequest) (*Quote, error) {
+	return g.tariff.quote(req)
+}
+
+type glsAddress struct {
+	Name           string `json:"Name"`
+	Street         string `json:"Street"`
+	HouseNumber    string `json:"HouseNumber"`
+	City           string `json:"City"`
+	ZipCode        string `json:"ZipCode"`
+	CountryIsoCode string `json:"CountryIsoCode"`
+	ContactName    string `json:"ContactName,omitempty"`
+	ContactPhone   string `json:"ContactPhone,omitempty"`
+	ContactEmail   string `json:"ContactEmail,omitempty"`
+}
+
+type glsError struct {
+	ErrorCode        int    `json:"ErrorCode"`
+	ErrorDescription string `json:"ErrorDescription"`
+}
+
+func glsErrors(method string, errs []glsError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, fmt.Sprintf("%s (%d)", e.ErrorDescription, e.ErrorCode))
+	}
+	return fmt.Errorf("gls: %s: %s", method, strings.Join(msgs, "; "))
+}
+
+func (g *glsCarrier) CreateShipment(ctx context.Context, req ShipmentRequest) (*CreatedShipment, error) {
+	clientNumber, _ := strconv.Atoi(g.cc.ClientNumber)
+	if g.cc.Username == "" || clientNumber == 0 {
+		return nil, fmt.Errorf("%w: gls needs username, password and client_number", ErrNotConfigured)
+	}
+	street, houseNo := splitStreet(req.Recipient.Street)
+	senderStreet, senderHouseNo := splitStreet(g.sender.Street)
+
+	parcel := map[string]interface{}{
+		"ClientNumber":    clientNumber,
+		"ClientReference": req.Reference,
+		"Count":           1,
+		"Content":         req.Note,
+		"PickupDate":      glsDate(nextWorkday(time.Now())),
+		"PickupAddress": glsAddress{
+			Name: g.sender.Company, Street: senderStreet, HouseNumber: senderHouseNo,
+			City: g.sender.City, ZipCode: strings.ReplaceAll(g.sender.PostalCode, " ", ""), CountryIsoCode: "SK",
+			ContactEmail: g.sender.Email,
+		},
+		"DeliveryAddress": glsAddress{
+			Name: firstNonEmpty(req.Recipient.Company, recipientName(req.Recipient)), Street: street, HouseNumber: houseNo,
+			City: req.Recipient.City, ZipCode: strings.ReplaceAll(req.Recipient.PostalCode, " ", ""),
+			CountryIsoCode: AddressCountry(req.Recipient), ContactName: recipientName(req.Recipient),
+			ContactPhone: req.Recipient.Phone, ContactEmail: req.Recipient.Email,
+		},
+	}
+	if req.COD > 0 {
+		parcel["CODAmount"] = roundCents(req.COD)
+		parcel["CODReference"] = req.Reference
+		parcel["CODCurrency"] = firstNonEmpty(req.Currency, "EUR")
+	}
+
+	var resp struct {
+		Labels               []int      `json:"Labels"`
+		PrintLabelsErrorList []glsError `json:"PrintLabelsErrorList"`
+		PrintLabelsInfoList  []struct {
+			ClientReference string `json:"ClientReference"`
+			ParcelID        int64  `json:"ParcelId"`
+			ParcelNumber    int64  `json:"ParcelNumber"`
+		} `json:"PrintLabelsInfoList"`
+	}
+	body := g.auth(map[string]interface{}{
+		"ParcelList":    []interface{}{parcel},
+		"TypeOfPrinter": g.printer(""),
+		"PrintPosition": 1,
+	})
+	if err := doJSON(ctx, g.http, http.MethodPost, g.apiURL+"/PrintLabels", nil, body, &resp); err != nil {
+		return nil, fmt.Errorf("gls: PrintLabels: %w", err)
+	}
+	if err := glsErrors("PrintLabels", resp.PrintLabelsErrorList); err != nil {
+		return nil, err
+	}
+	if len(resp.PrintLabelsInfoList) == 0 {
+		return nil, fmt.Errorf("gls: PrintLabels returned no parcel")
+	}
+
+	info := resp.PrintLabelsInfoList[0]
+	return &CreatedShipment{
+		ID:             strconv.FormatInt(info.ParcelID, 10),
+		TrackingNumber: strconv.FormatInt(info.ParcelNumber, 10),
+		Label:          intsToBytes(resp.Labels),
+	}, nil
+}
+
+func (g *glsCarrier) Labels(ctx context.Context, shipmentIDs []string, format string) ([]byte, error) {
+	ids, err := glsParcelIDs(shipmentIDs)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Labels                    []int      `json:"Labels"`
+		GetPrintedLabelsErrorList []glsError `json:"GetPrintedLabelsErrorList"`
+	}
+	body := g.auth(map[string]interface{}{"ParcelIdList": ids, "TypeOfPrinter": g.printer(format), "PrintPosition": 1})
+	if err := doJSON(ctx, g.http, http.MethodPost, g.apiURL+"/GetPrintedLabels", nil, body, &resp); err != nil {
+		return nil, fmt.Errorf("gls: GetPrintedLabels: %w", err)
+	}
+	if err := glsErrors("GetPrintedLabels", resp.GetPrintedLabelsErrorList); err != nil {
+		return nil, err
+	}
+	return intsToBytes(resp.Labels), nil
+}
+
+func (g *glsCarrier) Cancel(ctx context.Context, shipmentID string) error {
+	ids, err := glsParcelIDs([]string{shipmentID})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		DeleteLabelsErrorList []glsError `json:"DeleteLabelsErrorList"`
+	}
+	if err := doJSON(ctx, g.http, http.MethodPost, g.apiURL+"/DeleteLabels", nil, g.auth(map[string]interface{}{"ParcelIdList": ids}), &resp); err != nil {
+		return fmt.Errorf("gls: DeleteLabels: %w", err)
+	}
+	return glsErrors("DeleteLabels", resp.DeleteLabelsErrorList)
+}
+
+func (g *glsCarrier) Track(ctx context.Context, shipmentID, trackingNumber string) ([]models.TrackingEvent, error) {
+	number, err := strconv.ParseInt(trackingNumber, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("gls: invalid parcel number %q", trackingNumber)
+	}
+	var resp struct {
+		ParcelStatusList []struct {
+			StatusCode        string `json:"StatusCode"`
+			StatusDescription string `json:"StatusDescription"`
+			StatusDate        string `json:"StatusDate"`
+			DepotCity         string `json:"DepotCity"`
+		} `json:"ParcelStatusList"`
+		GetParcelStatusErrors []glsError `json:"GetParcelStatusErrors"`
+	}
+	body := g.auth(map[string]interface{}{"ParcelNumber": number, "ReturnPOD": false, "LanguageIsoCode": "SK"})
+	if err := doJSON(ctx, g.http, http.MethodPost, g.apiURL+"/GetParcelStatuses", nil, body, &resp); err != nil {
+		return nil, fmt.Errorf("gls: GetParcelStatuses: %w", err)
+	}
+	if err := glsErrors("GetParcelStatuses", resp.GetParcelStatusErrors); err != nil {
+		return nil, err
+	}
+
+	events := make([]models.TrackingEvent, 0, len(resp.ParcelStatusList))
+	// The newest status comes first
+	for i := len(resp.ParcelStatusList) - 1; i >= 0; i-- {
+		s := resp.ParcelStatusList[i]
+		events = append(events, models.TrackingEvent{
+			Time:        parseGLSDate(s.StatusDate),
+			Status:      glsTrackingStatus(s.StatusCode),
+			Code:        s.StatusCode,
+			Description: s.StatusDescription,
+			Location:    s.DepotCity,
+		})
+	}
+	return events, nil
+}
+
+// glsTrackingStatus maps GLS status codes (05 delivered, 54 delivered to a
+// ParcelShop, 23 returned to sender)
+func glsTrackingStatus(code string) string {
+	switch strings.TrimLeft(code, "0") {
+	case "5":
+		return models.TrackingDelivered
+	case "54":
+		return models.TrackingReadyForPickup
+	case "23":
+		return models.TrackingReturned
+	default:
+		return models.TrackingInTransit
+	}
+}
+
+// auth adds the credentials; MyGLS expects the SHA-512 of the password as a byte array
+func (g *glsCarrier) auth(body map[string]interface{}) map[string]interface{} {
+	sum := sha512.Sum512([]byte(g.cc.Password))
+	password := make([]int, len(sum))
+	for i, b := range sum {
+		password[i] = int(b)
+	}
+	body["Username"] = g.cc.Username
+	body["Password"] = password
+	return body
+}
+
+func (g *glsCarrier) printer(format string) string {
+	switch firstNonEmpty(format, g.cc.LabelFormat) {
+	case LabelA6:
+		return "A6"
+	case "", LabelA4:
+		return "A4_2x2"
+	default:
+		return format
+	}
+}
+
+func glsParcelIDs(shipmentIDs []string) ([]int64, error) {
+	ids := make([]int64, 0, len(shipmentIDs))
+	for _, s := range shipmentIDs {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("gls: invalid parcel ID %q", s)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// intsToBytes converts the JSON number array GLS uses for binary data
+func intsToBytes(values []int) []byte {
+	if len(values) == 0 {
+		return nil
+	}
+	data := make([]byte, len(values))
+	for i, v := range values {
+		data[i] = byte(v)
+	}
+	return data
+}
+
+// glsDate formats a WCF JSON date: /Date(milliseconds)/
+func glsDate(t time.Time) string {
+	return fmt.Sprintf("/Date(%d)/", t.UnixMilli())
+}
+
+var glsDatePattern = regexp.MustCompile(`/Date\((-?\d+)`)
+
+func parseGLSDate(s string) time.Time {
+	if m := glsDatePattern.FindStringSubmatch(s); m != nil {
+		ms, _ := strconv.ParseInt(m[1], 10, 64)
+		return time.UnixMilli(ms)
+	}
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
@@ -0,0 +1,392 @@
+package shipping
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/models"
+)
+
+// Packeta label formats accepted by packetLabelPdf / packetsLabelsPdf
+const (
+	PacketaLabelA6     = "A6 on A6"
+	PacketaLabelA6onA4 = "A6 on A4" // four labels per page, for bulk printing
+)
+
+// PacketaClient talks to the Packeta REST/XML API (https://docs.packeta.com)
+type PacketaClient struct {
+	BaseURL     string
+	APIPassword string
+	Sender      string // "eshop" sender label registered in the Packeta client section
+	HTTPClient  *http.Client
+}
+
+// PacketAttributes describe a packet sent to a pickup point
+type PacketAttributes struct {
+	Number        string // our order number
+	Name          string
+	Surname       string
+	Company       string
+	Email         string
+	Phone         string
+	PickupPointID string
+	Value         float64 // declared value for insurance
+	COD           float64 // cash on delivery, 0 if prepaid
+	Currency      string
+	Weight        float64 // kg
+}
+
+// Packet is a packet registered at Packeta
+type Packet struct {
+	ID          string // packet ID used by the other API calls
+	Barcode     string // Z1234567890, printed on the label and used for tracking
+	BarcodeText string
+}
+
+// PacketaError is a fault returned by the API, with the offending attributes
+type PacketaError struct {
+	Fault   string
+	Message string
+	Details []string
+}
+
+func (e *PacketaError) Error() string {
+	msg := fmt.Sprintf("packeta: %s: %s", e.Fault, e.Message)
+	if len(e.Details) > 0 {
+		msg += " (" + strings.Join(e.Details, "; ") + ")"
+	}
+	return msg
+}
+
+// NewPacketaClient creates a client from the application config
+func NewPacketaClient(cfg *config.Config) *PacketaClient {
+	return &PacketaClient{
+		BaseURL:     strings.TrimRight(cfg.PacketaAPIURL, "/"),
+		APIPassword: cfg.PacketaAPIPassword,
+		Sender:      cfg.PacketaSender,
+		HTTPClient:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// IsConfigured returns true if the API password is set
+func (c *PacketaClient) IsConfigured() bool {
+	return c.APIPassword != ""
+}
+
+// CreatePacket registers a packet and returns its ID and barcode
+func (c *PacketaClient) CreatePacket(ctx context.Context, attrs PacketAttributes) (*Packet, error) {
+	type packetAttributes struct {
+		Number    string `xml:"number"`
+		Name      string `xml:"name"`
+		Surname   string `xml:"surname"`
+		Company   string `xml:"company,omitempty"`
+		Email     string `xml:"email,omitempty"`
+		Phone     string `xml:"phone,omitempty"`
+		AddressID string `xml:"addressId"`
+		COD       string `xml:"cod,omitempty"`
+		Value     string `xml:"value"`
+		Currency  string `xml:"currency,omitempty"`
+		Weight    string `xml:"weight"`
+		Eshop     string `xml:"eshop,omitempty"`
+	}
+	req := struct {
+		XMLName    xml.Name         `xml:"createPacket"`
+		Password   string           `xml:"apiPassword"`
+		Attributes packetAttributes `xml:"packetAttributes"`
+	}{
+		Password: c.APIPassword,
+		Attributes: packetAttributes{
+			Number:    attrs.Number,
+			Name:      attrs.Name,
+			Surname:   attrs.Surname,
+			Company:   attrs.Company,
+			Email:     attrs.Email,
+			Phone:     attrs.Phone,
+			AddressID: attrs.PickupPointID,
+			Value:     formatAmount(attrs.Value),
+			Currency:  attrs.Currency,
+			Weight:    strconv.FormatFloat(attrs.Weight, 'f', 3, 64),
+			Eshop:     c.Sender,
+		},
+	}
+	if attrs.COD > 0 {
+		req.Attributes.COD = formatAmount(attrs.COD)
+	}
+
+	var result struct {
+		ID          string `xml:"id"`
+		Barcode     string `xml:"barcode"`
+		BarcodeText string `xml:"barcodeText"`
+	}
+	if err := c.call(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	if result.ID == "" {
+		return nil, fmt.Errorf("packeta: createPacket returned no packet ID")
+	}
+	return &Packet{ID: result.ID, Barcode: result.Barcode, BarcodeText: result.BarcodeText}, nil
+}
+
+// CancelPacket cancels a packet that was not handed over yet
+func (c *PacketaClient) CancelPacket(ctx context.Context, packetID string) error {
+	req := struct {
+		XMLName  xml.Name `xml:"cancelPacket"`
+		Password string   `xml:"apiPassword"`
+		PacketID string   `xml:"packetId"`
+	}{Password: c.APIPassword, PacketID: packetID}
+	return c.call(ctx, req, nil)
+}
+
+// PacketLabelPDF returns the label of one packet
+func (c *PacketaClient) PacketLabelPDF(ctx context.Context, packetID, format string) ([]byte, error) {
+	req := struct {
+		XMLName  xml.Name `xml:"packetLabelPdf"`
+		Password string   `xml:"apiPassword"`
+		PacketID string   `xml:"packetId"`
+		Format   string   `xml:"format"`
+		Offset   int      `xml:"offset"`
+	}{Password: c.APIPassword, PacketID: packetID, Format: format}
+	return c.pdf(ctx, req)
+}
+
+// PacketsLabelsPDF returns the labels of many packets in one PDF. offset
+// skips label positions already used on the first sheet.
+func (c *PacketaClient) PacketsLabelsPDF(ctx context.Context, packetIDs []string, format string, offset int) ([]byte, error) {
+	req := struct {
+		XMLName   xml.Name `xml:"packetsLabelsPdf"`
+		Password  string   `xml:"apiPassword"`
+		PacketIDs []string `xml:"packetIds>id"`
+		Format    string   `xml:"format"`
+		Offset    int      `xml:"offset"`
+	}{Password: c.APIPassword, PacketIDs: packetIDs, Format: format, Offset: offset}
+	return c.pdf(ctx, req)
+}
+
+// pdf calls a label method, whose result is the base64 encoded PDF
+func (c *PacketaClient) pdf(ctx context.Context, req interface{}) ([]byte, error) {
+	var result string
+	if err := c.call(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(result))
+	if err != nil {
+		return nil, fmt.Errorf("packeta: decode label: %w", err)
+	}
+	return data, nil
+}
+
+// call posts an XML request and decodes <result> into result
+func (c *PacketaClient) call(ctx context.Context, req interface{}, result interface{}) error {
+	body, err := xml.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("packeta: encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("packeta: build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "text/xml; charset=utf-8")
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("packeta: request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return fmt.Errorf("packeta: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("packeta: HTTP %d: %s", resp.StatusCode, truncate(string(data), 200))
+	}
+
+	var envelope struct {
+		Status string `xml:"status"`
+		Fault  string `xml:"fault"`
+		String string `xml:"string"`
+		Result struct {
+			Inner []byte `xml:",innerxml"`
+		} `xml:"result"`
+		Detail []struct {
+			Name  string `xml:"name"`
+			Fault string `xml:"fault"`
+		} `xml:"detail>attributes>fault"`
+	}
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("packeta: parse response: %w", err)
+	}
+	if envelope.Status != "ok" {
+		perr := &PacketaError{Fault: envelope.Fault, Message: envelope.String}
+		for _, d := range envelope.Detail {
+			perr.Details = append(perr.Details, d.Name+": "+d.Fault)
+		}
+		return perr
+	}
+	if result == nil {
+		return nil
+	}
+
+	// Wrap the inner XML again so both struct results and plain text results decode
+	wrapped := append(append([]byte("<result>"), envelope.Result.Inner...), "</result>"...)
+	if err := xml.Unmarshal(wrapped, result); err != nil {
+		return fmt.Errorf("packeta: parse result: %w", err)
+	}
+	return nil
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// PacketTracking returns the status history of a packet
+func (c *PacketaClient) PacketTracking(ctx context.Context, packetID string) ([]models.TrackingEvent, error) {
+	req := struct {
+		XMLName  xml.Name `xml:"packetTracking"`
+		Password string   `xml:"apiPassword"`
+		PacketID string   `xml:"packetId"`
+	}{Password: c.APIPassword, PacketID: packetID}
+
+	var result struct {
+		Records []struct {
+			DateTime   string `xml:"dateTime"`
+			StatusCode string `xml:"statusCode"`
+			CodeText   string `xml:"codeText"`
+			StatusText string `xml:"statusText"`
+		} `xml:"record"`
+	}
+	if err := c.call(ctx, req, &result); err != nil {
+		return nil, err
+	}
+
+	events := make([]models.TrackingEvent, 0, len(result.Records))
+	for _, r := range result.Records {
+		t, _ := time.ParseInLocation("2006-01-02T15:04:05", r.DateTime, carrierTimeZone)
+		events = append(events, models.TrackingEvent{
+			Time:        t,
+			Status:      packetaTrackingStatus(r.StatusCode),
+			Code:        r.StatusCode,
+			Description: firstNonEmpty(r.StatusText, r.CodeText),
+		})
+	}
+	return events, nil
+}
+
+// packetaTrackingStatus maps Packeta status codes (5 ready for pickup,
+// 7 delivered, 9/10 returning and returned to sender, 11 cancelled)
+func packetaTrackingStatus(code string) string {
+	switch code {
+	case "5":
+		return models.TrackingReadyForPickup
+	case "7":
+		return models.TrackingDelivered
+	case "10":
+		return models.TrackingReturned
+	case "11":
+		return models.TrackingCancelled
+	default:
+		return models.TrackingInTransit
+	}
+}
+
+// ==================== CARRIER ====================
+
+// packetaCarrier adapts the Packeta API to the Carrier interface
+type packetaCarrier struct {
+	client *PacketaClient
+	tariff tariff
+	format string
+}
+
+// newPacketaCarrier uses the PACKETA_* settings, the method config may override them
+func newPacketaCarrier(cfg *config.Config, cc CarrierConfig, t tariff) *packetaCarrier {
+	client := NewPacketaClient(cfg)
+	if cc.APIURL != "" {
+		client.BaseURL = strings.TrimRight(cc.APIURL, "/")
+	}
+	if cc.Password != "" {
+		client.APIPassword = cc.Password
+	}
+	if cc.Username != "" {
+		client.Sender = cc.Username
+	}
+	return &packetaCarrier{client: client, tariff: t, format: firstNonEmpty(cc.LabelFormat, cfg.PacketaLabelFormat)}
+}
+
+func (p *packetaCarrier) Code() string { return "packeta" }
+
+func (p *packetaCarrier) Quote(ctx context.Context, req QuoteRequest) (*Quote, error) {
+	return p.tariff.quote(req)
+}
+
+func (p *packetaCarrier) CreateShipment(ctx context.Context, req ShipmentRequest) (*CreatedShipment, error) {
+	if !p.client.IsConfigured() {
+		return nil, fmt.Errorf("%w: set PACKETA_API_PASSWORD", ErrNotConfigured)
+	}
+	if req.PickupPointID == "" {
+		return nil, fmt.Errorf("packeta: no pickup point selected")
+	}
+	packet, err := p.client.CreatePacket(ctx, PacketAttributes{
+		Number:        req.Reference,
+		Name:          req.Recipient.FirstName,
+		Surname:       req.Recipient.LastName,
+		Company:       req.Recipient.Company,
+		Email:         req.Recipient.Email,
+		Phone:         req.Recipient.Phone,
+		PickupPointID: req.PickupPointID,
+		Value:         req.Value,
+		COD:           req.COD,
+		Currency:      req.Currency,
+		Weight:        req.Weight,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CreatedShipment{ID: packet.ID, TrackingNumber: packet.Barcode}, nil
+}
+
+func (p *packetaCarrier) Labels(ctx context.Context, shipmentIDs []string, format string) ([]byte, error) {
+	return p.LabelsAt(ctx, shipmentIDs, format, 0)
+}
+
+// LabelsAt accepts the generic formats as well as Packeta's own ("A6 on A4")
+func (p *packetaCarrier) LabelsAt(ctx context.Context, shipmentIDs []string, format string, offset int) ([]byte, error) {
+	switch format {
+	case LabelA6:
+		format = PacketaLabelA6
+	case LabelA4:
+		format = PacketaLabelA6onA4
+	case "":
+		format = p.format
+	}
+	if len(shipmentIDs) == 1 && offset == 0 {
+		return p.client.PacketLabelPDF(ctx, shipmentIDs[0], format)
+	}
+	return p.client.PacketsLabelsPDF(ctx, shipmentIDs, format, offset)
+}
+
+func (p *packetaCarrier) Track(ctx context.Context, shipmentID, trackingNumber string) ([]models.TrackingEvent, error) {
+	// A barcode typed in by staff is "Z" followed by the packet ID
+	return p.client.PacketTracking(ctx, strings.TrimPrefix(strings.ToUpper(shipmentID), "Z"))
+}
+
+func (p *packetaCarrier) Cancel(ctx context.Context, shipmentID string) error {
+	return p.client.CancelPacket(ctx, shipmentID)
+}
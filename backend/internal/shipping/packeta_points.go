@@ -0,0 +1,379 @@
+package shipping
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"megashop/internal/models"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// PacketaBranchFeedURL is the Packeta export of all pickup points (branch.json works as well)
+const PacketaBranchFeedURL = "https://www.zasilkovna.cz/api/v4/%s/branch.xml?lang=sk"
+
+// PacketaPointStore keeps the local copy of the branch feed
+type PacketaPointStore interface {
+	// SyncPacketaPoints upserts the points and deactivates those missing from the feed
+	SyncPacketaPoints(ctx context.Context, points []models.PacketaPoint) (int, error)
+}
+
+// PacketaFeedSource returns where the branch feed is read from: the
+// configured URL or local file, else the API export for apiKey
+func PacketaFeedSource(configured, apiKey string) string {
+	if configured != "" {
+		return configured
+	}
+	if apiKey == "" {
+		return ""
+	}
+	return fmt.Sprintf(PacketaBranchFeedURL, apiKey)
+}
+
+// OpenPacketaFeed opens the branch feed from an http(s) URL or a local file
+func OpenPacketaFeed(ctx context.Context, source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("open branch feed: %w", err)
+		}
+		return f, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("branch feed request: %w", err)
+	}
+	resp, err := (&http.Client{Timeout: 5 * time.Minute}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download branch feed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download branch feed: HTTP %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// SyncPacketaPoints reads the feed from source and replaces the local copy.
+// Returns the number of points stored.
+func SyncPacketaPoints(ctx context.Context, store PacketaPointStore, source string) (int, error) {
+	feed, err := OpenPacketaFeed(ctx, source)
+	if err != nil {
+		return 0, err
+	}
+	defer feed.Close()
+
+	points, err := ParsePacketaPoints(feed)
+	if err != nil {
+		return 0, err
+	}
+	return store.SyncPacketaPoints(ctx, points)
+}
+
+// ==================== FEED PARSING ====================
+
+// ParsePacketaPoints reads the Packeta branch feed in XML or JSON, detected
+// from the first character. Points without ID or country are skipped; an
+// empty feed is an error so a broken download never wipes the table.
+func ParsePacketaPoints(r io.Reader) ([]models.PacketaPoint, error) {
+	br := bufio.NewReader(r)
+	first, err := firstNonSpace(br)
+	if err != nil {
+		return nil, fmt.Errorf("parse branch feed: %w", err)
+	}
+
+	var branches []packetaBranch
+	switch first {
+	case '<':
+		var doc struct {
+			Branches []packetaBranch `xml:"branches>branch"`
+		}
+		if err := xml.NewDecoder(br).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("parse branch feed XML: %w", err)
+		}
+		branches = doc.Branches
+	case '{', '[':
+		branches, err = decodePacketaJSON(br)
+		if err != nil {
+			return nil, fmt.Errorf("parse branch feed JSON: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("parse branch feed: unknown format")
+	}
+
+	points := make([]models.PacketaPoint, 0, len(branches))
+	for _, b := range branches {
+		if p, ok := b.point(); ok {
+			points = append(points, p)
+		}
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("parse branch feed: no pickup points found")
+	}
+	return points, nil
+}
+
+func firstNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		// UTF-8 BOM
+		if b == 0xEF {
+			br.Discard(2)
+			continue
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, br.UnreadByte()
+		}
+	}
+}
+
+// decodePacketaJSON accepts a plain array of branches, or an object with
+// the branches in "data" (array, or map keyed by ID as in API v4) or "branches"
+func decodePacketaJSON(r io.Reader) ([]packetaBranch, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	raw = bytes.TrimSpace(raw)
+	if raw[0] == '[' {
+		var list []packetaBranch
+		err := json.Unmarshal(raw, &list)
+		return list, err
+	}
+
+	var wrapper struct {
+		Data     json.RawMessage `json:"data"`
+		Branches json.RawMessage `json:"branches"`
+	}
+	if err := json.Unmarshal(raw, &wrapper); err != nil {
+		return nil, err
+	}
+	data := bytes.TrimSpace(wrapper.Data)
+	if len(data) == 0 {
+		data = bytes.TrimSpace(wrapper.Branches)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no branches in document")
+	}
+	if data[0] == '[' {
+		var list []packetaBranch
+		err := json.Unmarshal(data, &list)
+		return list, err
+	}
+	var byID map[string]packetaBranch
+	if err := json.Unmarshal(data, &byID); err != nil {
+		return nil, err
+	}
+	list := make([]packetaBranch, 0, len(byID))
+	for _, b := range byID {
+		list = append(list, b)
+	}
+	return list, nil
+}
+
+// packetaBranch is one branch of the feed, with the same element names in
+// XML and JSON. Numbers come as strings in some exports, as numbers in others.
+type packetaBranch struct {
+	ID           flexString   `xml:"id" json:"id"`
+	Name         string       `xml:"name" json:"name"`
+	NameStreet   string       `xml:"nameStreet" json:"nameStreet"`
+	Place        string       `xml:"place" json:"place"`
+	Street       string       `xml:"street" json:"street"`
+	City         string       `xml:"city" json:"city"`
+	Zip          string       `xml:"zip" json:"zip"`
+	Country      string       `xml:"country" json:"country"`
+	Type         string       `xml:"type" json:"type"`
+	BranchType   string       `xml:"branchType" json:"branchType"`
+	Latitude     flexString   `xml:"latitude" json:"latitude"`
+	Longitude    flexString   `xml:"longitude" json:"longitude"`
+	Directions   string       `xml:"directions" json:"directions"`
+	URL          string       `xml:"url" json:"url"`
+	Photos       packetaPhoto `xml:"photos" json:"photos"`
+	MaxWeight    flexString   `xml:"maxWeight" json:"maxWeight"`
+	Status       flexString   `xml:"status>statusId" json:"-"`
+	OpeningHours struct {
+		CompactShort string `xml:"compactShort" json:"compactShort"`
+		Regular      struct {
+			Monday    string `xml:"monday" json:"monday"`
+			Tuesday   string `xml:"tuesday" json:"tuesday"`
+			Wednesday string `xml:"wednesday" json:"wednesday"`
+			Thursday  string `xml:"thursday" json:"thursday"`
+			Friday    string `xml:"friday" json:"friday"`
+			Saturday  string `xml:"saturday" json:"saturday"`
+			Sunday    string `xml:"sunday" json:"sunday"`
+		} `xml:"regular" json:"regular"`
+	} `xml:"openingHours" json:"openingHours"`
+}
+
+func (b packetaBranch) point() (models.PacketaPoint, bool) {
+	id := strings.TrimSpace(string(b.ID))
+	country := strings.ToLower(strings.TrimSpace(b.Country))
+	// statusId 1 = open; closed points stay in some exports
+	if id == "" || country == "" || (b.Status != "" && b.Status != "1") {
+		return models.PacketaPoint{}, false
+	}
+
+	name := strings.TrimSpace(b.Name)
+	if name == "" {
+		name = strings.TrimSpace(b.NameStreet)
+	}
+
+	p := models.PacketaPoint{
+		ID:         id,
+		Name:       name,
+		Place:      strings.TrimSpace(b.Place),
+		Street:     strings.TrimSpace(b.Street),
+		City:       strings.TrimSpace(b.City),
+		Zip:        NormalizeZip(b.Zip),
+		Country:    country,
+		Type:       packetaPointType(b.Type, b.BranchType, name),
+		Latitude:   b.Latitude.float(),
+		Longitude:  b.Longitude.float(),
+		Directions: strings.TrimSpace(b.Directions),
+		URL:        strings.TrimSpace(b.URL),
+		Photo:      b.Photos.first(),
+		MaxWeight:  b.MaxWeight.float(),
+		IsActive:   true,
+	}
+
+	r := b.OpeningHours.Regular
+	p.OpeningHours.Compact = strings.TrimSpace(b.OpeningHours.CompactShort)
+	p.OpeningHours.Regular = map[string]string{}
+	for day, hours := range map[string]string{
+		"monday": r.Monday, "tuesday": r.Tuesday, "wednesday": r.Wednesday, "thursday": r.Thursday,
+		"friday": r.Friday, "saturday": r.Saturday, "sunday": r.Sunday,
+	} {
+		if hours = strings.TrimSpace(hours); hours != "" {
+			p.OpeningHours.Regular[day] = hours
+		}
+	}
+	return p, true
+}
+
+// packetaPointType maps the feed's type fields to our types. Older exports
+// have no type, Z-BOX lockers are recognised by name there.
+func packetaPointType(types ...string) string {
+	for _, t := range types {
+		t = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(t), "-", ""))
+		if strings.HasPrefix(t, "zbox") {
+			return models.PacketaPointZBox
+		}
+	}
+	return models.PacketaPointPickup
+}
+
+// packetaPhoto holds photo URLs: <photos><photo><normal>URL</normal></photo></photos>
+// in XML, an array of {"normal": URL} in JSON
+type packetaPhoto struct {
+	Normal []string `xml:"photo>normal"`
+}
+
+func (p *packetaPhoto) UnmarshalJSON(data []byte) error {
+	var list []struct {
+		Normal string `json:"normal"`
+	}
+	if json.Unmarshal(data, &list) != nil {
+		return nil
+	}
+	for _, ph := range list {
+		p.Normal = append(p.Normal, ph.Normal)
+	}
+	return nil
+}
+
+func (p packetaPhoto) first() string {
+	for _, u := range p.Normal {
+		if u = strings.TrimSpace(u); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+// flexString accepts a JSON string or number
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*f = flexString(s)
+		return nil
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	*f = flexString(strings.TrimSpace(string(data)))
+	return nil
+}
+
+func (f flexString) float() float64 {
+	v, _ := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(string(f)), ",", "."), 64)
+	return v
+}
+
+// NormalizeZip removes spaces from a postal code ("811 01" -> "81101")
+func NormalizeZip(zip string) string {
+	return strings.Join(strings.Fields(zip), "")
+}
+
+// FoldText lowercases and strips diacritics for searching ("Košice" -> "kosice")
+func FoldText(s string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		if r < 0x300 || r > 0x36f {
+			sb.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// ==================== PERIODIC SYNC ====================
+
+// PacketaSyncWorker refreshes the pickup points periodically
+type PacketaSyncWorker struct {
+	store    PacketaPointStore
+	source   string
+	interval time.Duration
+}
+
+// NewPacketaSyncWorker creates a worker syncing from source every interval
+func NewPacketaSyncWorker(store PacketaPointStore, source string, interval time.Duration) *PacketaSyncWorker {
+	return &PacketaSyncWorker{store: store, source: source, interval: interval}
+}
+
+// Run syncs right away and then every interval until ctx is cancelled
+func (w *PacketaSyncWorker) Run(ctx context.Context) {
+	log.Printf("[PACKETA] Branch sync started (every %v)", w.interval)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		n, err := SyncPacketaPoints(ctx, w.store, w.source)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[PACKETA] Branch sync failed: %v", err)
+		} else if err == nil {
+			log.Printf("[PACKETA] Synced %d pickup points in %v", n, time.Since(start).Round(time.Millisecond))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package shipping
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/models"
+)
+
+// Slovenská pošta B2B shipment API and the public track & trace service
+const (
+	postaDefaultAPIURL      = "https://api.posta.sk/b2b/v1"
+	postaDefaultTrackingURL = "https://api.posta.sk/private/search"
+)
+
+// postaCarrier submits parcels to Slovenská pošta (Balík na adresu by default)
+type postaCarrier struct {
+	apiURL      string
+	trackingURL string
+	cc          CarrierConfig
+	tariff      tariff
+	http        *http.Client
+}
+
+func newPostaCarrier(cfg *config.Config, cc CarrierConfig, t tariff) *postaCarrier {
+	return &postaCarrier{
+		apiURL:      strings.TrimRight(firstNonEmpty(cc.APIURL, postaDefaultAPIURL), "/"),
+		trackingURL: firstNonEmpty(cc.TrackingURL, postaDefaultTrackingURL),
+		cc:          cc,
+		tariff:      t,
+		http:        newHTTPClient(),
+	}
+}
+
+func (p *postaCarrier) Code() string { return "posta" }
+
+func (p *postaCarrier) Quote(ctx context.Context, req QuoteRequest) (*Quote, error) {
+	return p.tariff.quote(req)
+}
+
+func (p *postaCarrier) CreateShipment(ctx context.Context, req ShipmentRequest) (*CreatedShipment, error) {
+	body := map[string]interface{}{
+		"customerId": p.cc.ClientNumber,
+		"service":    firstNonEmpty(p.cc.Product, "BNA"), // Balík na adresu
+		"reference":  req.Reference,
+		"weight":     req.Weight,
+		"value":      roundCents(req.Value),
+		"note":       req.Note,
+		"recipient": map[string]interface{}{
+			"name":       recipientName(req.Recipient),
+			"company":    req.Recipient.Company,
+			"street":     req.Recipient.Street,
+			"city":       req.Recipient.City,
+			"postalCode": strings.ReplaceAll(req.Recipient.PostalCode, " ", ""),
+			"country":    AddressCountry(req.Recipient),
+			"phone":      req.Recipient.Phone,
+			"email":      req.Recipient.Email,
+		},
+	}
+	if req.COD > 0 {
+		body["cod"] = map[string]interface{}{
+			"amount":         roundCents(req.COD),
+			"currency":       firstNonEmpty(req.Currency, "EUR"),
+			"variableSymbol": codVariableSymbol(req.Reference),
+		}
+	}
+
+	var resp struct {
+		ID             string `json:"id"`
+		TrackingNumber string `json:"trackingNumber"`
+		Label          string `json:"label"` // base64 PDF
+	}
+	if err := doJSON(ctx, p.http, http.MethodPost, p.apiURL+"/shipments", p.header(), body, &resp); err != nil {
+		return nil, fmt.Errorf("posta: create shipment: %w", err)
+	}
+	if resp.ID == "" {
+		return nil, fmt.Errorf("posta: create shipment returned no ID")
+	}
+
+	created := &CreatedShipment{ID: resp.ID, TrackingNumber: firstNonEmpty(resp.TrackingNumber, resp.ID)}
+	if resp.Label != "" {
+		if label, err := base64.StdEncoding.DecodeString(resp.Label); err == nil {
+			created.Label = label
+		}
+	}
+	return created, nil
+}
+
+func (p *postaCarrier) Labels(ctx context.Context, shipmentIDs []string, format string) ([]byte, error) {
+	if firstNonEmpty(format, p.cc.LabelFormat) == LabelA4 {
+		format = LabelA4
+	} else {
+		format = LabelA6
+	}
+	var resp struct {
+		PDF string `json:"pdf"`
+	}
+	body := map[string]interface{}{"ids": shipmentIDs, "format": format}
+	if err := doJSON(ctx, p.http, http.MethodPost, p.apiURL+"/labels", p.header(), body, &resp); err != nil {
+		return nil, fmt.Errorf("posta: labels: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.PDF)
+	if err != nil {
+		return nil, fmt.Errorf("posta: decode label: %w", err)
+	}
+	return data, nil
+}
+
+func (p *postaCarrier) Cancel(ctx context.Context, shipmentID string) error {
+	if err := doJSON(ctx, p.http, http.MethodDelete, p.apiURL+"/shipments/"+url.PathEscape(shipmentID), p.header(), nil, nil); err != nil {
+		return fmt.Errorf("posta: cancel shipment: %w", err)
+	}
+	return nil
+}
+
+// Track reads the public track & trace service
+func (p *postaCarrier) Track(ctx context.Context, shipmentID, trackingNumber string) ([]models.TrackingEvent, error) {
+	var resp struct {
+		Parcels []struct {
+			Events []struct {
+				Date  []int  `json:"date"` // year, month, day, hour, minute
+				State string `json:"state"`
+				Desc  struct {
+					SK string `json:"sk"`
+				} `json:"desc"`
+				Post struct {
+					Name string `json:"name"`
+				} `json:"post"`
+			} `json:"events"`
+		} `json:"parcels"`
+	}
+	query := url.Values{"q": {firstNonEmpty(trackingNumber, shipmentID)}, "m": {"tnt"}}
+	if err := doJSON(ctx, p.http, http.MethodGet, p.trackingURL+"?"+query.Encode(), nil, nil, &resp); err != nil {
+		return nil, fmt.Errorf("posta: tracking: %w", err)
+	}
+	if len(resp.Parcels) == 0 {
+		return nil, nil
+	}
+
+	var events []models.TrackingEvent
+	for _, e := range resp.Parcels[0].Events {
+		events = append(events, models.TrackingEvent{
+			Time:        postaDate(e.Date),
+			Status:      postaTrackingStatus(e.State),
+			Code:        e.State,
+			Description: e.Desc.SK,
+			Location:    e.Post.Name,
+		})
+	}
+	return events, nil
+}
+
+// postaTrackingStatus maps the track & trace states
+func postaTrackingStatus(state string) string {
+	switch strings.ToLower(state) {
+	case "delivered":
+		return models.TrackingDelivered
+	case "returned", "returned_to_sender":
+		return models.TrackingReturned
+	case "ready_for_pickup", "notified":
+		return models.TrackingReadyForPickup
+	default:
+		return models.TrackingInTransit
+	}
+}
+
+func postaDate(parts []int) time.Time {
+	for len(parts) < 5 {
+		parts = append(parts, 0)
+	}
+	if parts[0] == 0 {
+		return time.Time{}
+	}
+	return time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], 0, 0, carrierTimeZone)
+}
+
+func (p *postaCarrier) header() http.Header {
+	h := http.Header{}
+	if p.cc.APIKey != "" {
+		h.Set("Authorization", "Bearer "+p.cc.APIKey)
+	}
+	return h
+}
@@ -0,0 +1,231 @@
+package shipping
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"megashop/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnknownMethod is returned for shipping methods that do not exist or are inactive
+var ErrUnknownMethod = errors.New("unknown shipping method")
+
+// DefaultCountry is the destination when the address has none
+const DefaultCountry = "SK"
+
+// RateItem is an ordered product as far as shipping cares
+type RateItem struct {
+	ProductID   uuid.UUID
+	CategoryID  *uuid.UUID
+	Quantity    int
+	Weight      float64 // kg per piece
+	IsLarge     bool
+	SmallPallet bool
+}
+
+// RateRequest describes an order (or a single product for feeds) to be priced
+type RateRequest struct {
+	Country  string  // ISO code of the destination, DefaultCountry if empty
+	Subtotal float64 // goods value, for free shipping
+	Items    []RateItem
+}
+
+// Weight returns the total weight in kg
+func (r RateRequest) Weight() float64 {
+	var w float64
+	for _, it := range r.Items {
+		w += it.Weight * float64(it.Quantity)
+	}
+	return w
+}
+
+// Rate is the price of a shipping method for a request
+type Rate struct {
+	Method    string  `json:"method"`
+	Name      string  `json:"name"`
+	Price     float64 `json:"price"`      // total to charge
+	BasePrice float64 `json:"base_price"` // before free shipping and surcharges
+	Surcharge float64 `json:"surcharge,omitempty"`
+	Free      bool    `json:"free"`
+	FreeFrom  float64 `json:"free_from,omitempty"`
+	Weight    float64 `json:"weight"`
+}
+
+// RateEngine prices shipping methods from their flat price, weight and
+// country rates and surcharge/exclusion rules.
+//
+// The rate used is the one for the destination country, falling back to
+// rates without a country; among them the narrowest weight tier wins. A
+// method that has rates but none for the destination and weight cannot
+// ship the parcel. Free shipping waives the rate, not the surcharges.
+type RateEngine struct {
+	methods []models.ShippingMethod
+	rates   map[string][]models.ShippingRate
+	rules   map[string][]models.ShippingRule
+}
+
+// NewRateEngine builds an engine over active methods and their rates and rules
+func NewRateEngine(methods []models.ShippingMethod, rates []models.ShippingRate, rules []models.ShippingRule) *RateEngine {
+	e := &RateEngine{
+		rates: make(map[string][]models.ShippingRate),
+		rules: make(map[string][]models.ShippingRule),
+	}
+	for _, m := range methods {
+		if m.IsActive {
+			e.methods = append(e.methods, m)
+		}
+	}
+	sort.SliceStable(e.methods, func(i, j int) bool { return e.methods[i].Price < e.methods[j].Price })
+	for _, r := range rates {
+		e.rates[r.MethodCode] = append(e.rates[r.MethodCode], r)
+	}
+	for _, r := range rules {
+		if r.IsActive {
+			e.rules[r.MethodCode] = append(e.rules[r.MethodCode], r)
+		}
+	}
+	return e
+}
+
+// Methods returns the active shipping methods, cheapest first
+func (e *RateEngine) Methods() []models.ShippingMethod {
+	return e.methods
+}
+
+// Rate prices one method. Returns ErrUnknownMethod or ErrNotDeliverable
+// when the method cannot be used.
+func (e *RateEngine) Rate(code string, req RateRequest) (*Rate, error) {
+	for _, m := range e.methods {
+		if m.Code == code {
+			return e.rate(m, req)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, code)
+}
+
+// Rates prices all methods that can ship the request, cheapest first
+func (e *RateEngine) Rates(req RateRequest) []Rate {
+	var rates []Rate
+	for _, m := range e.methods {
+		if r, err := e.rate(m, req); err == nil {
+			rates = append(rates, *r)
+		}
+	}
+	sort.SliceStable(rates, func(i, j int) bool { return rates[i].Price < rates[j].Price })
+	return rates
+}
+
+func (e *RateEngine) rate(m models.ShippingMethod, req RateRequest) (*Rate, error) {
+	country := strings.ToUpper(strings.TrimSpace(req.Country))
+	if country == "" {
+		country = DefaultCountry
+	}
+	weight := req.Weight()
+
+	price, freeFrom := m.Price, m.FreeFrom
+	if rates := e.rates[m.Code]; len(rates) > 0 {
+		r := matchRate(rates, country, weight)
+		if r == nil {
+			return nil, fmt.Errorf("%w: %s does not ship %.2f kg to %s", ErrNotDeliverable, m.Name, weight, country)
+		}
+		price = r.Price
+		if r.FreeFrom != nil {
+			freeFrom = *r.FreeFrom
+		}
+	}
+
+	rate := &Rate{Method: m.Code, Name: m.Name, Price: price, BasePrice: price, FreeFrom: freeFrom, Weight: weight}
+	if freeFrom > 0 && req.Subtotal >= freeFrom {
+		rate.Price = 0
+		rate.Free = true
+	}
+
+	for _, rule := range e.rules[m.Code] {
+		if rule.Country != "" && !strings.EqualFold(rule.Country, country) {
+			continue
+		}
+		if !ruleMatches(rule, req, country, weight) {
+			continue
+		}
+		switch rule.Action {
+		case models.ShippingRuleExclude:
+			reason := rule.Note
+			if reason == "" {
+				reason = rule.Condition
+			}
+			return nil, fmt.Errorf("%w: %s (%s)", ErrNotDeliverable, m.Name, reason)
+		case models.ShippingRuleSurcharge:
+			rate.Surcharge += rule.Amount
+		}
+	}
+	rate.Price = roundCents(rate.Price + rate.Surcharge)
+	return rate, nil
+}
+
+// matchRate picks the country's rate over a rate for any country, then the
+// narrowest weight tier
+func matchRate(rates []models.ShippingRate, country string, weight float64) *models.ShippingRate {
+	var best *models.ShippingRate
+	for i := range rates {
+		r := &rates[i]
+		if r.Country != "" && !strings.EqualFold(r.Country, country) {
+			continue
+		}
+		if weight < r.WeightFrom || (r.WeightTo != nil && weight > *r.WeightTo) {
+			continue
+		}
+		if best == nil || rateMoreSpecific(r, best) {
+			best = r
+		}
+	}
+	return best
+}
+
+func rateMoreSpecific(a, b *models.ShippingRate) bool {
+	if (a.Country != "") != (b.Country != "") {
+		return a.Country != ""
+	}
+	switch {
+	case a.WeightTo == nil:
+		return false
+	case b.WeightTo == nil:
+		return true
+	default:
+		return *a.WeightTo-a.WeightFrom < *b.WeightTo-b.WeightFrom
+	}
+}
+
+func ruleMatches(rule models.ShippingRule, req RateRequest, country string, weight float64) bool {
+	switch rule.Condition {
+	case models.ShippingCondLarge:
+		return anyItem(req.Items, func(it RateItem) bool { return it.IsLarge })
+	case models.ShippingCondSmallPallet:
+		return anyItem(req.Items, func(it RateItem) bool { return it.SmallPallet })
+	case models.ShippingCondCountry:
+		return strings.EqualFold(rule.Value, country)
+	case models.ShippingCondCategory:
+		return anyItem(req.Items, func(it RateItem) bool {
+			return it.CategoryID != nil && it.CategoryID.String() == rule.Value
+		})
+	case models.ShippingCondProduct:
+		return anyItem(req.Items, func(it RateItem) bool { return it.ProductID.String() == rule.Value })
+	case models.ShippingCondWeightOver:
+		limit, err := strconv.ParseFloat(rule.Value, 64)
+		return err == nil && weight > limit
+	}
+	return false
+}
+
+func anyItem(items []RateItem, match func(RateItem) bool) bool {
+	for _, it := range items {
+		if match(it) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package stock
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"megashop/internal/database"
+	"megashop/internal/email"
+	"megashop/internal/models"
+)
+
+// expiryBatch is the number of orders expired per round
+const expiryBatch = 100
+
+// ExpiryWorker cancels unpaid orders whose stock reservation ran out, which
+// returns their goods to stock
+type ExpiryWorker struct {
+	db       *database.Postgres
+	emailSvc *email.Service
+	interval time.Duration
+}
+
+// NewExpiryWorker creates a worker checking for expired reservations every interval
+func NewExpiryWorker(db *database.Postgres, emailSvc *email.Service, interval time.Duration) *ExpiryWorker {
+	return &ExpiryWorker{db: db, emailSvc: emailSvc, interval: interval}
+}
+
+// Run expires reservations right away and then every interval until ctx is cancelled
+func (w *ExpiryWorker) Run(ctx context.Context) {
+	log.Printf("[STOCK] Reservation expiry started (every %v)", w.interval)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := w.ExpireAll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[STOCK] Reservation expiry failed: %v", err)
+		} else if expired > 0 {
+			log.Printf("[STOCK] Cancelled %d unpaid orders, stock released", expired)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireAll cancels the orders past their reservation. Returns the number cancelled.
+func (w *ExpiryWorker) ExpireAll(ctx context.Context) (int, error) {
+	ids, err := w.db.ListExpiredReservations(ctx, expiryBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return expired, ctx.Err()
+		}
+		ok, err := w.db.ExpireReservation(ctx, id, "Nezaplatená objednávka zrušená, rezervácia tovaru vypršala")
+		if err != nil {
+			log.Printf("[STOCK] Failed to expire order %s: %v", id, err)
+			continue
+		}
+		if !ok {
+			// Paid or handled by staff in the meantime
+			continue
+		}
+		expired++
+
+		order, err := w.db.GetOrder(ctx, id)
+		if err != nil || order == nil {
+			log.Printf("[STOCK] Expired order %s not loaded for email: %v", id, err)
+			continue
+		}
+		log.Printf("[STOCK] #%s: reservation expired, order cancelled", order.OrderNumber)
+		if email.NotifiesStatus(models.OrderStatusCancelled) {
+			if err := w.emailSvc.SendOrderStatusEmail(order, ""); err != nil {
+				log.Printf("[STOCK] Failed to queue cancellation email for #%s: %v", order.OrderNumber, err)
+			}
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,223 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"megashop/internal/config"
+	"megashop/internal/database"
+	"megashop/internal/email"
+	"megashop/internal/models"
+	"megashop/internal/shipping"
+)
+
+const (
+	// recheckAfter is how long a parcel rests between two carrier requests
+	recheckAfter = 2 * time.Hour
+	// maxAge stops polling parcels that never reached a final state
+	maxAge = 60 * 24 * time.Hour
+	// batchSize is the number of parcels polled per round
+	batchSize = 200
+)
+
+// Syncer polls the carriers for shipped orders, stores the scans and moves
+// the orders to delivered or returned
+type Syncer struct {
+	db       *database.Postgres
+	cfg      *config.Config
+	emailSvc *email.Service
+}
+
+// NewSyncer creates a tracking syncer
+func NewSyncer(db *database.Postgres, cfg *config.Config, emailSvc *email.Service) *Syncer {
+	return &Syncer{db: db, cfg: cfg, emailSvc: emailSvc}
+}
+
+// Result is the outcome of syncing one parcel
+type Result struct {
+	OrderNumber string `json:"order_number"`
+	NewEvents   int    `json:"new_events"`
+	Status      string `json:"status,omitempty"`       // latest tracking status
+	OrderStatus string `json:"order_status,omitempty"` // set when the order moved
+	Error       string `json:"error,omitempty"`
+}
+
+// SyncAll polls all parcels due for a check. Returns the number of parcels
+// checked and of orders moved to a final status.
+func (s *Syncer) SyncAll(ctx context.Context) (checked, moved int, err error) {
+	parcels, err := s.db.ListTrackedParcels(ctx, recheckAfter, maxAge, batchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type loaded struct {
+		carrier shipping.Carrier
+		err     error
+	}
+	carriers := make(map[string]loaded)
+	for _, parcel := range parcels {
+		if ctx.Err() != nil {
+			return checked, moved, ctx.Err()
+		}
+		c, ok := carriers[parcel.Carrier]
+		if !ok {
+			c.carrier, c.err = s.carrier(ctx, parcel.Carrier)
+			if c.err != nil && !errors.Is(c.err, shipping.ErrNoCarrier) {
+				log.Printf("[TRACKING] Carrier %s unavailable: %v", parcel.Carrier, c.err)
+			}
+			carriers[parcel.Carrier] = c
+		}
+
+		r := s.syncParcel(ctx, c.carrier, c.err, parcel)
+		checked++
+		if r.OrderStatus != "" {
+			moved++
+		}
+	}
+	return checked, moved, nil
+}
+
+// SyncOrder polls the order's parcel right away
+func (s *Syncer) SyncOrder(ctx context.Context, parcel models.TrackedParcel) (*Result, error) {
+	carrier, err := s.carrier(ctx, parcel.Carrier)
+	if err != nil {
+		return nil, err
+	}
+	return s.syncParcel(ctx, carrier, nil, parcel), nil
+}
+
+func (s *Syncer) carrier(ctx context.Context, code string) (shipping.Carrier, error) {
+	method, err := s.db.GetShippingMethod(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if method == nil {
+		return nil, fmt.Errorf("%w: %s", shipping.ErrNoCarrier, code)
+	}
+	return shipping.NewCarrier(*method, s.cfg)
+}
+
+// syncParcel stores the parcel's scans and applies a final state to the
+// order. carrierErr is why there is no carrier for the parcel.
+func (s *Syncer) syncParcel(ctx context.Context, carrier shipping.Carrier, carrierErr error, parcel models.TrackedParcel) *Result {
+	r := &Result{OrderNumber: parcel.OrderNumber}
+
+	var events []models.TrackingEvent
+	var trackErr string
+	if carrierErr != nil {
+		// Remember the check anyway so the parcel does not hold a place
+		// in every batch
+		trackErr = carrierErr.Error()
+	} else if evs, err := carrier.Track(ctx, parcel.ParcelID, parcel.TrackingNumber); err != nil {
+		trackErr = err.Error()
+		log.Printf("[TRACKING] %s parcel %s of #%s: %v", parcel.Carrier, parcel.TrackingNumber, parcel.OrderNumber, err)
+	} else {
+		events = evs
+	}
+	r.Error = trackErr
+
+	added, err := s.db.SaveTrackingEvents(ctx, parcel, events, trackErr)
+	if err != nil {
+		log.Printf("[TRACKING] Failed to store events of #%s: %v", parcel.OrderNumber, err)
+		r.Error = err.Error()
+		return r
+	}
+	r.NewEvents = added
+
+	latest := latestEvent(events)
+	if latest == nil {
+		return r
+	}
+	r.Status = latest.Status
+
+	var target, note string
+	switch latest.Status {
+	case models.TrackingDelivered:
+		target = models.OrderStatusDelivered
+		note = fmt.Sprintf("Doručené podľa sledovania zásielky %s (%s)", parcel.TrackingNumber, parcel.Carrier)
+	case models.TrackingReturned:
+		target = models.OrderStatusReturned
+		note = fmt.Sprintf("Zásielka %s vrátená odosielateľovi (%s)", parcel.TrackingNumber, parcel.Carrier)
+	default:
+		return r
+	}
+
+	from, err := s.db.ChangeOrderStatus(ctx, parcel.OrderID, database.StatusUpdate{
+		Status:    target,
+		ActorType: models.OrderActorSystem,
+		Note:      note,
+	})
+	if errors.Is(err, database.ErrInvalidStatusTransition) {
+		// Already moved on by staff
+		return r
+	}
+	if err != nil {
+		log.Printf("[TRACKING] Failed to move #%s to %s: %v", parcel.OrderNumber, target, err)
+		r.Error = err.Error()
+		return r
+	}
+	r.OrderStatus = target
+	log.Printf("[TRACKING] #%s: %s -> %s", parcel.OrderNumber, from, target)
+
+	if email.NotifiesStatus(target) {
+		order, err := s.db.GetOrder(ctx, parcel.OrderID)
+		if err == nil && order != nil {
+			err = s.emailSvc.SendOrderStatusEmail(order, "")
+		}
+		if err != nil {
+			log.Printf("[TRACKING] Failed to queue %s email for #%s: %v", target, parcel.OrderNumber, err)
+		}
+	}
+	return r
+}
+
+// latestEvent returns the newest scan; carriers report them oldest first
+// but not all guarantee it
+func latestEvent(events []models.TrackingEvent) *models.TrackingEvent {
+	var latest *models.TrackingEvent
+	for i := range events {
+		if latest == nil || !events[i].Time.Before(latest.Time) {
+			latest = &events[i]
+		}
+	}
+	return latest
+}
+
+// ==================== PERIODIC SYNC ====================
+
+// Worker runs the tracking sync periodically
+type Worker struct {
+	syncer   *Syncer
+	interval time.Duration
+}
+
+// NewWorker creates a worker syncing every interval
+func NewWorker(syncer *Syncer, interval time.Duration) *Worker {
+	return &Worker{syncer: syncer, interval: interval}
+}
+
+// Run syncs right away and then every interval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	log.Printf("[TRACKING] Tracking sync started (every %v)", w.interval)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		checked, moved, err := w.syncer.SyncAll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[TRACKING] Tracking sync failed: %v", err)
+		} else if checked > 0 {
+			log.Printf("[TRACKING] Checked %d parcels, %d orders delivered or returned in %v",
+				checked, moved, time.Since(start).Round(time.Millisecond))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
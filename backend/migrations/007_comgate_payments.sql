@@ -0,0 +1,9 @@
+-- Migration 007: Comgate card payments
+-- Stores the gateway transaction ID on the order and allows cancelled payments
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_transaction_id VARCHAR(100);
+CREATE INDEX IF NOT EXISTS idx_orders_payment_transaction ON orders(payment_transaction_id);
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_payment_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_payment_status_check
+    CHECK (payment_status IN ('pending', 'paid', 'failed', 'cancelled', 'refunded'));
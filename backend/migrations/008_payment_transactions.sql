@@ -0,0 +1,45 @@
+-- Migration 008: Payment transactions ledger
+-- Every payment attempt and refund is recorded, orders.payment_status is derived from it
+
+CREATE TABLE IF NOT EXISTS payment_transactions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES payment_transactions(id) ON DELETE SET NULL,  -- refund -> original payment
+
+    gateway VARCHAR(20) NOT NULL,  -- 'comgate', 'gopay', 'transfer', 'cod'
+    type VARCHAR(20) NOT NULL CHECK (type IN ('payment', 'refund')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed', 'cancelled')),
+
+    amount DECIMAL(12, 2) NOT NULL,
+    currency VARCHAR(3) DEFAULT 'EUR',
+    external_id VARCHAR(100),  -- gateway transaction / refund ID
+    note TEXT,
+    error_message TEXT,
+
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_payment_transactions_order ON payment_transactions(order_id);
+CREATE INDEX idx_payment_transactions_parent ON payment_transactions(parent_id);
+CREATE UNIQUE INDEX idx_payment_transactions_external ON payment_transactions(gateway, external_id)
+    WHERE type = 'payment' AND external_id IS NOT NULL;
+
+-- Backfill the ledger from orders paid before it existed
+INSERT INTO payment_transactions (order_id, gateway, type, status, amount, currency, external_id, created_at, updated_at)
+SELECT o.id, COALESCE(NULLIF(o.payment_method, ''), 'unknown'), 'payment', 'succeeded', o.total, o.currency,
+       o.payment_transaction_id, COALESCE(o.paid_at, o.created_at), COALESCE(o.paid_at, o.created_at)
+FROM orders o
+WHERE o.payment_status IN ('paid', 'refunded')
+  AND NOT EXISTS (SELECT 1 FROM payment_transactions pt WHERE pt.order_id = o.id);
+
+INSERT INTO payment_transactions (order_id, parent_id, gateway, type, status, amount, currency, note)
+SELECT pt.order_id, pt.id, pt.gateway, 'refund', 'succeeded', pt.amount, pt.currency, 'Backfilled by migration 008'
+FROM payment_transactions pt
+JOIN orders o ON o.id = pt.order_id
+WHERE o.payment_status = 'refunded' AND pt.type = 'payment';
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_payment_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_payment_status_check
+    CHECK (payment_status IN ('pending', 'paid', 'failed', 'cancelled', 'partially_refunded', 'refunded'));
@@ -0,0 +1,7 @@
+-- Migration 009: Bank transfer payments
+-- Orders paid by transfer get a numeric variable symbol for matching bank statements
+
+CREATE SEQUENCE IF NOT EXISTS order_variable_symbol_seq START WITH 1000001;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS variable_symbol VARCHAR(10);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_variable_symbol ON orders(variable_symbol) WHERE variable_symbol IS NOT NULL;
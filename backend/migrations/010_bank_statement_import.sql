@@ -0,0 +1,6 @@
+-- Migration 010: Bank statement import
+-- Transfers are matched from bank statements, an underpaid order stays partially paid
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_payment_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_payment_status_check
+    CHECK (payment_status IN ('pending', 'partially_paid', 'paid', 'failed', 'cancelled', 'partially_refunded', 'refunded'));
@@ -0,0 +1,42 @@
+-- Migration 011: Invoices
+-- Issued invoices with a per-year gapless number series and the stored PDF
+
+CREATE TABLE IF NOT EXISTS document_sequences (
+    series VARCHAR(20) NOT NULL,  -- 'invoice', later other document types
+    year INTEGER NOT NULL,
+    last_number INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (series, year)
+);
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL UNIQUE REFERENCES orders(id) ON DELETE RESTRICT,
+    number VARCHAR(50) UNIQUE NOT NULL,
+    year INTEGER NOT NULL,
+    sequence INTEGER NOT NULL,
+
+    issue_date DATE NOT NULL,
+    supply_date DATE NOT NULL,
+    due_date DATE NOT NULL,
+
+    supplier JSONB NOT NULL,
+    customer JSONB NOT NULL,
+    lines JSONB NOT NULL,
+    vat_summary JSONB NOT NULL,
+
+    subtotal DECIMAL(12, 2) NOT NULL,
+    vat_total DECIMAL(12, 2) NOT NULL,
+    total DECIMAL(12, 2) NOT NULL,
+    currency VARCHAR(3) DEFAULT 'EUR',
+
+    payment_method VARCHAR(50),
+    variable_symbol VARCHAR(10),
+    iban VARCHAR(34),
+    paid BOOLEAN DEFAULT false,
+
+    pdf_path TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (year, sequence)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_issue_date ON invoices(issue_date);
@@ -0,0 +1,34 @@
+-- Migration 012: Credit notes
+-- Corrective documents (dobropis) to issued invoices with their own number series
+
+CREATE TABLE IF NOT EXISTS credit_notes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE RESTRICT,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    number VARCHAR(50) UNIQUE NOT NULL,
+    year INTEGER NOT NULL,
+    sequence INTEGER NOT NULL,
+
+    issue_date DATE NOT NULL,
+    supply_date DATE NOT NULL,
+    reason TEXT NOT NULL,
+
+    supplier JSONB NOT NULL,
+    customer JSONB NOT NULL,
+    lines JSONB NOT NULL,
+    vat_summary JSONB NOT NULL,
+
+    subtotal DECIMAL(12, 2) NOT NULL,  -- negative
+    vat_total DECIMAL(12, 2) NOT NULL,
+    total DECIMAL(12, 2) NOT NULL,
+    currency VARCHAR(3) DEFAULT 'EUR',
+    payment_method VARCHAR(50),
+
+    pdf_path TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (year, sequence)
+);
+
+CREATE INDEX IF NOT EXISTS idx_credit_notes_invoice ON credit_notes(invoice_id);
+CREATE INDEX IF NOT EXISTS idx_credit_notes_issue_date ON credit_notes(issue_date);
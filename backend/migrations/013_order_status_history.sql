@@ -0,0 +1,25 @@
+-- Migration 013: Order status history
+-- Validated status transitions are recorded with the actor and an optional note
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'paid', 'processing', 'shipped', 'delivered', 'cancelled', 'returned', 'refunded'));
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(30),  -- NULL for the order creation
+    to_status VARCHAR(30) NOT NULL,
+    actor_type VARCHAR(20) NOT NULL CHECK (actor_type IN ('admin', 'customer', 'system')),
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order ON order_status_history(order_id, created_at);
+
+-- Existing orders start their timeline with the current status
+INSERT INTO order_status_history (order_id, from_status, to_status, actor_type, note, created_at)
+SELECT id, NULL, status, 'system', 'Stav pred zavedením histórie', updated_at
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM order_status_history h WHERE h.order_id = o.id);
@@ -0,0 +1,10 @@
+-- Migration 014: Email templates
+-- Customer emails customized in admin; keys without a row use the built-in default
+
+CREATE TABLE IF NOT EXISTS email_templates (
+    key VARCHAR(50) PRIMARY KEY,
+    subject TEXT NOT NULL,
+    body_html TEXT NOT NULL,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,28 @@
+-- Migration 016: Packeta pickup points
+-- Local copy of the Packeta branch feed, refreshed by the branch sync
+
+CREATE TABLE IF NOT EXISTS packeta_points (
+    id VARCHAR(20) PRIMARY KEY,  -- Packeta branch ID
+    name VARCHAR(255) NOT NULL,
+    place VARCHAR(255),
+    street VARCHAR(255),
+    city VARCHAR(100),
+    zip VARCHAR(10),  -- without spaces
+    country VARCHAR(2) NOT NULL,
+    type VARCHAR(20) NOT NULL DEFAULT 'pickup_point',
+    latitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    longitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    directions TEXT,
+    url VARCHAR(500),
+    photo VARCHAR(500),
+    max_weight DECIMAL(8,2) NOT NULL DEFAULT 0,
+    opening_hours JSONB NOT NULL DEFAULT '{}',
+    search_text TEXT NOT NULL DEFAULT '',  -- lowercase, without diacritics
+    is_active BOOLEAN NOT NULL DEFAULT true,  -- false once the point disappears from the feed
+    synced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_packeta_points_zip ON packeta_points(zip) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_packeta_points_country ON packeta_points(country) WHERE is_active;
+CREATE INDEX IF NOT EXISTS idx_packeta_points_search ON packeta_points USING gin(search_text gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_packeta_points_location ON packeta_points(latitude, longitude) WHERE is_active;
@@ -0,0 +1,27 @@
+-- Migration 017: Shipments
+-- Parcels registered with carriers, and the pickup point chosen at checkout
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS pickup_point_id VARCHAR(20);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS pickup_point_name VARCHAR(500);  -- snapshot shown to staff and customer
+
+CREATE TABLE IF NOT EXISTS shipments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    carrier VARCHAR(20) NOT NULL,
+    packet_id VARCHAR(50) NOT NULL,
+    tracking_number VARCHAR(100) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'created' CHECK (status IN ('created', 'cancelled')),
+    pickup_point_id VARCHAR(20),
+    value DECIMAL(12,2) NOT NULL DEFAULT 0,
+    cod_amount DECIMAL(12,2) NOT NULL DEFAULT 0,
+    weight DECIMAL(8,3) NOT NULL DEFAULT 0,
+    label_path VARCHAR(500),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    cancelled_at TIMESTAMP WITH TIME ZONE
+);
+
+-- At most one live shipment per order
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shipments_order_active ON shipments(order_id) WHERE status = 'created';
+CREATE INDEX IF NOT EXISTS idx_shipments_order ON shipments(order_id);
+CREATE INDEX IF NOT EXISTS idx_shipments_carrier_packet ON shipments(carrier, packet_id);
@@ -0,0 +1,39 @@
+-- Migration 018: Shipping rates
+-- Weight tiers and per-country prices of shipping methods, plus surcharge
+-- and exclusion rules. Methods without rates keep their flat price.
+
+CREATE TABLE IF NOT EXISTS shipping_rates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    method_code VARCHAR(50) NOT NULL REFERENCES shipping_methods(code) ON UPDATE CASCADE ON DELETE CASCADE,
+    country VARCHAR(2),  -- destination ISO code, NULL = any country
+    weight_from DECIMAL(8,3) NOT NULL DEFAULT 0,  -- kg, inclusive
+    weight_to DECIMAL(8,3),  -- kg, inclusive, NULL = no limit
+    price DECIMAL(12,2) NOT NULL,
+    free_from DECIMAL(12,2),  -- overrides the method's free_from, 0 = never free
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK (weight_to IS NULL OR weight_to >= weight_from)
+);
+
+CREATE INDEX IF NOT EXISTS idx_shipping_rates_method ON shipping_rates(method_code);
+
+CREATE TABLE IF NOT EXISTS shipping_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    method_code VARCHAR(50) NOT NULL REFERENCES shipping_methods(code) ON UPDATE CASCADE ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('surcharge', 'exclude')),
+    condition VARCHAR(20) NOT NULL CHECK (condition IN ('large', 'small_pallet', 'country', 'category', 'product', 'weight_over')),
+    value VARCHAR(100) NOT NULL DEFAULT '',  -- country code, category/product ID or kg, by condition
+    country VARCHAR(2),  -- only for this destination, NULL = any
+    amount DECIMAL(12,2) NOT NULL DEFAULT 0,  -- surcharge per parcel
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    note VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_shipping_rules_method ON shipping_rules(method_code);
+
+-- Oversized goods go on a pallet, not in a parcel locker or the post
+INSERT INTO shipping_rules (method_code, action, condition, note)
+SELECT code, 'exclude', c.condition, 'Nadrozmerný tovar'
+FROM shipping_methods, (VALUES ('large'), ('small_pallet')) AS c(condition)
+WHERE code IN ('packeta', 'posta')
+  AND NOT EXISTS (SELECT 1 FROM shipping_rules);
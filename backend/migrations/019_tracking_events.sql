@@ -0,0 +1,26 @@
+-- Migration 019: Tracking events
+-- Carrier scans of shipped parcels, polled by the tracking sync
+
+CREATE TABLE IF NOT EXISTS tracking_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    carrier VARCHAR(20) NOT NULL,
+    tracking_number VARCHAR(100) NOT NULL,
+    event_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL,  -- normalized: in_transit, ready_for_pickup, delivered, returned, cancelled
+    code VARCHAR(50) NOT NULL DEFAULT '',  -- carrier's own status code
+    description TEXT NOT NULL DEFAULT '',
+    location VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Polling returns the whole history every time, store each scan once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tracking_events_unique ON tracking_events(order_id, tracking_number, event_time, code);
+CREATE INDEX IF NOT EXISTS idx_tracking_events_order ON tracking_events(order_id, event_time);
+
+-- Latest state of the parcel, and when the sync last asked the carrier
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_status VARCHAR(20);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_checked_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_error TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_orders_tracking ON orders(tracking_checked_at NULLS FIRST) WHERE status = 'shipped';
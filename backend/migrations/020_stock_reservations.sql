@@ -0,0 +1,14 @@
+-- Migration 020: Stock reservations
+-- Checkout reserves stock atomically, unpaid orders release it when they expire
+
+-- Backorders: per product, NULL follows the product's suppliers
+ALTER TABLE products ADD COLUMN IF NOT EXISTS allow_backorder BOOLEAN;
+ALTER TABLE suppliers ADD COLUMN IF NOT EXISTS allow_backorder BOOLEAN NOT NULL DEFAULT false;
+
+-- Pieces ordered over the stock of a backorder product
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS backordered INTEGER NOT NULL DEFAULT 0;
+
+-- Unpaid orders are cancelled after this, returning their goods to stock
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS reserved_until TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_orders_reserved_until ON orders(reserved_until) WHERE status = 'pending';
@@ -0,0 +1,52 @@
+-- Migration 021: Stock movements
+-- Ledger of every change of products.stock, written by a trigger so that no
+-- path (orders, supplier linking, admin edits, bulk imports) can skip it.
+-- The writer tags its transaction with set_config('megashop.stock_source', ...)
+-- and optionally megashop.stock_reference / megashop.stock_note; untagged
+-- changes count as manual.
+
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    source VARCHAR(20) NOT NULL CHECK (source IN ('order', 'cancel', 'supplier_import', 'manual')),
+    delta INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,  -- stock after the movement
+    reference_id UUID,  -- order for order/cancel, supplier for supplier_import, admin for manual
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_product ON stock_movements(product_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_reference ON stock_movements(reference_id) WHERE reference_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION record_stock_movement()
+RETURNS TRIGGER AS $$
+DECLARE
+    old_stock INTEGER := 0;
+    new_stock INTEGER := COALESCE(NEW.stock, 0);
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        old_stock := COALESCE(OLD.stock, 0);
+    END IF;
+    IF new_stock = old_stock THEN
+        RETURN NEW;
+    END IF;
+
+    INSERT INTO stock_movements (product_id, source, delta, quantity, reference_id, note)
+    VALUES (
+        NEW.id,
+        COALESCE(NULLIF(current_setting('megashop.stock_source', true), ''), 'manual'),
+        new_stock - old_stock,
+        new_stock,
+        NULLIF(current_setting('megashop.stock_reference', true), '')::uuid,
+        NULLIF(current_setting('megashop.stock_note', true), '')
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_products_stock_movement ON products;
+CREATE TRIGGER trg_products_stock_movement
+    AFTER INSERT OR UPDATE OF stock ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION record_stock_movement();
@@ -0,0 +1,15 @@
+-- Migration 022: Supplier offers
+-- Supplier products with the same EAN (or manufacturer part number and
+-- brand) are linked to one main product; the offer selection rules pick the
+-- offer that sets its price, stock and delivery days.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS active_offer_id UUID REFERENCES supplier_products(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_supplier_products_mpn_producer ON supplier_products(manufacturer_part_number, lower(producer_name))
+    WHERE manufacturer_part_number IS NOT NULL AND manufacturer_part_number <> '';
+
+-- Criteria applied in order until one offer wins:
+-- in_stock, cheapest, priority (supplier priority), fastest (shipping time)
+INSERT INTO settings (id, key, value, "group") VALUES
+    (uuid_generate_v4(), 'offer_selection', '{"rules": ["in_stock", "cheapest", "priority", "fastest"]}', 'suppliers')
+ON CONFLICT (key) DO NOTHING;
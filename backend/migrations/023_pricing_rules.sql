@@ -0,0 +1,31 @@
+-- Migration 023: Pricing rules
+-- Retail prices of supplier products computed from the purchase price.
+-- Every condition left NULL matches anything; among the matching rules the
+-- highest priority wins, then the most specific one.
+
+CREATE TABLE IF NOT EXISTS pricing_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+
+    -- Conditions
+    supplier_id UUID REFERENCES suppliers(id) ON DELETE CASCADE,
+    category_id UUID REFERENCES categories(id) ON DELETE CASCADE,  -- includes subcategories
+    brand_id UUID REFERENCES brands(id) ON DELETE CASCADE,
+    price_from DECIMAL(12, 2) NOT NULL DEFAULT 0,  -- purchase price without VAT
+    price_to DECIMAL(12, 2),  -- exclusive, NULL = no upper limit
+
+    -- Computation, on prices without VAT
+    markup_percent DECIMAL(6, 2) NOT NULL DEFAULT 0,
+    min_margin DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    fixed_surcharge DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    cap_at_srp BOOLEAN NOT NULL DEFAULT false,  -- never above the supplier's SRP
+    rounding VARCHAR(10) NOT NULL DEFAULT 'none' CHECK (rounding IN ('none', 'whole', 'x.90', 'x.99')),
+
+    priority INTEGER NOT NULL DEFAULT 0,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pricing_rules_active ON pricing_rules(is_active);
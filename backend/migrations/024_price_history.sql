@@ -0,0 +1,70 @@
+-- Migration 024: Price history
+-- Every change of products.price / sale_price, written by a trigger like the
+-- stock ledger. For the EU Omnibus directive a discount must be shown against
+-- the lowest price of the 30 days before it; that price is kept on the
+-- product in lowest_price_30d, fixed when the price changes. NULL until the
+-- first recorded change.
+
+CREATE TABLE IF NOT EXISTS price_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    price DECIMAL(12, 2) NOT NULL,
+    sale_price DECIMAL(12, 2),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_history_product ON price_history(product_id, created_at DESC);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS lowest_price_30d DECIMAL(12, 2);
+
+-- Prices known when history starts
+INSERT INTO price_history (product_id, price, sale_price)
+SELECT p.id, p.price, p.sale_price FROM products p
+WHERE NOT EXISTS (SELECT 1 FROM price_history h WHERE h.product_id = p.id);
+
+-- Lowest price paid in the 30 days before the change: the old price, every
+-- price set within the window and the one in effect when the window opened
+CREATE OR REPLACE FUNCTION set_lowest_price_30d()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.price IS NOT DISTINCT FROM OLD.price AND NEW.sale_price IS NOT DISTINCT FROM OLD.sale_price THEN
+        RETURN NEW;
+    END IF;
+
+    NEW.lowest_price_30d := LEAST(
+        COALESCE(OLD.sale_price, OLD.price),
+        (SELECT MIN(COALESCE(h.sale_price, h.price)) FROM price_history h
+         WHERE h.product_id = OLD.id AND h.created_at >= NOW() - INTERVAL '30 days'),
+        (SELECT COALESCE(h.sale_price, h.price) FROM price_history h
+         WHERE h.product_id = OLD.id AND h.created_at < NOW() - INTERVAL '30 days'
+         ORDER BY h.created_at DESC LIMIT 1)
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_products_lowest_price ON products;
+CREATE TRIGGER trg_products_lowest_price
+    BEFORE UPDATE OF price, sale_price ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION set_lowest_price_30d();
+
+CREATE OR REPLACE FUNCTION record_price_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.price IS NOT DISTINCT FROM OLD.price
+       AND NEW.sale_price IS NOT DISTINCT FROM OLD.sale_price THEN
+        RETURN NEW;
+    END IF;
+
+    INSERT INTO price_history (product_id, price, sale_price)
+    VALUES (NEW.id, NEW.price, NEW.sale_price);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_products_price_history ON products;
+CREATE TRIGGER trg_products_price_history
+    AFTER INSERT OR UPDATE OF price, sale_price ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION record_price_change();
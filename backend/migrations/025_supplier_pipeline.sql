@@ -0,0 +1,20 @@
+-- Migration 025: Scheduled supplier pipeline
+-- Suppliers with a cron schedule get their feed downloaded, imported, linked
+-- and the Heureka feed regenerated on that schedule. Every run is recorded
+-- with the outcome of each step; at most one run per supplier is running.
+
+ALTER TABLE suppliers ADD COLUMN IF NOT EXISTS schedule VARCHAR(100);  -- cron expression, NULL = manual only
+
+CREATE TABLE IF NOT EXISTS supplier_pipeline_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    supplier_id UUID NOT NULL REFERENCES suppliers(id) ON DELETE CASCADE,
+    triggered_by VARCHAR(20) NOT NULL DEFAULT 'scheduled' CHECK (triggered_by IN ('manual', 'scheduled', 'api')),
+    status VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'completed', 'failed', 'skipped')),
+    steps JSONB NOT NULL DEFAULT '[]',  -- [{"name": "download", "status": "completed", "message": ...}, ...]
+    error_message TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_supplier_pipeline_runs_supplier ON supplier_pipeline_runs(supplier_id, started_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_supplier_pipeline_runs_running ON supplier_pipeline_runs(supplier_id) WHERE status = 'running';
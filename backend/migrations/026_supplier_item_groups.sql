@@ -0,0 +1,7 @@
+-- Migration 026: Variant groups of supplier products
+-- Heureka (ITEMGROUP_ID) and Google (item_group_id) feeds group the variants
+-- of a product; the group is carried over to products.itemgroup_id on linking.
+
+ALTER TABLE supplier_products ADD COLUMN IF NOT EXISTS item_group_id VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_supplier_products_item_group ON supplier_products(supplier_id, item_group_id) WHERE item_group_id IS NOT NULL;